@@ -0,0 +1,40 @@
+package loggregator
+
+import (
+	"bytes"
+	"regexp"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// ansiEscape matches ANSI CSI sequences (e.g. colors and cursor movement),
+// OSC sequences (e.g. window titles and hyperlinks) and other escapes such
+// as character set selection.
+var ansiEscape = regexp.MustCompile(
+	"\x1b\\[[0-?]*[ -/]*[@-~]" +
+		"|\x1b\\][^\x07\x1b]*(?:\x07|\x1b\\\\)" +
+		"|\x1b[ -/]*[0-~]",
+)
+
+// WithANSIStripping removes ANSI escape sequences, e.g. colors, from log
+// payloads before they are emitted. Syslog drains and most UIs render these
+// sequences as garbage.
+func WithANSIStripping() IngressOption {
+	return func(c *IngressClient) {
+		c.stripANSI = true
+	}
+}
+
+// stripANSIEscapes removes ANSI escape sequences from the payload of e if it
+// is a log.
+func (c *IngressClient) stripANSIEscapes(e *loggregator_v2.Envelope) {
+	if !c.stripANSI {
+		return
+	}
+
+	l := e.GetLog()
+	if l == nil || bytes.IndexByte(l.Payload, 0x1b) < 0 {
+		return
+	}
+	l.Payload = ansiEscape.ReplaceAll(l.Payload, nil)
+}
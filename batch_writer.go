@@ -0,0 +1,57 @@
+package loggregator
+
+import (
+	"io"
+
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// BatchWriter writes batches of envelopes to a backend, see
+// WithBatchWriter. Write is only called by one goroutine at a time unless
+// the client sends on several streams (see WithSenderConcurrency). A batch
+// for which Write returns an error is handled like a failed send to
+// loggregator.
+type BatchWriter interface {
+	Write(ctx context.Context, batch []*loggregator_v2.Envelope) error
+}
+
+// WithBatchWriter makes the client hand its batches to w instead of
+// sending them to loggregator over gRPC, e.g. to route envelopes to another
+// system or to a test double. Buffering, batching, tags and the other emit
+// options apply as usual, as do retries (see WithMaxRetries), which wait
+// with the retry backoff between attempts, and the disk buffer. Options
+// that only concern the gRPC connection, such as the address, dial options
+// and compression, are ignored. If w implements io.Closer, it is closed
+// after the last batch has been written when the client is closed.
+func WithBatchWriter(w BatchWriter) IngressOption {
+	return func(c *IngressClient) {
+		c.batchWriter = w
+	}
+}
+
+// sendUnary sends the batch in a single call, either with the Send RPC or
+// to the batch writer, within the send deadline if there is one.
+func (c *IngressClient) sendUnary(ctx context.Context, batch []*loggregator_v2.Envelope) error {
+	if c.sendDeadline > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, c.sendDeadline)
+		defer cancel()
+	}
+
+	if c.batchWriter != nil {
+		return c.batchWriter.Write(ctx, batch)
+	}
+
+	_, err := c.client.Send(ctx, &loggregator_v2.EnvelopeBatch{Batch: batch})
+	return err
+}
+
+// closeBatchWriter closes the batch writer if it is an io.Closer.
+func (c *IngressClient) closeBatchWriter() error {
+	if cl, ok := c.batchWriter.(io.Closer); ok {
+		return cl.Close()
+	}
+	return nil
+}
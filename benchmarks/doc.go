@@ -0,0 +1,11 @@
+// Package benchmarks contains benchmarks of the go-loggregator clients:
+// emit throughput, the latency of flushing a batch, allocations per
+// envelope and envelope marshaling. It has no code of its own. Run the
+// benchmarks with scripts/benchmark, which writes results that can be
+// compared between revisions with benchstat:
+//
+//	scripts/benchmark > old.txt
+//	git checkout my-branch
+//	scripts/benchmark > new.txt
+//	benchstat old.txt new.txt
+package benchmarks
@@ -0,0 +1,175 @@
+package benchmarks_test
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/go-loggregator/testhelpers"
+)
+
+func BenchmarkEmitLog(b *testing.B) {
+	client, stop := newDiscardClient(b)
+	defer stop()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client.EmitLog("some log message", loggregator.WithStdout())
+	}
+}
+
+func BenchmarkEmitLogParallel(b *testing.B) {
+	client, stop := newDiscardClient(b)
+	defer stop()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			client.EmitLog("some log message", loggregator.WithStdout())
+		}
+	})
+}
+
+func BenchmarkEmitCounter(b *testing.B) {
+	client, stop := newDiscardClient(b)
+	defer stop()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client.EmitCounter("some-counter", loggregator.WithDelta(5))
+	}
+}
+
+func BenchmarkEmitGauge(b *testing.B) {
+	client, stop := newDiscardClient(b)
+	defer stop()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client.EmitGauge(
+			loggregator.WithGaugeValue("cpu", 0.5, "percentage"),
+			loggregator.WithGaugeValue("memory", 1024, "bytes"),
+		)
+	}
+}
+
+func BenchmarkEmitTimer(b *testing.B) {
+	client, stop := newDiscardClient(b)
+	defer stop()
+
+	start := time.Now()
+	end := start.Add(time.Second)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client.EmitTimer("some-timer", start, end)
+	}
+}
+
+func BenchmarkEmitLogWithTags(b *testing.B) {
+	client, stop := newDiscardClient(b,
+		loggregator.WithTag("deployment", "cf"),
+		loggregator.WithTag("job", "router"),
+		loggregator.WithTag("index", "0"),
+		loggregator.WithTag("ip", "10.0.0.1"),
+	)
+	defer stop()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client.EmitLog("some log message", loggregator.WithEnvelopeTag("request_id", "abc"))
+	}
+}
+
+func BenchmarkEmitLogWithSendTimeTags(b *testing.B) {
+	client, stop := newDiscardClient(b,
+		loggregator.WithTag("deployment", "cf"),
+		loggregator.WithTag("job", "router"),
+		loggregator.WithTag("index", "0"),
+		loggregator.WithTag("ip", "10.0.0.1"),
+		loggregator.WithSendTimeTags(),
+	)
+	defer stop()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client.EmitLog("some log message", loggregator.WithEnvelopeTag("request_id", "abc"))
+	}
+}
+
+// BenchmarkEmitLogGRPC measures emitting including the gRPC stream to a
+// local ingress server over TLS.
+func BenchmarkEmitLogGRPC(b *testing.B) {
+	benchmarkEmitLogGRPC(b)
+}
+
+// BenchmarkEmitLogGRPCWithCompression is BenchmarkEmitLogGRPC with batches
+// compressed with gzip.
+func BenchmarkEmitLogGRPCWithCompression(b *testing.B) {
+	benchmarkEmitLogGRPC(b, loggregator.WithCompression("gzip"))
+}
+
+func benchmarkEmitLogGRPC(b *testing.B, opts ...loggregator.IngressOption) {
+	server, err := testhelpers.NewFakeIngressServer()
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := server.Start(); err != nil {
+		b.Fatal(err)
+	}
+	defer server.Stop()
+
+	opts = append([]loggregator.IngressOption{loggregator.WithAddr(server.Addr())}, opts...)
+	client, err := loggregator.NewIngressClient(server.ClientTLSConfig(), opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer closeClient(client)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client.EmitLog("some log message", loggregator.WithStdout())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Flush(ctx); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// newDiscardClient returns a client whose batches are discarded instead of
+// sent, so that only the client itself is measured, and a function that
+// closes it.
+func newDiscardClient(b *testing.B, opts ...loggregator.IngressOption) (*loggregator.IngressClient, func()) {
+	opts = append([]loggregator.IngressOption{loggregator.WithBatchWriter(discardWriter{})}, opts...)
+	client, err := loggregator.NewInsecureIngressClient(opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return client, func() { closeClient(client) }
+}
+
+func closeClient(client *loggregator.IngressClient) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	client.CloseSendWithContext(ctx)
+}
+
+type discardWriter struct{}
+
+func (discardWriter) Write(context.Context, []*loggregator_v2.Envelope) error {
+	return nil
+}
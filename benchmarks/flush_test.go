@@ -0,0 +1,36 @@
+package benchmarks_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-loggregator"
+)
+
+// BenchmarkFlush measures the time from emitting a batch of envelopes to it
+// having been written.
+func BenchmarkFlush(b *testing.B) {
+	for _, size := range []int{1, 100, 1000} {
+		b.Run(fmt.Sprintf("batch-%d", size), func(b *testing.B) {
+			client, stop := newDiscardClient(b, loggregator.WithBatchMaxSize(uint(size)))
+			defer stop()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < size; j++ {
+					client.EmitLog("some log message", loggregator.WithStdout())
+				}
+				if err := client.Flush(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package benchmarks_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"code.cloudfoundry.org/go-loggregator/conversion"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+func BenchmarkMarshalBatch(b *testing.B) {
+	batch := &loggregator_v2.EnvelopeBatch{Batch: logEnvelopes(100)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := proto.Marshal(batch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalBatch(b *testing.B) {
+	data, err := proto.Marshal(&loggregator_v2.EnvelopeBatch{Batch: logEnvelopes(100)})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var batch loggregator_v2.EnvelopeBatch
+		if err := proto.Unmarshal(data, &batch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConvertToV1(b *testing.B) {
+	e := logEnvelopes(1)[0]
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conversion.ToV1(e)
+	}
+}
+
+func logEnvelopes(n int) []*loggregator_v2.Envelope {
+	envs := make([]*loggregator_v2.Envelope, n)
+	for i := range envs {
+		envs[i] = &loggregator_v2.Envelope{
+			Timestamp:  time.Now().UnixNano(),
+			SourceId:   "some-source-id",
+			InstanceId: "0",
+			Tags: map[string]string{
+				"deployment": "cf",
+				"job":        "router",
+			},
+			Message: &loggregator_v2.Envelope_Log{
+				Log: &loggregator_v2.Log{
+					Payload: []byte("some log message"),
+					Type:    loggregator_v2.Log_OUT,
+				},
+			},
+		}
+	}
+	return envs
+}
@@ -0,0 +1,281 @@
+// Command loggregator-loadgen emits a configurable mix of envelopes to a
+// loggregator agent and reports the achieved throughput and error rate. It
+// is intended for capacity planning, e.g. to find how many envelopes per
+// second an agent sustains:
+//
+//	loggregator-loadgen -addr localhost:3458 -rate 10000 -duration 1m
+//	loggregator-loadgen -mix log=8,counter=1,gauge=1 -size 1024 -concurrency 4
+//
+// Certificates are read from the -ca, -cert and -key flags, which default
+// to the CA_CERT_PATH, CERT_PATH and KEY_PATH environment variables.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/units"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "loggregator-loadgen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("loggregator-loadgen", flag.ExitOnError)
+
+	addr := fs.String("addr", "localhost:3458", "address of the loggregator agent")
+	insecure := fs.Bool("insecure", false, "connect without TLS")
+	ca := fs.String("ca", os.Getenv("CA_CERT_PATH"), "path to the CA certificate")
+	cert := fs.String("cert", os.Getenv("CERT_PATH"), "path to the client certificate")
+	key := fs.String("key", os.Getenv("KEY_PATH"), "path to the client key")
+	sourceID := fs.String("source-id", "loggregator-loadgen", "source ID of the envelopes")
+	mixFlag := fs.String("mix", "log=1", "comma separated weights of the envelope types as type=weight, types are log, counter and gauge")
+	rate := fs.Float64("rate", 0, "envelopes per second across all workers, 0 emits as fast as possible")
+	size := fs.Int("size", 128, "size of log payloads in bytes")
+	concurrency := fs.Int("concurrency", 1, "number of goroutines emitting envelopes")
+	duration := fs.Duration("duration", 10*time.Second, "how long to generate load for")
+	interval := fs.Duration("report-interval", time.Second, "how often to report throughput, 0 only reports at the end")
+	drop := fs.Bool("drop", false, "drop envelopes when the client's buffer is full instead of blocking")
+	fs.Parse(args)
+
+	mix, err := parseMix(*mixFlag)
+	if err != nil {
+		return err
+	}
+	if *concurrency < 1 {
+		return errors.New("-concurrency must be at least 1")
+	}
+
+	opts := []loggregator.IngressOption{
+		loggregator.WithAddr(*addr),
+		loggregator.WithDefaultSourceID(*sourceID),
+	}
+	if *drop {
+		opts = append(opts, loggregator.WithBackpressureStrategy(loggregator.DropNewest))
+	}
+
+	var client *loggregator.IngressClient
+	if *insecure {
+		client, err = loggregator.NewInsecureIngressClient(opts...)
+	} else {
+		tlsConfig, tlsErr := loggregator.NewIngressTLSConfig(*ca, *cert, *key)
+		if tlsErr != nil {
+			return fmt.Errorf("could not create TLS config: %s", tlsErr)
+		}
+		client, err = loggregator.NewIngressClient(tlsConfig, opts...)
+	}
+	if err != nil {
+		return fmt.Errorf("could not create client: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	g := &generator{
+		client:  client,
+		mix:     mix,
+		payload: strings.Repeat("x", *size),
+		rate:    *rate / float64(*concurrency),
+	}
+
+	start := time.Now()
+	r := &reporter{client: client, errors: &g.errors, start: start, last: start}
+
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.run(ctx, start)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var ticks <-chan time.Time
+	if *interval > 0 {
+		t := time.NewTicker(*interval)
+		defer t.Stop()
+		ticks = t.C
+	}
+
+	for running := true; running; {
+		select {
+		case <-ticks:
+			r.report()
+		case <-done:
+			running = false
+		}
+	}
+
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer flushCancel()
+	if err := client.Flush(flushCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "could not flush all envelopes: %s\n", err)
+	}
+	client.CloseSendWithContext(flushCtx)
+
+	r.summary()
+	return nil
+}
+
+// envelopeType is a kind of envelope the generator emits.
+type envelopeType string
+
+const (
+	logType     envelopeType = "log"
+	counterType envelopeType = "counter"
+	gaugeType   envelopeType = "gauge"
+)
+
+// parseMix parses a -mix flag value into a sequence that contains every
+// envelope type as many times as its weight.
+func parseMix(s string) ([]envelopeType, error) {
+	var mix []envelopeType
+	for _, part := range strings.Split(s, ",") {
+		name, weight := part, 1
+		if i := strings.Index(part, "="); i >= 0 {
+			var err error
+			name = part[:i]
+			weight, err = strconv.Atoi(part[i+1:])
+			if err != nil || weight < 0 {
+				return nil, fmt.Errorf("invalid weight in %q", part)
+			}
+		}
+
+		t := envelopeType(strings.TrimSpace(name))
+		switch t {
+		case logType, counterType, gaugeType:
+		default:
+			return nil, fmt.Errorf("unknown envelope type %q", name)
+		}
+
+		for i := 0; i < weight; i++ {
+			mix = append(mix, t)
+		}
+	}
+
+	if len(mix) == 0 {
+		return nil, errors.New("-mix has no envelopes with a weight above 0")
+	}
+	return mix, nil
+}
+
+// generator emits envelopes from every worker.
+type generator struct {
+	client  *loggregator.IngressClient
+	mix     []envelopeType
+	payload string
+
+	// rate is the number of envelopes per second of each worker.
+	rate float64
+
+	errors uint64
+}
+
+// run emits envelopes until ctx is done, keeping to the generator's rate
+// if it has one.
+func (g *generator) run(ctx context.Context, start time.Time) {
+	for n := 0; ctx.Err() == nil; n++ {
+		if g.rate > 0 {
+			due := start.Add(time.Duration(float64(n) / g.rate * float64(time.Second)))
+			if d := time.Until(due); d > 0 {
+				select {
+				case <-time.After(d):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+
+		if err := g.emit(ctx, g.mix[n%len(g.mix)]); err != nil && ctx.Err() == nil {
+			atomic.AddUint64(&g.errors, 1)
+		}
+	}
+}
+
+func (g *generator) emit(ctx context.Context, t envelopeType) error {
+	switch t {
+	case counterType:
+		return g.client.EmitCounterContext(ctx, "loadgen_counter", loggregator.WithDelta(1))
+	case gaugeType:
+		return g.client.EmitGaugeContext(ctx, loggregator.WithGaugeValue("loadgen_gauge", 1, units.Count))
+	default:
+		return g.client.EmitLogContext(ctx, g.payload, loggregator.WithStdout())
+	}
+}
+
+// reporter prints the client's throughput.
+type reporter struct {
+	client *loggregator.IngressClient
+	errors *uint64
+
+	start time.Time
+	last  time.Time
+	prev  loggregator.Stats
+}
+
+// report prints the throughput since the previous report.
+func (r *reporter) report() {
+	now := time.Now()
+	s := r.client.Stats()
+	secs := now.Sub(r.last).Seconds()
+
+	fmt.Printf("%6.1fs emitted %.0f/s sent %.0f/s dropped %d failed %d\n",
+		now.Sub(r.start).Seconds(),
+		float64(s.Emitted-r.prev.Emitted)/secs,
+		float64(s.EnvelopesSent-r.prev.EnvelopesSent)/secs,
+		s.Dropped-r.prev.Dropped,
+		s.Failed-r.prev.Failed,
+	)
+
+	r.last, r.prev = now, s
+}
+
+// summary prints the totals of the whole run.
+func (r *reporter) summary() {
+	s := r.client.Stats()
+	secs := time.Since(r.start).Seconds()
+	errs := atomic.LoadUint64(r.errors)
+
+	attempted := s.Emitted + s.Dropped + errs
+	lost := s.Dropped + s.Failed + errs
+	var errorRate float64
+	if attempted > 0 {
+		errorRate = float64(lost) / float64(attempted) * 100
+	}
+
+	fmt.Printf("\nduration   %.1fs\n", secs)
+	fmt.Printf("emitted    %d (%.0f/s)\n", s.Emitted, float64(s.Emitted)/secs)
+	fmt.Printf("sent       %d (%.0f/s) in %d batches\n", s.EnvelopesSent, float64(s.EnvelopesSent)/secs, s.BatchesSent)
+	fmt.Printf("dropped    %d\n", s.Dropped)
+	fmt.Printf("failed     %d\n", s.Failed)
+	fmt.Printf("errors     %d\n", errs)
+	fmt.Printf("error rate %.2f%%\n", errorRate)
+}
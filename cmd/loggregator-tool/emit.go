@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+)
+
+func emit(args []string) error {
+	fs := flag.NewFlagSet("emit", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: loggregator-tool emit [flags] log|counter|gauge <args>")
+		fs.PrintDefaults()
+	}
+
+	var (
+		t    tlsFlags
+		tags = tagFlags{}
+	)
+	t.register(fs)
+	addr := fs.String("addr", "localhost:3458", "address of the loggregator agent")
+	insecure := fs.Bool("insecure", false, "connect without TLS")
+	sourceID := fs.String("source-id", "loggregator-tool", "source ID of the envelope")
+	instanceID := fs.String("instance-id", "", "instance ID of the envelope")
+	timeout := fs.Duration("timeout", 5*time.Second, "how long to wait for the envelope to be sent")
+	fs.Var(tags, "tag", "tag of the envelope as name=value, may be repeated")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return errors.New("missing envelope type")
+	}
+
+	opts := []loggregator.IngressOption{
+		loggregator.WithAddr(*addr),
+		loggregator.WithDefaultSourceID(*sourceID),
+		loggregator.WithDefaultInstanceID(*instanceID),
+	}
+	for k, v := range tags {
+		opts = append(opts, loggregator.WithTag(k, v))
+	}
+
+	var (
+		client *loggregator.IngressClient
+		err    error
+	)
+	if *insecure {
+		client, err = loggregator.NewInsecureIngressClient(opts...)
+	} else {
+		tlsConfig, tlsErr := loggregator.NewIngressTLSConfig(t.ca, t.cert, t.key)
+		if tlsErr != nil {
+			return fmt.Errorf("could not create TLS config: %s", tlsErr)
+		}
+		client, err = loggregator.NewIngressClient(tlsConfig, opts...)
+	}
+	if err != nil {
+		return fmt.Errorf("could not create client: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	defer client.CloseSendWithContext(ctx)
+
+	if err := emitEnvelope(ctx, client, fs.Args()); err != nil {
+		return err
+	}
+
+	return client.Flush(ctx)
+}
+
+func emitEnvelope(ctx context.Context, client *loggregator.IngressClient, args []string) error {
+	switch kind, args := args[0], args[1:]; kind {
+	case "log":
+		if len(args) != 1 {
+			return errors.New("usage: emit log <message>")
+		}
+		return client.EmitLogContext(ctx, args[0], loggregator.WithStdout())
+	case "counter":
+		if len(args) < 1 || len(args) > 2 {
+			return errors.New("usage: emit counter <name> [delta]")
+		}
+		delta := uint64(1)
+		if len(args) == 2 {
+			var err error
+			delta, err = strconv.ParseUint(args[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid delta %q", args[1])
+			}
+		}
+		return client.EmitCounterContext(ctx, args[0], loggregator.WithDelta(delta))
+	case "gauge":
+		if len(args) < 2 || len(args) > 3 {
+			return errors.New("usage: emit gauge <name> <value> [unit]")
+		}
+		value, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid value %q", args[1])
+		}
+		var unit string
+		if len(args) == 3 {
+			unit = args[2]
+		}
+		return client.EmitGaugeContext(ctx, loggregator.WithGaugeValue(args[0], value, unit))
+	default:
+		return fmt.Errorf("unknown envelope type %q", kind)
+	}
+}
@@ -0,0 +1,87 @@
+// Command loggregator-tool emits envelopes to and tails envelopes from
+// loggregator. It is intended for smoke testing connectivity, e.g. to the
+// agent on a BOSH VM:
+//
+//	loggregator-tool emit log "hello from $(hostname)"
+//	loggregator-tool emit counter requests 5
+//	loggregator-tool emit gauge cpu 0.5 percentage
+//	loggregator-tool tail -addr reverse-log-proxy:8082 -source-id some-app
+//
+// Certificates are read from the -ca, -cert and -key flags, which default
+// to the CA_CERT_PATH, CERT_PATH and KEY_PATH environment variables.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const usage = `usage: loggregator-tool <command> [flags] [args]
+
+commands:
+  emit log <message>               emit a log
+  emit counter <name> [delta]      emit a counter, delta defaults to 1
+  emit gauge <name> <value> [unit] emit a gauge
+  tail                             print envelopes from the reverse log proxy
+
+Run "loggregator-tool <command> -h" for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "emit":
+		err = emit(os.Args[2:])
+	case "tail":
+		err = tail(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "loggregator-tool: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// tlsFlags are the certificate flags shared by every command.
+type tlsFlags struct {
+	ca, cert, key string
+}
+
+func (t *tlsFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&t.ca, "ca", os.Getenv("CA_CERT_PATH"), "path to the CA certificate")
+	fs.StringVar(&t.cert, "cert", os.Getenv("CERT_PATH"), "path to the client certificate")
+	fs.StringVar(&t.key, "key", os.Getenv("KEY_PATH"), "path to the client key")
+}
+
+// tagFlags collects repeated -tag name=value flags.
+type tagFlags map[string]string
+
+func (t tagFlags) String() string {
+	var tags []string
+	for k, v := range t {
+		tags = append(tags, k+"="+v)
+	}
+	return strings.Join(tags, ",")
+}
+
+func (t tagFlags) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i < 1 {
+		return fmt.Errorf("invalid tag %q, expected name=value", s)
+	}
+	t[s[:i]] = s[i+1:]
+	return nil
+}
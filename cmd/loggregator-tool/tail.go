@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/formatter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+func tail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+
+	var t tlsFlags
+	t.register(fs)
+	addr := fs.String("addr", "", "address of the reverse log proxy")
+	sourceIDs := fs.String("source-id", "", "comma separated source IDs to tail, defaults to all")
+	shardID := fs.String("shard-id", "loggregator-tool", "shard ID of the stream")
+	verbose := fs.Bool("v", false, "log connection errors to stderr")
+	fs.Parse(args)
+
+	if *addr == "" {
+		fs.Usage()
+		return errors.New("missing -addr")
+	}
+
+	tlsConfig, err := loggregator.NewEgressTLSConfig(t.ca, t.cert, t.key)
+	if err != nil {
+		return fmt.Errorf("could not create TLS config: %s", err)
+	}
+
+	var opts []loggregator.EnvelopeStreamOption
+	if *verbose {
+		opts = append(opts, loggregator.WithEnvelopeStreamLogger(log.New(os.Stderr, "", log.LstdFlags)))
+	}
+	connector := loggregator.NewEnvelopeStreamConnector(*addr, tlsConfig, opts...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	stream := connector.Stream(ctx, &loggregator_v2.EgressBatchRequest{
+		ShardId:   *shardID,
+		Selectors: selectors(*sourceIDs),
+	})
+
+	f := formatter.New()
+	for ctx.Err() == nil {
+		for _, e := range stream() {
+			fmt.Println(f.Format(e))
+		}
+	}
+
+	return nil
+}
+
+// selectors returns selectors for every envelope type of the given comma
+// separated source IDs, or of every source ID if there are none.
+func selectors(sourceIDs string) []*loggregator_v2.Selector {
+	if sourceIDs == "" {
+		return loggregator.AllSelectors()
+	}
+
+	return loggregator.NewSelectorSet(strings.Split(sourceIDs, ",")...).
+		Logs().
+		Counters().
+		Gauges().
+		Timers().
+		Events().
+		Selectors()
+}
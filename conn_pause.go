@@ -0,0 +1,97 @@
+package loggregator
+
+import (
+	"sync"
+
+	"google.golang.org/grpc/connectivity"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// WithPauseOnConnectionLoss makes the client stop sending batches while its
+// connection to loggregator is in transient failure, rather than failing
+// every send until it is back. Envelopes are held in the envelope buffer in
+// the meantime, subject to the backpressure strategy (see
+// WithBackpressureStrategy). Once the connection is ready again, everything
+// that was held is flushed. Closing the client ends the pause.
+func WithPauseOnConnectionLoss() IngressOption {
+	return func(c *IngressClient) {
+		c.connPause = &connPause{ready: make(chan struct{})}
+	}
+}
+
+// connPause tracks whether sends are paused because the connection is in
+// transient failure. ready is closed when the pause ends.
+type connPause struct {
+	mu     sync.Mutex
+	paused bool
+	ready  chan struct{}
+}
+
+func (p *connPause) setState(s connectivity.State) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case s == connectivity.TransientFailure && !p.paused:
+		p.paused = true
+		p.ready = make(chan struct{})
+	case s == connectivity.Ready && p.paused:
+		p.paused = false
+		close(p.ready)
+	}
+}
+
+func (p *connPause) state() (bool, chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.paused, p.ready
+}
+
+// watchConnection follows the state of the connection until it is shut
+// down or the client's context is done.
+func (c *IngressClient) watchConnection() {
+	state := c.conn.GetState()
+	for {
+		c.connPause.setState(state)
+		if state == connectivity.Shutdown || !c.conn.WaitForStateChange(c.ctx, state) {
+			return
+		}
+		state = c.conn.GetState()
+	}
+}
+
+// awaitConnection blocks while sends are paused for a lost connection. It
+// reports whether it waited, in which case the caller should flush
+// everything that was buffered in the meantime.
+func (c *IngressClient) awaitConnection() bool {
+	if c.connPause == nil || c.isClosed() {
+		return false
+	}
+
+	paused, ready := c.connPause.state()
+	if !paused {
+		return false
+	}
+
+	c.logger.Printf("Connection lost, pausing sends until it is ready")
+	select {
+	case <-ready:
+	case <-c.closing:
+	case <-c.ctx.Done():
+	}
+
+	return true
+}
+
+// dispatchBatch dispatches the batch, first waiting for the connection if
+// sends are paused. Once a pause ends, the batch is flushed along with the
+// envelopes buffered during it.
+func (c *IngressClient) dispatchBatch(batch []*loggregator_v2.Envelope, batchBytes int) {
+	if c.awaitConnection() {
+		c.flushBuffered(batch, batchBytes)
+		return
+	}
+	c.dispatch(batch, nil)
+}
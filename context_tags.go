@@ -0,0 +1,77 @@
+package loggregator
+
+import (
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+type contextTagsKey struct{}
+
+// ContextWithTags returns a copy of ctx that carries the given tags in
+// addition to any tags ctx already carries, e.g. to tag every envelope
+// emitted while handling a request with its request ID:
+//
+//	ctx = loggregator.ContextWithTags(r.Context(), map[string]string{
+//		"request_id": r.Header.Get("X-Request-Id"),
+//	})
+//	client.EmitLogContext(ctx, "handling request")
+//
+// The tags are added to every envelope emitted with the context by the
+// Context variants of the Emit methods, e.g. EmitLogContext, and by
+// EmitEvent. Tags that are already set on the envelope, e.g. by emit
+// options, are kept. Tags given for a name ctx already carries replace the
+// earlier value.
+func ContextWithTags(ctx context.Context, tags map[string]string) context.Context {
+	parent := TagsFromContext(ctx)
+
+	merged := make(map[string]string, len(parent)+len(tags))
+	for k, v := range parent {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, contextTagsKey{}, merged)
+}
+
+// TagsFromContext returns the tags carried by ctx, or nil if it carries
+// none. The returned map must not be modified.
+func TagsFromContext(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(contextTagsKey{}).(map[string]string)
+	return tags
+}
+
+// WithContextTags adds the tags carried by ctx to the envelope, for emit
+// methods that take no context, such as EmitLog, or for the v1 client.
+// Unlike the tags added by the Context variants of the Emit methods, they
+// replace tags of the same name that are already set.
+func WithContextTags(ctx context.Context) func(proto.Message) {
+	return WithEnvelopeTags(TagsFromContext(ctx))
+}
+
+// addContextTags adds the tags carried by ctx that are not yet set on e.
+// The client's tags take precedence over them. They are already on e unless
+// the client adds them at send time, in which case context tags of the same
+// name are left out here.
+func (c *IngressClient) addContextTags(ctx context.Context, e *loggregator_v2.Envelope) {
+	tags := TagsFromContext(ctx)
+	if len(tags) == 0 {
+		return
+	}
+
+	if e.Tags == nil {
+		e.Tags = make(map[string]string, len(tags))
+	}
+	for k, v := range tags {
+		if _, ok := e.Tags[k]; ok {
+			continue
+		}
+		if _, ok := c.tags[k]; ok && c.sendTimeTags {
+			continue
+		}
+		e.Tags[k] = v
+	}
+}
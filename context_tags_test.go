@@ -0,0 +1,67 @@
+package loggregator_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ContextWithTags", func() {
+	It("merges with the tags the context already carries", func() {
+		ctx := loggregator.ContextWithTags(context.Background(), map[string]string{
+			"request_id": "abc",
+			"user_id":    "alice",
+		})
+		ctx = loggregator.ContextWithTags(ctx, map[string]string{"user_id": "bob"})
+
+		Expect(loggregator.TagsFromContext(ctx)).To(Equal(map[string]string{
+			"request_id": "abc",
+			"user_id":    "bob",
+		}))
+		Expect(loggregator.TagsFromContext(context.Background())).To(BeNil())
+	})
+
+	It("adds the tags with WithContextTags", func() {
+		ctx := loggregator.ContextWithTags(context.Background(), map[string]string{"request_id": "abc"})
+
+		e := &loggregator_v2.Envelope{}
+		var opt loggregator.EmitLogOption = loggregator.WithContextTags(ctx)
+		opt(e)
+
+		Expect(e.GetTags()).To(Equal(map[string]string{"request_id": "abc"}))
+	})
+
+	It("adds the tags to envelopes emitted with the context", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+		received := server.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx := loggregator.ContextWithTags(context.Background(), map[string]string{
+			"request_id": "abc",
+			"user_id":    "alice",
+		})
+		Expect(client.EmitLogContext(ctx, "message", loggregator.WithEnvelopeTag("user_id", "bob"))).To(Succeed())
+		Expect(client.EmitCounterContext(ctx, "counter")).To(Succeed())
+
+		var e *loggregator_v2.Envelope
+		Eventually(received).Should(Receive(&e))
+		Expect(e.GetTags()).To(Equal(map[string]string{
+			"request_id": "abc",
+			"user_id":    "bob",
+		}))
+		Eventually(received).Should(Receive(&e))
+		Expect(e.GetTags()).To(HaveKeyWithValue("request_id", "abc"))
+	})
+})
@@ -0,0 +1,171 @@
+package loggregator
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// WithLogDeduplication suppresses logs that repeat the payload of an earlier
+// log from the same source ID within the given window, e.g. the same error
+// printed by a crash loop. The first log is sent as usual. Once the window
+// after it has passed, a single log with the payload "message repeated N
+// times: <payload>" is sent in place of the N suppressed repeats. Logs are
+// compared by a hash of their payload, and only logs are deduplicated. A
+// window that is not positive disables deduplication.
+func WithLogDeduplication(window time.Duration) IngressOption {
+	return func(c *IngressClient) {
+		c.dedup = nil
+		if window > 0 {
+			c.dedup = newDeduplicator(window)
+		}
+	}
+}
+
+// duplicate reports whether e repeats a recent log, recording it if so.
+func (c *IngressClient) duplicate(e *loggregator_v2.Envelope) bool {
+	if c.dedup == nil || e.GetLog() == nil || !c.dedup.seen(e) {
+		return false
+	}
+	atomic.AddUint64(&c.stats.deduplicated, 1)
+
+	return true
+}
+
+type dedupKey struct {
+	sourceID string
+	hash     uint64
+}
+
+type dedupEntry struct {
+	first   time.Time
+	repeats int
+
+	// last is the most recent repeat. It was never sent, so it is reused
+	// for the summary.
+	last *loggregator_v2.Envelope
+}
+
+// deduplicator tracks the logs seen within the window. It is safe for
+// concurrent use.
+type deduplicator struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	entries map[dedupKey]*dedupEntry
+	pending []*loggregator_v2.Envelope
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newDeduplicator(window time.Duration) *deduplicator {
+	return &deduplicator{
+		window:  window,
+		entries: make(map[dedupKey]*dedupEntry),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// seen reports whether e repeats a log within its window.
+func (d *deduplicator) seen(e *loggregator_v2.Envelope) bool {
+	h := fnv.New64a()
+	h.Write(e.GetLog().GetPayload())
+	key := dedupKey{sourceID: e.GetSourceId(), hash: h.Sum64()}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry, ok := d.entries[key]
+	if ok && time.Since(entry.first) < d.window {
+		entry.repeats++
+		entry.last = e
+		return true
+	}
+
+	// The window has passed but the sweep has not summarized it yet. Leave
+	// the summary for the next sweep, since sending it here could block.
+	if ok && entry.repeats > 0 {
+		d.pending = append(d.pending, summarize(entry))
+	}
+	d.entries[key] = &dedupEntry{first: time.Now()}
+
+	return false
+}
+
+// minDedupSweep is the shortest interval between sweeps, which keeps tiny
+// windows from spinning the sweep goroutine.
+const minDedupSweep = time.Millisecond
+
+// run sends summaries for windows that have passed until the deduplicator
+// is stopped. It sweeps twice per window.
+func (d *deduplicator) run(c *IngressClient) {
+	defer close(d.stopped)
+
+	interval := d.window / 2
+	if interval < minDedupSweep {
+		interval = minDedupSweep
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			d.sweep(c.ctx, c, false)
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// sweep sends a summary for every expired entry with repeats, or for every
+// entry with repeats if all is set, and forgets those entries. Summaries
+// that cannot be buffered before ctx is done are dropped.
+func (d *deduplicator) sweep(ctx context.Context, c *IngressClient, all bool) {
+	d.mu.Lock()
+	summaries := d.pending
+	d.pending = nil
+	for key, entry := range d.entries {
+		if !all && time.Since(entry.first) < d.window {
+			continue
+		}
+		delete(d.entries, key)
+
+		if entry.repeats > 0 {
+			summaries = append(summaries, summarize(entry))
+		}
+	}
+	d.mu.Unlock()
+
+	for _, e := range summaries {
+		c.enqueue(ctx, e)
+	}
+}
+
+// stop stops the sweep and sends the summaries of every pending entry,
+// giving up once ctx is done. The client must not be closed until it
+// returns.
+func (d *deduplicator) stop(ctx context.Context, c *IngressClient) {
+	close(d.done)
+	<-d.stopped
+	d.sweep(ctx, c, true)
+}
+
+func summarize(entry *dedupEntry) *loggregator_v2.Envelope {
+	e := entry.last
+	e.Timestamp = time.Now().UnixNano()
+	e.GetLog().Payload = []byte(fmt.Sprintf(
+		"message repeated %d times: %s",
+		entry.repeats,
+		e.GetLog().GetPayload(),
+	))
+
+	return e
+}
@@ -0,0 +1,82 @@
+package loggregator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// failoverDialTimeout bounds each connection attempt so that an address
+// that does not answer cannot use up the whole dial before the others are
+// tried.
+const failoverDialTimeout = 5 * time.Second
+
+// failoverDialer connects to the first of several addresses that accepts a
+// connection. It starts from the address it last connected to, so a client
+// stays on a working agent and only moves on when that agent goes away.
+type failoverDialer struct {
+	addrs  []string
+	logger Logger
+
+	mu   sync.Mutex
+	next int
+}
+
+func newFailoverDialer(addrs []string, logger Logger) *failoverDialer {
+	return &failoverDialer{
+		addrs:  addrs,
+		logger: logger,
+	}
+}
+
+func (d *failoverDialer) dial(ctx context.Context, _ string) (net.Conn, error) {
+	d.mu.Lock()
+	start := d.next
+	d.mu.Unlock()
+
+	var lastErr error
+	for i := range d.addrs {
+		idx := (start + i) % len(d.addrs)
+
+		dialer := net.Dialer{Timeout: failoverDialTimeout}
+		conn, err := dialer.DialContext(ctx, "tcp", d.addrs[idx])
+		if err == nil {
+			d.mu.Lock()
+			d.next = idx
+			d.mu.Unlock()
+
+			if idx != start {
+				d.logger.Printf("failed over to loggregator address %s", d.addrs[idx])
+			}
+			return conn, nil
+		}
+
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, lastErr
+}
+
+// dialUnix connects to the Unix domain socket at path.
+func dialUnix(ctx context.Context, path string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "unix", path)
+}
+
+// validateAddr checks that addr is a host and port that can be dialed.
+func validateAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid loggregator address %q: %s", addr, err)
+	}
+	if port == "" {
+		return fmt.Errorf("invalid loggregator address %q: missing port", addr)
+	}
+
+	return nil
+}
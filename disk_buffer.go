@@ -0,0 +1,136 @@
+package loggregator
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// ErrDiskBufferFull is returned when a batch does not fit in the disk buffer.
+var ErrDiskBufferFull = errors.New("disk buffer is full")
+
+const diskBufferExt = ".batch"
+
+// diskBuffer is a FIFO of envelope batches stored as one file per batch in a
+// directory. Batches left over from a previous process are picked up when
+// the buffer is created. It is not safe for concurrent use.
+type diskBuffer struct {
+	dir      string
+	maxBytes int64
+
+	size  int64
+	seq   uint64
+	files []string
+}
+
+func newDiskBuffer(dir string, maxBytes int64) (*diskBuffer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &diskBuffer{
+		dir:      dir,
+		maxBytes: maxBytes,
+	}
+
+	for _, info := range infos {
+		name := info.Name()
+		if !strings.HasSuffix(name, diskBufferExt) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, diskBufferExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if seq >= d.seq {
+			d.seq = seq + 1
+		}
+		d.size += info.Size()
+		d.files = append(d.files, name)
+	}
+	sort.Strings(d.files)
+
+	return d, nil
+}
+
+func (d *diskBuffer) empty() bool {
+	return len(d.files) == 0
+}
+
+// push appends the batch to the buffer. It returns ErrDiskBufferFull if the
+// batch would grow the buffer beyond its maximum size.
+func (d *diskBuffer) push(batch []*loggregator_v2.Envelope) error {
+	data, err := proto.Marshal(&loggregator_v2.EnvelopeBatch{Batch: batch})
+	if err != nil {
+		return err
+	}
+
+	if d.size+int64(len(data)) > d.maxBytes {
+		return ErrDiskBufferFull
+	}
+
+	name := fmt.Sprintf("%020d%s", d.seq, diskBufferExt)
+	tmp := filepath.Join(d.dir, name+".tmp")
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(d.dir, name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	d.seq++
+	d.size += int64(len(data))
+	d.files = append(d.files, name)
+
+	return nil
+}
+
+// peek returns the oldest batch in the buffer without removing it.
+func (d *diskBuffer) peek() ([]*loggregator_v2.Envelope, error) {
+	data, err := ioutil.ReadFile(filepath.Join(d.dir, d.files[0]))
+	if err != nil {
+		return nil, err
+	}
+
+	var b loggregator_v2.EnvelopeBatch
+	if err := proto.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+
+	return b.Batch, nil
+}
+
+// pop removes the oldest batch from the buffer.
+func (d *diskBuffer) pop() error {
+	path := filepath.Join(d.dir, d.files[0])
+	info, err := os.Stat(path)
+	if err == nil {
+		d.size -= info.Size()
+	}
+	d.files = d.files[1:]
+
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,186 @@
+// Package metrics is a replacement for dropsonde's metrics package that
+// sends through a v2 loggregator client. Components migrating off dropsonde
+// can swap the import of github.com/cloudfoundry/dropsonde/metrics for this
+// package and replace their call to dropsonde.Initialize with a call to
+// Initialize. Until Initialize is called, every function is a no-op, just as
+// it is in dropsonde.
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	loggregator "code.cloudfoundry.org/go-loggregator"
+)
+
+// Client is the client used to send metrics. This would usually be the
+// go-loggregator v2 client.
+type Client interface {
+	EmitCounter(name string, opts ...loggregator.EmitCounterOption)
+	EmitGauge(opts ...loggregator.EmitGaugeOption)
+}
+
+// Option configures the package in Initialize.
+type Option func(*sender)
+
+// WithBatchInterval sets how often counters incremented with
+// BatchIncrementCounter and BatchAddCounter are sent. It defaults to 5
+// seconds, the interval dropsonde uses.
+func WithBatchInterval(d time.Duration) Option {
+	return func(s *sender) {
+		s.batchInterval = d
+	}
+}
+
+var (
+	mu      sync.Mutex
+	current *sender
+)
+
+// Initialize routes the package's functions to the given client. Calling it
+// again sends any pending batched counters to the previous client first.
+func Initialize(c Client, opts ...Option) {
+	s := &sender{
+		client:        c,
+		batchInterval: 5 * time.Second,
+		counters:      make(map[string]uint64),
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+
+	mu.Lock()
+	prev := current
+	current = s
+	mu.Unlock()
+
+	if prev != nil {
+		prev.close()
+	}
+
+	go s.run()
+}
+
+// Close sends any pending batched counters and stops the package from
+// sending further metrics until Initialize is called again.
+func Close() {
+	mu.Lock()
+	s := current
+	current = nil
+	mu.Unlock()
+
+	if s != nil {
+		s.close()
+	}
+}
+
+// SendValue sends a gauge with the given name, value and unit.
+func SendValue(name string, value float64, unit string) error {
+	if s := get(); s != nil {
+		s.client.EmitGauge(loggregator.WithGaugeValue(name, value, unit))
+	}
+	return nil
+}
+
+// IncrementCounter sends a counter with the given name and a delta of 1.
+func IncrementCounter(name string) error {
+	return AddToCounter(name, 1)
+}
+
+// AddToCounter sends a counter with the given name and delta.
+func AddToCounter(name string, delta uint64) error {
+	if s := get(); s != nil {
+		s.client.EmitCounter(name, loggregator.WithDelta(delta))
+	}
+	return nil
+}
+
+// BatchIncrementCounter adds 1 to the named counter. Batched counters are
+// summed and sent on the batch interval.
+func BatchIncrementCounter(name string) {
+	BatchAddCounter(name, 1)
+}
+
+// BatchAddCounter adds delta to the named counter. Batched counters are
+// summed and sent on the batch interval.
+func BatchAddCounter(name string, delta uint64) {
+	if s := get(); s != nil {
+		s.add(name, delta)
+	}
+}
+
+// SendContainerMetric sends a gauge with the CPU, memory and disk usage of
+// an application instance, named as loggregator names the metrics of a
+// converted dropsonde ContainerMetric.
+func SendContainerMetric(applicationID string, instanceIndex int32, cpuPercentage float64, memoryBytes, diskBytes uint64) error {
+	if s := get(); s != nil {
+		s.client.EmitGauge(
+			loggregator.WithGaugeAppInfo(applicationID, int(instanceIndex)),
+			loggregator.WithGaugeValue("cpu", cpuPercentage, "percentage"),
+			loggregator.WithGaugeValue("memory", float64(memoryBytes), "bytes"),
+			loggregator.WithGaugeValue("disk", float64(diskBytes), "bytes"),
+		)
+	}
+	return nil
+}
+
+func get() *sender {
+	mu.Lock()
+	defer mu.Unlock()
+	return current
+}
+
+type sender struct {
+	client        Client
+	batchInterval time.Duration
+
+	mu       sync.Mutex
+	counters map[string]uint64
+
+	closeOnce sync.Once
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+func (s *sender) add(name string, delta uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[name] += delta
+}
+
+func (s *sender) run() {
+	defer close(s.stopped)
+
+	t := time.NewTicker(s.batchInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			s.flush()
+		case <-s.done:
+			s.flush()
+			return
+		}
+	}
+}
+
+func (s *sender) flush() {
+	s.mu.Lock()
+	counters := s.counters
+	s.counters = make(map[string]uint64, len(counters))
+	s.mu.Unlock()
+
+	for name, delta := range counters {
+		s.client.EmitCounter(name, loggregator.WithDelta(delta))
+	}
+}
+
+func (s *sender) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	<-s.stopped
+}
@@ -0,0 +1,138 @@
+package metrics_test
+
+import (
+	"sync"
+	"time"
+
+	loggregator "code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/dropsonde/metrics"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	var client *spyClient
+
+	BeforeEach(func() {
+		client = &spyClient{}
+		metrics.Initialize(client, metrics.WithBatchInterval(10*time.Millisecond))
+	})
+
+	AfterEach(func() {
+		metrics.Close()
+	})
+
+	It("sends values as gauges", func() {
+		Expect(metrics.SendValue("latency", 1.5, "ms")).To(Succeed())
+
+		Expect(client.envelopes()).To(HaveLen(1))
+		m := client.envelopes()[0].GetGauge().GetMetrics()["latency"]
+		Expect(m.GetValue()).To(Equal(1.5))
+		Expect(m.GetUnit()).To(Equal("ms"))
+	})
+
+	It("sends counters", func() {
+		Expect(metrics.IncrementCounter("requests")).To(Succeed())
+		Expect(metrics.AddToCounter("bytes", 512)).To(Succeed())
+
+		envs := client.envelopes()
+		Expect(envs).To(HaveLen(2))
+		Expect(envs[0].GetCounter().GetName()).To(Equal("requests"))
+		Expect(envs[0].GetCounter().GetDelta()).To(Equal(uint64(1)))
+		Expect(envs[1].GetCounter().GetName()).To(Equal("bytes"))
+		Expect(envs[1].GetCounter().GetDelta()).To(Equal(uint64(512)))
+	})
+
+	It("sums batched counters and sends them on the batch interval", func() {
+		metrics.Initialize(client, metrics.WithBatchInterval(time.Hour))
+
+		metrics.BatchIncrementCounter("requests")
+		metrics.BatchIncrementCounter("requests")
+		metrics.BatchAddCounter("requests", 3)
+		Expect(client.envelopes()).To(BeEmpty())
+
+		metrics.Close()
+
+		envs := client.envelopes()
+		Expect(envs).To(HaveLen(1))
+		Expect(envs[0].GetCounter().GetName()).To(Equal("requests"))
+		Expect(envs[0].GetCounter().GetDelta()).To(Equal(uint64(5)))
+	})
+
+	It("sends batched counters periodically", func() {
+		metrics.BatchIncrementCounter("requests")
+		Eventually(client.envelopes).Should(HaveLen(1))
+
+		metrics.BatchIncrementCounter("requests")
+		Eventually(client.envelopes).Should(HaveLen(2))
+	})
+
+	It("sends container metrics as gauges", func() {
+		Expect(metrics.SendContainerMetric("app-id", 2, 12.5, 1024, 2048)).To(Succeed())
+
+		Expect(client.envelopes()).To(HaveLen(1))
+		e := client.envelopes()[0]
+		Expect(e.GetSourceId()).To(Equal("app-id"))
+		Expect(e.GetInstanceId()).To(Equal("2"))
+		Expect(e.GetGauge().GetMetrics()).To(Equal(map[string]*loggregator_v2.GaugeValue{
+			"cpu":    {Value: 12.5, Unit: "percentage"},
+			"memory": {Value: 1024, Unit: "bytes"},
+			"disk":   {Value: 2048, Unit: "bytes"},
+		}))
+	})
+
+	It("does nothing before it is initialized", func() {
+		metrics.Close()
+
+		Expect(metrics.SendValue("latency", 1.5, "ms")).To(Succeed())
+		Expect(metrics.IncrementCounter("requests")).To(Succeed())
+		metrics.BatchIncrementCounter("requests")
+
+		Expect(client.envelopes()).To(BeEmpty())
+	})
+})
+
+type spyClient struct {
+	mu   sync.Mutex
+	envs []*loggregator_v2.Envelope
+}
+
+func (s *spyClient) EmitCounter(name string, opts ...loggregator.EmitCounterOption) {
+	e := &loggregator_v2.Envelope{
+		Message: &loggregator_v2.Envelope_Counter{
+			Counter: &loggregator_v2.Counter{Name: name, Delta: 1},
+		},
+	}
+	for _, o := range opts {
+		o(e)
+	}
+	s.add(e)
+}
+
+func (s *spyClient) EmitGauge(opts ...loggregator.EmitGaugeOption) {
+	e := &loggregator_v2.Envelope{
+		Message: &loggregator_v2.Envelope_Gauge{
+			Gauge: &loggregator_v2.Gauge{
+				Metrics: make(map[string]*loggregator_v2.GaugeValue),
+			},
+		},
+	}
+	for _, o := range opts {
+		o(e)
+	}
+	s.add(e)
+}
+
+func (s *spyClient) add(e *loggregator_v2.Envelope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.envs = append(s.envs, e)
+}
+
+func (s *spyClient) envelopes() []*loggregator_v2.Envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*loggregator_v2.Envelope(nil), s.envs...)
+}
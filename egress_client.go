@@ -0,0 +1,180 @@
+package loggregator
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/internal/backoff"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// EgressClient consumes envelopes from the loggregator v2 Egress API (e.g.
+// the Reverse Log Proxy). Streams created by the client reconnect with an
+// exponential backoff when they die. It should be created with the
+// NewEgressClient constructor.
+type EgressClient struct {
+	addr string
+
+	conn   *grpc.ClientConn
+	client loggregator_v2.EgressClient
+
+	dialOpts   []grpc.DialOption
+	log        Logger
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// EgressOption configures an EgressClient.
+type EgressOption func(*EgressClient)
+
+// WithEgressLogger allows for the configuration of a logger.
+// By default, the logger is disabled.
+func WithEgressLogger(l Logger) EgressOption {
+	return func(c *EgressClient) {
+		c.log = l
+	}
+}
+
+// WithEgressDialOptions allows for configuration of grpc dial options.
+func WithEgressDialOptions(opts ...grpc.DialOption) EgressOption {
+	return func(c *EgressClient) {
+		c.dialOpts = append(c.dialOpts, opts...)
+	}
+}
+
+// WithEgressBackoff configures the delays used between reconnect attempts.
+// The delay starts at min and doubles on every failed attempt until it
+// reaches max. It defaults to 50 milliseconds and 5 seconds.
+func WithEgressBackoff(min, max time.Duration) EgressOption {
+	return func(c *EgressClient) {
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+// NewEgressClient creates a v2 loggregator egress client. Its TLS
+// configuration must share a CA with the loggregator server.
+func NewEgressClient(addr string, tlsConfig *tls.Config, opts ...EgressOption) (*EgressClient, error) {
+	c := &EgressClient{
+		addr:       addr,
+		log:        log.New(ioutil.Discard, "", 0),
+		minBackoff: 50 * time.Millisecond,
+		maxBackoff: 5 * time.Second,
+	}
+
+	for _, o := range opts {
+		o(c)
+	}
+
+	c.dialOpts = append(c.dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+
+	conn, err := grpc.Dial(
+		c.addr,
+		c.dialOpts...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	c.client = loggregator_v2.NewEgressClient(conn)
+
+	return c, nil
+}
+
+// Close closes the underlying gRPC connection. Any open streams will stop.
+func (c *EgressClient) Close() error {
+	return c.conn.Close()
+}
+
+// EnvelopeReceiver returns envelopes one at a time. It blocks until its
+// context is done or an envelope is available.
+type EnvelopeReceiver func() *loggregator_v2.Envelope
+
+// Receiver returns a new EnvelopeReceiver for the given context and request.
+// The selectors on the request determine which envelopes are received. The
+// lifecycle of the EnvelopeReceiver is managed by the given context. If the
+// underlying gRPC stream dies, it attempts to reconnect until the context is
+// done, at which point the EnvelopeReceiver returns nil.
+func (c *EgressClient) Receiver(ctx context.Context, req *loggregator_v2.EgressRequest) EnvelopeReceiver {
+	b := backoff.New(c.minBackoff, c.maxBackoff)
+	var rx loggregator_v2.Egress_ReceiverClient
+
+	return func() *loggregator_v2.Envelope {
+		for {
+			if rx == nil {
+				var err error
+				rx, err = c.client.Receiver(ctx, req)
+				if err != nil {
+					c.log.Printf("Error connecting to Logs Provider: %s", err)
+					if !b.Wait(ctx) {
+						return nil
+					}
+					continue
+				}
+			}
+
+			e, err := rx.Recv()
+			if err != nil {
+				rx = nil
+				if ctx.Err() != nil {
+					return nil
+				}
+				c.log.Printf("Error receiving from Logs Provider: %s", err)
+				if !b.Wait(ctx) {
+					return nil
+				}
+				continue
+			}
+			b.Reset()
+
+			return e
+		}
+	}
+}
+
+// BatchedReceiver returns a new EnvelopeStream for the given context and
+// request. The selectors on the request determine which envelopes are
+// received. The lifecycle of the EnvelopeStream is managed by the given
+// context. If the underlying gRPC stream dies, it attempts to reconnect until
+// the context is done, at which point the EnvelopeStream returns nil.
+func (c *EgressClient) BatchedReceiver(ctx context.Context, req *loggregator_v2.EgressBatchRequest) EnvelopeStream {
+	b := backoff.New(c.minBackoff, c.maxBackoff)
+	var rx loggregator_v2.Egress_BatchedReceiverClient
+
+	return func() []*loggregator_v2.Envelope {
+		for {
+			if rx == nil {
+				var err error
+				rx, err = c.client.BatchedReceiver(ctx, req)
+				if err != nil {
+					c.log.Printf("Error connecting to Logs Provider: %s", err)
+					if !b.Wait(ctx) {
+						return nil
+					}
+					continue
+				}
+			}
+
+			batch, err := rx.Recv()
+			if err != nil {
+				rx = nil
+				if ctx.Err() != nil {
+					return nil
+				}
+				c.log.Printf("Error receiving from Logs Provider: %s", err)
+				if !b.Wait(ctx) {
+					return nil
+				}
+				continue
+			}
+			b.Reset()
+
+			return batch.Batch
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package loggregator_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/gogo/protobuf/proto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EgressClient", func() {
+	var (
+		producer *fakeEventProducer
+		client   *loggregator.EgressClient
+	)
+
+	BeforeEach(func() {
+		var err error
+		producer, err = newFakeEventProducer()
+		Expect(err).NotTo(HaveOccurred())
+		producer.start()
+
+		tlsConf, err := NewClientMutualTLSConfig(
+			fixture("server.crt"),
+			fixture("server.key"),
+			fixture("CA.crt"),
+			"metron",
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		client, err = loggregator.NewEgressClient(
+			producer.addr,
+			tlsConf,
+			loggregator.WithEgressBackoff(10*time.Millisecond, 100*time.Millisecond),
+		)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		client.Close()
+		producer.stop()
+	})
+
+	It("receives envelopes one at a time", func() {
+		req := &loggregator_v2.EgressRequest{
+			ShardId: "some-id",
+			Selectors: []*loggregator_v2.Selector{
+				{
+					SourceId: "some-source-id",
+					Message: &loggregator_v2.Selector_Log{
+						Log: &loggregator_v2.LogSelector{},
+					},
+				},
+			},
+		}
+		rx := client.Receiver(context.Background(), req)
+
+		Expect(rx()).NotTo(BeNil())
+		Expect(proto.Equal(producer.actualReceiverReq(), req)).To(BeTrue())
+	})
+
+	It("receives batches of envelopes", func() {
+		req := &loggregator_v2.EgressBatchRequest{ShardId: "some-id"}
+		rx := client.BatchedReceiver(context.Background(), req)
+
+		Expect(rx()).NotTo(BeEmpty())
+		Expect(proto.Equal(producer.actualReq(), req)).To(BeTrue())
+	})
+
+	It("reconnects if the stream fails", func() {
+		go func() {
+			rx := client.BatchedReceiver(context.Background(), &loggregator_v2.EgressBatchRequest{})
+			for {
+				rx()
+			}
+		}()
+
+		Eventually(producer.connectionAttempts).Should(Equal(1))
+		producer.stop()
+		producer.start()
+		defer producer.stop()
+
+		Eventually(producer.connectionAttempts, 5).Should(Equal(2))
+		Consistently(producer.connectionAttempts).Should(Equal(2))
+	})
+
+	It("backs off when every stream fails", func() {
+		producer.failStreams(errors.New("stream failed"))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			rx := client.BatchedReceiver(ctx, &loggregator_v2.EgressBatchRequest{})
+			rx()
+		}()
+
+		Eventually(producer.connectionAttempts).Should(BeNumerically(">", 1))
+		Consistently(producer.connectionAttempts, 500*time.Millisecond).Should(BeNumerically("<", 20))
+
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("returns nil once the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		rx := client.Receiver(ctx, &loggregator_v2.EgressRequest{})
+		Expect(rx()).NotTo(BeNil())
+
+		cancel()
+
+		Eventually(rx).Should(BeNil())
+	})
+})
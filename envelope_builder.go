@@ -0,0 +1,127 @@
+package loggregator
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// EnvelopeBuilder constructs arbitrary v2 envelopes for use with
+// IngressClient.Emit. Setting a message (e.g. SetLog) replaces any message
+// that was set before. It should be created with the NewEnvelope
+// constructor.
+type EnvelopeBuilder struct {
+	e *loggregator_v2.Envelope
+}
+
+// NewEnvelope returns an EnvelopeBuilder for an envelope with the current
+// time as its timestamp.
+func NewEnvelope() *EnvelopeBuilder {
+	return &EnvelopeBuilder{
+		e: &loggregator_v2.Envelope{
+			Timestamp: time.Now().UnixNano(),
+			Tags:      make(map[string]string),
+		},
+	}
+}
+
+// SetTimestamp sets the envelope's timestamp.
+func (b *EnvelopeBuilder) SetTimestamp(t time.Time) *EnvelopeBuilder {
+	b.e.Timestamp = t.UnixNano()
+	return b
+}
+
+// SetSourceInfo sets the envelope's source ID and instance ID.
+func (b *EnvelopeBuilder) SetSourceInfo(sourceID, instanceID string) *EnvelopeBuilder {
+	b.e.SourceId = sourceID
+	b.e.InstanceId = instanceID
+	return b
+}
+
+// SetLog makes the envelope a log with the given payload and type.
+func (b *EnvelopeBuilder) SetLog(payload []byte, t loggregator_v2.Log_Type) *EnvelopeBuilder {
+	b.e.Message = &loggregator_v2.Envelope_Log{
+		Log: &loggregator_v2.Log{
+			Payload: payload,
+			Type:    t,
+		},
+	}
+	return b
+}
+
+// SetCounter makes the envelope a counter with the given delta and total.
+func (b *EnvelopeBuilder) SetCounter(name string, delta, total uint64) *EnvelopeBuilder {
+	b.e.Message = &loggregator_v2.Envelope_Counter{
+		Counter: &loggregator_v2.Counter{
+			Name:  name,
+			Delta: delta,
+			Total: total,
+		},
+	}
+	return b
+}
+
+// SetGauge makes the envelope a gauge and adds the given metric to it. It
+// may be called several times to add multiple metrics to the same gauge.
+func (b *EnvelopeBuilder) SetGauge(name string, value float64, unit string) *EnvelopeBuilder {
+	g := b.e.GetGauge()
+	if g == nil {
+		g = &loggregator_v2.Gauge{
+			Metrics: make(map[string]*loggregator_v2.GaugeValue),
+		}
+		b.e.Message = &loggregator_v2.Envelope_Gauge{Gauge: g}
+	}
+
+	g.Metrics[name] = &loggregator_v2.GaugeValue{
+		Value: value,
+		Unit:  unit,
+	}
+	return b
+}
+
+// SetTimer makes the envelope a timer spanning start to stop.
+func (b *EnvelopeBuilder) SetTimer(name string, start, stop time.Time) *EnvelopeBuilder {
+	b.e.Message = &loggregator_v2.Envelope_Timer{
+		Timer: &loggregator_v2.Timer{
+			Name:  name,
+			Start: start.UnixNano(),
+			Stop:  stop.UnixNano(),
+		},
+	}
+	return b
+}
+
+// SetEvent makes the envelope an event with the given title and body.
+func (b *EnvelopeBuilder) SetEvent(title, body string) *EnvelopeBuilder {
+	b.e.Message = &loggregator_v2.Envelope_Event{
+		Event: &loggregator_v2.Event{
+			Title: title,
+			Body:  body,
+		},
+	}
+	return b
+}
+
+// SetTag sets a single tag on the envelope.
+func (b *EnvelopeBuilder) SetTag(name, value string) *EnvelopeBuilder {
+	b.e.Tags[name] = value
+	return b
+}
+
+// SetTags sets the given tags on the envelope. Existing tags with other
+// names are kept.
+func (b *EnvelopeBuilder) SetTags(tags map[string]string) *EnvelopeBuilder {
+	for name, value := range tags {
+		b.e.Tags[name] = value
+	}
+	return b
+}
+
+// Build returns the envelope. The builder may be used again afterwards, e.g.
+// as a template for similar envelopes, without affecting envelopes that have
+// already been built.
+func (b *EnvelopeBuilder) Build() *loggregator_v2.Envelope {
+	return proto.Clone(b.e).(*loggregator_v2.Envelope)
+}
@@ -0,0 +1,81 @@
+package loggregator_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EnvelopeBuilder", func() {
+	It("builds a log envelope", func() {
+		ts := time.Unix(0, 12345)
+		e := loggregator.NewEnvelope().
+			SetTimestamp(ts).
+			SetSourceInfo("source-id", "instance-id").
+			SetLog([]byte("message"), loggregator_v2.Log_OUT).
+			SetTag("a", "1").
+			SetTags(map[string]string{"b": "2"}).
+			Build()
+
+		Expect(e.GetTimestamp()).To(Equal(int64(12345)))
+		Expect(e.GetSourceId()).To(Equal("source-id"))
+		Expect(e.GetInstanceId()).To(Equal("instance-id"))
+		Expect(e.GetLog().GetPayload()).To(Equal([]byte("message")))
+		Expect(e.GetLog().GetType()).To(Equal(loggregator_v2.Log_OUT))
+		Expect(e.GetTags()).To(Equal(map[string]string{"a": "1", "b": "2"}))
+	})
+
+	It("defaults the timestamp to now", func() {
+		e := loggregator.NewEnvelope().Build()
+
+		Expect(time.Unix(0, e.GetTimestamp())).To(BeTemporally("~", time.Now(), time.Second))
+	})
+
+	It("builds metric envelopes", func() {
+		counter := loggregator.NewEnvelope().SetCounter("counter", 1, 2).Build()
+		Expect(counter.GetCounter().GetName()).To(Equal("counter"))
+		Expect(counter.GetCounter().GetDelta()).To(Equal(uint64(1)))
+		Expect(counter.GetCounter().GetTotal()).To(Equal(uint64(2)))
+
+		gauge := loggregator.NewEnvelope().
+			SetGauge("a", 1, "unit-a").
+			SetGauge("b", 2, "unit-b").
+			Build()
+		Expect(gauge.GetGauge().GetMetrics()).To(HaveLen(2))
+		Expect(gauge.GetGauge().GetMetrics()["b"].GetValue()).To(Equal(2.0))
+		Expect(gauge.GetGauge().GetMetrics()["b"].GetUnit()).To(Equal("unit-b"))
+
+		start, stop := time.Unix(0, 1), time.Unix(0, 2)
+		timer := loggregator.NewEnvelope().SetTimer("timer", start, stop).Build()
+		Expect(timer.GetTimer().GetName()).To(Equal("timer"))
+		Expect(timer.GetTimer().GetStart()).To(Equal(int64(1)))
+		Expect(timer.GetTimer().GetStop()).To(Equal(int64(2)))
+
+		event := loggregator.NewEnvelope().SetEvent("title", "body").Build()
+		Expect(event.GetEvent().GetTitle()).To(Equal("title"))
+		Expect(event.GetEvent().GetBody()).To(Equal("body"))
+	})
+
+	It("replaces the message when a different one is set", func() {
+		e := loggregator.NewEnvelope().
+			SetGauge("a", 1, "unit").
+			SetEvent("title", "body").
+			Build()
+
+		Expect(e.GetGauge()).To(BeNil())
+		Expect(e.GetEvent()).ToNot(BeNil())
+	})
+
+	It("can be reused after building", func() {
+		b := loggregator.NewEnvelope().SetTag("a", "1")
+		first := b.Build()
+		second := b.SetTag("b", "2").Build()
+
+		Expect(first.GetTags()).To(Equal(map[string]string{"a": "1"}))
+		Expect(second.GetTags()).To(Equal(map[string]string{"a": "1", "b": "2"}))
+	})
+})
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	gendiodes "code.cloudfoundry.org/go-diodes"
+	"code.cloudfoundry.org/go-loggregator/internal/backoff"
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -27,6 +28,8 @@ type EnvelopeStreamConnector struct {
 
 	log         Logger
 	dialOptions []grpc.DialOption
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
 }
 
 // NewEnvelopeStreamConnector creates a new EnvelopeStreamConnector. Its TLS
@@ -41,7 +44,9 @@ func NewEnvelopeStreamConnector(
 		addr:    addr,
 		tlsConf: t,
 
-		log: log.New(ioutil.Discard, "", 0),
+		log:        log.New(ioutil.Discard, "", 0),
+		minBackoff: 50 * time.Millisecond,
+		maxBackoff: 50 * time.Millisecond,
 	}
 
 	for _, o := range opts {
@@ -70,6 +75,16 @@ func WithEnvelopeStreamConnectorDialOptions(opts ...grpc.DialOption) EnvelopeStr
 	}
 }
 
+// WithEnvelopeStreamBackoff configures the delays used between attempts to
+// reconnect a stream. The delay starts at min and doubles on every failed
+// attempt until it reaches max. It defaults to a constant 50 milliseconds.
+func WithEnvelopeStreamBackoff(min, max time.Duration) EnvelopeStreamOption {
+	return func(c *EnvelopeStreamConnector) {
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
 // WithEnvelopeStreamBuffer enables the EnvelopeStream to read more quickly
 // from the stream. It puts each envelope in a buffer that overwrites data if
 // it is not being drained quick enough. If the buffer drops data, the
@@ -87,10 +102,11 @@ type EnvelopeStream func() []*loggregator_v2.Envelope
 
 // Stream returns a new EnvelopeStream for the given context and request. The
 // lifecycle of the EnvelopeStream is managed by the given context. If the
-// underlying gRPC stream dies, it attempts to reconnect until the context
-// is done.
+// underlying gRPC stream dies, it attempts to reconnect with a backoff until
+// the context is done.
 func (c *EnvelopeStreamConnector) Stream(ctx context.Context, req *loggregator_v2.EgressBatchRequest) EnvelopeStream {
 	s := newStream(ctx, c.addr, req, c.tlsConf, c.dialOptions, c.log)
+	s.backoff = backoff.New(c.minBackoff, c.maxBackoff)
 	if c.alerter != nil || c.bufferSize > 0 {
 		d := NewOneToOneEnvelopeBatch(
 			c.bufferSize,
@@ -116,11 +132,12 @@ func (c *EnvelopeStreamConnector) Stream(ctx context.Context, req *loggregator_v
 }
 
 type stream struct {
-	log    Logger
-	ctx    context.Context
-	req    *loggregator_v2.EgressBatchRequest
-	client loggregator_v2.EgressClient
-	rx     loggregator_v2.Egress_BatchedReceiverClient
+	log     Logger
+	backoff *backoff.Backoff
+	ctx     context.Context
+	req     *loggregator_v2.EgressBatchRequest
+	client  loggregator_v2.EgressClient
+	rx      loggregator_v2.Egress_BatchedReceiverClient
 }
 
 func newStream(
@@ -170,8 +187,10 @@ func (s *stream) recv() []*loggregator_v2.Envelope {
 		batch, err := s.rx.Recv()
 		if err != nil {
 			s.rx = nil
+			s.backoff.Wait(s.ctx)
 			continue
 		}
+		s.backoff.Reset()
 
 		return batch.Batch
 	}
@@ -195,7 +214,7 @@ func (s *stream) connect(ctx context.Context) bool {
 
 			if err != nil {
 				s.log.Printf("Error connecting to Logs Provider: %s", err)
-				time.Sleep(50 * time.Millisecond)
+				s.backoff.Wait(ctx)
 				continue
 			}
 
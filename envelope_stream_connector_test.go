@@ -10,10 +10,10 @@ import (
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 
 	"code.cloudfoundry.org/go-loggregator"
@@ -91,6 +91,38 @@ var _ = Describe("Connector", func() {
 		Consistently(producer.connectionAttempts).Should(Equal(2))
 	})
 
+	It("backs off between failed reconnects", func() {
+		tlsConf, err := NewClientMutualTLSConfig(
+			fixture("server.crt"),
+			fixture("server.key"),
+			fixture("CA.crt"),
+			"metron",
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		var attempts int64
+		failingInterceptor := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			atomic.AddInt64(&attempts, 1)
+			return nil, errors.New("some-error")
+		}
+
+		c := loggregator.NewEnvelopeStreamConnector(
+			"127.0.0.1:0",
+			tlsConf,
+			loggregator.WithEnvelopeStreamConnectorDialOptions(grpc.WithStreamInterceptor(failingInterceptor)),
+			loggregator.WithEnvelopeStreamBackoff(10*time.Millisecond, time.Second),
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go c.Stream(ctx, &loggregator_v2.EgressBatchRequest{})()
+
+		Eventually(func() int64 { return atomic.LoadInt64(&attempts) }).Should(BeNumerically(">=", 3))
+		Consistently(func() int64 {
+			return atomic.LoadInt64(&attempts)
+		}, 500*time.Millisecond).Should(BeNumerically("<", 8))
+	})
+
 	It("enables buffering", func() {
 		producer, err := newFakeEventProducer()
 		Expect(err).NotTo(HaveOccurred())
@@ -156,6 +188,8 @@ type fakeEventProducer struct {
 	mu                  sync.Mutex
 	connectionAttempts_ int
 	actualReq_          *loggregator_v2.EgressBatchRequest
+	actualReceiverReq_  *loggregator_v2.EgressRequest
+	streamErr_          error
 }
 
 func newFakeEventProducer() (*fakeEventProducer, error) {
@@ -165,11 +199,34 @@ func newFakeEventProducer() (*fakeEventProducer, error) {
 }
 
 func (f *fakeEventProducer) Receiver(
-	*loggregator_v2.EgressRequest,
-	loggregator_v2.Egress_ReceiverServer,
+	req *loggregator_v2.EgressRequest,
+	srv loggregator_v2.Egress_ReceiverServer,
 ) error {
-
-	return grpc.Errorf(codes.Unimplemented, "use BatchedReceiver instead")
+	f.mu.Lock()
+	f.connectionAttempts_++
+	f.actualReceiverReq_ = req
+	err := f.streamErr_
+	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	var i int
+	for range time.Tick(10 * time.Millisecond) {
+		err = srv.Send(&loggregator_v2.Envelope{
+			SourceId: fmt.Sprintf("envelope-%d", i),
+			Message: &loggregator_v2.Envelope_Event{
+				Event: &loggregator_v2.Event{
+					Title: "event-name",
+					Body:  "event-body",
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		i++
+	}
+	return nil
 }
 
 func (f *fakeEventProducer) BatchedReceiver(
@@ -179,7 +236,11 @@ func (f *fakeEventProducer) BatchedReceiver(
 	f.mu.Lock()
 	f.connectionAttempts_++
 	f.actualReq_ = req
+	err := f.streamErr_
 	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
 	var i int
 	for range time.Tick(10 * time.Millisecond) {
 		srv.Send(&loggregator_v2.EnvelopeBatch{
@@ -252,6 +313,19 @@ func (f *fakeEventProducer) actualReq() *loggregator_v2.EgressBatchRequest {
 	return f.actualReq_
 }
 
+func (f *fakeEventProducer) actualReceiverReq() *loggregator_v2.EgressRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.actualReceiverReq_
+}
+
+// failStreams makes every later stream fail at once with the given error.
+func (f *fakeEventProducer) failStreams(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.streamErr_ = err
+}
+
 func (f *fakeEventProducer) connectionAttempts() int {
 	f.mu.Lock()
 	defer f.mu.Unlock()
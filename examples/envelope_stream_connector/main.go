@@ -10,34 +10,6 @@ import (
 	loggregator "code.cloudfoundry.org/go-loggregator"
 )
 
-var allSelectors = []*loggregator_v2.Selector{
-	{
-		Message: &loggregator_v2.Selector_Log{
-			Log: &loggregator_v2.LogSelector{},
-		},
-	},
-	{
-		Message: &loggregator_v2.Selector_Counter{
-			Counter: &loggregator_v2.CounterSelector{},
-		},
-	},
-	{
-		Message: &loggregator_v2.Selector_Gauge{
-			Gauge: &loggregator_v2.GaugeSelector{},
-		},
-	},
-	{
-		Message: &loggregator_v2.Selector_Timer{
-			Timer: &loggregator_v2.TimerSelector{},
-		},
-	},
-	{
-		Message: &loggregator_v2.Selector_Event{
-			Event: &loggregator_v2.EventSelector{},
-		},
-	},
-}
-
 func main() {
 	tlsConfig, err := loggregator.NewEgressTLSConfig(
 		os.Getenv("CA_CERT_PATH"),
@@ -57,7 +29,7 @@ func main() {
 
 	rx := streamConnector.Stream(context.Background(), &loggregator_v2.EgressBatchRequest{
 		ShardId:   os.Getenv("SHARD_ID"),
-		Selectors: allSelectors,
+		Selectors: loggregator.AllSelectors(),
 	})
 
 	for {
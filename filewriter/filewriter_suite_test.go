@@ -0,0 +1,13 @@
+package filewriter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFilewriter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "File Writer Suite")
+}
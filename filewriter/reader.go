@@ -0,0 +1,119 @@
+package filewriter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/protobuf/proto"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// maxEnvelopeBytes is the size of the largest envelope a Reader accepts, to
+// guard against corrupt length prefixes.
+const maxEnvelopeBytes = 64 * 1024 * 1024
+
+// Reader reads the envelopes of a file written by a Writer.
+type Reader struct {
+	r      *bufio.Reader
+	ndjson bool
+	closer io.Closer
+}
+
+// NewReader returns a Reader for envelopes in the length prefixed protobuf
+// format.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// NewNDJSONReader returns a Reader for envelopes in the newline delimited
+// JSON format.
+func NewNDJSONReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r), ndjson: true}
+}
+
+// Open opens a file written by a Writer, choosing its format by its
+// extension. The Reader must be closed.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewReader(f)
+	if filepath.Ext(path) == NDJSONExt {
+		r = NewNDJSONReader(f)
+	}
+	r.closer = f
+
+	return r, nil
+}
+
+// Next returns the next envelope. It returns io.EOF once every envelope has
+// been read, and io.ErrUnexpectedEOF if the file ends within an envelope,
+// e.g. because it was being written when it was read.
+func (r *Reader) Next() (*loggregator_v2.Envelope, error) {
+	if r.ndjson {
+		return r.nextJSON()
+	}
+
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxEnvelopeBytes {
+		return nil, fmt.Errorf("envelope of %d bytes is too large", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	var e loggregator_v2.Envelope
+	if err := proto.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (r *Reader) nextJSON() (*loggregator_v2.Envelope, error) {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if len(line) > 0 && err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) == 1 {
+			continue
+		}
+
+		var e loggregator_v2.Envelope
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, err
+		}
+
+		return &e, nil
+	}
+}
+
+// Close closes the file of a Reader returned by Open. It does nothing for
+// other readers.
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
@@ -0,0 +1,287 @@
+// Package filewriter appends envelopes to rotating files in a directory,
+// as a durable local archive or to capture envelopes for debugging and
+// replay. Its Writer is a loggregator.BatchWriter, so it is used through an
+// IngressClient:
+//
+//	w, err := filewriter.New("/var/vcap/data/envelopes")
+//	...
+//	client, err := loggregator.NewIngressClient(nil, loggregator.WithBatchWriter(w))
+//
+// Envelopes are written as protobuf, each preceded by its length as a
+// varint, which is the delimited format of other protobuf libraries, or as
+// newline delimited JSON with WithNDJSON.
+package filewriter
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+const (
+	filePrefix = "envelopes-"
+
+	// timeFormat sorts in time order, so that file names sort in the order
+	// the files were created.
+	timeFormat = "20060102T150405.000000000Z"
+
+	// ProtobufExt and NDJSONExt are the extensions of the files written in
+	// each format.
+	ProtobufExt = ".pb"
+	NDJSONExt   = ".ndjson"
+)
+
+// Option is a function type that is used to configure optional settings for
+// a Writer.
+type Option func(*Writer)
+
+// WithNDJSON writes envelopes as newline delimited JSON, in the format of
+// the RLP gateway (see loggregator_v2.Envelope.MarshalJSON), instead of as
+// length prefixed protobuf.
+func WithNDJSON() Option {
+	return func(w *Writer) {
+		w.ndjson = true
+	}
+}
+
+// WithMaxFileSize starts a new file once the current one has reached n
+// bytes. It defaults to 100 MiB.
+func WithMaxFileSize(n int64) Option {
+	return func(w *Writer) {
+		w.maxSize = n
+	}
+}
+
+// WithMaxFileAge starts a new file once the current one is older than d.
+// By default files are only rotated by size.
+func WithMaxFileAge(d time.Duration) Option {
+	return func(w *Writer) {
+		w.maxFileAge = d
+	}
+}
+
+// WithMaxFiles keeps at most n files, including the current one, removing
+// the oldest when a new file is started. It defaults to 10. Zero keeps every
+// file.
+func WithMaxFiles(n int) Option {
+	return func(w *Writer) {
+		w.maxFiles = n
+	}
+}
+
+// WithRetention removes files that were last written more than d ago when a
+// new file is started. By default files are kept regardless of their age.
+func WithRetention(d time.Duration) Option {
+	return func(w *Writer) {
+		w.retention = d
+	}
+}
+
+// Writer is a loggregator.BatchWriter that appends envelopes to files in a
+// directory. The directory should not be shared with other Writers. It is
+// safe for concurrent use.
+type Writer struct {
+	dir        string
+	ndjson     bool
+	maxSize    int64
+	maxFileAge time.Duration
+	maxFiles   int
+	retention  time.Duration
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	created time.Time
+}
+
+// New returns a Writer that writes files to dir, creating it if needed.
+func New(dir string, opts ...Option) (*Writer, error) {
+	w := &Writer{
+		dir:      dir,
+		maxSize:  100 * 1024 * 1024,
+		maxFiles: 10,
+	}
+
+	for _, o := range opts {
+		o(w)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Write implements loggregator.BatchWriter. The batch is appended to the
+// current file in a single write, starting a new file first if the current
+// one is due to be rotated.
+func (w *Writer) Write(_ context.Context, batch []*loggregator_v2.Envelope) error {
+	var buf bytes.Buffer
+	for _, e := range batch {
+		if err := w.encode(&buf, e); err != nil {
+			return err
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil || w.due() {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.f.Write(buf.Bytes())
+	w.size += int64(n)
+
+	return err
+}
+
+// Close closes the current file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+
+	err := w.f.Close()
+	w.f = nil
+
+	return err
+}
+
+func (w *Writer) encode(buf *bytes.Buffer, e *loggregator_v2.Envelope) error {
+	if w.ndjson {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+		return nil
+	}
+
+	data, err := proto.Marshal(e)
+	if err != nil {
+		return err
+	}
+	buf.Write(proto.EncodeVarint(uint64(len(data))))
+	buf.Write(data)
+
+	return nil
+}
+
+// due reports whether the current file has reached its maximum size or
+// age.
+func (w *Writer) due() bool {
+	if w.maxSize > 0 && w.size >= w.maxSize {
+		return true
+	}
+
+	return w.maxFileAge > 0 && time.Since(w.created) >= w.maxFileAge
+}
+
+// rotate closes the current file, starts a new one and removes old files.
+func (w *Writer) rotate() error {
+	if w.f != nil {
+		if err := w.f.Close(); err != nil {
+			return err
+		}
+		w.f = nil
+	}
+
+	now := time.Now()
+	name := filePrefix + now.UTC().Format(timeFormat) + w.ext()
+	f, err := os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w.f, w.size, w.created = f, 0, now
+
+	return w.removeOld(name)
+}
+
+// removeOld removes the files beyond the maximum number of files and those
+// older than the retention period. current is never removed.
+func (w *Writer) removeOld(current string) error {
+	files, err := Files(w.dir)
+	if err != nil {
+		return err
+	}
+
+	var keep []string
+	for _, path := range files {
+		if filepath.Base(path) == current {
+			continue
+		}
+
+		if w.retention > 0 {
+			info, err := os.Stat(path)
+			if err == nil && time.Since(info.ModTime()) > w.retention {
+				if err := os.Remove(path); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		keep = append(keep, path)
+	}
+
+	if w.maxFiles <= 0 {
+		return nil
+	}
+	for len(keep) >= w.maxFiles {
+		if err := os.Remove(keep[0]); err != nil {
+			return err
+		}
+		keep = keep[1:]
+	}
+
+	return nil
+}
+
+func (w *Writer) ext() string {
+	if w.ndjson {
+		return NDJSONExt
+	}
+	return ProtobufExt
+}
+
+// Files returns the paths of the files written to dir by a Writer, oldest
+// first.
+func Files(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, filePrefix) {
+			continue
+		}
+		if ext := filepath.Ext(name); ext != ProtobufExt && ext != NDJSONExt {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
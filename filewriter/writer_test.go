@@ -0,0 +1,202 @@
+package filewriter_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-loggregator/filewriter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Writer", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "filewriter")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	logs := func(payloads ...string) []*loggregator_v2.Envelope {
+		var batch []*loggregator_v2.Envelope
+		for _, p := range payloads {
+			batch = append(batch, &loggregator_v2.Envelope{
+				SourceId: "app",
+				Message: &loggregator_v2.Envelope_Log{
+					Log: &loggregator_v2.Log{Payload: []byte(p)},
+				},
+			})
+		}
+		return batch
+	}
+
+	files := func() []string {
+		paths, err := filewriter.Files(dir)
+		Expect(err).ToNot(HaveOccurred())
+		return paths
+	}
+
+	It("writes length prefixed protobuf envelopes", func() {
+		w, err := filewriter.New(dir)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(w.Write(context.Background(), logs("one", "two"))).To(Succeed())
+		Expect(w.Close()).To(Succeed())
+
+		Expect(files()).To(HaveLen(1))
+		Expect(files()[0]).To(HaveSuffix(filewriter.ProtobufExt))
+		data, err := ioutil.ReadFile(files()[0])
+		Expect(err).ToNot(HaveOccurred())
+
+		var payloads []string
+		for len(data) > 0 {
+			size, n := proto.DecodeVarint(data)
+			Expect(n).ToNot(BeZero())
+			data = data[n:]
+
+			var e loggregator_v2.Envelope
+			Expect(proto.Unmarshal(data[:size], &e)).To(Succeed())
+			payloads = append(payloads, string(e.GetLog().GetPayload()))
+			data = data[size:]
+		}
+		Expect(payloads).To(Equal([]string{"one", "two"}))
+	})
+
+	It("writes newline delimited JSON", func() {
+		w, err := filewriter.New(dir, filewriter.WithNDJSON())
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(w.Write(context.Background(), logs("one", "two"))).To(Succeed())
+		Expect(w.Close()).To(Succeed())
+
+		Expect(files()[0]).To(HaveSuffix(filewriter.NDJSONExt))
+		data, err := ioutil.ReadFile(files()[0])
+		Expect(err).ToNot(HaveOccurred())
+
+		s := bufio.NewScanner(bytes.NewReader(data))
+		var payloads []string
+		for s.Scan() {
+			var e loggregator_v2.Envelope
+			Expect(json.Unmarshal(s.Bytes(), &e)).To(Succeed())
+			payloads = append(payloads, string(e.GetLog().GetPayload()))
+		}
+		Expect(payloads).To(Equal([]string{"one", "two"}))
+	})
+
+	It("rotates files by size and keeps the newest", func() {
+		w, err := filewriter.New(dir,
+			filewriter.WithMaxFileSize(1),
+			filewriter.WithMaxFiles(2),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer w.Close()
+
+		for _, p := range []string{"one", "two", "three"} {
+			Expect(w.Write(context.Background(), logs(p))).To(Succeed())
+		}
+
+		paths := files()
+		Expect(paths).To(HaveLen(2))
+		data, err := ioutil.ReadFile(paths[1])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(ContainSubstring("three"))
+		data, err = ioutil.ReadFile(paths[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(ContainSubstring("two"))
+	})
+
+	It("rotates files by age and removes expired files", func() {
+		w, err := filewriter.New(dir,
+			filewriter.WithMaxFileAge(10*time.Millisecond),
+			filewriter.WithRetention(time.Hour),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer w.Close()
+
+		Expect(w.Write(context.Background(), logs("one"))).To(Succeed())
+		Expect(w.Write(context.Background(), logs("two"))).To(Succeed())
+		Expect(files()).To(HaveLen(1))
+
+		old := time.Now().Add(-2 * time.Hour)
+		Expect(os.Chtimes(files()[0], old, old)).To(Succeed())
+		time.Sleep(20 * time.Millisecond)
+
+		Expect(w.Write(context.Background(), logs("three"))).To(Succeed())
+		paths := files()
+		Expect(paths).To(HaveLen(1))
+		Expect(filepath.Base(paths[0])).To(HavePrefix("envelopes-"))
+		data, err := ioutil.ReadFile(paths[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(ContainSubstring("three"))
+	})
+})
+
+var _ = Describe("Reader", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "filewriter")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	DescribeTable("reads the envelopes written by a Writer",
+		func(opts ...filewriter.Option) {
+			w, err := filewriter.New(dir, opts...)
+			Expect(err).ToNot(HaveOccurred())
+			batch := []*loggregator_v2.Envelope{
+				{SourceId: "app", Timestamp: 1},
+				{SourceId: "app", Timestamp: 2},
+			}
+			Expect(w.Write(context.Background(), batch)).To(Succeed())
+			Expect(w.Close()).To(Succeed())
+
+			paths, err := filewriter.Files(dir)
+			Expect(err).ToNot(HaveOccurred())
+			r, err := filewriter.Open(paths[0])
+			Expect(err).ToNot(HaveOccurred())
+			defer r.Close()
+
+			for _, expected := range batch {
+				e, err := r.Next()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(proto.Equal(e, expected)).To(BeTrue())
+			}
+			_, err = r.Next()
+			Expect(err).To(Equal(io.EOF))
+		},
+		Entry("protobuf"),
+		Entry("NDJSON", filewriter.WithNDJSON()),
+	)
+
+	It("reports a truncated envelope", func() {
+		data, err := proto.Marshal(&loggregator_v2.Envelope{SourceId: "app"})
+		Expect(err).ToNot(HaveOccurred())
+		prefixed := append(proto.EncodeVarint(uint64(len(data))), data...)
+
+		r := filewriter.NewReader(bytes.NewReader(prefixed[:len(prefixed)-1]))
+		_, err = r.Next()
+		Expect(err).To(Equal(io.ErrUnexpectedEOF))
+	})
+})
@@ -0,0 +1,351 @@
+// Package firehose consumes the v1 Traffic Controller endpoints and converts
+// the received dropsonde envelopes to v2 envelopes. It lets nozzles that
+// still read from the Traffic Controller use the same types as consumers of
+// the Reverse Log Proxy.
+package firehose
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/conversion"
+	"code.cloudfoundry.org/go-loggregator/internal/backoff"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
+)
+
+// Consumer reads from the Traffic Controller. It should be created with the
+// NewConsumer constructor.
+type Consumer struct {
+	addr             string
+	token            string
+	tlsConfig        *tls.Config
+	doer             loggregator.Doer
+	log              *log.Logger
+	usePreferredTags bool
+}
+
+// ConsumerOption configures a Consumer.
+type ConsumerOption func(*Consumer)
+
+// WithAuthToken sets the OAuth token (e.g. "bearer <token>") sent in the
+// Authorization header of every request.
+func WithAuthToken(token string) ConsumerOption {
+	return func(c *Consumer) {
+		c.token = token
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used for websocket connections.
+func WithTLSConfig(t *tls.Config) ConsumerOption {
+	return func(c *Consumer) {
+		c.tlsConfig = t
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for the recent logs and
+// container metrics endpoints. It defaults to the http.DefaultClient.
+func WithHTTPClient(d loggregator.Doer) ConsumerOption {
+	return func(c *Consumer) {
+		c.doer = d
+	}
+}
+
+// WithLogger sets the logger that stream errors are written to. It defaults
+// to a silent logger.
+func WithLogger(l *log.Logger) ConsumerOption {
+	return func(c *Consumer) {
+		c.log = l
+	}
+}
+
+// WithPreferredTags converts envelopes using the preferred tags rather than
+// the deprecated DeprecatedTags field. See conversion.ToV2.
+func WithPreferredTags() ConsumerOption {
+	return func(c *Consumer) {
+		c.usePreferredTags = true
+	}
+}
+
+// NewConsumer returns a Consumer for the Traffic Controller at the given
+// address (e.g. wss://doppler.some-system-domain:443).
+func NewConsumer(addr string, opts ...ConsumerOption) *Consumer {
+	c := &Consumer{
+		addr: strings.TrimSuffix(addr, "/"),
+		doer: http.DefaultClient,
+		log:  log.New(ioutil.Discard, "", 0),
+	}
+
+	for _, o := range opts {
+		o(c)
+	}
+
+	return c
+}
+
+// Stream returns an EnvelopeStream of the logs and metrics of a single
+// application. The lifecycle of the EnvelopeStream is managed by the given
+// context. If the websocket dies, it reconnects with an exponential backoff
+// until the context is done.
+func (c *Consumer) Stream(ctx context.Context, appGUID string) loggregator.EnvelopeStream {
+	return c.stream(ctx, "/apps/"+url.PathEscape(appGUID)+"/stream")
+}
+
+// Firehose returns an EnvelopeStream of every envelope in the platform.
+// Consumers with the same subscription ID share the firehose between them.
+// The lifecycle of the EnvelopeStream is managed by the given context. If
+// the websocket dies, it reconnects with an exponential backoff until the
+// context is done.
+func (c *Consumer) Firehose(ctx context.Context, subscriptionID string) loggregator.EnvelopeStream {
+	return c.stream(ctx, "/firehose/"+url.PathEscape(subscriptionID))
+}
+
+// RecentLogs returns the logs the Traffic Controller holds for an
+// application.
+func (c *Consumer) RecentLogs(ctx context.Context, appGUID string) ([]*loggregator_v2.Envelope, error) {
+	return c.readMultipart(ctx, "/apps/"+url.PathEscape(appGUID)+"/recentlogs")
+}
+
+// ContainerMetrics returns the latest container metrics of each instance of
+// an application.
+func (c *Consumer) ContainerMetrics(ctx context.Context, appGUID string) ([]*loggregator_v2.Envelope, error) {
+	return c.readMultipart(ctx, "/apps/"+url.PathEscape(appGUID)+"/containermetrics")
+}
+
+func (c *Consumer) stream(ctx context.Context, path string) loggregator.EnvelopeStream {
+	es := make(chan *loggregator_v2.Envelope, 100)
+	go func() {
+		defer close(es)
+		b := backoff.New(50*time.Millisecond, 5*time.Second)
+		b.Jitter = true
+		for ctx.Err() == nil {
+			if c.connect(ctx, es, path) {
+				b.Reset()
+			}
+			b.Wait(ctx)
+		}
+	}()
+
+	return func() []*loggregator_v2.Envelope {
+		var batch []*loggregator_v2.Envelope
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case e, ok := <-es:
+				if !ok {
+					return nil
+				}
+				batch = append(batch, e)
+			default:
+				if len(batch) > 0 {
+					return batch
+				}
+
+				time.Sleep(50 * time.Millisecond)
+			}
+		}
+	}
+}
+
+// connect reads envelopes from a single websocket until it dies. It returns
+// true if the websocket was established.
+func (c *Consumer) connect(ctx context.Context, es chan<- *loggregator_v2.Envelope, path string) bool {
+	config, err := websocket.NewConfig(c.wsAddr()+path, "http://localhost")
+	if err != nil {
+		c.log.Printf("failed to build websocket config: %s", err)
+		return false
+	}
+	config.TlsConfig = c.tlsConfig
+	if c.token != "" {
+		config.Header.Set("Authorization", c.token)
+	}
+
+	ws, err := dial(ctx, config)
+	if err != nil {
+		c.log.Printf("error dialing traffic controller: %s", err)
+		return false
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		ws.Close()
+	}()
+
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			if ctx.Err() == nil {
+				c.log.Printf("failed while reading websocket: %s", err)
+			}
+			return true
+		}
+
+		var v1e events.Envelope
+		if err := proto.Unmarshal(data, &v1e); err != nil {
+			c.log.Printf("failed to unmarshal envelope: %s", err)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return true
+		case es <- conversion.ToV2(&v1e, c.usePreferredTags):
+		}
+	}
+}
+
+func (c *Consumer) readMultipart(ctx context.Context, path string) ([]*loggregator_v2.Envelope, error) {
+	req, err := http.NewRequest(http.MethodGet, c.httpAddr()+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", c.token)
+	}
+
+	resp, err := c.doer.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, body)
+	}
+
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	if params["boundary"] == "" {
+		return nil, fmt.Errorf("response has no multipart boundary")
+	}
+
+	var envelopes []*loggregator_v2.Envelope
+	r := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			return envelopes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			continue
+		}
+
+		var v1e events.Envelope
+		if err := proto.Unmarshal(data, &v1e); err != nil {
+			return nil, err
+		}
+
+		envelopes = append(envelopes, conversion.ToV2(&v1e, c.usePreferredTags))
+	}
+}
+
+// dial opens the websocket described by config. Unlike
+// websocket.DialConfig, it gives up once ctx is done, also while the TLS or
+// websocket handshake is in progress.
+func dial(ctx context.Context, config *websocket.Config) (*websocket.Conn, error) {
+	host := config.Location.Host
+	addr := host
+	if config.Location.Port() == "" {
+		addr = net.JoinHostPort(host, "80")
+		if config.Location.Scheme == "wss" {
+			addr = net.JoinHostPort(host, "443")
+		}
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The handshakes do not take a context, so the connection is closed if
+	// ctx is done before they complete.
+	handshaken := make(chan struct{})
+	defer close(handshaken)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-handshaken:
+		}
+	}()
+
+	if config.Location.Scheme == "wss" {
+		tlsConfig := &tls.Config{}
+		if config.TlsConfig != nil {
+			tlsConfig = config.TlsConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = config.Location.Hostname()
+		}
+
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+func (c *Consumer) wsAddr() string {
+	switch {
+	case strings.HasPrefix(c.addr, "https://"):
+		return "wss://" + strings.TrimPrefix(c.addr, "https://")
+	case strings.HasPrefix(c.addr, "http://"):
+		return "ws://" + strings.TrimPrefix(c.addr, "http://")
+	}
+	return c.addr
+}
+
+func (c *Consumer) httpAddr() string {
+	switch {
+	case strings.HasPrefix(c.addr, "wss://"):
+		return "https://" + strings.TrimPrefix(c.addr, "wss://")
+	case strings.HasPrefix(c.addr, "ws://"):
+		return "http://" + strings.TrimPrefix(c.addr, "ws://")
+	}
+	return c.addr
+}
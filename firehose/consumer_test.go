@@ -0,0 +1,192 @@
+package firehose_test
+
+import (
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/firehose"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Consumer", func() {
+	var (
+		server   *httptest.Server
+		paths    chan string
+		auths    chan string
+		consumer *firehose.Consumer
+	)
+
+	BeforeEach(func() {
+		paths = make(chan string, 100)
+		auths = make(chan string, 100)
+
+		streamHandler := websocket.Handler(func(ws *websocket.Conn) {
+			defer ws.Close()
+			for i := 0; i < 3; i++ {
+				websocket.Message.Send(ws, marshal(logMessage("message")))
+			}
+		})
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case paths <- r.URL.Path:
+				auths <- r.Header.Get("Authorization")
+			default:
+			}
+
+			if strings.Contains(r.URL.Path, "missing") {
+				http.NotFound(w, r)
+				return
+			}
+
+			if strings.HasSuffix(r.URL.Path, "/recentlogs") ||
+				strings.HasSuffix(r.URL.Path, "/containermetrics") {
+				mw := multipart.NewWriter(w)
+				w.Header().Set("Content-Type", "multipart/x-protobuf; boundary="+mw.Boundary())
+				for _, msg := range []string{"first", "second"} {
+					part, _ := mw.CreatePart(nil)
+					part.Write(marshal(logMessage(msg)))
+				}
+				mw.Close()
+				return
+			}
+
+			streamHandler.ServeHTTP(w, r)
+		}))
+
+		consumer = firehose.NewConsumer(
+			"ws://"+strings.TrimPrefix(server.URL, "http://"),
+			firehose.WithAuthToken("bearer token"),
+		)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	readEnvelopes := func(es func() []*loggregator_v2.Envelope, n int) []*loggregator_v2.Envelope {
+		var envelopes []*loggregator_v2.Envelope
+		for len(envelopes) < n {
+			envelopes = append(envelopes, es()...)
+		}
+		return envelopes
+	}
+
+	It("streams an application's envelopes as v2 envelopes", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		envelopes := readEnvelopes(consumer.Stream(ctx, "app-guid"), 3)
+
+		Expect(<-paths).To(Equal("/apps/app-guid/stream"))
+		Expect(<-auths).To(Equal("bearer token"))
+		Expect(envelopes[0].GetSourceId()).To(Equal("app-guid"))
+		Expect(envelopes[0].GetLog().GetPayload()).To(Equal([]byte("message")))
+	})
+
+	It("streams the firehose", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		envelopes := readEnvelopes(consumer.Firehose(ctx, "subscription"), 3)
+
+		Expect(<-paths).To(Equal("/firehose/subscription"))
+		for _, e := range envelopes {
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("message")))
+		}
+	})
+
+	It("reconnects when the websocket closes", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		readEnvelopes(consumer.Stream(ctx, "app-guid"), 6)
+
+		Expect(<-paths).To(Equal("/apps/app-guid/stream"))
+		Expect(<-paths).To(Equal("/apps/app-guid/stream"))
+	})
+
+	It("stops dialing when the context is done during the handshake", func() {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer lis.Close()
+
+		accepted := make(chan struct{})
+		closed := make(chan struct{})
+		go func() {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			close(accepted)
+
+			// Never answer the upgrade request, only wait for the
+			// client to hang up.
+			ioutil.ReadAll(conn)
+			close(closed)
+		}()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		es := firehose.NewConsumer("ws://"+lis.Addr().String()).Stream(ctx, "app-guid")
+		Eventually(accepted).Should(BeClosed())
+		cancel()
+
+		Eventually(closed).Should(BeClosed())
+		Expect(es()).To(BeNil())
+	})
+
+	It("reads recent logs", func() {
+		envelopes, err := consumer.RecentLogs(context.Background(), "app-guid")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(<-paths).To(Equal("/apps/app-guid/recentlogs"))
+		Expect(<-auths).To(Equal("bearer token"))
+		Expect(envelopes).To(HaveLen(2))
+		Expect(envelopes[1].GetLog().GetPayload()).To(Equal([]byte("second")))
+	})
+
+	It("reads container metrics", func() {
+		_, err := consumer.ContainerMetrics(context.Background(), "app-guid")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(<-paths).To(Equal("/apps/app-guid/containermetrics"))
+	})
+
+	It("returns an error for non-200 responses", func() {
+		_, err := consumer.RecentLogs(context.Background(), "app-guid/missing")
+		Expect(err).To(MatchError(ContainSubstring("404")))
+	})
+})
+
+func logMessage(msg string) *events.Envelope {
+	return &events.Envelope{
+		Origin:    proto.String("origin"),
+		EventType: events.Envelope_LogMessage.Enum(),
+		LogMessage: &events.LogMessage{
+			Message:     []byte(msg),
+			MessageType: events.LogMessage_OUT.Enum(),
+			Timestamp:   proto.Int64(1),
+			AppId:       proto.String("app-guid"),
+		},
+	}
+}
+
+func marshal(e *events.Envelope) []byte {
+	data, err := proto.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
@@ -0,0 +1,125 @@
+// Package formatter renders envelopes as human readable lines in the style
+// of the cf CLI, e.g.
+//
+//	2019-03-01T12:00:00.00+0000 [APP/PROC/WEB/0] OUT some log message
+//
+// so that tools built on the egress clients print consistent output.
+package formatter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// timeFormat is the timestamp format of the cf CLI.
+const timeFormat = "2006-01-02T15:04:05.00-0700"
+
+// Formatter renders envelopes as text. It should be created with the New
+// constructor.
+type Formatter struct {
+	location *time.Location
+}
+
+// Option configures a Formatter.
+type Option func(*Formatter)
+
+// WithLocation sets the time zone timestamps are rendered in. It defaults
+// to the local time zone.
+func WithLocation(l *time.Location) Option {
+	return func(f *Formatter) {
+		f.location = l
+	}
+}
+
+// New returns a Formatter.
+func New(opts ...Option) *Formatter {
+	f := &Formatter{
+		location: time.Local,
+	}
+
+	for _, o := range opts {
+		o(f)
+	}
+
+	return f
+}
+
+// Format renders the envelope as a single line without a trailing newline.
+// The line starts with the timestamp and the source in brackets, followed
+// by the message:
+//
+//	log:     OUT some log message (ERR for stderr)
+//	counter: COUNTER name:delta total:total
+//	gauge:   GAUGE name=value unit, sorted by name
+//	timer:   TIMER name duration
+//	event:   EVENT title: body
+func (f *Formatter) Format(e *loggregator_v2.Envelope) string {
+	return fmt.Sprintf("%s [%s] %s",
+		time.Unix(0, e.GetTimestamp()).In(f.location).Format(timeFormat),
+		source(e),
+		message(e),
+	)
+}
+
+// source renders the source like the cf CLI does, e.g. APP/PROC/WEB/0. The
+// source type tag is preferred over the source ID.
+func source(e *loggregator_v2.Envelope) string {
+	s := e.GetTags()["source_type"]
+	if s == "" {
+		s = e.GetDeprecatedTags()["source_type"].GetText()
+	}
+	if s == "" {
+		s = e.GetSourceId()
+	}
+
+	if e.GetInstanceId() != "" {
+		s += "/" + e.GetInstanceId()
+	}
+
+	return s
+}
+
+func message(e *loggregator_v2.Envelope) string {
+	switch m := e.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		stream := "OUT"
+		if m.Log.GetType() == loggregator_v2.Log_ERR {
+			stream = "ERR"
+		}
+		return stream + " " + strings.TrimRight(string(m.Log.GetPayload()), "\r\n")
+	case *loggregator_v2.Envelope_Counter:
+		return fmt.Sprintf("COUNTER %s:%d total:%d",
+			m.Counter.GetName(),
+			m.Counter.GetDelta(),
+			m.Counter.GetTotal(),
+		)
+	case *loggregator_v2.Envelope_Gauge:
+		metrics := m.Gauge.GetMetrics()
+		names := make([]string, 0, len(metrics))
+		for name := range metrics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		values := make([]string, 0, len(names))
+		for _, name := range names {
+			v := fmt.Sprintf("%s=%g", name, metrics[name].GetValue())
+			if unit := metrics[name].GetUnit(); unit != "" {
+				v += " " + unit
+			}
+			values = append(values, v)
+		}
+		return "GAUGE " + strings.Join(values, " ")
+	case *loggregator_v2.Envelope_Timer:
+		d := time.Duration(m.Timer.GetStop() - m.Timer.GetStart())
+		return fmt.Sprintf("TIMER %s %s", m.Timer.GetName(), d)
+	case *loggregator_v2.Envelope_Event:
+		return fmt.Sprintf("EVENT %s: %s", m.Event.GetTitle(), m.Event.GetBody())
+	default:
+		return "UNKNOWN"
+	}
+}
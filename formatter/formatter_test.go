@@ -0,0 +1,81 @@
+package formatter_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/formatter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Formatter", func() {
+	var (
+		f  *formatter.Formatter
+		ts = time.Date(2019, 3, 1, 12, 0, 0, 120000000, time.UTC).UnixNano()
+	)
+
+	BeforeEach(func() {
+		f = formatter.New(formatter.WithLocation(time.UTC))
+	})
+
+	DescribeTable("formats envelopes", func(e *loggregator_v2.Envelope, expected string) {
+		e.Timestamp = ts
+		Expect(f.Format(e)).To(Equal(expected))
+	},
+		Entry("stdout logs", &loggregator_v2.Envelope{
+			SourceId:   "some-app",
+			InstanceId: "0",
+			Tags:       map[string]string{"source_type": "APP/PROC/WEB"},
+			Message: &loggregator_v2.Envelope_Log{
+				Log: &loggregator_v2.Log{Payload: []byte("hello\n")},
+			},
+		}, "2019-03-01T12:00:00.12+0000 [APP/PROC/WEB/0] OUT hello"),
+		Entry("stderr logs", &loggregator_v2.Envelope{
+			SourceId: "some-app",
+			DeprecatedTags: map[string]*loggregator_v2.Value{
+				"source_type": {Data: &loggregator_v2.Value_Text{Text: "RTR"}},
+			},
+			Message: &loggregator_v2.Envelope_Log{
+				Log: &loggregator_v2.Log{Payload: []byte("oops"), Type: loggregator_v2.Log_ERR},
+			},
+		}, "2019-03-01T12:00:00.12+0000 [RTR] ERR oops"),
+		Entry("counters", &loggregator_v2.Envelope{
+			SourceId: "some-app",
+			Message: &loggregator_v2.Envelope_Counter{
+				Counter: &loggregator_v2.Counter{Name: "requests", Delta: 5, Total: 120},
+			},
+		}, "2019-03-01T12:00:00.12+0000 [some-app] COUNTER requests:5 total:120"),
+		Entry("gauges", &loggregator_v2.Envelope{
+			SourceId:   "some-app",
+			InstanceId: "1",
+			Message: &loggregator_v2.Envelope_Gauge{
+				Gauge: &loggregator_v2.Gauge{Metrics: map[string]*loggregator_v2.GaugeValue{
+					"memory": {Value: 1024, Unit: "bytes"},
+					"cpu":    {Value: 0.5, Unit: "percentage"},
+					"disk":   {Value: 3},
+				}},
+			},
+		}, "2019-03-01T12:00:00.12+0000 [some-app/1] GAUGE cpu=0.5 percentage disk=3 memory=1024 bytes"),
+		Entry("timers", &loggregator_v2.Envelope{
+			SourceId: "some-app",
+			Message: &loggregator_v2.Envelope_Timer{
+				Timer: &loggregator_v2.Timer{Name: "http", Start: 0, Stop: int64(1500 * time.Millisecond)},
+			},
+		}, "2019-03-01T12:00:00.12+0000 [some-app] TIMER http 1.5s"),
+		Entry("events", &loggregator_v2.Envelope{
+			SourceId: "some-app",
+			Message: &loggregator_v2.Envelope_Event{
+				Event: &loggregator_v2.Event{Title: "crash", Body: "exited with 1"},
+			},
+		}, "2019-03-01T12:00:00.12+0000 [some-app] EVENT crash: exited with 1"),
+	)
+
+	It("renders timestamps in the configured time zone", func() {
+		f = formatter.New(formatter.WithLocation(time.FixedZone("", -5*60*60)))
+
+		Expect(f.Format(&loggregator_v2.Envelope{Timestamp: ts})).To(HavePrefix("2019-03-01T07:00:00.12-0500 "))
+	})
+})
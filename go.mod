@@ -19,7 +19,7 @@ require (
 	github.com/onsi/gomega v1.5.0
 	github.com/poy/eachers v0.0.0-20181020210610-23942921fe77 // indirect
 	golang.org/x/net v0.0.0-20190613194153-d28f0bde5980
-	golang.org/x/sys v0.0.0-20190712062909-fae7ac547cb7 // indirect
+	golang.org/x/sys v0.0.0-20190712062909-fae7ac547cb7
 	google.golang.org/grpc v1.19.1
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
 	gopkg.in/yaml.v2 v2.2.2 // indirect
@@ -0,0 +1,13 @@
+package grpcinterceptor_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestGrpcinterceptor(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Grpcinterceptor Suite")
+}
@@ -0,0 +1,137 @@
+// Package grpcinterceptor instruments gRPC servers with a timer envelope per
+// RPC and counters for failed RPCs, like the httpmiddleware package does for
+// HTTP servers.
+package grpcinterceptor
+
+import (
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Emitter is the interface of the client that envelopes are emitted to. It
+// is satisfied by the IngressClient.
+type Emitter interface {
+	EmitTimer(name string, start, stop time.Time, opts ...loggregator.EmitTimerOption)
+	EmitCounter(name string, opts ...loggregator.EmitCounterOption)
+}
+
+// Option configures the interceptors.
+type Option func(*interceptor)
+
+// WithTimerOptions adds options, e.g. loggregator.WithTimerSourceInfo, to
+// every timer emitted by the interceptors.
+func WithTimerOptions(opts ...loggregator.EmitTimerOption) Option {
+	return func(i *interceptor) {
+		i.timerOpts = append(i.timerOpts, opts...)
+	}
+}
+
+// WithCounterOptions adds options, e.g. loggregator.WithCounterSourceInfo,
+// to every counter emitted by the interceptors.
+func WithCounterOptions(opts ...loggregator.EmitCounterOption) Option {
+	return func(i *interceptor) {
+		i.counterOpts = append(i.counterOpts, opts...)
+	}
+}
+
+// UnaryServerInterceptor returns an interceptor that emits a "grpc" timer
+// spanning each unary RPC and increments the "grpc_errors" counter for each
+// RPC that fails. Both are tagged with the peer_type, method, status_code
+// and remote_address of the RPC. Trace IDs from traceparent or B3 metadata
+// are added to the timer as trace_id and span_id.
+func UnaryServerInterceptor(e Emitter, opts ...Option) grpc.UnaryServerInterceptor {
+	i := newInterceptor(e, opts)
+
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		i.emit(ctx, info.FullMethod, start, err)
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that emits the same
+// envelopes as UnaryServerInterceptor, with the timer spanning the whole
+// stream.
+func StreamServerInterceptor(e Emitter, opts ...Option) grpc.StreamServerInterceptor {
+	i := newInterceptor(e, opts)
+
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		i.emit(ss.Context(), info.FullMethod, start, err)
+
+		return err
+	}
+}
+
+type interceptor struct {
+	emitter     Emitter
+	timerOpts   []loggregator.EmitTimerOption
+	counterOpts []loggregator.EmitCounterOption
+}
+
+func newInterceptor(e Emitter, opts []Option) *interceptor {
+	i := &interceptor{
+		emitter: e,
+	}
+
+	for _, o := range opts {
+		o(i)
+	}
+
+	return i
+}
+
+func (i *interceptor) emit(ctx context.Context, method string, start time.Time, err error) {
+	stop := time.Now()
+
+	tags := map[string]string{
+		"peer_type":   "Server",
+		"method":      method,
+		"status_code": status.Code(err).String(),
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		tags["remote_address"] = p.Addr.String()
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		h := make(http.Header, len(md))
+		for k, v := range md {
+			h[http.CanonicalHeaderKey(k)] = v
+		}
+		ctx = loggregator.ContextWithTraceHeaders(ctx, h)
+	}
+
+	timerOpts := append([]loggregator.EmitTimerOption{
+		loggregator.WithEnvelopeTags(tags),
+		loggregator.WithTraceContext(ctx),
+	}, i.timerOpts...)
+	i.emitter.EmitTimer("grpc", start, stop, timerOpts...)
+
+	if err != nil {
+		counterOpts := append([]loggregator.EmitCounterOption{
+			loggregator.WithDelta(1),
+			loggregator.WithEnvelopeTags(tags),
+		}, i.counterOpts...)
+		i.emitter.EmitCounter("grpc_errors", counterOpts...)
+	}
+}
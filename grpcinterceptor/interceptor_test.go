@@ -0,0 +1,164 @@
+package grpcinterceptor_test
+
+import (
+	"net"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/grpcinterceptor"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Interceptors", func() {
+	var (
+		emitter *spyEmitter
+		ctx     context.Context
+	)
+
+	BeforeEach(func() {
+		emitter = &spyEmitter{}
+		ctx = peer.NewContext(context.Background(), &peer.Peer{
+			Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234},
+		})
+	})
+
+	Describe("UnaryServerInterceptor", func() {
+		var info = &grpc.UnaryServerInfo{FullMethod: "/service/Method"}
+
+		It("emits a timer for each RPC", func() {
+			i := grpcinterceptor.UnaryServerInterceptor(emitter)
+
+			resp, err := i(ctx, "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				time.Sleep(10 * time.Millisecond)
+				return "resp", nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp).To(Equal("resp"))
+
+			Expect(emitter.timers).To(HaveLen(1))
+			timer := emitter.timers[0]
+			Expect(timer.GetTimer().GetName()).To(Equal("grpc"))
+			Expect(timer.GetTimer().GetStop() - timer.GetTimer().GetStart()).To(
+				BeNumerically(">=", int64(10*time.Millisecond)),
+			)
+			Expect(timer.GetTags()).To(Equal(map[string]string{
+				"peer_type":      "Server",
+				"method":         "/service/Method",
+				"status_code":    "OK",
+				"remote_address": "10.0.0.1:1234",
+			}))
+			Expect(emitter.counters).To(BeEmpty())
+		})
+
+		It("counts failed RPCs", func() {
+			i := grpcinterceptor.UnaryServerInterceptor(emitter)
+
+			_, err := i(ctx, "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, status.Error(codes.NotFound, "not found")
+			})
+			Expect(err).To(HaveOccurred())
+
+			Expect(emitter.timers[0].GetTags()).To(HaveKeyWithValue("status_code", "NotFound"))
+			Expect(emitter.counters).To(HaveLen(1))
+			Expect(emitter.counters[0].GetCounter().GetName()).To(Equal("grpc_errors"))
+			Expect(emitter.counters[0].GetCounter().GetDelta()).To(Equal(uint64(1)))
+			Expect(emitter.counters[0].GetTags()).To(HaveKeyWithValue("method", "/service/Method"))
+		})
+
+		It("adds trace IDs from the metadata", func() {
+			i := grpcinterceptor.UnaryServerInterceptor(emitter)
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(
+				"traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			))
+
+			i(ctx, "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, nil
+			})
+
+			Expect(emitter.timers[0].GetTags()).To(HaveKeyWithValue("trace_id", "4bf92f3577b34da6a3ce929d0e0e4736"))
+		})
+
+		It("applies the configured options", func() {
+			i := grpcinterceptor.UnaryServerInterceptor(emitter,
+				grpcinterceptor.WithTimerOptions(loggregator.WithTimerSourceInfo("source-id", "instance-id")),
+				grpcinterceptor.WithCounterOptions(loggregator.WithCounterSourceInfo("source-id", "instance-id")),
+			)
+
+			i(ctx, "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, status.Error(codes.Internal, "failed")
+			})
+
+			Expect(emitter.timers[0].GetSourceId()).To(Equal("source-id"))
+			Expect(emitter.counters[0].GetInstanceId()).To(Equal("instance-id"))
+		})
+	})
+
+	Describe("StreamServerInterceptor", func() {
+		It("emits a timer spanning the stream", func() {
+			i := grpcinterceptor.StreamServerInterceptor(emitter)
+
+			err := i(nil, &spyServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/service/Stream"},
+				func(srv interface{}, ss grpc.ServerStream) error {
+					return status.Error(codes.Unavailable, "unavailable")
+				},
+			)
+			Expect(err).To(HaveOccurred())
+
+			Expect(emitter.timers).To(HaveLen(1))
+			Expect(emitter.timers[0].GetTags()).To(HaveKeyWithValue("method", "/service/Stream"))
+			Expect(emitter.timers[0].GetTags()).To(HaveKeyWithValue("remote_address", "10.0.0.1:1234"))
+			Expect(emitter.counters[0].GetTags()).To(HaveKeyWithValue("status_code", "Unavailable"))
+		})
+	})
+})
+
+type spyServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *spyServerStream) Context() context.Context {
+	return s.ctx
+}
+
+type spyEmitter struct {
+	timers   []*loggregator_v2.Envelope
+	counters []*loggregator_v2.Envelope
+}
+
+func (s *spyEmitter) EmitTimer(name string, start, stop time.Time, opts ...loggregator.EmitTimerOption) {
+	e := &loggregator_v2.Envelope{
+		Message: &loggregator_v2.Envelope_Timer{
+			Timer: &loggregator_v2.Timer{
+				Name:  name,
+				Start: start.UnixNano(),
+				Stop:  stop.UnixNano(),
+			},
+		},
+	}
+	for _, o := range opts {
+		o(e)
+	}
+	s.timers = append(s.timers, e)
+}
+
+func (s *spyEmitter) EmitCounter(name string, opts ...loggregator.EmitCounterOption) {
+	e := &loggregator_v2.Envelope{
+		Message: &loggregator_v2.Envelope_Counter{
+			Counter: &loggregator_v2.Counter{Name: name},
+		},
+	}
+	for _, o := range opts {
+		o(e)
+	}
+	s.counters = append(s.counters, e)
+}
@@ -0,0 +1,153 @@
+// Package httpmiddleware instruments HTTP servers with the envelopes that
+// the gorouter emits for each request, so that any Go HTTP service reports
+// consistent platform metrics.
+package httpmiddleware
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+)
+
+// Emitter is the interface of the client that envelopes are emitted to. It
+// is satisfied by the IngressClient.
+type Emitter interface {
+	EmitTimer(name string, start, stop time.Time, opts ...loggregator.EmitTimerOption)
+	EmitCounter(name string, opts ...loggregator.EmitCounterOption)
+}
+
+// Option configures the middleware.
+type Option func(*handler)
+
+// WithTimerOptions adds options, e.g. loggregator.WithTimerSourceInfo, to
+// every timer emitted by the middleware.
+func WithTimerOptions(opts ...loggregator.EmitTimerOption) Option {
+	return func(h *handler) {
+		h.timerOpts = append(h.timerOpts, opts...)
+	}
+}
+
+// WithCounterOptions adds options, e.g. loggregator.WithCounterSourceInfo,
+// to every counter emitted by the middleware.
+func WithCounterOptions(opts ...loggregator.EmitCounterOption) Option {
+	return func(h *handler) {
+		h.counterOpts = append(h.counterOpts, opts...)
+	}
+}
+
+// Wrap returns a handler that serves requests with next and, for each
+// request, emits an "http" timer spanning the request as well as
+// increments the "total_requests" counter and the counter for the class of
+// the response status (e.g. "responses.2xx").
+//
+// The timer is tagged like the timers of the gorouter: peer_type, method,
+// uri, remote_address, user_agent, status_code, content_length (of the
+// response), request_id (from X-Vcap-Request-Id) and forwarded (from
+// X-Forwarded-For). Trace IDs from traceparent or B3 headers are added as
+// trace_id and span_id.
+func Wrap(next http.Handler, e Emitter, opts ...Option) http.Handler {
+	h := &handler{
+		next:    next,
+		emitter: e,
+	}
+
+	for _, o := range opts {
+		o(h)
+	}
+
+	return h
+}
+
+type handler struct {
+	next        http.Handler
+	emitter     Emitter
+	timerOpts   []loggregator.EmitTimerOption
+	counterOpts []loggregator.EmitCounterOption
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+
+	h.next.ServeHTTP(rw, r)
+
+	stop := time.Now()
+	ctx := loggregator.ContextWithTraceHeaders(r.Context(), r.Header)
+
+	opts := append([]loggregator.EmitTimerOption{
+		loggregator.WithEnvelopeTags(map[string]string{
+			"peer_type":      "Server",
+			"method":         r.Method,
+			"uri":            requestURI(r),
+			"remote_address": r.RemoteAddr,
+			"user_agent":     r.UserAgent(),
+			"status_code":    strconv.Itoa(rw.status),
+			"content_length": strconv.FormatInt(rw.written, 10),
+			"request_id":     r.Header.Get("X-Vcap-Request-Id"),
+			"forwarded":      strings.Join(r.Header["X-Forwarded-For"], "\n"),
+		}),
+		loggregator.WithTraceContext(ctx),
+	}, h.timerOpts...)
+	h.emitter.EmitTimer("http", start, stop, opts...)
+
+	counterOpts := append([]loggregator.EmitCounterOption{loggregator.WithDelta(1)}, h.counterOpts...)
+	h.emitter.EmitCounter("total_requests", counterOpts...)
+	h.emitter.EmitCounter(fmt.Sprintf("responses.%dxx", rw.status/100), counterOpts...)
+}
+
+func requestURI(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+// responseWriter records the status code and the number of bytes written.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	written     int64
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher if the underlying writer does.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the underlying writer does, e.g. for
+// websockets.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	w.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
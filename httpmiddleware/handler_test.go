@@ -0,0 +1,137 @@
+package httpmiddleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/httpmiddleware"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Wrap", func() {
+	var (
+		emitter *spyEmitter
+		handler http.Handler
+	)
+
+	BeforeEach(func() {
+		emitter = &spyEmitter{}
+		handler = httpmiddleware.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(10 * time.Millisecond)
+			w.WriteHeader(http.StatusTeapot)
+			w.Write([]byte("hello"))
+		}), emitter)
+	})
+
+	It("emits an http timer for each request", func() {
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/path?q=1", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("User-Agent", "agent")
+		req.Header.Set("X-Vcap-Request-Id", "request-id")
+		req.Header.Add("X-Forwarded-For", "10.0.0.2")
+		req.Header.Add("X-Forwarded-For", "10.0.0.3")
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusTeapot))
+
+		Expect(emitter.timers).To(HaveLen(1))
+		timer := emitter.timers[0]
+		Expect(timer.GetTimer().GetName()).To(Equal("http"))
+		Expect(timer.GetTimer().GetStop() - timer.GetTimer().GetStart()).To(
+			BeNumerically(">=", int64(10*time.Millisecond)),
+		)
+		Expect(timer.GetTags()).To(Equal(map[string]string{
+			"peer_type":      "Server",
+			"method":         "POST",
+			"uri":            "http://example.com/path?q=1",
+			"remote_address": "10.0.0.1:1234",
+			"user_agent":     "agent",
+			"status_code":    "418",
+			"content_length": "5",
+			"request_id":     "request-id",
+			"forwarded":      "10.0.0.2\n10.0.0.3",
+		}))
+	})
+
+	It("increments the request and response counters", func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		Expect(emitter.counters).To(HaveLen(2))
+		Expect(emitter.counters[0].GetCounter().GetName()).To(Equal("total_requests"))
+		Expect(emitter.counters[0].GetCounter().GetDelta()).To(Equal(uint64(1)))
+		Expect(emitter.counters[1].GetCounter().GetName()).To(Equal("responses.4xx"))
+	})
+
+	It("defaults the status code to 200", func() {
+		handler = httpmiddleware.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}), emitter)
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		Expect(emitter.timers[0].GetTags()).To(HaveKeyWithValue("status_code", "200"))
+		Expect(emitter.counters[1].GetCounter().GetName()).To(Equal("responses.2xx"))
+	})
+
+	It("adds trace IDs from the request headers", func() {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		Expect(emitter.timers[0].GetTags()).To(HaveKeyWithValue("trace_id", "4bf92f3577b34da6a3ce929d0e0e4736"))
+		Expect(emitter.timers[0].GetTags()).To(HaveKeyWithValue("span_id", "00f067aa0ba902b7"))
+	})
+
+	It("applies the configured options", func() {
+		handler = httpmiddleware.Wrap(handler, emitter,
+			httpmiddleware.WithTimerOptions(loggregator.WithTimerSourceInfo("source-id", "instance-id")),
+			httpmiddleware.WithCounterOptions(loggregator.WithCounterSourceInfo("source-id", "instance-id")),
+		)
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		// The inner and outer handler both emit.
+		Expect(emitter.timers[1].GetSourceId()).To(Equal("source-id"))
+		Expect(emitter.counters[2].GetInstanceId()).To(Equal("instance-id"))
+	})
+})
+
+type spyEmitter struct {
+	timers   []*loggregator_v2.Envelope
+	counters []*loggregator_v2.Envelope
+}
+
+func (s *spyEmitter) EmitTimer(name string, start, stop time.Time, opts ...loggregator.EmitTimerOption) {
+	e := &loggregator_v2.Envelope{
+		Message: &loggregator_v2.Envelope_Timer{
+			Timer: &loggregator_v2.Timer{
+				Name:  name,
+				Start: start.UnixNano(),
+				Stop:  stop.UnixNano(),
+			},
+		},
+	}
+	for _, o := range opts {
+		o(e)
+	}
+	s.timers = append(s.timers, e)
+}
+
+func (s *spyEmitter) EmitCounter(name string, opts ...loggregator.EmitCounterOption) {
+	e := &loggregator_v2.Envelope{
+		Message: &loggregator_v2.Envelope_Counter{
+			Counter: &loggregator_v2.Counter{Name: name},
+		},
+	}
+	for _, o := range opts {
+		o(e)
+	}
+	s.counters = append(s.counters, e)
+}
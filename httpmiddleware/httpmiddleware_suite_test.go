@@ -0,0 +1,13 @@
+package httpmiddleware_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestHttpmiddleware(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Httpmiddleware Suite")
+}
@@ -2,29 +2,91 @@ package loggregator
 
 import (
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/protobuf/proto"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 
+	"code.cloudfoundry.org/go-loggregator/internal/backoff"
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/go-loggregator/units"
 )
 
 // IngressOption is the type of a configurable client option.
 type IngressOption func(*IngressClient)
 
+// WithDialOptions allows for the configuration of additional gRPC dial
+// options, e.g. keepalive parameters, interceptors, maximum message sizes or
+// load balancing policies. The options are applied in addition to the
+// transport credentials derived from the client's TLS configuration.
 func WithDialOptions(opts ...grpc.DialOption) IngressOption {
 	return func(c *IngressClient) {
 		c.dialOpts = append(c.dialOpts, opts...)
 	}
 }
 
+// WithKeepalive sets the gRPC keepalive parameters of the client's
+// connection. By default, the client pings every 30 seconds, waits 10
+// seconds for a reply and pings even while no stream is open, so that a
+// connection silently dropped by a load balancer is noticed before the next
+// batch is sent rather than losing it. The server must permit pings at the
+// configured rate; loggregator agents allow a ping every 10 seconds. Keepalive
+// parameters passed to WithDialOptions take precedence.
+func WithKeepalive(params keepalive.ClientParameters) IngressOption {
+	return func(c *IngressClient) {
+		c.keepalive = params
+	}
+}
+
+// WithBlockingDial makes creating the client wait until its connection to
+// loggregator is established, and fail if that takes longer than timeout,
+// so that a wrong address or an agent that is down is noticed at start up.
+// By default the connection is established in the background and the client
+// is returned right away; envelopes emitted while loggregator cannot be
+// reached fail to send.
+func WithBlockingDial(timeout time.Duration) IngressOption {
+	return func(c *IngressClient) {
+		c.dialTimeout = timeout
+	}
+}
+
+// WithDefaultLogType sets the output type of logs emitted without WithStdout
+// or WithStderr. It defaults to loggregator_v2.Log_ERR.
+func WithDefaultLogType(t loggregator_v2.Log_Type) IngressOption {
+	return func(c *IngressClient) {
+		c.defaultLogType = t
+	}
+}
+
+// WithCompression compresses every batch sent by the client with the named
+// gRPC compressor. Log payloads compress well, so this trades some CPU for
+// considerably less bandwidth on constrained links to the agent. The "gzip"
+// compressor is always available; other compressors must be registered with
+// google.golang.org/grpc/encoding first, or creating the client fails. The
+// server must support the compressor as well. An empty name disables
+// compression, which is the default.
+func WithCompression(name string) IngressOption {
+	return func(c *IngressClient) {
+		c.compressor = name
+	}
+}
+
 // WithTag allows for the configuration of arbitrary string value
 // metadata which will be included in all data sent to Loggregator
 func WithTag(name, value string) IngressOption {
@@ -33,6 +95,50 @@ func WithTag(name, value string) IngressOption {
 	}
 }
 
+// WithDefaultSourceID sets the source ID of every envelope emitted by the
+// client, including envelopes passed to Emit that have no source ID. Options
+// that set the source ID on individual envelopes (e.g. WithAppInfo or
+// WithGaugeSourceInfo) take precedence.
+func WithDefaultSourceID(id string) IngressOption {
+	return func(c *IngressClient) {
+		c.sourceID = id
+	}
+}
+
+// WithDefaultInstanceID sets the instance ID of every envelope emitted by
+// the client, including envelopes passed to Emit that have no instance ID.
+// Options that set the instance ID on individual envelopes (e.g. WithAppInfo
+// or WithCounterSourceInfo) take precedence.
+func WithDefaultInstanceID(id string) IngressOption {
+	return func(c *IngressClient) {
+		c.instanceID = id
+	}
+}
+
+// WithDeprecatedTags makes the client send envelope tags as typed text
+// values in the envelope's DeprecatedTags instead of its Tags, for
+// compatibility with older Metron agents that ignore the string tags.
+func WithDeprecatedTags() IngressOption {
+	return func(c *IngressClient) {
+		c.deprecatedTags = true
+	}
+}
+
+// WithSendTimeTags makes the client add its tags (see WithTag) to envelopes
+// on the sender goroutine, as they are batched, instead of copying them into
+// each envelope as it is emitted. This only moves the copy: every envelope
+// still gets its own copy of the tags, so the total work and allocations are
+// the same. It shortens emitting for callers whose emitting goroutines are
+// latency sensitive. Tags set on the envelope itself still take precedence,
+// and the client's tags still take precedence over context tags (see
+// ContextWithTags). Unlike the default, the client's tags are also added to
+// envelopes passed to Emit and EmitBatch.
+func WithSendTimeTags() IngressOption {
+	return func(c *IngressClient) {
+		c.sendTimeTags = true
+	}
+}
+
 // WithBatchMaxSize allows for the configuration of the number of messages to
 // collect before emitting them into loggregator. By default, its value is 100
 // messages.
@@ -48,9 +154,40 @@ func WithBatchMaxSize(maxSize uint) IngressOption {
 	}
 }
 
+// WithBatchMaxBytes allows for the configuration of the maximum size in
+// bytes of a serialized batch. A batch is flushed before an envelope would
+// take it past this size, which keeps batches below the message size limit
+// of the loggregator server. An envelope that is larger than the limit on
+// its own is still sent in a batch of its own. By default, there is no limit.
+func WithBatchMaxBytes(n int) IngressOption {
+	return func(c *IngressClient) {
+		c.batchMaxBytes = n
+	}
+}
+
+// WithBufferSize allows for the configuration of the number of envelopes
+// that can be buffered before emitting blocks or drops envelopes, depending
+// on the backpressure strategy. By default, its value is 100 envelopes.
+//
+// Note that the buffer is separate from the batch being assembled for the
+// next send. The client can therefore hold up to the buffer size plus the
+// batch max size envelopes in memory. A buffer at least as large as the
+// batch max size allows emitters to keep writing while a batch is sent. The
+// size must not be negative; the client constructors return an error
+// otherwise.
+func WithBufferSize(n int) IngressOption {
+	return func(c *IngressClient) {
+		c.bufferSize = n
+	}
+}
+
 // WithBatchFlushInterval allows for the configuration of the maximum time to
 // wait before sending a batch of messages. Note that the batch interval
 // may be triggered prior to the batch reaching the configured maximum size.
+// The interval runs on a fixed tick that is independent of batches sent for
+// reaching their maximum size, so a buffered envelope waits at most one
+// interval before it is sent. The interval must be positive; the client
+// constructors return an error otherwise.
 func WithBatchFlushInterval(d time.Duration) IngressOption {
 	return func(c *IngressClient) {
 		c.batchFlushInterval = d
@@ -59,10 +196,34 @@ func WithBatchFlushInterval(d time.Duration) IngressOption {
 
 // WithAddr allows for the configuration of the loggregator v2 address.
 // The value to defaults to localhost:3458, which happens to be the default
-// address in the loggregator server.
+// address in the loggregator server. The address must be a host and port;
+// the client constructors return an error otherwise.
 func WithAddr(addr string) IngressOption {
 	return func(c *IngressClient) {
-		c.addr = addr
+		c.addrs = []string{addr}
+	}
+}
+
+// WithUnixSocket connects the client to an agent listening on the Unix
+// domain socket at path instead of a TCP address. It takes precedence over
+// WithAddr and WithAddrs. A socket is usually only reachable from the same
+// host, so it is typically used with NewInsecureIngressClient to avoid TLS
+// on the local path.
+func WithUnixSocket(path string) IngressOption {
+	return func(c *IngressClient) {
+		c.unixSocket = path
+	}
+}
+
+// WithAddrs configures several loggregator v2 addresses, e.g. agents
+// listening on more than one port or old and new agents during an upgrade.
+// The client connects to the first address that accepts a connection and
+// stays on it. When that connection is lost, it reconnects starting from the
+// same address and fails over to the next ones in order. It replaces any
+// address set with WithAddr.
+func WithAddrs(addrs ...string) IngressOption {
+	return func(c *IngressClient) {
+		c.addrs = addrs
 	}
 }
 
@@ -80,32 +241,364 @@ func WithLogger(l Logger) IngressOption {
 	}
 }
 
+// WithCertReload configures the client to periodically re-read its client
+// certificate and key from the given paths. Connections established after a
+// reload (e.g. when the stream to loggregator is re-established) present the
+// new certificate, which allows certificates to be rotated without
+// restarting the process. If a reload fails, the error is logged and the
+// previous certificate remains in use. The interval must be positive;
+// NewIngressClient returns an error otherwise. It has no effect on clients
+// created via NewInsecureIngressClient.
+func WithCertReload(certPath, keyPath string, interval time.Duration) IngressOption {
+	return func(c *IngressClient) {
+		c.certReload = &certReloader{
+			certPath: certPath,
+			keyPath:  keyPath,
+			interval: interval,
+		}
+	}
+}
+
+// ConnState describes a change in the state of the client's stream to
+// loggregator.
+type ConnState int
+
+const (
+	// Connected indicates the stream was established for the first time.
+	Connected ConnState = iota
+
+	// Disconnected indicates the stream was lost or closed.
+	Disconnected
+
+	// Reconnected indicates the stream was re-established after being lost.
+	Reconnected
+)
+
+// String returns the name of the state.
+func (s ConnState) String() string {
+	switch s {
+	case Connected:
+		return "Connected"
+	case Disconnected:
+		return "Disconnected"
+	case Reconnected:
+		return "Reconnected"
+	default:
+		return fmt.Sprintf("ConnState(%d)", int(s))
+	}
+}
+
+// WithConnectionObserver configures a function that is invoked whenever the
+// client's stream to loggregator connects, disconnects or reconnects. The
+// function is called from the client's sender goroutine and should not
+// block.
+func WithConnectionObserver(f func(ConnState)) IngressOption {
+	return func(c *IngressClient) {
+		c.connObserver = f
+	}
+}
+
 // WithContext configures the context that manages the lifecycle for the gRPC
-// connection. It defaults to a context.Background().
+// connection. It defaults to a context.Background(). Cancelling the context
+// tears down the BatchSender stream, and any gRPC metadata attached to it is
+// sent along with the stream.
 func WithContext(ctx context.Context) IngressOption {
 	return func(c *IngressClient) {
 		c.ctx = ctx
 	}
 }
 
+// BackpressureStrategy determines how the client behaves when its envelope
+// buffer is full, e.g. because loggregator is unreachable.
+type BackpressureStrategy int
+
+const (
+	// Block makes emitting wait until there is room in the buffer. This is
+	// the default.
+	Block BackpressureStrategy = iota
+
+	// DropNewest discards the envelope being emitted.
+	DropNewest
+
+	// DropOldest discards the oldest buffered envelope to make room for the
+	// one being emitted.
+	DropOldest
+)
+
+// ErrBufferFull is returned by TryEmit when the envelope buffer is full.
+var ErrBufferFull = errors.New("envelope buffer is full")
+
+// ErrClosed is returned when emitting with a client that has been closed.
+var ErrClosed = errors.New("ingress client is closed")
+
+// WithBackpressureStrategy configures how the client behaves when its
+// envelope buffer is full. It defaults to Block. With DropNewest and
+// DropOldest, emitting never blocks.
+func WithBackpressureStrategy(s BackpressureStrategy) IngressOption {
+	return func(c *IngressClient) {
+		c.backpressure = s
+	}
+}
+
+// WithDropAlerter configures a function that is invoked with the number of
+// envelopes dropped whenever the backpressure strategy discards envelopes.
+func WithDropAlerter(alerter func(dropped int)) IngressOption {
+	return func(c *IngressClient) {
+		c.dropAlerter = alerter
+	}
+}
+
+// WithRateLimit caps the number of envelopes of the given type that are
+// emitted per second, e.g. to stop a noisy component from flooding
+// loggregator with logs while still letting its metrics through. Envelopes
+// over the limit are discarded and reported to the throttle alerter. Bursts
+// of up to perSecond envelopes are allowed.
+func WithRateLimit(t EnvelopeType, perSecond int) IngressOption {
+	return func(c *IngressClient) {
+		c.rateLimits[t] = newRateLimiter(perSecond)
+	}
+}
+
+// WithThrottleAlerter configures a function that is invoked with the
+// envelope type and number of envelopes whenever envelopes are discarded by
+// a rate limit.
+func WithThrottleAlerter(alerter func(t EnvelopeType, throttled int)) IngressOption {
+	return func(c *IngressClient) {
+		c.throttleAlerter = alerter
+	}
+}
+
+// WithRetryBackoff configures the delay before the stream to loggregator is
+// re-established after a failure. The delay starts at min and doubles on
+// every consecutive failure until it reaches max. Each delay is randomized
+// to between half and all of its value. By default the stream is
+// re-established immediately.
+func WithRetryBackoff(min, max time.Duration) IngressOption {
+	return func(c *IngressClient) {
+		c.retryBackoff = backoff.New(min, max)
+		c.retryBackoff.Jitter = true
+	}
+}
+
+// WithMaxRetries sets how many times a batch is resent after a failed send
+// before it is discarded. It defaults to 0, in which case a batch is
+// discarded after the first failed send.
+func WithMaxRetries(n int) IngressOption {
+	return func(c *IngressClient) {
+		c.maxRetries = n
+	}
+}
+
+// WithAcknowledgedDelivery makes the client send every batch with the
+// unary Send RPC, whose response acknowledges that loggregator received the
+// batch, instead of the BatchSender stream, which gives no indication of
+// delivery. A batch that is not acknowledged is resent, waiting with the
+// retry backoff (see WithRetryBackoff) between attempts, until it has been
+// tried maxAttempts times or the number of retries set with WithMaxRetries
+// is exhausted, whichever allows more attempts. It is then handled like any
+// other batch that could not be sent (see WithPermanentFailureHandler and
+// WithDiskBuffer). This trades throughput for at-least-once delivery, e.g.
+// for audit logs; a batch may be received twice if an acknowledgement is
+// lost.
+func WithAcknowledgedDelivery(maxAttempts int) IngressOption {
+	return func(c *IngressClient) {
+		c.acked = true
+		c.ackAttempts = maxAttempts
+	}
+}
+
+// WithPermanentFailureHandler sets a function that is invoked with a batch
+// and the last send error whenever a batch is discarded because it could
+// not be sent within the configured number of retries.
+func WithPermanentFailureHandler(f func(batch []*loggregator_v2.Envelope, err error)) IngressOption {
+	return func(c *IngressClient) {
+		c.failureHandler = f
+	}
+}
+
+// WithErrorHandler sets a function that is invoked with the error of every
+// failed attempt to send a batch, including attempts that are retried. It
+// lets callers react to sustained send failures, e.g. by alerting or by
+// switching destinations, rather than only finding them in the log. The
+// handler is called from the sender and must not block.
+func WithErrorHandler(f func(error)) IngressOption {
+	return func(c *IngressClient) {
+		c.errorHandler = f
+	}
+}
+
+// WithStrictUnits makes the client reject gauges with a unit that is not
+// known to the units package. EmitGaugeContext returns an error for such
+// gauges and EmitGauge discards them. Units are checked as given; use
+// WithUnitNormalization to also send them under their canonical names.
+func WithStrictUnits() IngressOption {
+	return func(c *IngressClient) {
+		c.strictUnits = true
+	}
+}
+
+// WithUnitNormalization makes the client send gauge units that the units
+// package knows under their canonical names, e.g. "ms" and "Milliseconds"
+// as "milliseconds", so that a metric is not split across spellings. Other
+// units are sent as given. Without it, units are sent exactly as emitted.
+func WithUnitNormalization() IngressOption {
+	return func(c *IngressClient) {
+		c.normalizeUnits = true
+	}
+}
+
+// WithUnaryFallback makes the client send batches with the unary Send RPC
+// once the BatchSender stream has failed the given number of times in a
+// row. This helps when intermediaries (e.g. proxies) mishandle long-lived
+// streams. The stream is tried again after retryStream has passed. By
+// default, the client only uses the stream.
+func WithUnaryFallback(failures int, retryStream time.Duration) IngressOption {
+	return func(c *IngressClient) {
+		c.unaryFallback = failures
+		c.unaryRetryStream = retryStream
+	}
+}
+
+// WithOversizeHandler sets a function that is invoked with an envelope and
+// the send error when the envelope is discarded because it is too large to
+// be sent, even in a batch of its own. Batches that are rejected for being
+// too large are split in half and resent until only such envelopes remain.
+func WithOversizeHandler(f func(e *loggregator_v2.Envelope, err error)) IngressOption {
+	return func(c *IngressClient) {
+		c.oversizeHandler = f
+	}
+}
+
+// WithSenderConcurrency sets the number of BatchSender streams that batches
+// are sent over in parallel. It defaults to 1. All streams share the
+// client's connection. With more than one stream, each batch is sent on
+// whichever stream is free, so batches (and the envelopes in them) may
+// arrive out of order, and the connection observer and failure handlers may
+// be invoked concurrently. The connection observer is notified for each
+// stream.
+func WithSenderConcurrency(n int) IngressOption {
+	return func(c *IngressClient) {
+		c.senderConcurrency = n
+	}
+}
+
+// WithDiskBuffer enables spooling of batches to files in the given directory
+// when they cannot be sent within the configured number of retries. Spooled
+// batches are replayed in order, ahead of any new batches, once the stream
+// to loggregator recovers. Batches left in the directory by a previous
+// process are replayed as well. Once the spooled batches reach maxBytes,
+// further failed batches are discarded and reported to the permanent
+// failure handler.
+func WithDiskBuffer(dir string, maxBytes int64) IngressOption {
+	return func(c *IngressClient) {
+		c.diskBufferDir = dir
+		c.diskBufferMax = maxBytes
+	}
+}
+
 // IngressClient represents an emitter into loggregator. It should be created with the
 // NewIngressClient constructor.
 type IngressClient struct {
 	client loggregator_v2.IngressClient
-	sender loggregator_v2.Ingress_BatchSenderClient
 
-	envelopes chan *loggregator_v2.Envelope
-	tags      map[string]string
+	senderConcurrency int
+	streams           []*ingressStream
+	jobs              chan sendJob
+	inflight          sync.WaitGroup
+
+	envelopes  chan *loggregator_v2.Envelope
+	bufferSize int
+	tags       map[string]string
+	sourceID   string
+	instanceID string
+
+	defaultLogType loggregator_v2.Log_Type
+
+	deprecatedTags bool
+	sendTimeTags   bool
+
+	backpressure BackpressureStrategy
+	dropAlerter  func(int)
+
+	rateLimits      map[EnvelopeType]*rateLimiter
+	throttleAlerter func(EnvelopeType, int)
+
+	sourceQuota  *sourceQuota
+	quotaAlerter func(string, int)
+
+	dedup *deduplicator
+
+	strictUnits    bool
+	normalizeUnits bool
+
+	sampling       bool
+	sampleRate     float64
+	sampleRules    []sampleRule
+	sampledOutLogs *Counter
+
+	stripANSI     bool
+	maxLogPayload int
+
+	tagValidation       bool
+	tagPolicy           TagPolicy
+	maxTagName          int
+	maxTagValue         int
+	tagViolationHandler func(TagViolation)
 
 	batchMaxSize       uint
+	batchMaxBytes      int
 	batchFlushInterval time.Duration
-	addr               string
+	addrs              []string
+	unixSocket         string
 
-	dialOpts []grpc.DialOption
+	retryBackoff    *backoff.Backoff
+	maxRetries      int
+	failureHandler  func([]*loggregator_v2.Envelope, error)
+	errorHandler    func(error)
+	oversizeHandler func(*loggregator_v2.Envelope, error)
+
+	unaryFallback    int
+	unaryRetryStream time.Duration
+
+	acked       bool
+	ackAttempts int
+
+	sendDeadline time.Duration
+
+	diskBufferDir string
+	diskBufferMax int64
+	diskBufferMu  sync.Mutex
+	diskBuffer    *diskBuffer
+
+	dialOpts    []grpc.DialOption
+	dialTimeout time.Duration
+	keepalive   keepalive.ClientParameters
+	compressor  string
+	certReload  *certReloader
+
+	connObserver func(ConnState)
+	connPause    *connPause
+	conn         *grpc.ClientConn
+	batchWriter  BatchWriter
 
 	logger Logger
 
-	closeErrors chan error
+	// closed is set atomically once CloseSend is called. closeMu keeps
+	// envelopes from being added to the buffer while it is closed.
+	closed     int32
+	closing    chan struct{}
+	closeMu    sync.RWMutex
+	closeOnce  sync.Once
+	connOnce   sync.Once
+	closeErr   error
+	senderDone chan struct{}
+
+	flushes chan chan error
+
+	metrics        *metricRegistry
+	metricInterval time.Duration
+
+	stats *clientStats
 
 	ctx    context.Context
 	cancel func()
@@ -114,37 +607,200 @@ type IngressClient struct {
 // NewIngressClient creates a v2 loggregator client. Its TLS configuration
 // must share a CA with the loggregator server.
 func NewIngressClient(tlsConfig *tls.Config, opts ...IngressOption) (*IngressClient, error) {
+	return newIngressClient(tlsConfig, false, opts...)
+}
+
+// NewInsecureIngressClient creates a v2 loggregator client that connects
+// without TLS. It is intended for local development and test environments
+// where the ingress endpoint has TLS disabled and should not be used in
+// production.
+func NewInsecureIngressClient(opts ...IngressOption) (*IngressClient, error) {
+	return newIngressClient(nil, true, opts...)
+}
+
+// newIngressClient creates a v2 loggregator client. It connects with the
+// given TLS configuration unless insecure is set, in which case the
+// connection is plaintext.
+func newIngressClient(tlsConfig *tls.Config, insecure bool, opts ...IngressOption) (*IngressClient, error) {
 	c := &IngressClient{
-		envelopes:          make(chan *loggregator_v2.Envelope, 100),
+		bufferSize:         100,
 		tags:               make(map[string]string),
 		batchMaxSize:       100,
 		batchFlushInterval: 100 * time.Millisecond,
-		addr:               "localhost:3458",
+		addrs:              []string{"localhost:3458"},
 		logger:             log.New(ioutil.Discard, "", 0),
-		closeErrors:        make(chan error),
+		closing:            make(chan struct{}),
+		senderDone:         make(chan struct{}),
+		flushes:            make(chan chan error),
+		stats:              &clientStats{},
 		ctx:                context.Background(),
+		dropAlerter:        func(int) {},
+		rateLimits:         make(map[EnvelopeType]*rateLimiter),
+		throttleAlerter:    func(EnvelopeType, int) {},
+		quotaAlerter:       func(string, int) {},
+		connObserver:       func(ConnState) {},
+		retryBackoff:       backoff.New(0, 0),
+		failureHandler:     func([]*loggregator_v2.Envelope, error) {},
+		errorHandler:       func(error) {},
+		oversizeHandler:    func(*loggregator_v2.Envelope, error) {},
+		metrics:            newMetricRegistry(),
+		metricInterval:     10 * time.Second,
+		sampleRate:         1,
+		defaultLogType:     loggregator_v2.Log_ERR,
+		maxTagName:         256,
+		maxTagValue:        256,
+		keepalive: keepalive.ClientParameters{
+			Time:                30 * time.Second,
+			Timeout:             10 * time.Second,
+			PermitWithoutStream: true,
+		},
 	}
 
 	for _, o := range opts {
 		o(c)
 	}
 
+	if c.bufferSize < 0 {
+		return nil, fmt.Errorf("buffer size must not be negative, got %d", c.bufferSize)
+	}
+	if c.batchFlushInterval <= 0 {
+		return nil, fmt.Errorf("batch flush interval must be positive, got %s", c.batchFlushInterval)
+	}
+	if c.metricInterval <= 0 {
+		return nil, fmt.Errorf("metric interval must be positive, got %s", c.metricInterval)
+	}
+
+	if c.tagViolationHandler == nil {
+		c.tagViolationHandler = func(v TagViolation) {
+			c.logger.Printf("invalid tag: %s", v)
+		}
+	}
+	if c.tagValidation {
+		c.validateTags(c.tags)
+	}
+
+	if c.diskBufferDir != "" {
+		var err error
+		c.diskBuffer, err = newDiskBuffer(c.diskBufferDir, c.diskBufferMax)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.envelopes = make(chan *loggregator_v2.Envelope, c.bufferSize)
 	c.ctx, c.cancel = context.WithCancel(c.ctx)
 
-	c.dialOpts = append(c.dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	if c.batchWriter == nil {
+		if err := c.dial(tlsConfig, insecure); err != nil {
+			c.cancel()
+			return nil, err
+		}
+	}
+	if c.connPause != nil && c.conn != nil {
+		go c.watchConnection()
+	}
+
+	if c.dedup != nil {
+		go c.dedup.run(c)
+	}
+	if c.sampling {
+		c.sampledOutLogs = c.NewCounter(sampledOutCounter)
+	}
+
+	if c.senderConcurrency < 1 {
+		c.senderConcurrency = 1
+	}
+	for i := 0; i < c.senderConcurrency; i++ {
+		b := *c.retryBackoff
+		c.streams = append(c.streams, &ingressStream{backoff: &b})
+	}
+	if c.senderConcurrency > 1 {
+		c.jobs = make(chan sendJob)
+		for _, s := range c.streams {
+			go c.sendJobs(s)
+		}
+	}
+
+	go c.startSender()
+
+	return c, nil
+}
+
+// dial connects to loggregator, or to the first of its addresses if there
+// are several. The connection uses TLS unless insecure is set.
+func (c *IngressClient) dial(tlsConfig *tls.Config, insecure bool) error {
+	target := c.unixSocket
+	if target == "" {
+		if len(c.addrs) == 0 {
+			return errors.New("no loggregator address configured")
+		}
+		for _, addr := range c.addrs {
+			if err := validateAddr(addr); err != nil {
+				return err
+			}
+		}
+		target = c.addrs[0]
+	}
+
+	if c.compressor != "" && encoding.GetCompressor(c.compressor) == nil {
+		return fmt.Errorf("unknown compressor %q", c.compressor)
+	}
+
+	creds := grpc.WithInsecure()
+	if !insecure {
+		if c.certReload != nil {
+			var err error
+			tlsConfig, err = c.certReload.configure(c.ctx, tlsConfig, c.logger)
+			if err != nil {
+				return err
+			}
+		}
+
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+	}
+	c.dialOpts = append([]grpc.DialOption{
+		grpc.WithKeepaliveParams(c.keepalive),
+	}, c.dialOpts...)
+	if c.compressor != "" {
+		c.dialOpts = append([]grpc.DialOption{
+			grpc.WithDefaultCallOptions(grpc.UseCompressor(c.compressor)),
+		}, c.dialOpts...)
+	}
+	c.dialOpts = append(c.dialOpts, creds)
+	switch {
+	case c.unixSocket != "":
+		c.dialOpts = append([]grpc.DialOption{
+			grpc.WithContextDialer(dialUnix),
+		}, c.dialOpts...)
+	case len(c.addrs) > 1:
+		c.dialOpts = append([]grpc.DialOption{
+			grpc.WithContextDialer(newFailoverDialer(c.addrs, c.logger).dial),
+		}, c.dialOpts...)
+	}
+
+	ctx := c.ctx
+	if c.dialTimeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, c.dialTimeout)
+		defer cancel()
+		c.dialOpts = append(c.dialOpts, grpc.WithBlock())
+	}
 
-	conn, err := grpc.Dial(
-		c.addr,
+	conn, err := grpc.DialContext(
+		ctx,
+		target,
 		c.dialOpts...,
 	)
 	if err != nil {
-		return nil, err
+		if c.dialTimeout > 0 {
+			return fmt.Errorf("could not connect to loggregator at %s: %s", target, err)
+		}
+		return err
 	}
+	c.conn = conn
 	c.client = loggregator_v2.NewIngressClient(conn)
 
-	go c.startSender()
-
-	return c, nil
+	return nil
 }
 
 // protoEditor is required for v1 envelopes. It should be removed once v1
@@ -155,13 +811,29 @@ type protoEditor interface {
 	SetCounterAppInfo(appID string, index int)
 	SetSourceInfo(sourceID, instanceID string)
 	SetLogToStdout()
+	LogPayload() []byte
+	SetLogPayload(p []byte)
 	SetGaugeValue(name string, value float64, unit string)
 	SetDelta(d uint64)
 	SetTotal(t uint64)
 	SetTag(name, value string)
 }
 
-// EmitLogOption is the option type passed into EmitLog
+// timestampEditor is implemented by v1 envelopes that support WithTimestamp.
+// It is separate from protoEditor so that editors without it still accept
+// every other option.
+type timestampEditor interface {
+	SetTimestamp(ns int64)
+}
+
+// stderrEditor is implemented by v1 envelopes that support WithStderr.
+type stderrEditor interface {
+	SetLogToStderr()
+}
+
+// EmitLogOption is the option type passed into EmitLog. Options never
+// panic; an option that does not apply to the envelope it is given (e.g.
+// WithStdout on a gauge) is ignored.
 type EmitLogOption func(proto.Message)
 
 // WithAppInfo configures the meta data associated with emitted data. Exists
@@ -177,52 +849,107 @@ func WithSourceInfo(sourceID, sourceType, sourceInstance string) EmitLogOption {
 		case *loggregator_v2.Envelope:
 			e.SourceId = sourceID
 			e.InstanceId = sourceInstance
-			e.Tags["source_type"] = sourceType
+			setTag(e, "source_type", sourceType)
 		case protoEditor:
 			e.SetLogAppInfo(sourceID, sourceType, sourceInstance)
-		default:
-			panic(fmt.Sprintf("unsupported Message type: %T", m))
 		}
 	}
 }
 
-// WithStdout sets the output type to stdout. Without using this option,
-// all data is assumed to be stderr output.
+// WithStdout sets the output type to stdout. Without this option or
+// WithStderr, logs get the client's default log type, which is stderr
+// unless set with WithDefaultLogType.
 func WithStdout() EmitLogOption {
 	return func(m proto.Message) {
 		switch e := m.(type) {
 		case *loggregator_v2.Envelope:
-			e.GetLog().Type = loggregator_v2.Log_OUT
+			if l := e.GetLog(); l != nil {
+				l.Type = loggregator_v2.Log_OUT
+			}
 		case protoEditor:
 			e.SetLogToStdout()
-		default:
-			panic(fmt.Sprintf("unsupported Message type: %T", m))
 		}
 	}
 }
 
+// WithStderr sets the output type to stderr.
+func WithStderr() EmitLogOption {
+	return func(m proto.Message) {
+		switch e := m.(type) {
+		case *loggregator_v2.Envelope:
+			if l := e.GetLog(); l != nil {
+				l.Type = loggregator_v2.Log_ERR
+			}
+		case stderrEditor:
+			e.SetLogToStderr()
+		}
+	}
+}
+
+// WithLogFields adds structured fields to the log payload. The payload is
+// replaced with a JSON object that contains the original message under the
+// "message" key alongside the given fields. If the payload is already a JSON
+// object (e.g. from a previous WithLogFields), the fields are merged into it.
+// Fields named "message" do not replace the original message. If the fields
+// cannot be marshalled to JSON, the payload is left unchanged.
+func WithLogFields(fields map[string]interface{}) EmitLogOption {
+	return func(m proto.Message) {
+		switch e := m.(type) {
+		case *loggregator_v2.Envelope:
+			if l := e.GetLog(); l != nil {
+				l.Payload = addLogFields(l.GetPayload(), fields)
+			}
+		case protoEditor:
+			e.SetLogPayload(addLogFields(e.LogPayload(), fields))
+		}
+	}
+}
+
+func addLogFields(payload []byte, fields map[string]interface{}) []byte {
+	obj := make(map[string]interface{})
+	if err := json.Unmarshal(payload, &obj); err != nil {
+		obj = map[string]interface{}{"message": string(payload)}
+	}
+
+	for k, v := range fields {
+		if _, ok := obj[k]; ok && k == "message" {
+			continue
+		}
+		obj[k] = v
+	}
+
+	p, err := json.Marshal(obj)
+	if err != nil {
+		return payload
+	}
+
+	return p
+}
+
 // EmitLog sends a message to loggregator.
 func (c *IngressClient) EmitLog(message string, opts ...EmitLogOption) {
-	e := &loggregator_v2.Envelope{
-		Timestamp: time.Now().UnixNano(),
-		Message: &loggregator_v2.Envelope_Log{
-			Log: &loggregator_v2.Log{
-				Payload: []byte(message),
-				Type:    loggregator_v2.Log_ERR,
-			},
-		},
-		Tags: make(map[string]string),
-	}
+	c.EmitLogContext(context.Background(), message, opts...)
+}
 
-	for k, v := range c.tags {
-		e.Tags[k] = v
+// EmitLogContext sends a message to loggregator. It blocks until the
+// envelope has been buffered or the given context is done, in which case the
+// context's error is returned.
+func (c *IngressClient) EmitLogContext(ctx context.Context, message string, opts ...EmitLogOption) error {
+	le := &logEnvelope{
+		log: loggregator_v2.Log{
+			Payload: []byte(message),
+			Type:    c.defaultLogType,
+		},
 	}
+	le.message.Log = &le.log
+	le.envelope.Message = &le.message
+	e := c.initEnvelope(&le.envelope)
 
 	for _, o := range opts {
 		o(e)
 	}
 
-	c.envelopes <- e
+	return c.emitContext(ctx, e)
 }
 
 // EmitGaugeOption is the option type passed into EmitGauge.
@@ -245,8 +972,6 @@ func WithGaugeSourceInfo(sourceID, instanceID string) EmitGaugeOption {
 			e.InstanceId = instanceID
 		case protoEditor:
 			e.SetSourceInfo(sourceID, instanceID)
-		default:
-			panic(fmt.Sprintf("unsupported Message type: %T", m))
 		}
 	}
 }
@@ -254,7 +979,10 @@ func WithGaugeSourceInfo(sourceID, instanceID string) EmitGaugeOption {
 // WithGaugeValue adds a gauge information. For example,
 // to send information about current CPU usage, one might use:
 //
-// WithGaugeValue("cpu", 3.0, "percent")
+// WithGaugeValue("cpu", 3.0, units.Percentage)
+//
+// The unit is sent as given unless the client normalizes units, see
+// WithUnitNormalization.
 //
 // An number of calls to WithGaugeValue may be passed into EmitGauge.
 // If there are duplicate names in any of the options, i.e., "cpu" and "cpu",
@@ -263,38 +991,61 @@ func WithGaugeValue(name string, value float64, unit string) EmitGaugeOption {
 	return func(m proto.Message) {
 		switch e := m.(type) {
 		case *loggregator_v2.Envelope:
-			e.GetGauge().Metrics[name] = &loggregator_v2.GaugeValue{Value: value, Unit: unit}
+			if g := e.GetGauge(); g != nil {
+				if g.Metrics == nil {
+					g.Metrics = make(map[string]*loggregator_v2.GaugeValue)
+				}
+				g.Metrics[name] = &loggregator_v2.GaugeValue{Value: value, Unit: unit}
+			}
 		case protoEditor:
 			e.SetGaugeValue(name, value, unit)
-		default:
-			panic(fmt.Sprintf("unsupported Message type: %T", m))
 		}
 	}
 }
 
+// WithGaugeTags is WithEnvelopeTags for gauges.
+func WithGaugeTags(tags map[string]string) EmitGaugeOption {
+	return WithEnvelopeTags(tags)
+}
+
 // EmitGauge sends the configured gauge values to loggregator.
 // If no EmitGaugeOption values are present, the client will emit
 // an empty gauge.
 func (c *IngressClient) EmitGauge(opts ...EmitGaugeOption) {
-	e := &loggregator_v2.Envelope{
-		Timestamp: time.Now().UnixNano(),
-		Message: &loggregator_v2.Envelope_Gauge{
-			Gauge: &loggregator_v2.Gauge{
-				Metrics: make(map[string]*loggregator_v2.GaugeValue),
-			},
-		},
-		Tags: make(map[string]string),
-	}
+	c.EmitGaugeContext(context.Background(), opts...)
+}
 
-	for k, v := range c.tags {
-		e.Tags[k] = v
+// EmitGaugeContext sends the configured gauge values to loggregator. It
+// blocks until the envelope has been buffered or the given context is done,
+// in which case the context's error is returned.
+func (c *IngressClient) EmitGaugeContext(ctx context.Context, opts ...EmitGaugeOption) error {
+	ge := &gaugeEnvelope{
+		gauge: loggregator_v2.Gauge{
+			Metrics: make(map[string]*loggregator_v2.GaugeValue),
+		},
 	}
+	ge.message.Gauge = &ge.gauge
+	ge.envelope.Message = &ge.message
+	e := c.initEnvelope(&ge.envelope)
 
 	for _, o := range opts {
 		o(e)
 	}
 
-	c.envelopes <- e
+	if c.normalizeUnits {
+		for _, v := range ge.gauge.Metrics {
+			v.Unit, _ = units.Normalize(v.Unit)
+		}
+	}
+	if c.strictUnits {
+		for name, v := range ge.gauge.Metrics {
+			if !units.Valid(v.Unit) {
+				return fmt.Errorf("gauge %q has unknown unit %q", name, v.Unit)
+			}
+		}
+	}
+
+	return c.emitContext(ctx, e)
 }
 
 // EmitCounterOption is the option type passed into EmitCounter.
@@ -305,11 +1056,11 @@ func WithDelta(d uint64) EmitCounterOption {
 	return func(m proto.Message) {
 		switch e := m.(type) {
 		case *loggregator_v2.Envelope:
-			e.GetCounter().Delta = d
+			if c := e.GetCounter(); c != nil {
+				c.Delta = d
+			}
 		case protoEditor:
 			e.SetDelta(d)
-		default:
-			panic(fmt.Sprintf("unsupported Message type: %T", m))
 		}
 	}
 }
@@ -319,12 +1070,12 @@ func WithTotal(t uint64) EmitCounterOption {
 	return func(m proto.Message) {
 		switch e := m.(type) {
 		case *loggregator_v2.Envelope:
-			e.GetCounter().Total = t
-			e.GetCounter().Delta = 0
+			if c := e.GetCounter(); c != nil {
+				c.Total = t
+				c.Delta = 0
+			}
 		case protoEditor:
 			e.SetTotal(t)
-		default:
-			panic(fmt.Sprintf("unsupported Message type: %T", m))
 		}
 	}
 }
@@ -346,34 +1097,34 @@ func WithCounterSourceInfo(sourceID, instanceID string) EmitCounterOption {
 			e.InstanceId = instanceID
 		case protoEditor:
 			e.SetSourceInfo(sourceID, instanceID)
-		default:
-			panic(fmt.Sprintf("unsupported Message type: %T", m))
 		}
 	}
 }
 
 // EmitCounter sends a counter envelope with a delta of 1.
 func (c *IngressClient) EmitCounter(name string, opts ...EmitCounterOption) {
-	e := &loggregator_v2.Envelope{
-		Timestamp: time.Now().UnixNano(),
-		Message: &loggregator_v2.Envelope_Counter{
-			Counter: &loggregator_v2.Counter{
-				Name:  name,
-				Delta: uint64(1),
-			},
-		},
-		Tags: make(map[string]string),
-	}
+	c.EmitCounterContext(context.Background(), name, opts...)
+}
 
-	for k, v := range c.tags {
-		e.Tags[k] = v
+// EmitCounterContext sends a counter envelope with a delta of 1. It blocks
+// until the envelope has been buffered or the given context is done, in which
+// case the context's error is returned.
+func (c *IngressClient) EmitCounterContext(ctx context.Context, name string, opts ...EmitCounterOption) error {
+	ce := &counterEnvelope{
+		counter: loggregator_v2.Counter{
+			Name:  name,
+			Delta: uint64(1),
+		},
 	}
+	ce.message.Counter = &ce.counter
+	ce.envelope.Message = &ce.message
+	e := c.initEnvelope(&ce.envelope)
 
 	for _, o := range opts {
 		o(e)
 	}
 
-	c.envelopes <- e
+	return c.emitContext(ctx, e)
 }
 
 // EmitTimerOption is the option type passed into EmitTimer.
@@ -389,35 +1140,35 @@ func WithTimerSourceInfo(sourceID, instanceID string) EmitTimerOption {
 			e.InstanceId = instanceID
 		case protoEditor:
 			e.SetSourceInfo(sourceID, instanceID)
-		default:
-			panic(fmt.Sprintf("unsupported Message type: %T", m))
 		}
 	}
 }
 
 // EmitTimer sends a timer envelope with the given name, start time and stop time.
 func (c *IngressClient) EmitTimer(name string, start, stop time.Time, opts ...EmitTimerOption) {
-	e := &loggregator_v2.Envelope{
-		Timestamp: time.Now().UnixNano(),
-		Message: &loggregator_v2.Envelope_Timer{
-			Timer: &loggregator_v2.Timer{
-				Name:  name,
-				Start: start.UnixNano(),
-				Stop:  stop.UnixNano(),
-			},
-		},
-		Tags: make(map[string]string),
-	}
+	c.EmitTimerContext(context.Background(), name, start, stop, opts...)
+}
 
-	for k, v := range c.tags {
-		e.Tags[k] = v
+// EmitTimerContext sends a timer envelope with the given name, start time and
+// stop time. It blocks until the envelope has been buffered or the given
+// context is done, in which case the context's error is returned.
+func (c *IngressClient) EmitTimerContext(ctx context.Context, name string, start, stop time.Time, opts ...EmitTimerOption) error {
+	te := &timerEnvelope{
+		timer: loggregator_v2.Timer{
+			Name:  name,
+			Start: start.UnixNano(),
+			Stop:  stop.UnixNano(),
+		},
 	}
+	te.message.Timer = &te.timer
+	te.envelope.Message = &te.message
+	e := c.initEnvelope(&te.envelope)
 
 	for _, o := range opts {
 		o(e)
 	}
 
-	c.envelopes <- e
+	return c.emitContext(ctx, e)
 }
 
 // EmitEventOption is the option type passed into EmitEvent.
@@ -433,126 +1184,833 @@ func WithEventSourceInfo(sourceID, instanceID string) EmitEventOption {
 			e.InstanceId = instanceID
 		case protoEditor:
 			e.SetSourceInfo(sourceID, instanceID)
-		default:
-			panic(fmt.Sprintf("unsupported Message type: %T", m))
 		}
 	}
 }
 
-// EmitEvent sends an Event envelope.
+// EmitEvent sends an Event envelope right away with the unary Send RPC, or
+// to the batch writer (see WithBatchWriter), bypassing the envelope buffer.
 func (c *IngressClient) EmitEvent(ctx context.Context, title, body string, opts ...EmitEventOption) error {
-	e := &loggregator_v2.Envelope{
-		Timestamp: time.Now().UnixNano(),
-		Message: &loggregator_v2.Envelope_Event{
-			Event: &loggregator_v2.Event{
-				Title: title,
-				Body:  body,
-			},
+	ee := &eventEnvelope{
+		event: loggregator_v2.Event{
+			Title: title,
+			Body:  body,
 		},
-		Tags: make(map[string]string),
-	}
-
-	for k, v := range c.tags {
-		e.Tags[k] = v
 	}
+	ee.message.Event = &ee.event
+	ee.envelope.Message = &ee.message
+	e := c.initEnvelope(&ee.envelope)
 
 	for _, o := range opts {
 		o(e)
 	}
+	c.addContextTags(ctx, e)
 
-	_, err := c.client.Send(ctx, &loggregator_v2.EnvelopeBatch{
-		Batch: []*loggregator_v2.Envelope{e},
-	})
+	c.validateEnvelopeTags(e)
+	c.stripANSIEscapes(e)
+	if c.deprecatedTags {
+		useDeprecatedTags(e)
+	}
+	// Events skip the sender, which adds send time tags to every other
+	// envelope.
+	c.addSendTimeTags(e)
 
-	return err
+	return c.sendUnary(ctx, []*loggregator_v2.Envelope{e})
 }
 
 // Emit sends an envelope. It will sent within a batch.
 func (c *IngressClient) Emit(e *loggregator_v2.Envelope) {
-	c.envelopes <- e
+	c.EmitContext(context.Background(), e)
+}
+
+// EmitContext sends an envelope. It will sent within a batch. It blocks until
+// the envelope has been buffered or the given context is done, in which case
+// the context's error is returned.
+func (c *IngressClient) EmitContext(ctx context.Context, e *loggregator_v2.Envelope) error {
+	if e.SourceId == "" {
+		e.SourceId = c.sourceID
+	}
+	if e.InstanceId == "" {
+		e.InstanceId = c.instanceID
+	}
+
+	return c.emitContext(ctx, e)
+}
+
+// The envelope types below hold an envelope together with its message so
+// that the Emit methods build both in a single allocation.
+type logEnvelope struct {
+	envelope loggregator_v2.Envelope
+	message  loggregator_v2.Envelope_Log
+	log      loggregator_v2.Log
+}
+
+type gaugeEnvelope struct {
+	envelope loggregator_v2.Envelope
+	message  loggregator_v2.Envelope_Gauge
+	gauge    loggregator_v2.Gauge
+}
+
+type counterEnvelope struct {
+	envelope loggregator_v2.Envelope
+	message  loggregator_v2.Envelope_Counter
+	counter  loggregator_v2.Counter
+}
+
+type timerEnvelope struct {
+	envelope loggregator_v2.Envelope
+	message  loggregator_v2.Envelope_Timer
+	timer    loggregator_v2.Timer
+}
+
+type eventEnvelope struct {
+	envelope loggregator_v2.Envelope
+	message  loggregator_v2.Envelope_Event
+	event    loggregator_v2.Event
+}
+
+// initEnvelope timestamps e and applies the client's defaults. The tags map
+// is sized for the client's tags up front so that copying them does not grow
+// it.
+func (c *IngressClient) initEnvelope(e *loggregator_v2.Envelope) *loggregator_v2.Envelope {
+	e.Timestamp = time.Now().UnixNano()
+	if c.sendTimeTags {
+		e.Tags = make(map[string]string)
+	} else {
+		e.Tags = make(map[string]string, len(c.tags))
+	}
+	c.setDefaults(e)
+
+	return e
+}
+
+// setDefaults applies the client's tags and default IDs to a new envelope.
+// It is called before any per-envelope options are applied so that they
+// take precedence.
+func (c *IngressClient) setDefaults(e *loggregator_v2.Envelope) {
+	e.SourceId = c.sourceID
+	e.InstanceId = c.instanceID
+
+	if c.sendTimeTags {
+		return
+	}
+
+	for k, v := range c.tags {
+		e.Tags[k] = v
+	}
+}
+
+// addSendTimeTags adds the client's tags to e on the sender goroutine when
+// WithSendTimeTags is set. Tags already on the envelope are left as they
+// are.
+func (c *IngressClient) addSendTimeTags(e *loggregator_v2.Envelope) {
+	if !c.sendTimeTags || len(c.tags) == 0 {
+		return
+	}
+
+	if c.deprecatedTags {
+		if e.DeprecatedTags == nil {
+			e.DeprecatedTags = make(map[string]*loggregator_v2.Value, len(c.tags))
+		}
+		for k, v := range c.tags {
+			if _, ok := e.DeprecatedTags[k]; !ok {
+				e.DeprecatedTags[k] = &loggregator_v2.Value{
+					Data: &loggregator_v2.Value_Text{Text: v},
+				}
+			}
+		}
+		return
+	}
+
+	if e.Tags == nil {
+		e.Tags = make(map[string]string, len(c.tags))
+	}
+	for k, v := range c.tags {
+		if _, ok := e.Tags[k]; !ok {
+			e.Tags[k] = v
+		}
+	}
+}
+
+// EmitBatch sends the given envelopes synchronously as a single batch. It
+// bypasses the envelope buffer and returns any error from the transport,
+// which makes it suitable for callers that need delivery confirmation or
+// implement their own queueing. The envelopes are sent as is; client tags
+// are only applied with WithSendTimeTags.
+func (c *IngressClient) EmitBatch(ctx context.Context, envs []*loggregator_v2.Envelope) error {
+	for _, e := range envs {
+		c.addSendTimeTags(e)
+	}
+	return c.sendUnary(ctx, envs)
+}
+
+// TryEmit sends an envelope if there is room in the envelope buffer. It
+// never blocks and returns ErrBufferFull if the envelope was not accepted.
+// The backpressure strategy does not apply to TryEmit.
+func (c *IngressClient) TryEmit(e *loggregator_v2.Envelope) error {
+	c.validateEnvelopeTags(e)
+	c.stripANSIEscapes(e)
+	c.truncateLog(e)
+	if c.sampledOut(e) || c.duplicate(e) || c.throttled(e) || c.overQuota(e) {
+		return nil
+	}
+
+	if c.deprecatedTags {
+		useDeprecatedTags(e)
+	}
+
+	c.closeMu.RLock()
+	defer c.closeMu.RUnlock()
+	if c.isClosed() {
+		c.drop()
+		return ErrClosed
+	}
+
+	select {
+	case c.envelopes <- e:
+		atomic.AddUint64(&c.stats.emitted, 1)
+		return nil
+	default:
+		return ErrBufferFull
+	}
+}
+
+// useDeprecatedTags moves the envelope's tags into its DeprecatedTags.
+func useDeprecatedTags(e *loggregator_v2.Envelope) {
+	if len(e.Tags) == 0 {
+		return
+	}
+
+	if e.DeprecatedTags == nil {
+		e.DeprecatedTags = make(map[string]*loggregator_v2.Value, len(e.Tags))
+	}
+	for k, v := range e.Tags {
+		e.DeprecatedTags[k] = &loggregator_v2.Value{
+			Data: &loggregator_v2.Value_Text{Text: v},
+		}
+	}
+	e.Tags = nil
+}
+
+// throttled reports whether the envelope is over its type's rate limit, in
+// which case it should be discarded.
+func (c *IngressClient) throttled(e *loggregator_v2.Envelope) bool {
+	t, ok := envelopeType(e)
+	if !ok {
+		return false
+	}
+
+	l, ok := c.rateLimits[t]
+	if !ok || l.allow() {
+		return false
+	}
+	atomic.AddUint64(&c.stats.throttled, 1)
+	c.throttleAlerter(t, 1)
+
+	return true
+}
+
+func (c *IngressClient) emitContext(ctx context.Context, e *loggregator_v2.Envelope) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.addContextTags(ctx, e)
+	c.validateEnvelopeTags(e)
+	c.stripANSIEscapes(e)
+	c.truncateLog(e)
+	if c.sampledOut(e) || c.duplicate(e) || c.throttled(e) || c.overQuota(e) {
+		return nil
+	}
+
+	return c.enqueue(ctx, e)
+}
+
+// enqueue adds e to the envelope buffer according to the backpressure
+// strategy. It returns ErrClosed once the client has been closed.
+func (c *IngressClient) enqueue(ctx context.Context, e *loggregator_v2.Envelope) error {
+	if c.deprecatedTags {
+		useDeprecatedTags(e)
+	}
+
+	c.closeMu.RLock()
+	defer c.closeMu.RUnlock()
+	if c.isClosed() {
+		c.drop()
+		return ErrClosed
+	}
+
+	switch c.backpressure {
+	case DropNewest:
+		select {
+		case c.envelopes <- e:
+			atomic.AddUint64(&c.stats.emitted, 1)
+		default:
+			c.drop()
+		}
+		return nil
+	case DropOldest:
+		for {
+			select {
+			case c.envelopes <- e:
+				atomic.AddUint64(&c.stats.emitted, 1)
+				return nil
+			default:
+			}
+
+			select {
+			case <-c.envelopes:
+				c.drop()
+			default:
+			}
+		}
+	default:
+		select {
+		case c.envelopes <- e:
+			atomic.AddUint64(&c.stats.emitted, 1)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.ctx.Done():
+			c.drop()
+			return c.ctx.Err()
+		case <-c.closing:
+			c.drop()
+			return ErrClosed
+		}
+	}
+}
+
+func (c *IngressClient) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) != 0
+}
+
+func (c *IngressClient) drop() {
+	atomic.AddUint64(&c.stats.dropped, 1)
+	c.dropAlerter(1)
 }
 
 // CloseSend will flush the envelope buffers and close the stream to the
 // ingress server. This method will block until the buffers are flushed.
+// Envelopes emitted afterwards are dropped, and the Emit methods that return
+// an error return ErrClosed. CloseSend may be called more than once; every
+// call waits for the same shutdown and returns the same error.
 func (c *IngressClient) CloseSend() error {
+	return c.CloseSendWithContext(context.Background())
+}
+
+// CloseSendWithContext is like CloseSend but stops waiting once the given
+// context is done. In that case the stream is torn down without waiting for
+// the server and the context's error is returned. Envelopes that have not
+// been sent by then are lost, including the final emits of metrics and log
+// summaries that are still waiting for room in the buffer.
+func (c *IngressClient) CloseSendWithContext(ctx context.Context) error {
+	c.closeOnce.Do(func() {
+		go c.closeEnvelopes(ctx)
+	})
+
+	select {
+	case <-c.senderDone:
+		return c.closeErr
+	case <-ctx.Done():
+		c.cancel()
+		return ctx.Err()
+	}
+}
+
+// Close closes the stream like CloseSend and then closes the client's
+// connection to loggregator. Long-lived processes that replace clients, e.g.
+// when the agent's address changes, should close the old ones with Close to
+// release their connections. The client cannot be used afterwards. Close may
+// be called more than once, also after CloseSend.
+func (c *IngressClient) Close() error {
+	return c.CloseWithContext(context.Background())
+}
+
+// CloseWithContext is like Close but stops waiting for the stream to be
+// closed once the given context is done, see CloseSendWithContext. The
+// connection is closed either way.
+func (c *IngressClient) CloseWithContext(ctx context.Context) error {
+	err := c.CloseSendWithContext(ctx)
+
+	c.connOnce.Do(func() {
+		if c.conn == nil {
+			return
+		}
+		if cerr := c.conn.Close(); err == nil {
+			err = cerr
+		}
+	})
+
+	return err
+}
+
+// State returns the state of the client's connection to loggregator, e.g.
+// connectivity.TransientFailure while the agent cannot be reached or
+// connectivity.Shutdown once the client has been closed with Close. Clients
+// with a batch writer (see WithBatchWriter) have no connection; they report
+// connectivity.Ready until they are closed.
+func (c *IngressClient) State() connectivity.State {
+	if c.conn != nil {
+		return c.conn.GetState()
+	}
+	if c.isClosed() {
+		return connectivity.Shutdown
+	}
+	return connectivity.Ready
+}
+
+// closeEnvelopes emits the final metrics and log summaries, giving up on
+// them once ctx is done, and then closes the envelope buffer, which stops
+// the sender once it has been drained.
+func (c *IngressClient) closeEnvelopes(ctx context.Context) {
+	c.metrics.stop(ctx, c)
+	if c.dedup != nil {
+		c.dedup.stop(ctx, c)
+	}
+
+	// Emitters blocked on a full buffer hold closeMu, so they are woken up
+	// before waiting for it.
+	atomic.StoreInt32(&c.closed, 1)
+	close(c.closing)
+
+	c.closeMu.Lock()
 	close(c.envelopes)
+	c.closeMu.Unlock()
+}
+
+// Flush sends every envelope that has been emitted so far, including the
+// current partial batch, and waits until they have been written to the
+// stream. It returns the first send error, or the context's error if the
+// context is done first. It is intended for short-lived processes that exit
+// right after emitting. Unlike CloseSend, the client remains usable
+// afterwards. Flush returns ErrClosed once the client has been closed.
+func (c *IngressClient) Flush(ctx context.Context) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	errs := make(chan error, 1)
+
+	select {
+	case c.flushes <- errs:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
 
-	return <-c.closeErrors
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (c *IngressClient) startSender() {
 	defer c.cancel()
 
-	t := time.NewTimer(c.batchFlushInterval)
+	t := time.NewTicker(c.batchFlushInterval)
+	defer t.Stop()
 
-	var batch []*loggregator_v2.Envelope
+	var (
+		batch      []*loggregator_v2.Envelope
+		batchBytes int
+	)
 	for {
 		select {
 		case env, ok := <-c.envelopes:
 			if !ok {
+				var err error
 				if len(batch) > 0 {
-					err := c.flush(batch)
-					c.closeAndRecv()
-					c.closeErrors <- err
-					return
+					err = c.dispatchWait(batch)
 				}
 
-				c.closeAndRecv()
-				c.closeErrors <- nil
+				c.stopStreams()
+				if cerr := c.closeBatchWriter(); err == nil {
+					err = cerr
+				}
+				c.closeErr = err
+				close(c.senderDone)
 
 				return
 			}
 
+			c.addSendTimeTags(env)
+			size := c.envelopeSize(env)
+			if c.exceedsBatchBytes(batch, batchBytes+size) {
+				c.dispatchBatch(batch, batchBytes)
+				batch, batchBytes = nil, 0
+			}
+
 			batch = append(batch, env)
+			batchBytes += size
 
-			if len(batch) >= int(c.batchMaxSize) {
-				c.flush(batch)
-				batch = nil
-				if !t.Stop() {
-					<-t.C
-				}
-				t.Reset(c.batchFlushInterval)
+			if c.batchFull(batch, batchBytes) {
+				c.dispatchBatch(batch, batchBytes)
+				batch, batchBytes = nil, 0
 			}
 		case <-t.C:
 			if len(batch) > 0 {
-				c.flush(batch)
-				batch = nil
+				c.dispatchBatch(batch, batchBytes)
+				batch, batchBytes = nil, 0
+			}
+		case errs := <-c.flushes:
+			errs <- c.flushBuffered(batch, batchBytes)
+			batch, batchBytes = nil, 0
+		}
+	}
+}
+
+// flushBuffered sends the given batch along with every envelope currently
+// waiting in the envelope buffer and waits for every batch in flight. It
+// returns the first error encountered by the batches it sent.
+func (c *IngressClient) flushBuffered(batch []*loggregator_v2.Envelope, batchBytes int) error {
+	var results []chan error
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		result := make(chan error, 1)
+		c.dispatch(batch, result)
+		results = append(results, result)
+		batch, batchBytes = nil, 0
+	}
+	wait := func() error {
+		c.inflight.Wait()
+
+		var firstErr error
+		for _, result := range results {
+			if err := <-result; err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+
+	for {
+		select {
+		case env, ok := <-c.envelopes:
+			if !ok {
+				flush()
+				return wait()
+			}
+
+			c.addSendTimeTags(env)
+			size := c.envelopeSize(env)
+			if c.exceedsBatchBytes(batch, batchBytes+size) {
+				flush()
+			}
+
+			batch = append(batch, env)
+			batchBytes += size
+
+			if c.batchFull(batch, batchBytes) {
+				flush()
 			}
-			t.Reset(c.batchFlushInterval)
+		default:
+			flush()
+			return wait()
 		}
 	}
 }
 
-func (c *IngressClient) closeAndRecv() {
-	if c.sender == nil {
+// envelopeSize returns the number of bytes the envelope adds to a
+// serialized batch. It is only computed when a maximum batch size in bytes
+// is configured.
+func (c *IngressClient) envelopeSize(e *loggregator_v2.Envelope) int {
+	if c.batchMaxBytes <= 0 {
+		return 0
+	}
+
+	return proto.Size(&loggregator_v2.EnvelopeBatch{
+		Batch: []*loggregator_v2.Envelope{e},
+	})
+}
+
+// exceedsBatchBytes reports whether a non-empty batch would be larger than
+// the maximum size in bytes if it grew to the given size.
+func (c *IngressClient) exceedsBatchBytes(batch []*loggregator_v2.Envelope, bytes int) bool {
+	return c.batchMaxBytes > 0 && len(batch) > 0 && bytes > c.batchMaxBytes
+}
+
+// batchFull reports whether the batch has reached either its maximum number
+// of envelopes or its maximum size in bytes.
+func (c *IngressClient) batchFull(batch []*loggregator_v2.Envelope, bytes int) bool {
+	if len(batch) >= int(c.batchMaxSize) {
+		return true
+	}
+
+	return c.batchMaxBytes > 0 && bytes >= c.batchMaxBytes
+}
+
+// ingressStream is the state of a single BatchSender stream. A stream is
+// only used by one goroutine at a time.
+type ingressStream struct {
+	sender     loggregator_v2.Ingress_BatchSenderClient
+	cancel     func()
+	failures   int
+	unaryUntil time.Time
+	connected  bool
+	backoff    *backoff.Backoff
+}
+
+// sendJob is a batch handed to one of several streams. The outcome of the
+// send is written to result if it is not nil.
+type sendJob struct {
+	batch  []*loggregator_v2.Envelope
+	result chan<- error
+}
+
+// dispatch sends the batch. With a single stream it is sent right away on
+// the calling goroutine; otherwise it is handed to the next free stream.
+// If result is not nil it receives the outcome of the send.
+func (c *IngressClient) dispatch(batch []*loggregator_v2.Envelope, result chan<- error) {
+	if c.jobs == nil {
+		err := c.flush(c.streams[0], batch)
+		if result != nil {
+			result <- err
+		}
 		return
 	}
-	c.sender.CloseAndRecv()
+
+	c.inflight.Add(1)
+	c.jobs <- sendJob{batch: batch, result: result}
 }
 
-func (c *IngressClient) flush(batch []*loggregator_v2.Envelope) error {
-	err := c.emit(batch)
-	if err != nil {
+// dispatchWait sends the batch and waits for the outcome.
+func (c *IngressClient) dispatchWait(batch []*loggregator_v2.Envelope) error {
+	result := make(chan error, 1)
+	c.dispatch(batch, result)
+	return <-result
+}
+
+// sendJobs sends the batches handed to the stream until the client is
+// closed.
+func (c *IngressClient) sendJobs(s *ingressStream) {
+	for job := range c.jobs {
+		err := c.flush(s, job.batch)
+		if job.result != nil {
+			job.result <- err
+		}
+		c.inflight.Done()
+	}
+}
+
+// stopStreams waits for the batches in flight and closes every stream.
+func (c *IngressClient) stopStreams() {
+	if c.jobs != nil {
+		c.inflight.Wait()
+		close(c.jobs)
+	}
+
+	for _, s := range c.streams {
+		c.closeAndRecv(s)
+	}
+}
+
+func (c *IngressClient) closeAndRecv(s *ingressStream) {
+	if s.sender == nil {
+		return
+	}
+	s.sender.CloseAndRecv()
+	s.cancel()
+	c.connObserver(Disconnected)
+}
+
+func (c *IngressClient) flush(s *ingressStream, batch []*loggregator_v2.Envelope) error {
+	err := c.replaySpooled(s)
+	if err == nil {
+		err = c.send(s, batch)
+		if err == nil {
+			return nil
+		}
+	}
+
+	if c.diskBuffer != nil {
+		c.diskBufferMu.Lock()
+		spoolErr := c.diskBuffer.push(batch)
+		c.diskBufferMu.Unlock()
+		if spoolErr == nil {
+			return err
+		}
+		c.logger.Printf("Error while spooling batch to disk: %s", spoolErr)
+	}
+
+	atomic.AddUint64(&c.stats.failed, uint64(len(batch)))
+	c.failureHandler(batch, err)
+
+	return err
+}
+
+// replaySpooled sends any batches in the disk buffer, oldest first. It stops
+// at the first batch that cannot be sent.
+func (c *IngressClient) replaySpooled(s *ingressStream) error {
+	if c.diskBuffer == nil {
+		return nil
+	}
+
+	c.diskBufferMu.Lock()
+	defer c.diskBufferMu.Unlock()
+
+	for !c.diskBuffer.empty() {
+		batch, err := c.diskBuffer.peek()
+		if err != nil {
+			c.logger.Printf("Discarding unreadable spooled batch: %s", err)
+		} else if err := c.send(s, batch); err != nil {
+			return err
+		}
+
+		if err := c.diskBuffer.pop(); err != nil {
+			c.logger.Printf("Error while removing spooled batch: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// send sends the batch, resending it up to the configured number of retries.
+func (c *IngressClient) send(s *ingressStream, batch []*loggregator_v2.Envelope) error {
+	attempts := c.maxRetries + 1
+	if c.acked && c.ackAttempts > attempts {
+		attempts = c.ackAttempts
+	}
+
+	// Streams back off when they are re-established, unary sends between
+	// attempts.
+	unary := c.acked || c.batchWriter != nil
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if unary && !s.backoff.Wait(c.ctx) {
+				break
+			}
+			atomic.AddUint64(&c.stats.retries, 1)
+		}
+
+		err = c.emit(s, batch)
+		if err == nil {
+			if unary {
+				s.backoff.Reset()
+			}
+			return nil
+		}
 		c.logger.Printf("Error while flushing: %s", err)
+		c.errorHandler(err)
+
+		if status.Code(err) == codes.ResourceExhausted {
+			return c.sendSplit(batch, err)
+		}
+
+		if c.ctx.Err() != nil {
+			break
+		}
 	}
 
 	return err
 }
 
-func (c *IngressClient) emit(batch []*loggregator_v2.Envelope) error {
-	if c.sender == nil {
-		var err error
-		c.sender, err = c.client.BatchSender(c.ctx)
+// sendSplit sends the two halves of a batch that was rejected for being too
+// large, splitting them further if they are rejected as well. An envelope
+// that is too large on its own is discarded and reported to the oversize
+// handler. The halves are sent with the unary Send RPC, so that a rejected
+// half cannot tear down a stream that carries the other.
+func (c *IngressClient) sendSplit(batch []*loggregator_v2.Envelope, err error) error {
+	if len(batch) == 1 {
+		atomic.AddUint64(&c.stats.failed, 1)
+		c.oversizeHandler(batch[0], err)
+		return nil
+	}
+
+	mid := len(batch) / 2
+	for _, half := range [][]*loggregator_v2.Envelope{batch[:mid], batch[mid:]} {
+		err := c.sendUnary(c.ctx, half)
+		if err == nil {
+			c.recordSent(len(half))
+		} else {
+			atomic.AddUint64(&c.stats.sendErrors, 1)
+		}
+		if status.Code(err) == codes.ResourceExhausted {
+			err = c.sendSplit(half, err)
+		}
 		if err != nil {
 			return err
 		}
 	}
 
-	err := c.sender.Send(&loggregator_v2.EnvelopeBatch{Batch: batch})
+	return nil
+}
+
+func (c *IngressClient) emit(s *ingressStream, batch []*loggregator_v2.Envelope) error {
+	if c.acked || c.batchWriter != nil {
+		return c.emitUnary(batch)
+	}
+
+	if c.unaryFallback > 0 && time.Now().Before(s.unaryUntil) {
+		return c.emitUnary(batch)
+	}
+
+	if s.sender == nil {
+		if s.failures > 0 && !s.backoff.Wait(c.ctx) {
+			return c.ctx.Err()
+		}
+
+		ctx, cancel := context.WithCancel(c.ctx)
+		sender, err := c.client.BatchSender(ctx)
+		if err != nil {
+			cancel()
+			atomic.AddUint64(&c.stats.sendErrors, 1)
+			c.streamFailed(s)
+			return err
+		}
+		s.sender, s.cancel = sender, cancel
+
+		if s.connected {
+			c.connObserver(Reconnected)
+		} else {
+			c.connObserver(Connected)
+		}
+		s.connected = true
+	}
+
+	err := c.sendStream(s, batch)
+	if err != nil {
+		atomic.AddUint64(&c.stats.sendErrors, 1)
+		s.cancel()
+		s.sender = nil
+		c.streamFailed(s)
+		c.connObserver(Disconnected)
+		return err
+	}
+
+	s.failures = 0
+	s.backoff.Reset()
+	c.recordSent(len(batch))
+
+	return nil
+}
+
+// streamFailed records a failure of the BatchSender stream. Once the
+// configured number of consecutive failures is reached, batches are sent
+// with the unary Send RPC until the stream is due to be tried again.
+func (c *IngressClient) streamFailed(s *ingressStream) {
+	s.failures++
+
+	if c.unaryFallback > 0 && s.failures >= c.unaryFallback {
+		c.logger.Printf("Stream failed %d times, falling back to unary sends", s.failures)
+		s.unaryUntil = time.Now().Add(c.unaryRetryStream)
+	}
+}
+
+func (c *IngressClient) emitUnary(batch []*loggregator_v2.Envelope) error {
+	err := c.sendUnary(c.ctx, batch)
 	if err != nil {
-		c.sender = nil
+		atomic.AddUint64(&c.stats.sendErrors, 1)
 		return err
 	}
+	c.recordSent(len(batch))
 
 	return nil
 }
@@ -562,11 +2020,24 @@ func WithEnvelopeTag(name, value string) func(proto.Message) {
 	return func(m proto.Message) {
 		switch e := m.(type) {
 		case *loggregator_v2.Envelope:
-			e.Tags[name] = value
+			setTag(e, name, value)
 		case protoEditor:
 			e.SetTag(name, value)
-		default:
-			panic(fmt.Sprintf("unsupported Message type: %T", m))
+		}
+	}
+}
+
+// WithTimestamp sets the envelope's timestamp, which otherwise is the time
+// the envelope is emitted. It can be passed to any of the Emit methods, e.g.
+// to keep the original times of events replayed from files or another
+// system.
+func WithTimestamp(t time.Time) func(proto.Message) {
+	return func(m proto.Message) {
+		switch e := m.(type) {
+		case *loggregator_v2.Envelope:
+			e.Timestamp = t.UnixNano()
+		case timestampEditor:
+			e.SetTimestamp(t.UnixNano())
 		}
 	}
 }
@@ -579,14 +2050,19 @@ func WithEnvelopeTags(tags map[string]string) func(proto.Message) {
 		switch e := m.(type) {
 		case *loggregator_v2.Envelope:
 			for name, value := range tags {
-				e.Tags[name] = value
+				setTag(e, name, value)
 			}
 		case protoEditor:
 			for name, value := range tags {
 				e.SetTag(name, value)
 			}
-		default:
-			panic(fmt.Sprintf("unsupported Message type: %T", m))
 		}
 	}
 }
+
+func setTag(e *loggregator_v2.Envelope, name, value string) {
+	if e.Tags == nil {
+		e.Tags = make(map[string]string)
+	}
+	e.Tags[name] = value
+}
@@ -1,18 +1,35 @@
 package loggregator_test
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/conversion"
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"code.cloudfoundry.org/go-loggregator/runtimeemitter"
+	"code.cloudfoundry.org/go-loggregator/units"
+	"github.com/golang/protobuf/proto"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
@@ -143,6 +160,50 @@ var _ = Describe("IngressClient", func() {
 		Expect(log.Type).To(Equal(loggregator_v2.Log_OUT))
 	})
 
+	It("sends logs with structured fields", func() {
+		client.EmitLog(
+			"message",
+			loggregator.WithLogFields(map[string]interface{}{
+				"user":    "alice",
+				"count":   2,
+				"message": "ignored",
+			}),
+			loggregator.WithLogFields(map[string]interface{}{"ok": true}),
+		)
+		env, err := getEnvelopeAt(server.receivers, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(env.GetLog().GetPayload()).To(MatchJSON(
+			`{"message": "message", "user": "alice", "count": 2, "ok": true}`,
+		))
+	})
+
+	It("sends logs with a context", func() {
+		err := client.EmitLogContext(
+			context.Background(),
+			"message",
+			loggregator.WithSourceInfo("source-id", "source-type", "source-instance"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		env, err := getEnvelopeAt(server.receivers, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(env.SourceId).To(Equal("source-id"))
+		Expect(env.GetLog().Payload).To(Equal([]byte("message")))
+	})
+
+	It("returns the context error when the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		Expect(client.EmitLogContext(ctx, "message")).To(MatchError(context.Canceled))
+		Expect(client.EmitGaugeContext(ctx)).To(MatchError(context.Canceled))
+		Expect(client.EmitCounterContext(ctx, "counter")).To(MatchError(context.Canceled))
+		Expect(client.EmitTimerContext(ctx, "timer", time.Now(), time.Now())).To(MatchError(context.Canceled))
+		Expect(client.EmitContext(ctx, &loggregator_v2.Envelope{})).To(MatchError(context.Canceled))
+	})
+
 	It("sends app error logs", func() {
 		client.EmitLog(
 			"message",
@@ -186,6 +247,17 @@ var _ = Describe("IngressClient", func() {
 		Expect(env.Tags["some-tag"]).To(Equal("some-tag-value"))
 	})
 
+	It("sends gauge tags", func() {
+		client.EmitGauge(
+			loggregator.WithGaugeValue("name", 1, "unit"),
+			loggregator.WithGaugeTags(map[string]string{"some-tag": "some-tag-value"}),
+		)
+
+		env, err := getEnvelopeAt(server.receivers, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env.Tags).To(HaveKeyWithValue("some-tag", "some-tag-value"))
+	})
+
 	It("sends gauge metrics", func() {
 		client.EmitGauge(
 			loggregator.WithGaugeValue("name-a", 1, "unit-a"),
@@ -209,6 +281,61 @@ var _ = Describe("IngressClient", func() {
 		Expect(env.Tags["some-tag"]).To(Equal("some-tag-value"))
 	})
 
+	It("sends logs with a severity", func() {
+		client.Info("started")
+		client.Error("failed")
+		client.Warn("slow", loggregator.WithEnvelopeTag("extra", "tag"))
+
+		var recv loggregator_v2.Ingress_BatchSenderServer
+		Eventually(server.receivers, 10).Should(Receive(&recv))
+
+		var envs []*loggregator_v2.Envelope
+		for len(envs) < 3 {
+			b, err := recv.Recv()
+			Expect(err).ToNot(HaveOccurred())
+			envs = append(envs, b.GetBatch()...)
+		}
+
+		Expect(envs[0].Tags).To(HaveKeyWithValue("level", "info"))
+		Expect(envs[0].GetLog().Type).To(Equal(loggregator_v2.Log_OUT))
+		Expect(envs[1].Tags).To(HaveKeyWithValue("level", "error"))
+		Expect(envs[1].GetLog().Type).To(Equal(loggregator_v2.Log_ERR))
+		Expect(envs[2].Tags).To(HaveKeyWithValue("level", "warn"))
+		Expect(envs[2].Tags).To(HaveKeyWithValue("extra", "tag"))
+		Expect(envs[2].GetLog().Type).To(Equal(loggregator_v2.Log_OUT))
+	})
+
+	It("sends the units of gauge metrics as given", func() {
+		client.EmitGauge(
+			loggregator.WithGaugeValue("latency", 1, "ms"),
+		)
+
+		env, err := getEnvelopeAt(server.receivers, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(env.GetGauge().GetMetrics()["latency"].Unit).To(Equal("ms"))
+	})
+
+	It("sends app counters", func() {
+		client.EmitCounter(
+			"counter-name",
+			loggregator.WithDelta(5),
+			loggregator.WithEnvelopeTags(map[string]string{"some-tag": "some-tag-value"}),
+			loggregator.WithCounterAppInfo("app-id", 123),
+		)
+
+		env, err := getEnvelopeAt(server.receivers, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		counter := env.GetCounter()
+		Expect(counter).NotTo(BeNil())
+		Expect(counter.GetName()).To(Equal("counter-name"))
+		Expect(counter.GetDelta()).To(Equal(uint64(5)))
+		Expect(env.SourceId).To(Equal("app-id"))
+		Expect(env.InstanceId).To(Equal("123"))
+		Expect(env.Tags["some-tag"]).To(Equal("some-tag-value"))
+	})
+
 	It("sends timers", func() {
 		stopTime := time.Now()
 		startTime := stopTime.Add(-time.Minute)
@@ -232,6 +359,27 @@ var _ = Describe("IngressClient", func() {
 		Expect(timer.GetStop()).To(Equal(stopTime.UnixNano()))
 	})
 
+	It("sends envelopes with the given timestamp", func() {
+		ts := time.Unix(1500000000, 0)
+		client.EmitLog("message", loggregator.WithTimestamp(ts))
+		client.EmitCounter("counter", loggregator.WithTimestamp(ts))
+		client.EmitGauge(loggregator.WithTimestamp(ts), loggregator.WithGaugeValue("gauge", 1, "unit"))
+		client.EmitTimer("timer", time.Now(), time.Now(), loggregator.WithTimestamp(ts))
+
+		var recv loggregator_v2.Ingress_BatchSenderServer
+		Eventually(server.receivers, 10).Should(Receive(&recv))
+
+		var received int
+		for received < 4 {
+			b, err := recv.Recv()
+			Expect(err).ToNot(HaveOccurred())
+			for _, e := range b.GetBatch() {
+				Expect(e.GetTimestamp()).To(Equal(ts.UnixNano()))
+				received++
+			}
+		}
+	})
+
 	It("sends envelopes", func() {
 		stopTime := time.Now()
 		startTime := stopTime.Add(-time.Minute)
@@ -265,6 +413,59 @@ var _ = Describe("IngressClient", func() {
 		Expect(timer.GetStop()).To(Equal(stopTime.UnixNano()))
 	})
 
+	It("uses the given dial options", func() {
+		tlsConfig, err := loggregator.NewIngressTLSConfig(
+			fixture("CA.crt"),
+			fixture("client.crt"),
+			fixture("client.key"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		streams := make(chan string, 10)
+		client, err := loggregator.NewIngressClient(
+			tlsConfig,
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithDialOptions(grpc.WithStreamInterceptor(
+				func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+					streams <- method
+					return streamer(ctx, desc, cc, method, opts...)
+				},
+			)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+
+		Eventually(streams).Should(Receive(Equal("/loggregator.v2.Ingress/BatchSender")))
+	})
+
+	It("sends envelopes with the given keepalive parameters", func() {
+		tlsConfig, err := loggregator.NewIngressTLSConfig(
+			fixture("CA.crt"),
+			fixture("client.crt"),
+			fixture("client.key"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client, err := loggregator.NewIngressClient(
+			tlsConfig,
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithKeepalive(keepalive.ClientParameters{
+				Time:    time.Minute,
+				Timeout: time.Second,
+			}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+
+		env, err := getEnvelopeAt(server.receivers, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(env.GetLog().GetPayload()).To(Equal([]byte("message")))
+	})
+
 	It("works with the runtime emitter", func() {
 		// This test is to ensure that the v2 client satisfies the
 		// runtimeemitter.Sender interface. If it does not satisfy the
@@ -302,6 +503,32 @@ var _ = Describe("IngressClient", func() {
 		}),
 	)
 
+	It("ignores options that do not apply to the envelope", func() {
+		gauge := &loggregator_v2.Envelope{
+			Message: &loggregator_v2.Envelope_Gauge{
+				Gauge: &loggregator_v2.Gauge{},
+			},
+		}
+		log := &loggregator_v2.Envelope{
+			Message: &loggregator_v2.Envelope_Log{
+				Log: &loggregator_v2.Log{},
+			},
+		}
+
+		Expect(func() {
+			loggregator.WithStdout()(gauge)
+			loggregator.WithLogFields(map[string]interface{}{"a": 1})(gauge)
+			loggregator.WithDelta(1)(log)
+			loggregator.WithTotal(1)(log)
+			loggregator.WithGaugeValue("name", 1, "unit")(log)
+			loggregator.WithEnvelopeTag("name", "value")(log)
+			loggregator.WithStdout()(&loggregator_v2.EnvelopeBatch{})
+		}).ToNot(Panic())
+
+		Expect(gauge.GetGauge().GetMetrics()).To(BeEmpty())
+		Expect(log.GetTags()).To(Equal(map[string]string{"name": "value"}))
+	})
+
 	It("sets the counter's delta to the given value", func() {
 		e := &loggregator_v2.Envelope{
 			Message: &loggregator_v2.Envelope_Counter{
@@ -382,6 +609,32 @@ var _ = Describe("IngressClient", func() {
 		Expect(env.GetInstanceId()).To(Equal("instance-id"))
 	})
 
+	It("sends a batch synchronously", func() {
+		envs := []*loggregator_v2.Envelope{
+			{SourceId: "source-id-1"},
+			{SourceId: "source-id-2"},
+		}
+		Eventually(func() error {
+			return client.EmitBatch(context.Background(), envs)
+		}).Should(Succeed())
+
+		var envelopeBatch *loggregator_v2.EnvelopeBatch
+		Eventually(server.sendReceiver).Should(Receive(&envelopeBatch))
+		Expect(envelopeBatch.GetBatch()).To(HaveLen(2))
+		Expect(envelopeBatch.GetBatch()[0].GetSourceId()).To(Equal("source-id-1"))
+		Expect(envelopeBatch.GetBatch()[1].GetSourceId()).To(Equal("source-id-2"))
+	})
+
+	It("returns transport errors from EmitBatch", func() {
+		server.stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err := client.EmitBatch(ctx, []*loggregator_v2.Envelope{{}})
+		Expect(err).To(HaveOccurred())
+	})
+
 	// So this test is a bit... crazy. We want to ensure that gRPC gets to
 	// flush its buffer. However, gRPC is pretty good about getting data out
 	// of its process, therefore we have to fight it. We need to run the
@@ -417,6 +670,61 @@ var _ = Describe("IngressClient", func() {
 		err := client.CloseSend()
 		Expect(err).ToNot(HaveOccurred())
 	})
+
+	It("can be closed more than once", func(done Done) {
+		defer close(done)
+
+		Expect(client.CloseSend()).To(Succeed())
+		Expect(client.CloseSend()).To(Succeed())
+	})
+
+	It("drops envelopes emitted after it is closed", func(done Done) {
+		defer close(done)
+
+		Expect(client.CloseSend()).To(Succeed())
+
+		client.EmitLog("message")
+		Expect(client.EmitLogContext(context.Background(), "message")).To(MatchError(loggregator.ErrClosed))
+		Expect(client.TryEmit(&loggregator_v2.Envelope{})).To(MatchError(loggregator.ErrClosed))
+		Expect(client.Stats().Dropped).To(Equal(uint64(3)))
+		Expect(client.Stats().Emitted).To(BeZero())
+	})
+
+	It("does not panic when closed while emitting", func(done Done) {
+		defer close(done)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					err := client.EmitLogContext(context.Background(), "message")
+					if err == loggregator.ErrClosed {
+						return
+					}
+				}
+			}()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		client.CloseSendWithContext(ctx)
+		wg.Wait()
+	}, 5)
+
+	It("stops waiting for the server when the context is done", func(done Done) {
+		defer close(done)
+
+		client.EmitLog("message")
+		Expect(client.Flush(context.Background())).To(Succeed())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err := client.CloseSendWithContext(ctx)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	}, 5)
 })
 
 func getEnvelopesN(receivers chan loggregator_v2.Ingress_BatchSenderServer, n int) ([]*loggregator_v2.Envelope, error) {
@@ -487,3 +795,2044 @@ func buildIngressClient(serverAddr string, flushInterval time.Duration, addConte
 
 	return client, cancel
 }
+
+var _ = Describe("Insecure IngressClient", func() {
+	It("sends envelopes without TLS", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+
+		env, err := getEnvelopeAt(server.receivers, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(env.GetLog().GetPayload()).To(Equal([]byte("message")))
+	})
+
+	It("does not fall back to plaintext for a nil TLS config", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+		received := server.collect()
+
+		client, err := loggregator.NewIngressClient(
+			nil,
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+
+		Consistently(received, 500*time.Millisecond).ShouldNot(Receive())
+	})
+})
+
+var _ = Describe("IngressClient connection observer", func() {
+	It("reports connects, disconnects and reconnects", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		go func() {
+			for srv := range server.receivers {
+				go func(srv loggregator_v2.Ingress_BatchSenderServer) {
+					for {
+						if _, err := srv.Recv(); err != nil {
+							return
+						}
+					}
+				}(srv)
+			}
+		}()
+
+		states := make(chan loggregator.ConnState, 100)
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithConnectionObserver(func(s loggregator.ConnState) {
+				states <- s
+			}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		emitAndDrain := func() []loggregator.ConnState {
+			client.EmitLog("message")
+			time.Sleep(20 * time.Millisecond)
+			var received []loggregator.ConnState
+			for len(states) > 0 {
+				received = append(received, <-states)
+			}
+			return received
+		}
+
+		Eventually(emitAndDrain).Should(Equal([]loggregator.ConnState{loggregator.Connected}))
+
+		server.stop()
+		Eventually(emitAndDrain, 5).Should(ContainElement(loggregator.Disconnected))
+
+		Expect(server.start()).To(Succeed())
+		Eventually(emitAndDrain, 5).Should(ContainElement(loggregator.Reconnected))
+	})
+
+	It("has readable state names", func() {
+		Expect(loggregator.Connected.String()).To(Equal("Connected"))
+		Expect(loggregator.Disconnected.String()).To(Equal("Disconnected"))
+		Expect(loggregator.Reconnected.String()).To(Equal("Reconnected"))
+	})
+})
+
+var _ = Describe("IngressClient defaults", func() {
+	It("stamps the default source and instance IDs on every envelope", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(time.Hour),
+			loggregator.WithDefaultSourceID("default-source"),
+			loggregator.WithDefaultInstanceID("default-instance"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+		client.EmitCounter("counter", loggregator.WithCounterSourceInfo("other-source", "0"))
+		client.EmitGauge(loggregator.WithGaugeValue("gauge", 1, "unit"))
+		client.EmitTimer("timer", time.Now(), time.Now())
+		client.Emit(&loggregator_v2.Envelope{})
+		go client.Flush(context.Background())
+
+		var recv loggregator_v2.Ingress_BatchSenderServer
+		Eventually(server.receivers, 5).Should(Receive(&recv))
+		b, err := recv.Recv()
+		Expect(err).ToNot(HaveOccurred())
+
+		var ids []string
+		for _, e := range b.GetBatch() {
+			ids = append(ids, e.GetSourceId()+"/"+e.GetInstanceId())
+		}
+		Expect(ids).To(Equal([]string{
+			"default-source/default-instance",
+			"other-source/0",
+			"default-source/default-instance",
+			"default-source/default-instance",
+			"default-source/default-instance",
+		}))
+	})
+})
+
+var _ = Describe("IngressClient deprecated tags", func() {
+	It("sends tags as deprecated tags", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithTag("client-tag", "client-value"),
+			loggregator.WithDeprecatedTags(),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message", loggregator.WithEnvelopeTag("envelope-tag", "envelope-value"))
+
+		env, err := getEnvelopeAt(server.receivers, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(env.GetTags()).To(BeEmpty())
+		Expect(env.GetDeprecatedTags()).To(HaveLen(2))
+		Expect(env.GetDeprecatedTags()["client-tag"].GetText()).To(Equal("client-value"))
+		Expect(env.GetDeprecatedTags()["envelope-tag"].GetText()).To(Equal("envelope-value"))
+	})
+})
+
+var _ = Describe("IngressClient send time tags", func() {
+	var server *testIngressServer
+
+	BeforeEach(func() {
+		server = newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		server.stop()
+	})
+
+	It("adds the client's tags to every envelope as it is batched", func() {
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(time.Hour),
+			loggregator.WithTag("client-tag", "client-value"),
+			loggregator.WithTag("overridden", "client-value"),
+			loggregator.WithSendTimeTags(),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message", loggregator.WithEnvelopeTag("overridden", "envelope-value"))
+		client.Emit(&loggregator_v2.Envelope{})
+		go client.Flush(context.Background())
+
+		var recv loggregator_v2.Ingress_BatchSenderServer
+		Eventually(server.receivers, 5).Should(Receive(&recv))
+		b, err := recv.Recv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b.GetBatch()).To(HaveLen(2))
+
+		Expect(b.GetBatch()[0].GetTags()).To(Equal(map[string]string{
+			"client-tag": "client-value",
+			"overridden": "envelope-value",
+		}))
+		Expect(b.GetBatch()[1].GetTags()).To(Equal(map[string]string{
+			"client-tag": "client-value",
+			"overridden": "client-value",
+		}))
+	})
+
+	It("adds the client's tags to events", func() {
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithTag("client-tag", "client-value"),
+			loggregator.WithSendTimeTags(),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() error {
+			return client.EmitEvent(context.Background(), "title", "body")
+		}).Should(Succeed())
+
+		var b *loggregator_v2.EnvelopeBatch
+		Eventually(server.sendReceiver).Should(Receive(&b))
+		Expect(b.GetBatch()[0].GetTags()).To(Equal(map[string]string{
+			"client-tag": "client-value",
+		}))
+	})
+
+	It("adds the client's tags to batches sent with EmitBatch", func() {
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithTag("client-tag", "client-value"),
+			loggregator.WithSendTimeTags(),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() error {
+			return client.EmitBatch(context.Background(), []*loggregator_v2.Envelope{{}})
+		}).Should(Succeed())
+
+		var b *loggregator_v2.EnvelopeBatch
+		Eventually(server.sendReceiver).Should(Receive(&b))
+		Expect(b.GetBatch()[0].GetTags()).To(Equal(map[string]string{
+			"client-tag": "client-value",
+		}))
+	})
+
+	It("gives the client's tags precedence over context tags", func() {
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithTag("client-tag", "client-value"),
+			loggregator.WithSendTimeTags(),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx := loggregator.ContextWithTags(context.Background(), map[string]string{
+			"client-tag": "context-value",
+			"request_id": "abc",
+		})
+		Expect(client.EmitLogContext(ctx, "message")).To(Succeed())
+
+		env, err := getEnvelopeAt(server.receivers, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(env.GetTags()).To(Equal(map[string]string{
+			"client-tag": "client-value",
+			"request_id": "abc",
+		}))
+	})
+
+	It("adds the client's tags as deprecated tags", func() {
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithTag("client-tag", "client-value"),
+			loggregator.WithDeprecatedTags(),
+			loggregator.WithSendTimeTags(),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message", loggregator.WithEnvelopeTag("envelope-tag", "envelope-value"))
+
+		env, err := getEnvelopeAt(server.receivers, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(env.GetTags()).To(BeEmpty())
+		Expect(env.GetDeprecatedTags()).To(HaveLen(2))
+		Expect(env.GetDeprecatedTags()["client-tag"].GetText()).To(Equal("client-value"))
+		Expect(env.GetDeprecatedTags()["envelope-tag"].GetText()).To(Equal("envelope-value"))
+	})
+})
+
+var _ = Describe("IngressClient batch size in bytes", func() {
+	It("keeps batches below the maximum size", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(time.Hour),
+			loggregator.WithBatchMaxBytes(400),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		payload := strings.Repeat("x", 100)
+		for i := 0; i < 10; i++ {
+			client.EmitLog(payload)
+		}
+		go client.Flush(context.Background())
+
+		var recv loggregator_v2.Ingress_BatchSenderServer
+		Eventually(server.receivers, 5).Should(Receive(&recv))
+
+		var received, batches int
+		for received < 10 {
+			b, err := recv.Recv()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(proto.Size(b)).To(BeNumerically("<=", 400))
+			received += len(b.GetBatch())
+			batches++
+		}
+		Expect(received).To(Equal(10))
+		Expect(batches).To(BeNumerically(">=", 3))
+		Expect(batches).To(BeNumerically("<", 10))
+	})
+})
+
+var _ = Describe("IngressClient oversize batches", func() {
+	It("splits rejected batches and drops only oversize envelopes", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+		go func() {
+			for srv := range server.receivers {
+				srv.Recv()
+			}
+		}()
+
+		oversize := make(chan *loggregator_v2.Envelope, 10)
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(time.Hour),
+			loggregator.WithDialOptions(grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(300))),
+			loggregator.WithOversizeHandler(func(e *loggregator_v2.Envelope, err error) {
+				oversize <- e
+			}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("a")
+		client.EmitLog("b")
+		client.EmitLog(strings.Repeat("x", 500))
+		client.EmitLog("c")
+		Expect(client.Flush(context.Background())).To(Succeed())
+
+		var e *loggregator_v2.Envelope
+		Eventually(oversize).Should(Receive(&e))
+		Expect(e.GetLog().GetPayload()).To(HaveLen(500))
+
+		var payloads []string
+		for len(server.sendReceiver) > 0 {
+			for _, e := range (<-server.sendReceiver).GetBatch() {
+				payloads = append(payloads, string(e.GetLog().GetPayload()))
+			}
+		}
+		Expect(payloads).To(Equal([]string{"a", "b", "c"}))
+	})
+})
+
+var _ = Describe("IngressClient Flush", func() {
+	var (
+		server *testIngressServer
+		client *loggregator.IngressClient
+	)
+
+	BeforeEach(func() {
+		server = newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+
+		var err error
+		client, err = loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(time.Hour),
+		)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.stop()
+	})
+
+	It("sends the partial batch", func() {
+		for i := 0; i < 3; i++ {
+			client.EmitLog("message")
+		}
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- client.Flush(context.Background())
+		}()
+
+		var recv loggregator_v2.Ingress_BatchSenderServer
+		Eventually(server.receivers, 5).Should(Receive(&recv))
+		b, err := recv.Recv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b.GetBatch()).To(HaveLen(3))
+		Eventually(errs).Should(Receive(BeNil()))
+	})
+
+	It("returns an error once the client is closed", func() {
+		go func() {
+			for srv := range server.receivers {
+				srv.Recv()
+			}
+		}()
+		Expect(client.CloseSend()).To(Succeed())
+
+		Expect(client.Flush(context.Background())).To(MatchError(loggregator.ErrClosed))
+	})
+})
+
+var _ = Describe("IngressClient flush interval", func() {
+	var (
+		server   *testIngressServer
+		received chan *loggregator_v2.Envelope
+	)
+
+	BeforeEach(func() {
+		server = newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		received = server.collect()
+	})
+
+	AfterEach(func() {
+		server.stop()
+	})
+
+	It("sends a partial batch within the flush interval", func() {
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(200*time.Millisecond),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		// Let the stream connect so that only the interval is measured.
+		client.EmitLog("first")
+		Eventually(received, 5).Should(Receive())
+
+		client.EmitLog("second")
+		Eventually(received, 400*time.Millisecond).Should(Receive())
+	})
+
+	It("keeps flushing on the interval after a full batch is sent", func() {
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchMaxSize(2),
+			loggregator.WithBatchFlushInterval(200*time.Millisecond),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("first")
+		client.EmitLog("second")
+		Eventually(received, 5).Should(Receive())
+		Eventually(received, 5).Should(Receive())
+
+		for i := 0; i < 3; i++ {
+			client.EmitLog("partial")
+			Eventually(received, 400*time.Millisecond).Should(Receive())
+		}
+	})
+
+	It("does not send empty batches on the interval", func() {
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+		Eventually(received, 5).Should(Receive())
+		Consistently(received, 100*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("returns an error for a non-positive interval", func() {
+		for _, d := range []time.Duration{0, -time.Second} {
+			_, err := loggregator.NewInsecureIngressClient(
+				loggregator.WithAddr(server.addr),
+				loggregator.WithBatchFlushInterval(d),
+			)
+			Expect(err).To(HaveOccurred())
+		}
+	})
+})
+
+var _ = Describe("IngressClient addresses", func() {
+	It("rejects addresses without a port", func() {
+		_, err := loggregator.NewInsecureIngressClient(loggregator.WithAddr("localhost"))
+		Expect(err).To(MatchError(ContainSubstring(`invalid loggregator address "localhost"`)))
+
+		_, err = loggregator.NewInsecureIngressClient(loggregator.WithAddrs("localhost:3458", "localhost:"))
+		Expect(err).To(MatchError(ContainSubstring("missing port")))
+	})
+
+	It("requires an address", func() {
+		_, err := loggregator.NewInsecureIngressClient(loggregator.WithAddrs())
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("connects to the first address that accepts a connection", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		deadAddr := l.Addr().String()
+		Expect(l.Close()).To(Succeed())
+
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+		received := server.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddrs(deadAddr, server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+		Eventually(received, 5).Should(Receive())
+	})
+
+	It("fails over when the connected address goes away", func() {
+		first := newInsecureTestIngressServer()
+		Expect(first.start()).To(Succeed())
+		firstReceived := first.collect()
+
+		second := newInsecureTestIngressServer()
+		Expect(second.start()).To(Succeed())
+		defer second.stop()
+		secondReceived := second.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddrs(first.addr, second.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+		Eventually(firstReceived, 5).Should(Receive())
+
+		first.stop()
+
+		Eventually(func() int {
+			client.EmitLog("message")
+			return len(secondReceived)
+		}, 5, 50*time.Millisecond).ShouldNot(BeZero())
+	})
+})
+
+var _ = Describe("IngressClient Unix socket", func() {
+	It("sends envelopes over a Unix domain socket", func() {
+		dir, err := ioutil.TempDir("", "loggregator")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		server := newInsecureTestIngressServer()
+		Expect(server.startUnix(filepath.Join(dir, "agent.sock"))).To(Succeed())
+		defer server.stop()
+		received := server.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithUnixSocket(filepath.Join(dir, "agent.sock")),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+
+		var e *loggregator_v2.Envelope
+		Eventually(received, 5).Should(Receive(&e))
+		Expect(e.GetLog().GetPayload()).To(Equal([]byte("message")))
+	})
+})
+
+var _ = Describe("IngressClient sender concurrency", func() {
+	var (
+		server   *testIngressServer
+		received chan *loggregator_v2.Envelope
+		streams  int32
+		gate     chan struct{}
+	)
+
+	gatedInterceptor := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		atomic.AddInt32(&streams, 1)
+		s, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &gatedClientStream{ClientStream: s, gate: gate}, nil
+	}
+
+	BeforeEach(func() {
+		server = newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		received = server.collect()
+		atomic.StoreInt32(&streams, 0)
+		gate = make(chan struct{})
+	})
+
+	AfterEach(func() {
+		server.stop()
+	})
+
+	It("sends batches over several streams in parallel", func() {
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchMaxSize(1),
+			loggregator.WithSenderConcurrency(3),
+			loggregator.WithDialOptions(grpc.WithStreamInterceptor(gatedInterceptor)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		for i := 0; i < 10; i++ {
+			client.EmitLog("message")
+		}
+
+		// Every stream is blocked on its first batch, so each batch is
+		// taken up by a stream that is still free.
+		Eventually(func() int32 { return atomic.LoadInt32(&streams) }).Should(Equal(int32(3)))
+		Consistently(func() int32 { return atomic.LoadInt32(&streams) }).Should(Equal(int32(3)))
+
+		close(gate)
+		Expect(client.Flush(context.Background())).To(Succeed())
+		Eventually(received).Should(HaveLen(10))
+	})
+
+	It("sends every batch in flight before closing", func() {
+		close(gate)
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchMaxSize(2),
+			loggregator.WithBatchFlushInterval(time.Hour),
+			loggregator.WithSenderConcurrency(2),
+			loggregator.WithDialOptions(grpc.WithStreamInterceptor(gatedInterceptor)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		for i := 0; i < 5; i++ {
+			client.EmitLog("message")
+		}
+
+		// The test server never ends the streams, so closing does not
+		// complete; every batch is written before the streams are closed.
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		client.CloseSendWithContext(ctx)
+
+		Eventually(received).Should(HaveLen(5))
+	})
+})
+
+type gatedClientStream struct {
+	grpc.ClientStream
+	gate chan struct{}
+}
+
+func (s *gatedClientStream) SendMsg(m interface{}) error {
+	<-s.gate
+	return s.ClientStream.SendMsg(m)
+}
+
+var _ = Describe("IngressClient retries", func() {
+	var (
+		server   *testIngressServer
+		attempts chan time.Time
+		failures int32
+	)
+
+	failingInterceptor := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		attempts <- time.Now()
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			return nil, errors.New("unavailable")
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+
+	BeforeEach(func() {
+		server = newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		attempts = make(chan time.Time, 100)
+	})
+
+	AfterEach(func() {
+		server.stop()
+	})
+
+	It("backs off and resends a failed batch", func() {
+		atomic.StoreInt32(&failures, 2)
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithRetryBackoff(50*time.Millisecond, time.Second),
+			loggregator.WithMaxRetries(2),
+			loggregator.WithDialOptions(grpc.WithStreamInterceptor(failingInterceptor)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+
+		env, err := getEnvelopeAt(server.receivers, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(env.GetLog().GetPayload()).To(Equal([]byte("message")))
+
+		Expect(attempts).To(HaveLen(3))
+		first, second, third := <-attempts, <-attempts, <-attempts
+		Expect(second.Sub(first)).To(BeNumerically(">=", 25*time.Millisecond))
+		Expect(third.Sub(second)).To(BeNumerically(">=", 50*time.Millisecond))
+	})
+
+	It("reports batches that could not be sent", func() {
+		atomic.StoreInt32(&failures, 1000)
+		failed := make(chan []*loggregator_v2.Envelope, 10)
+		errs := make(chan error, 10)
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithRetryBackoff(time.Millisecond, 10*time.Millisecond),
+			loggregator.WithMaxRetries(2),
+			loggregator.WithDialOptions(grpc.WithStreamInterceptor(failingInterceptor)),
+			loggregator.WithPermanentFailureHandler(func(batch []*loggregator_v2.Envelope, err error) {
+				errs <- err
+				failed <- batch
+			}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+
+		var batch []*loggregator_v2.Envelope
+		Eventually(failed).Should(Receive(&batch))
+		Expect(batch).To(HaveLen(1))
+		Expect(batch[0].GetLog().GetPayload()).To(Equal([]byte("message")))
+		Expect(errs).To(Receive(MatchError(ContainSubstring("unavailable"))))
+		Expect(attempts).To(HaveLen(3))
+	})
+
+	It("reports every failed send to the error handler", func() {
+		atomic.StoreInt32(&failures, 2)
+		errs := make(chan error, 10)
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithRetryBackoff(time.Millisecond, 10*time.Millisecond),
+			loggregator.WithMaxRetries(2),
+			loggregator.WithDialOptions(grpc.WithStreamInterceptor(failingInterceptor)),
+			loggregator.WithErrorHandler(func(err error) {
+				errs <- err
+			}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+
+		_, err = getEnvelopeAt(server.receivers, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(errs).To(HaveLen(2))
+		Expect(errs).To(Receive(MatchError(ContainSubstring("unavailable"))))
+	})
+})
+
+var _ = Describe("IngressClient acknowledged delivery", func() {
+	It("sends batches with Send and resends them until they are acknowledged", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		failures := int32(2)
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithRetryBackoff(time.Millisecond, 10*time.Millisecond),
+			loggregator.WithAcknowledgedDelivery(3),
+			loggregator.WithDialOptions(grpc.WithUnaryInterceptor(
+				func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+					if atomic.AddInt32(&failures, -1) >= 0 {
+						return errors.New("unavailable")
+					}
+					return invoker(ctx, method, req, reply, cc, opts...)
+				},
+			)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+
+		var batch *loggregator_v2.EnvelopeBatch
+		Eventually(server.sendReceiver).Should(Receive(&batch))
+		Expect(batch.GetBatch()).To(HaveLen(1))
+		Expect(batch.GetBatch()[0].GetLog().GetPayload()).To(Equal([]byte("message")))
+		Expect(client.Stats().Retries).To(Equal(uint64(2)))
+		Expect(server.receivers).ToNot(Receive())
+	})
+
+	It("gives up after the maximum number of attempts", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		var attempts int32
+		failed := make(chan []*loggregator_v2.Envelope, 10)
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithAcknowledgedDelivery(4),
+			loggregator.WithPermanentFailureHandler(func(batch []*loggregator_v2.Envelope, _ error) {
+				failed <- batch
+			}),
+			loggregator.WithDialOptions(grpc.WithUnaryInterceptor(
+				func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, grpc.UnaryInvoker, ...grpc.CallOption) error {
+					atomic.AddInt32(&attempts, 1)
+					return errors.New("unavailable")
+				},
+			)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+
+		Eventually(failed).Should(Receive(HaveLen(1)))
+		Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(4)))
+	})
+})
+
+var _ = Describe("IngressClient unary fallback", func() {
+	It("sends batches with Send after repeated stream failures", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		streams := make(chan string, 100)
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(time.Hour),
+			loggregator.WithMaxRetries(2),
+			loggregator.WithUnaryFallback(2, time.Hour),
+			loggregator.WithDialOptions(grpc.WithStreamInterceptor(
+				func(_ context.Context, _ *grpc.StreamDesc, _ *grpc.ClientConn, method string, _ grpc.Streamer, _ ...grpc.CallOption) (grpc.ClientStream, error) {
+					streams <- method
+					return nil, errors.New("unavailable")
+				},
+			)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("first")
+		Expect(client.Flush(context.Background())).To(Succeed())
+		client.EmitLog("second")
+		Expect(client.Flush(context.Background())).To(Succeed())
+
+		Expect(streams).To(HaveLen(2))
+
+		var b *loggregator_v2.EnvelopeBatch
+		Expect(server.sendReceiver).To(Receive(&b))
+		Expect(b.GetBatch()[0].GetLog().GetPayload()).To(Equal([]byte("first")))
+		Expect(server.sendReceiver).To(Receive(&b))
+		Expect(b.GetBatch()[0].GetLog().GetPayload()).To(Equal([]byte("second")))
+	})
+})
+
+var _ = Describe("IngressClient disk buffer", func() {
+	var (
+		server *testIngressServer
+		dir    string
+	)
+
+	failingInterceptor := grpc.WithStreamInterceptor(
+		func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, grpc.Streamer, ...grpc.CallOption) (grpc.ClientStream, error) {
+			return nil, errors.New("unavailable")
+		},
+	)
+
+	spooled := func() int {
+		infos, err := ioutil.ReadDir(dir)
+		Expect(err).ToNot(HaveOccurred())
+		return len(infos)
+	}
+
+	BeforeEach(func() {
+		server = newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+
+		var err error
+		dir, err = ioutil.TempDir("", "disk-buffer")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.stop()
+		os.RemoveAll(dir)
+	})
+
+	It("replays spooled batches in order before new ones", func() {
+		failing, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithDiskBuffer(dir, 1<<20),
+			loggregator.WithDialOptions(failingInterceptor),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		failing.EmitLog("first")
+		Eventually(spooled).Should(Equal(1))
+		failing.EmitLog("second")
+		Eventually(spooled).Should(Equal(2))
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithDiskBuffer(dir, 1<<20),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("third")
+
+		var recv loggregator_v2.Ingress_BatchSenderServer
+		Eventually(server.receivers, 5).Should(Receive(&recv))
+		for _, payload := range []string{"first", "second", "third"} {
+			b, err := recv.Recv()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b.GetBatch()[0].GetLog().GetPayload()).To(Equal([]byte(payload)))
+		}
+		Eventually(spooled).Should(Equal(0))
+	})
+
+	It("reports batches that do not fit in the disk buffer", func() {
+		failed := make(chan error, 10)
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithDiskBuffer(dir, 1),
+			loggregator.WithDialOptions(failingInterceptor),
+			loggregator.WithPermanentFailureHandler(func(_ []*loggregator_v2.Envelope, err error) {
+				failed <- err
+			}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+
+		Eventually(failed).Should(Receive(MatchError(ContainSubstring("unavailable"))))
+		Expect(spooled()).To(Equal(0))
+	})
+})
+
+var _ = Describe("IngressClient rate limiting", func() {
+	It("throttles envelopes of the limited type only", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		received := server.collect()
+
+		var throttled int64
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithRateLimit(loggregator.LogEnvelope, 5),
+			loggregator.WithThrottleAlerter(func(t loggregator.EnvelopeType, n int) {
+				Expect(t).To(Equal(loggregator.LogEnvelope))
+				atomic.AddInt64(&throttled, int64(n))
+			}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		for i := 0; i < 20; i++ {
+			client.EmitLog("message")
+		}
+		for i := 0; i < 3; i++ {
+			client.EmitCounter("counter")
+		}
+
+		var logs, counters int
+		Eventually(func() int {
+			for len(received) > 0 {
+				e := <-received
+				if e.GetLog() != nil {
+					logs++
+				}
+				if e.GetCounter() != nil {
+					counters++
+				}
+			}
+			return counters
+		}).Should(Equal(3))
+
+		Expect(logs).To(BeNumerically(">=", 5))
+		Expect(int64(logs) + atomic.LoadInt64(&throttled)).To(Equal(int64(20)))
+		Expect(atomic.LoadInt64(&throttled)).To(BeNumerically(">=", 10))
+	})
+})
+
+var _ = Describe("IngressClient source quota", func() {
+	It("limits the envelopes of each source ID per interval", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		received := server.collect()
+
+		var mu sync.Mutex
+		exceeded := make(map[string]int)
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithSourceQuota(5, time.Hour),
+			loggregator.WithQuotaAlerter(func(sourceID string, n int) {
+				mu.Lock()
+				defer mu.Unlock()
+				exceeded[sourceID] += n
+			}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		for i := 0; i < 20; i++ {
+			client.EmitLog("message", loggregator.WithSourceInfo("noisy", "", ""))
+		}
+		for i := 0; i < 3; i++ {
+			client.EmitLog("message", loggregator.WithSourceInfo("quiet", "", ""))
+		}
+
+		perSource := make(map[string]int)
+		Eventually(func() int {
+			for len(received) > 0 {
+				perSource[(<-received).GetSourceId()]++
+			}
+			return perSource["noisy"] + perSource["quiet"]
+		}).Should(Equal(8))
+		Consistently(received).ShouldNot(Receive())
+
+		Expect(perSource).To(Equal(map[string]int{"noisy": 5, "quiet": 3}))
+		mu.Lock()
+		Expect(exceeded).To(Equal(map[string]int{"noisy": 15}))
+		mu.Unlock()
+		Expect(client.Stats().QuotaExceeded).To(Equal(uint64(15)))
+	})
+
+	It("resets quotas every interval", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		received := server.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithSourceQuota(1, 100*time.Millisecond),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("first")
+		client.EmitLog("over quota")
+		Eventually(received).Should(Receive())
+
+		time.Sleep(150 * time.Millisecond)
+		client.EmitLog("second")
+
+		var e *loggregator_v2.Envelope
+		Eventually(received).Should(Receive(&e))
+		Expect(e.GetLog().GetPayload()).To(Equal([]byte("second")))
+	})
+})
+
+var _ = Describe("IngressClient cert reload", func() {
+	It("presents the reloaded certificate on new connections", func() {
+		server, err := newTestIngressServer(
+			fixture("server.crt"),
+			fixture("server.key"),
+			fixture("CA.crt"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		commonNames := make(chan string, 100)
+		server.tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			cert, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return err
+			}
+			commonNames <- cert.Subject.CommonName
+			return nil
+		}
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		certPath := fixture("client.crt")
+		keyPath := fixture("client.key")
+
+		tlsConfig, err := loggregator.NewIngressTLSConfig(fixture("CA.crt"), certPath, keyPath)
+		Expect(err).ToNot(HaveOccurred())
+
+		client, err := loggregator.NewIngressClient(
+			tlsConfig,
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithCertReload(certPath, keyPath, 10*time.Millisecond),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+		Eventually(commonNames).Should(Receive(Equal("reverselogproxy")))
+
+		server.stop()
+		Expect(ioutil.WriteFile(certPath, MustAsset("server.crt"), 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(keyPath, MustAsset("server.key"), 0600)).To(Succeed())
+		time.Sleep(50 * time.Millisecond)
+		Expect(server.start()).To(Succeed())
+
+		Eventually(func() string {
+			client.EmitLog("message")
+			select {
+			case cn := <-commonNames:
+				return cn
+			default:
+				return ""
+			}
+		}, 5).Should(Equal("metron"))
+	})
+
+	It("returns an error if the certificate cannot be loaded", func() {
+		tlsConfig, err := loggregator.NewIngressTLSConfig(
+			fixture("CA.crt"),
+			fixture("client.crt"),
+			fixture("client.key"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = loggregator.NewIngressClient(
+			tlsConfig,
+			loggregator.WithCertReload("/does/not/exist", "/does/not/exist", time.Second),
+		)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("returns an error for a non-positive interval", func() {
+		tlsConfig, err := loggregator.NewIngressTLSConfig(
+			fixture("CA.crt"),
+			fixture("client.crt"),
+			fixture("client.key"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = loggregator.NewIngressClient(
+			tlsConfig,
+			loggregator.WithCertReload(fixture("client.crt"), fixture("client.key"), 0),
+		)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("IngressClient backpressure", func() {
+	var (
+		lis       net.Listener
+		tlsConfig *tls.Config
+
+		mu      sync.Mutex
+		dropped int
+	)
+
+	BeforeEach(func() {
+		var err error
+		lis, err = newBlackholeListener()
+		Expect(err).ToNot(HaveOccurred())
+
+		tlsConfig, err = loggregator.NewIngressTLSConfig(
+			fixture("CA.crt"),
+			fixture("client.crt"),
+			fixture("client.key"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		mu.Lock()
+		dropped = 0
+		mu.Unlock()
+	})
+
+	AfterEach(func() {
+		lis.Close()
+	})
+
+	buildClient := func(opts ...loggregator.IngressOption) *loggregator.IngressClient {
+		opts = append(opts,
+			loggregator.WithAddr(lis.Addr().String()),
+			loggregator.WithDropAlerter(func(n int) {
+				mu.Lock()
+				defer mu.Unlock()
+				dropped += n
+			}),
+		)
+		client, err := loggregator.NewIngressClient(tlsConfig, opts...)
+		Expect(err).ToNot(HaveOccurred())
+		return client
+	}
+
+	droppedCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return dropped
+	}
+
+	emitMany := func(client *loggregator.IngressClient) chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 1000; i++ {
+				client.EmitLog("message")
+			}
+		}()
+		return done
+	}
+
+	It("blocks by default when the buffer is full", func() {
+		client := buildClient()
+
+		Consistently(emitMany(client)).ShouldNot(BeClosed())
+		Expect(droppedCount()).To(BeZero())
+	})
+
+	It("drops the newest envelopes", func() {
+		client := buildClient(loggregator.WithBackpressureStrategy(loggregator.DropNewest))
+
+		Eventually(emitMany(client)).Should(BeClosed())
+		Expect(droppedCount()).ToNot(BeZero())
+	})
+
+	It("drops the oldest envelopes", func() {
+		client := buildClient(loggregator.WithBackpressureStrategy(loggregator.DropOldest))
+
+		Eventually(emitMany(client)).Should(BeClosed())
+		Expect(droppedCount()).ToNot(BeZero())
+	})
+
+	It("returns an error from TryEmit when the buffer is full", func() {
+		client := buildClient()
+
+		var err error
+		for i := 0; i < 1000 && err == nil; i++ {
+			err = client.TryEmit(&loggregator_v2.Envelope{})
+		}
+		Expect(err).To(MatchError(loggregator.ErrBufferFull))
+		Expect(droppedCount()).To(BeZero())
+	})
+
+	It("uses the configured buffer size", func() {
+		client := buildClient(
+			loggregator.WithBufferSize(10),
+			loggregator.WithBatchMaxSize(1),
+		)
+
+		var accepted int
+		for i := 0; i < 1000; i++ {
+			if client.TryEmit(&loggregator_v2.Envelope{}) != nil {
+				break
+			}
+			accepted++
+		}
+
+		// The sender may have already pulled one envelope into its batch.
+		Expect(accepted).To(BeNumerically(">=", 10))
+		Expect(accepted).To(BeNumerically("<=", 11))
+	})
+
+	It("returns an error for a negative buffer size", func() {
+		_, err := loggregator.NewIngressClient(
+			tlsConfig,
+			loggregator.WithAddr(lis.Addr().String()),
+			loggregator.WithBufferSize(-1),
+		)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+// newBlackholeListener accepts connections but never reads from or writes to
+// them. Clients connecting to it stall during the TLS handshake.
+func newBlackholeListener() (net.Listener, error) {
+	lis, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				for _, c := range conns {
+					c.Close()
+				}
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	return lis, nil
+}
+
+var _ = Describe("IngressClient log deduplication", func() {
+	It("replaces repeated logs with a summary once the window passes", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		received := server.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithLogDeduplication(200*time.Millisecond),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		for i := 0; i < 5; i++ {
+			client.EmitLog("disk full", loggregator.WithSourceInfo("app", "", ""))
+		}
+		client.EmitLog("disk full", loggregator.WithSourceInfo("other-app", "", ""))
+		client.EmitLog("something else", loggregator.WithSourceInfo("app", "", ""))
+
+		var payloads []string
+		Eventually(func() []string {
+			for len(received) > 0 {
+				e := <-received
+				payloads = append(payloads, e.GetSourceId()+": "+string(e.GetLog().GetPayload()))
+			}
+			return payloads
+		}).Should(ConsistOf(
+			"app: disk full",
+			"other-app: disk full",
+			"app: something else",
+			"app: message repeated 4 times: disk full",
+		))
+		Expect(client.Stats().Deduplicated).To(Equal(uint64(4)))
+	})
+
+	It("supports windows shorter than the sweep interval", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		received := server.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithLogDeduplication(time.Nanosecond),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("disk full")
+		Eventually(received).Should(Receive())
+	})
+
+	It("does not deduplicate other envelope types", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		received := server.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithLogDeduplication(time.Hour),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		for i := 0; i < 3; i++ {
+			client.EmitCounter("some-counter")
+		}
+
+		Eventually(received).Should(HaveLen(3))
+		Expect(client.Stats().Deduplicated).To(BeZero())
+	})
+
+	It("sends pending summaries when closed", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		received := server.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithLogDeduplication(time.Hour),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("disk full")
+		client.EmitLog("disk full")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		client.CloseSendWithContext(ctx)
+
+		var e *loggregator_v2.Envelope
+		Eventually(received).Should(Receive(&e))
+		Expect(e.GetLog().GetPayload()).To(Equal([]byte("disk full")))
+		Eventually(received).Should(Receive(&e))
+		Expect(e.GetLog().GetPayload()).To(Equal([]byte("message repeated 1 times: disk full")))
+	})
+})
+
+var _ = Describe("IngressClient blocking dial", func() {
+	It("connects before returning", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		_, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBlockingDial(5*time.Second),
+		)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("returns an error if loggregator cannot be reached in time", func() {
+		l, err := net.Listen("tcp4", "localhost:0")
+		Expect(err).ToNot(HaveOccurred())
+		addr := l.Addr().String()
+		l.Close()
+
+		start := time.Now()
+		_, err = loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(addr),
+			loggregator.WithBlockingDial(100*time.Millisecond),
+		)
+		Expect(err).To(MatchError(ContainSubstring("could not connect to loggregator at " + addr)))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+})
+
+var _ = Describe("IngressClient Close", func() {
+	It("closes the connection", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+		received := server.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBlockingDial(5*time.Second),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(client.State()).To(Equal(connectivity.Ready))
+
+		client.EmitLog("message")
+		Expect(client.Flush(context.Background())).To(Succeed())
+		Eventually(received).Should(HaveLen(1))
+
+		// The test server only ends the stream once its context is done,
+		// so closing it waits until the timeout.
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		Expect(client.CloseWithContext(ctx)).To(MatchError(context.DeadlineExceeded))
+
+		Expect(client.State()).To(Equal(connectivity.Shutdown))
+		Expect(client.Close()).To(Succeed())
+		Expect(client.EmitLogContext(context.Background(), "message")).To(MatchError(loggregator.ErrClosed))
+	})
+
+	It("stops waiting for the final metrics once the context is done", func() {
+		// The server never reads from the stream, so the sender blocks once
+		// the stream's flow control window is used up.
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchMaxSize(1),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		client.NewCounter("counter")
+
+		payload := strings.Repeat("x", 16*1024)
+		Eventually(func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			return client.EmitLogContext(ctx, payload)
+		}, 10, 0).Should(MatchError(context.DeadlineExceeded))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		errs := make(chan error, 1)
+		go func() {
+			errs <- client.CloseSendWithContext(ctx)
+		}()
+
+		Eventually(errs, 2).Should(Receive(MatchError(context.DeadlineExceeded)))
+	})
+
+	It("reports a batch writer client as shut down once closed", func() {
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithBatchWriter(&spyBatchWriter{}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(client.State()).To(Equal(connectivity.Ready))
+
+		Expect(client.Close()).To(Succeed())
+		Expect(client.State()).To(Equal(connectivity.Shutdown))
+	})
+})
+
+var _ = Describe("IngressClient source metadata", func() {
+	It("sends tags that convert to the v1 envelope fields", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+		received := server.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithOrigin("some-origin"),
+			loggregator.WithDeployment("cf"),
+			loggregator.WithJob("router"),
+			loggregator.WithIndex("some-index"),
+			loggregator.WithIP("10.0.0.1"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+
+		var e *loggregator_v2.Envelope
+		Eventually(received).Should(Receive(&e))
+		v1e := conversion.ToV1(e)[0]
+		Expect(v1e.GetOrigin()).To(Equal("some-origin"))
+		Expect(v1e.GetDeployment()).To(Equal("cf"))
+		Expect(v1e.GetJob()).To(Equal("router"))
+		Expect(v1e.GetIndex()).To(Equal("some-index"))
+		Expect(v1e.GetIp()).To(Equal("10.0.0.1"))
+	})
+})
+
+var _ = Describe("IngressClient default log type", func() {
+	It("emits logs with the default log type unless overridden", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+		received := server.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithDefaultLogType(loggregator_v2.Log_OUT),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("default")
+		client.EmitLog("stderr", loggregator.WithStderr())
+
+		var e *loggregator_v2.Envelope
+		Eventually(received).Should(Receive(&e))
+		Expect(e.GetLog().GetType()).To(Equal(loggregator_v2.Log_OUT))
+		Eventually(received).Should(Receive(&e))
+		Expect(e.GetLog().GetType()).To(Equal(loggregator_v2.Log_ERR))
+	})
+})
+
+var _ = Describe("IngressClient compression", func() {
+	It("compresses batches with the configured compressor", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		received := server.collect()
+
+		compressor := &countingCompressor{Compressor: encoding.GetCompressor("gzip")}
+		encoding.RegisterCompressor(compressor)
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithCompression(compressor.Name()),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("some log message")
+
+		var e *loggregator_v2.Envelope
+		Eventually(received).Should(Receive(&e))
+		Expect(e.GetLog().GetPayload()).To(Equal([]byte("some log message")))
+		Expect(atomic.LoadInt64(&compressor.compressed)).To(BeNumerically(">", 0))
+	})
+
+	It("returns an error for an unknown compressor", func() {
+		_, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithCompression("unknown"),
+		)
+		Expect(err).To(MatchError(`unknown compressor "unknown"`))
+	})
+})
+
+// countingCompressor is a gzip compressor under another name that counts how
+// often it compresses.
+type countingCompressor struct {
+	encoding.Compressor
+	compressed int64
+}
+
+func (c *countingCompressor) Name() string {
+	return "counting-gzip"
+}
+
+func (c *countingCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	atomic.AddInt64(&c.compressed, 1)
+	return c.Compressor.Compress(w)
+}
+
+var _ = Describe("IngressClient strict units", func() {
+	It("rejects gauges with unknown units", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		received := server.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithStrictUnits(),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = client.EmitGaugeContext(context.Background(),
+			loggregator.WithGaugeValue("cpu", 1, "Percent"),
+			loggregator.WithGaugeValue("distance", 2, "nanofortnights"),
+		)
+		Expect(err).To(MatchError(`gauge "distance" has unknown unit "nanofortnights"`))
+
+		err = client.EmitGaugeContext(context.Background(),
+			loggregator.WithGaugeValue("cpu", 1, "Percent"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		var e *loggregator_v2.Envelope
+		Eventually(received).Should(Receive(&e))
+		Expect(e.GetGauge().GetMetrics()).To(HaveLen(1))
+		Expect(e.GetGauge().GetMetrics()["cpu"].Unit).To(Equal("Percent"))
+		Consistently(received).ShouldNot(Receive())
+	})
+})
+
+var _ = Describe("IngressClient unit normalization", func() {
+	It("sends known units under their canonical names", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		received := server.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithUnitNormalization(),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitGauge(
+			loggregator.WithGaugeValue("latency", 1, "ms"),
+			loggregator.WithGaugeValue("bandwidth", 2, "Mb"),
+			loggregator.WithGaugeValue("distance", 3, "nanofortnights"),
+		)
+
+		var e *loggregator_v2.Envelope
+		Eventually(received).Should(Receive(&e))
+		metrics := e.GetGauge().GetMetrics()
+		Expect(metrics["latency"].Unit).To(Equal(units.Milliseconds))
+		Expect(metrics["bandwidth"].Unit).To(Equal("Mb"))
+		Expect(metrics["distance"].Unit).To(Equal("nanofortnights"))
+	})
+})
+
+var _ = Describe("IngressClient tag validation", func() {
+	var (
+		server     *testIngressServer
+		received   chan *loggregator_v2.Envelope
+		violations chan loggregator.TagViolation
+	)
+
+	BeforeEach(func() {
+		server = newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		received = server.collect()
+		violations = make(chan loggregator.TagViolation, 10)
+	})
+
+	AfterEach(func() {
+		server.stop()
+	})
+
+	newClient := func(p loggregator.TagPolicy, opts ...loggregator.IngressOption) *loggregator.IngressClient {
+		client, err := loggregator.NewInsecureIngressClient(append([]loggregator.IngressOption{
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10 * time.Millisecond),
+			loggregator.WithTagValidation(p),
+			loggregator.WithTagLimits(8, 8),
+			loggregator.WithTagViolationHandler(func(v loggregator.TagViolation) {
+				violations <- v
+			}),
+		}, opts...)...)
+		Expect(err).ToNot(HaveOccurred())
+		return client
+	}
+
+	It("reports invalid tags and sends them unchanged", func() {
+		client := newClient(loggregator.ReportInvalidTags)
+
+		client.EmitLog("message",
+			loggregator.WithEnvelopeTag("source_id", "app"),
+			loggregator.WithEnvelopeTag("valid", "value"),
+		)
+
+		var v loggregator.TagViolation
+		Eventually(violations).Should(Receive(&v))
+		Expect(v).To(Equal(loggregator.TagViolation{
+			Name:   "source_id",
+			Value:  "app",
+			Reason: "name is reserved",
+		}))
+		Consistently(violations).ShouldNot(Receive())
+
+		var e *loggregator_v2.Envelope
+		Eventually(received).Should(Receive(&e))
+		Expect(e.Tags).To(Equal(map[string]string{
+			"source_id": "app",
+			"valid":     "value",
+		}))
+	})
+
+	It("sanitizes invalid tags", func() {
+		client := newClient(loggregator.SanitizeInvalidTags,
+			loggregator.WithTag("job name", "router"),
+		)
+		Eventually(violations).Should(Receive())
+
+		client.EmitLog("message",
+			loggregator.WithEnvelopeTag("instance_id", "0"),
+			loggregator.WithEnvelopeTag("much-too-long", "much-too-long"),
+			loggregator.WithEnvelopeTag("bad", "\xffok"),
+		)
+		Eventually(violations).Should(HaveLen(3))
+
+		var e *loggregator_v2.Envelope
+		Eventually(received).Should(Receive(&e))
+		Expect(e.Tags).To(Equal(map[string]string{
+			"job_name": "router",
+			"much-too": "much-too",
+			"bad":      "\uFFFDok",
+		}))
+	})
+})
+
+var _ = Describe("IngressClient log truncation", func() {
+	It("truncates long log payloads and marks them", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		received := server.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithLogTruncation(16),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("short")
+		client.EmitLog("a payload that is much too long")
+		client.EmitLog("ünïcödé ünïcödé")
+
+		var e *loggregator_v2.Envelope
+		Eventually(received).Should(Receive(&e))
+		Expect(string(e.GetLog().GetPayload())).To(Equal("short"))
+		Expect(e.Tags).ToNot(HaveKey("truncated"))
+
+		Eventually(received).Should(Receive(&e))
+		Expect(string(e.GetLog().GetPayload())).To(Equal("a payloTRUNCATED"))
+		Expect(e.Tags).To(HaveKeyWithValue("truncated", "true"))
+
+		Eventually(received).Should(Receive(&e))
+		Expect(string(e.GetLog().GetPayload())).To(Equal("ünïcTRUNCATED"))
+	})
+})
+
+var _ = Describe("IngressClient ANSI stripping", func() {
+	It("removes escape sequences from log payloads", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		received := server.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithANSIStripping(),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("\x1b[1;31mERROR\x1b[0m disk \x1b[Kfull")
+		client.EmitLog("\x1b]0;title\x07plain \x1b(Btext")
+
+		var e *loggregator_v2.Envelope
+		Eventually(received).Should(Receive(&e))
+		Expect(string(e.GetLog().GetPayload())).To(Equal("ERROR disk full"))
+
+		Eventually(received).Should(Receive(&e))
+		Expect(string(e.GetLog().GetPayload())).To(Equal("plain text"))
+	})
+})
+
+var _ = Describe("IngressClient sampling", func() {
+	It("discards logs according to the sampling rules and counts them", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		received := server.collect()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithMetricInterval(50*time.Millisecond),
+			loggregator.WithSampling(0),
+			loggregator.WithTagSampling("level", "error", 1),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		for i := 0; i < 5; i++ {
+			client.Debug("debug")
+		}
+		client.Error("error")
+		client.EmitCounter("requests")
+
+		var names []string
+		var sampledOut uint64
+		Eventually(func() uint64 {
+			for len(received) > 0 {
+				e := <-received
+				switch {
+				case e.GetLog() != nil:
+					names = append(names, string(e.GetLog().GetPayload()))
+				case e.GetCounter().GetName() == "sampled_out_logs":
+					sampledOut = e.GetCounter().GetTotal()
+				default:
+					names = append(names, e.GetCounter().GetName())
+				}
+			}
+			return sampledOut
+		}).Should(Equal(uint64(5)))
+		Expect(names).To(ConsistOf("error", "requests"))
+		Expect(client.Stats().SampledOut).To(Equal(uint64(5)))
+	})
+})
+
+var _ = Describe("IngressClient pause on connection loss", func() {
+	It("holds envelopes while the connection is down and flushes them once it is back", func() {
+		l, err := net.Listen("tcp4", "localhost:0")
+		Expect(err).ToNot(HaveOccurred())
+		addr := l.Addr().String()
+		l.Close()
+
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithPauseOnConnectionLoss(),
+			loggregator.WithDialOptions(grpc.WithBackoffMaxDelay(100*time.Millisecond)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		// Give the connection time to fail before emitting.
+		time.Sleep(200 * time.Millisecond)
+		for i := 0; i < 5; i++ {
+			client.EmitLog("message")
+		}
+		Consistently(func() uint64 {
+			return client.Stats().SendErrors
+		}, 200*time.Millisecond).Should(BeZero())
+
+		server := newInsecureTestIngressServer()
+		server.addr = addr
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+		received := server.collect()
+
+		Eventually(received, 5).Should(HaveLen(5))
+		Expect(client.Stats().SendErrors).To(BeZero())
+	})
+})
+
+var _ = Describe("IngressClient send deadline", func() {
+	It("re-establishes the stream when a send stalls", func() {
+		server := newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		defer server.stop()
+
+		errs := make(chan error, 100)
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithSendDeadline(100*time.Millisecond),
+			loggregator.WithErrorHandler(func(err error) {
+				select {
+				case errs <- err:
+				default:
+				}
+			}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			payload := strings.Repeat("x", 32*1024)
+			for {
+				select {
+				case <-done:
+					return
+				case <-time.After(5 * time.Millisecond):
+					client.EmitLog(payload)
+				}
+			}
+		}()
+
+		// The first stream is never read, so sends block once its flow
+		// control window is full.
+		var stalled loggregator_v2.Ingress_BatchSenderServer
+		Eventually(server.receivers, 5).Should(Receive(&stalled))
+
+		var sendErr error
+		Eventually(errs, 5).Should(Receive(&sendErr))
+		Expect(status.Code(sendErr)).To(Equal(codes.DeadlineExceeded))
+
+		var next loggregator_v2.Ingress_BatchSenderServer
+		Eventually(server.receivers, 5).Should(Receive(&next))
+		b, err := next.Recv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b.GetBatch()).ToNot(BeEmpty())
+		Eventually(stalled.Context().Done()).Should(BeClosed())
+	})
+})
+
+var _ = Describe("IngressClient batch writer", func() {
+	It("writes batches to the batch writer", func() {
+		w := &spyBatchWriter{failures: 1}
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithBatchWriter(w),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithMaxRetries(1),
+			loggregator.WithTag("deployment", "cf"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+		client.EmitCounter("counter")
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		Expect(client.CloseSendWithContext(ctx)).To(Succeed())
+
+		envs := w.envelopes()
+		Expect(envs).To(HaveLen(2))
+		Expect(envs[0].GetLog().GetPayload()).To(Equal([]byte("message")))
+		Expect(envs[0].Tags).To(HaveKeyWithValue("deployment", "cf"))
+		Expect(envs[1].GetCounter().GetName()).To(Equal("counter"))
+		Expect(client.Stats().Retries).To(Equal(uint64(1)))
+		Expect(w.isClosed()).To(BeTrue())
+	})
+})
+
+var _ = Describe("IngressClient batch writer events", func() {
+	It("writes events to the batch writer", func() {
+		w := &spyBatchWriter{}
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithBatchWriter(w),
+			loggregator.WithTagValidation(loggregator.SanitizeInvalidTags),
+			loggregator.WithTagViolationHandler(func(loggregator.TagViolation) {}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = client.EmitEvent(
+			context.Background(),
+			"title",
+			"body",
+			loggregator.WithEnvelopeTag("bad name", "value"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		envs := w.envelopes()
+		Expect(envs).To(HaveLen(1))
+		Expect(envs[0].GetEvent().GetTitle()).To(Equal("title"))
+		Expect(envs[0].GetEvent().GetBody()).To(Equal("body"))
+		Expect(envs[0].Tags).To(Equal(map[string]string{"bad_name": "value"}))
+	})
+})
+
+type spyBatchWriter struct {
+	mu       sync.Mutex
+	failures int
+	batches  [][]*loggregator_v2.Envelope
+	closed   bool
+}
+
+func (w *spyBatchWriter) Write(_ context.Context, batch []*loggregator_v2.Envelope) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.failures > 0 {
+		w.failures--
+		return errors.New("unavailable")
+	}
+	w.batches = append(w.batches, batch)
+
+	return nil
+}
+
+func (w *spyBatchWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.closed = true
+	return nil
+}
+
+func (w *spyBatchWriter) envelopes() []*loggregator_v2.Envelope {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var envs []*loggregator_v2.Envelope
+	for _, b := range w.batches {
+		envs = append(envs, b...)
+	}
+	return envs
+}
+
+func (w *spyBatchWriter) isClosed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.closed
+}
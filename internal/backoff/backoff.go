@@ -0,0 +1,60 @@
+// Package backoff implements the exponential backoff that the go-loggregator
+// clients use between reconnect and retry attempts.
+package backoff
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Backoff tracks the delay between successive attempts. It is not safe for
+// concurrent use; copy it to give each goroutine its own.
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+
+	// Jitter randomizes each delay to between half and all of the current
+	// delay so that many clients do not retry in lockstep.
+	Jitter bool
+
+	current time.Duration
+}
+
+// New returns a Backoff that starts at min and doubles up to max.
+func New(min, max time.Duration) *Backoff {
+	return &Backoff{
+		Min:     min,
+		Max:     max,
+		current: min,
+	}
+}
+
+// Wait sleeps for the current delay and then doubles it, up to the maximum.
+// It returns false if the context is done before the delay elapses.
+func (b *Backoff) Wait(ctx context.Context) bool {
+	d := b.current
+	if b.Jitter && d > 1 {
+		d = d/2 + time.Duration(rand.Int63n(int64(d/2)))
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	b.current *= 2
+	if b.current > b.Max {
+		b.current = b.Max
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// Reset returns the delay to its minimum.
+func (b *Backoff) Reset() {
+	b.current = b.Min
+}
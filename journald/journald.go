@@ -0,0 +1,229 @@
+//go:build linux
+// +build linux
+
+// Package journald reads the systemd journal and emits its entries as
+// loggregator logs, for hosts that run components as systemd units. Entries
+// are read from journalctl, so that no cgo bindings to libsystemd are
+// needed; journalctl must be on the PATH.
+package journald
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	loggregator "code.cloudfoundry.org/go-loggregator"
+)
+
+// maxEntryBytes is the longest JSON line read from journalctl.
+const maxEntryBytes = 1024 * 1024
+
+// LogClient is the client used by Reader to emit logs. This would usually be
+// the go-loggregator v2 client.
+type LogClient interface {
+	EmitLog(message string, opts ...loggregator.EmitLogOption)
+}
+
+// Option configures a Reader.
+type Option func(*Reader)
+
+// WithUnits only reads the entries of the given systemd units.
+func WithUnits(units ...string) Option {
+	return func(r *Reader) {
+		r.units = append(r.units, units...)
+	}
+}
+
+// WithAfterCursor starts reading after the entry with the given cursor, e.g.
+// one returned by Cursor before a restart. By default only entries written
+// after Run is called are read.
+func WithAfterCursor(cursor string) Option {
+	return func(r *Reader) {
+		r.cursor = cursor
+	}
+}
+
+// WithEmitLogOptions sets options that are applied to every emitted log,
+// e.g. loggregator.WithSourceInfo.
+func WithEmitLogOptions(opts ...loggregator.EmitLogOption) Option {
+	return func(r *Reader) {
+		r.opts = append(r.opts, opts...)
+	}
+}
+
+// WithJournalctlPath sets the journalctl binary that is run. It defaults to
+// "journalctl".
+func WithJournalctlPath(path string) Option {
+	return func(r *Reader) {
+		r.journalctl = path
+	}
+}
+
+// Reader emits journal entries as logs. The unit, priority and syslog
+// identifier of every entry are added as the "unit", "priority" and
+// "syslog_identifier" tags, and its time becomes the envelope timestamp.
+// Entries with a priority of err or more severe are emitted as stderr,
+// everything else as stdout. It should be created with the New constructor.
+type Reader struct {
+	client     LogClient
+	units      []string
+	opts       []loggregator.EmitLogOption
+	journalctl string
+
+	mu     sync.Mutex
+	cursor string
+}
+
+// New returns a Reader that emits to the given client.
+func New(c LogClient, opts ...Option) *Reader {
+	r := &Reader{
+		client:     c,
+		journalctl: "journalctl",
+	}
+
+	for _, o := range opts {
+		o(r)
+	}
+
+	return r
+}
+
+// Cursor returns the cursor of the last emitted entry, or the cursor given
+// with WithAfterCursor if no entry has been emitted yet.
+func (r *Reader) Cursor() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cursor
+}
+
+// Run follows the journal until the context is done. If journalctl exits
+// before then, Run returns an error; it can then be called again to resume
+// after the last emitted entry.
+func (r *Reader) Run(ctx context.Context) error {
+	args := []string{"--follow", "--output=json", "--no-pager"}
+	if cursor := r.Cursor(); cursor != "" {
+		args = append(args, "--after-cursor="+cursor)
+	} else {
+		args = append(args, "--lines=0")
+	}
+	for _, u := range r.units {
+		args = append(args, "--unit="+u)
+	}
+
+	cmd := exec.CommandContext(ctx, r.journalctl, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxEntryBytes)
+	for scanner.Scan() {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		r.emit(e)
+	}
+	scanErr := scanner.Err()
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	if scanErr != nil {
+		return scanErr
+	}
+	if err != nil {
+		return fmt.Errorf("journalctl exited: %s", err)
+	}
+
+	return errors.New("journalctl exited")
+}
+
+func (r *Reader) emit(e entry) {
+	if e.Message == nil {
+		return
+	}
+
+	var opts []loggregator.EmitLogOption
+	p, err := strconv.Atoi(e.Priority)
+	if err != nil || p < 0 || p >= len(priorities) {
+		p = -1
+	}
+	if p >= 0 {
+		opts = append(opts, loggregator.WithEnvelopeTag("priority", priorities[p]))
+	}
+	if p < 0 || p > errPriority {
+		opts = append(opts, loggregator.WithStdout())
+	}
+	if e.Unit != "" {
+		opts = append(opts, loggregator.WithEnvelopeTag("unit", e.Unit))
+	}
+	if e.SyslogIdentifier != "" {
+		opts = append(opts, loggregator.WithEnvelopeTag("syslog_identifier", e.SyslogIdentifier))
+	}
+	if us, err := strconv.ParseInt(e.RealtimeTimestamp, 10, 64); err == nil {
+		opts = append(opts, loggregator.WithTimestamp(time.Unix(0, us*int64(time.Microsecond))))
+	}
+
+	r.client.EmitLog(string(e.Message), append(opts, r.opts...)...)
+
+	r.mu.Lock()
+	r.cursor = e.Cursor
+	r.mu.Unlock()
+}
+
+// errPriority is the least severe priority that is emitted as stderr.
+const errPriority = 3
+
+// priorities are the names of the syslog priorities, by value.
+var priorities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// entry is a journal entry as written by journalctl --output=json.
+type entry struct {
+	Cursor            string  `json:"__CURSOR"`
+	RealtimeTimestamp string  `json:"__REALTIME_TIMESTAMP"`
+	Message           message `json:"MESSAGE"`
+	Priority          string  `json:"PRIORITY"`
+	Unit              string  `json:"_SYSTEMD_UNIT"`
+	SyslogIdentifier  string  `json:"SYSLOG_IDENTIFIER"`
+}
+
+// message is the MESSAGE field of an entry. journalctl writes it as a
+// string, or as an array of bytes if it is not valid UTF-8.
+type message []byte
+
+func (m *message) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*m = message(s)
+		return nil
+	}
+
+	var b []int
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	*m = make(message, len(b))
+	for i, c := range b {
+		(*m)[i] = byte(c)
+	}
+
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build linux
+// +build linux
+
+package journald_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestJournald(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Journald Suite")
+}
@@ -0,0 +1,163 @@
+//go:build linux
+// +build linux
+
+package journald_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	loggregator "code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/journald"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reader", func() {
+	var (
+		dir    string
+		client *spyLogClient
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "journald")
+		Expect(err).ToNot(HaveOccurred())
+
+		client = &spyLogClient{}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	// fakeJournalctl writes a journalctl that records its arguments and
+	// prints the given entries.
+	fakeJournalctl := func(entries ...string) string {
+		path := filepath.Join(dir, "journalctl")
+		script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "args") + "\ncat <<'EOF'\n" +
+			strings.Join(entries, "\n") + "\nEOF\n"
+		Expect(ioutil.WriteFile(path, []byte(script), 0755)).To(Succeed())
+		return path
+	}
+
+	args := func() string {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+		Expect(err).ToNot(HaveOccurred())
+		return strings.TrimSpace(string(data))
+	}
+
+	It("emits journal entries as logs", func() {
+		r := journald.New(client, journald.WithJournalctlPath(fakeJournalctl(
+			`{"__CURSOR":"c1","__REALTIME_TIMESTAMP":"1551441600000001","MESSAGE":"started","PRIORITY":"6","_SYSTEMD_UNIT":"nginx.service","SYSLOG_IDENTIFIER":"nginx"}`,
+			`{"__CURSOR":"c2","MESSAGE":"failed","PRIORITY":"3"}`,
+		)))
+
+		Expect(r.Run(context.Background())).To(MatchError("journalctl exited"))
+
+		envs := client.envelopes()
+		Expect(envs).To(HaveLen(2))
+
+		Expect(envs[0].GetLog().GetPayload()).To(Equal([]byte("started")))
+		Expect(envs[0].GetLog().GetType()).To(Equal(loggregator_v2.Log_OUT))
+		Expect(envs[0].GetTimestamp()).To(Equal(int64(1551441600000001000)))
+		Expect(envs[0].GetTags()).To(Equal(map[string]string{
+			"priority":          "info",
+			"unit":              "nginx.service",
+			"syslog_identifier": "nginx",
+		}))
+
+		Expect(envs[1].GetLog().GetType()).To(Equal(loggregator_v2.Log_ERR))
+		Expect(envs[1].GetTags()).To(HaveKeyWithValue("priority", "err"))
+
+		Expect(r.Cursor()).To(Equal("c2"))
+		Expect(args()).To(Equal("--follow --output=json --no-pager --lines=0"))
+	})
+
+	It("decodes messages written as byte arrays", func() {
+		r := journald.New(client, journald.WithJournalctlPath(fakeJournalctl(
+			`{"__CURSOR":"c1","MESSAGE":[104,105,255]}`,
+			`{"__CURSOR":"c2","MESSAGE":null}`,
+			`not json`,
+		)))
+
+		r.Run(context.Background())
+
+		envs := client.envelopes()
+		Expect(envs).To(HaveLen(1))
+		Expect(envs[0].GetLog().GetPayload()).To(Equal([]byte{104, 105, 255}))
+		Expect(envs[0].GetLog().GetType()).To(Equal(loggregator_v2.Log_OUT))
+	})
+
+	It("passes the units and cursor to journalctl", func() {
+		r := journald.New(client,
+			journald.WithJournalctlPath(fakeJournalctl()),
+			journald.WithUnits("a.service", "b.service"),
+			journald.WithAfterCursor("some-cursor"),
+		)
+
+		r.Run(context.Background())
+
+		Expect(args()).To(Equal("--follow --output=json --no-pager --after-cursor=some-cursor --unit=a.service --unit=b.service"))
+		Expect(r.Cursor()).To(Equal("some-cursor"))
+	})
+
+	It("applies the configured emit options", func() {
+		r := journald.New(client,
+			journald.WithJournalctlPath(fakeJournalctl(`{"MESSAGE":"hello"}`)),
+			journald.WithEmitLogOptions(loggregator.WithSourceInfo("some-id", "HOST", "0")),
+		)
+
+		r.Run(context.Background())
+
+		Expect(client.envelopes()).To(HaveLen(1))
+		Expect(client.envelopes()[0].GetSourceId()).To(Equal("some-id"))
+	})
+
+	It("returns nil once the context is done", func() {
+		path := filepath.Join(dir, "journalctl")
+		Expect(ioutil.WriteFile(path, []byte("#!/bin/sh\nexec sleep 10\n"), 0755)).To(Succeed())
+		r := journald.New(client, journald.WithJournalctlPath(path))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		Expect(r.Run(ctx)).To(Succeed())
+	})
+})
+
+type spyLogClient struct {
+	mu   sync.Mutex
+	envs []*loggregator_v2.Envelope
+}
+
+func (s *spyLogClient) EmitLog(message string, opts ...loggregator.EmitLogOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := &loggregator_v2.Envelope{
+		Tags: make(map[string]string),
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{Payload: []byte(message), Type: loggregator_v2.Log_ERR},
+		},
+	}
+	for _, o := range opts {
+		o(e)
+	}
+	s.envs = append(s.envs, e)
+}
+
+func (s *spyLogClient) envelopes() []*loggregator_v2.Envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*loggregator_v2.Envelope(nil), s.envs...)
+}
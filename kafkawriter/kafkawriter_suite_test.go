@@ -0,0 +1,13 @@
+package kafkawriter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestKafkawriter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Kafka Writer Suite")
+}
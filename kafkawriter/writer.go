@@ -0,0 +1,115 @@
+// Package kafkawriter publishes envelopes to a Kafka topic, for bridging
+// loggregator telemetry into existing Kafka pipelines. Its Writer is a
+// loggregator.BatchWriter, so it is used through an IngressClient:
+//
+//	client, err := loggregator.NewIngressClient(nil,
+//		loggregator.WithBatchWriter(kafkawriter.New(producer, "envelopes")),
+//	)
+//
+// Rather than depending on a particular Kafka client library, Writer
+// produces through the small Producer interface. For example, with
+// github.com/segmentio/kafka-go:
+//
+//	producer := kafkawriter.ProducerFunc(func(ctx context.Context, topic string, msgs []kafkawriter.Message) error {
+//		km := make([]kafka.Message, len(msgs))
+//		for i, m := range msgs {
+//			km[i] = kafka.Message{Topic: topic, Key: m.Key, Value: m.Value}
+//		}
+//		return kw.WriteMessages(ctx, km...)
+//	})
+package kafkawriter
+
+import (
+	"encoding/json"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// Message is a Kafka message holding a single envelope.
+type Message struct {
+	// Key is the envelope's source ID, so that the envelopes of a source
+	// are kept in order on one partition.
+	Key []byte
+
+	// Value is the serialized envelope.
+	Value []byte
+}
+
+// Producer publishes messages to a Kafka topic. Produce should return once
+// the messages have been acknowledged by the broker.
+type Producer interface {
+	Produce(ctx context.Context, topic string, msgs []Message) error
+}
+
+// ProducerFunc is an adapter that allows a function to be used as a
+// Producer.
+type ProducerFunc func(ctx context.Context, topic string, msgs []Message) error
+
+// Produce calls f.
+func (f ProducerFunc) Produce(ctx context.Context, topic string, msgs []Message) error {
+	return f(ctx, topic, msgs)
+}
+
+// Option is a function type that is used to configure optional settings for
+// a Writer.
+type Option func(*Writer)
+
+// WithJSON makes the Writer serialize envelopes as JSON, in the format of
+// the RLP gateway (see loggregator_v2.Envelope.MarshalJSON), instead of as
+// protobuf.
+func WithJSON() Option {
+	return func(w *Writer) {
+		w.json = true
+	}
+}
+
+// Writer is a loggregator.BatchWriter that produces every envelope of a
+// batch as a message, keyed by its source ID, to a Kafka topic.
+type Writer struct {
+	producer Producer
+	topic    string
+	json     bool
+}
+
+// New returns a Writer that produces to the given topic.
+func New(p Producer, topic string, opts ...Option) *Writer {
+	w := &Writer{
+		producer: p,
+		topic:    topic,
+	}
+
+	for _, o := range opts {
+		o(w)
+	}
+
+	return w
+}
+
+// Write implements loggregator.BatchWriter. The batch is passed to the
+// Producer in a single call.
+func (w *Writer) Write(ctx context.Context, batch []*loggregator_v2.Envelope) error {
+	msgs := make([]Message, 0, len(batch))
+	for _, e := range batch {
+		value, err := w.marshal(e)
+		if err != nil {
+			return err
+		}
+
+		msgs = append(msgs, Message{
+			Key:   []byte(e.GetSourceId()),
+			Value: value,
+		})
+	}
+
+	return w.producer.Produce(ctx, w.topic, msgs)
+}
+
+func (w *Writer) marshal(e *loggregator_v2.Envelope) ([]byte, error) {
+	if w.json {
+		return json.Marshal(e)
+	}
+	return proto.Marshal(e)
+}
@@ -0,0 +1,68 @@
+package kafkawriter_test
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-loggregator/kafkawriter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Writer", func() {
+	var (
+		topic string
+		msgs  []kafkawriter.Message
+		err   error
+
+		producer = kafkawriter.ProducerFunc(func(_ context.Context, t string, m []kafkawriter.Message) error {
+			topic = t
+			msgs = append(msgs, m...)
+			return err
+		})
+
+		batch = []*loggregator_v2.Envelope{
+			{SourceId: "app-1", Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{Payload: []byte("one")}}},
+			{SourceId: "app-2", Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{Payload: []byte("two")}}},
+		}
+	)
+
+	BeforeEach(func() {
+		topic, msgs, err = "", nil, nil
+	})
+
+	It("produces each envelope keyed by its source ID", func() {
+		w := kafkawriter.New(producer, "envelopes")
+		Expect(w.Write(context.Background(), batch)).To(Succeed())
+
+		Expect(topic).To(Equal("envelopes"))
+		Expect(msgs).To(HaveLen(2))
+		Expect(msgs[0].Key).To(Equal([]byte("app-1")))
+		Expect(msgs[1].Key).To(Equal([]byte("app-2")))
+
+		var e loggregator_v2.Envelope
+		Expect(proto.Unmarshal(msgs[1].Value, &e)).To(Succeed())
+		Expect(proto.Equal(&e, batch[1])).To(BeTrue())
+	})
+
+	It("serializes envelopes as JSON", func() {
+		w := kafkawriter.New(producer, "envelopes", kafkawriter.WithJSON())
+		Expect(w.Write(context.Background(), batch[:1])).To(Succeed())
+
+		var e loggregator_v2.Envelope
+		Expect(json.Unmarshal(msgs[0].Value, &e)).To(Succeed())
+		Expect(e.GetSourceId()).To(Equal("app-1"))
+		Expect(msgs[0].Value).To(ContainSubstring(`"source_id"`))
+	})
+
+	It("returns the producer's error", func() {
+		err = errors.New("no brokers")
+		w := kafkawriter.New(producer, "envelopes")
+		Expect(w.Write(context.Background(), batch)).To(MatchError("no brokers"))
+	})
+})
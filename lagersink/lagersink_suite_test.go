@@ -0,0 +1,13 @@
+package lagersink_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestLagersink(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Lager Sink Suite")
+}
@@ -0,0 +1,154 @@
+// Package lagersink forwards lager log lines to loggregator.
+//
+// lager sinks receive lager's own LogFormat type, so rather than depending on
+// lager this package provides an io.Writer that understands the JSON lager
+// writes. Register it with a lager WriterSink or PrettySink:
+//
+//	logger.RegisterSink(lager.NewWriterSink(lagersink.New(client), lager.INFO))
+package lagersink
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	loggregator "code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/logwriter"
+)
+
+// LogClient is the client used by Sink to emit logs. This would usually be
+// the go-loggregator v2 client.
+type LogClient interface {
+	EmitLog(message string, opts ...loggregator.EmitLogOption)
+}
+
+// SinkOption is a function type that is used to configure optional settings
+// for a Sink.
+type SinkOption func(*Sink)
+
+// WithEmitLogOptions sets options that are applied to every emitted log,
+// e.g. loggregator.WithSourceInfo. The source type is always taken from the
+// lager line.
+func WithEmitLogOptions(opts ...loggregator.EmitLogOption) SinkOption {
+	return func(s *Sink) {
+		s.opts = append(s.opts, opts...)
+	}
+}
+
+// Sink is an io.Writer that emits each lager line written to it as a
+// loggregator log. The lager message and data are written to the payload as
+// a JSON object (see loggregator.WithLogFields). The lager source, i.e. the
+// component name, becomes the source type, and the level is added as a
+// "level" tag. Error and fatal lines are emitted as stderr, everything else
+// as stdout. Lines that are not lager JSON are emitted to stdout as is.
+type Sink struct {
+	client LogClient
+	opts   []loggregator.EmitLogOption
+
+	w *logwriter.Writer
+}
+
+// New returns a Sink configured with the given LogClient and SinkOptions.
+func New(c LogClient, opts ...SinkOption) *Sink {
+	s := &Sink{
+		client: c,
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+	s.w = logwriter.New(lineEmitter{s})
+
+	return s
+}
+
+// Write implements io.Writer. Each newline terminated line is emitted as a
+// log. A trailing partial line is held until the rest of it is written.
+func (s *Sink) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+// lineEmitter is the LogClient of the logwriter.Writer that splits what is
+// written to a Sink into lines. It emits each line as a lager log.
+type lineEmitter struct {
+	s *Sink
+}
+
+func (e lineEmitter) EmitLog(line string, _ ...loggregator.EmitLogOption) {
+	e.s.emit(line)
+}
+
+// lagerLine holds the fields of both lager's default format, which has a
+// numeric log_level and epoch timestamp, and its pretty format, which has a
+// level name and RFC3339 timestamp.
+type lagerLine struct {
+	Timestamp string                 `json:"timestamp"`
+	Source    string                 `json:"source"`
+	Message   string                 `json:"message"`
+	LogLevel  *int                   `json:"log_level"`
+	Level     string                 `json:"level"`
+	Data      map[string]interface{} `json:"data"`
+	Error     interface{}            `json:"error"`
+}
+
+var levelNames = []string{"debug", "info", "error", "fatal"}
+
+func (s *Sink) emit(line string) {
+	var l lagerLine
+	if err := json.Unmarshal([]byte(line), &l); err != nil || l.Message == "" {
+		opts := append(s.opts[:len(s.opts):len(s.opts)], loggregator.WithStdout())
+		s.client.EmitLog(line, opts...)
+		return
+	}
+
+	level := strings.ToLower(l.Level)
+	if l.LogLevel != nil && *l.LogLevel >= 0 && *l.LogLevel < len(levelNames) {
+		level = levelNames[*l.LogLevel]
+	}
+
+	fields := l.Data
+	if l.Error != nil {
+		if fields == nil {
+			fields = make(map[string]interface{})
+		}
+		fields["error"] = l.Error
+	}
+
+	opts := make([]loggregator.EmitLogOption, 0, len(s.opts)+5)
+	opts = append(opts, s.opts...)
+	if l.Source != "" {
+		opts = append(opts, loggregator.WithEnvelopeTag("source_type", l.Source))
+	}
+	if level != "" {
+		opts = append(opts, loggregator.WithEnvelopeTag("level", level))
+	}
+	if level != "error" && level != "fatal" {
+		opts = append(opts, loggregator.WithStdout())
+	}
+	if ts, ok := parseTimestamp(l.Timestamp); ok {
+		opts = append(opts, loggregator.WithTimestamp(ts))
+	}
+	if len(fields) > 0 {
+		opts = append(opts, loggregator.WithLogFields(fields))
+	}
+
+	s.client.EmitLog(l.Message, opts...)
+}
+
+func parseTimestamp(ts string) (time.Time, bool) {
+	if ts == "" {
+		return time.Time{}, false
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+		return t, true
+	}
+
+	secs, err := strconv.ParseFloat(ts, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	whole := int64(secs)
+	return time.Unix(whole, int64((secs-float64(whole))*float64(time.Second))), true
+}
@@ -0,0 +1,120 @@
+package lagersink_test
+
+import (
+	"fmt"
+	"time"
+
+	loggregator "code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/lagersink"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sink", func() {
+	var (
+		client *spyLogClient
+		sink   *lagersink.Sink
+	)
+
+	BeforeEach(func() {
+		client = newSpyLogClient()
+		sink = lagersink.New(client,
+			lagersink.WithEmitLogOptions(
+				loggregator.WithSourceInfo("source-id", "ignored", "instance-id"),
+			),
+		)
+	})
+
+	It("emits lager lines with the component as the source type", func() {
+		fmt.Fprintln(sink, `{"timestamp":"1570000000.500000000","source":"rep","message":"rep.started","log_level":1,"data":{"session":"1"}}`)
+
+		var env *loggregator_v2.Envelope
+		Expect(client.envelopes).To(Receive(&env))
+		Expect(env.GetSourceId()).To(Equal("source-id"))
+		Expect(env.GetInstanceId()).To(Equal("instance-id"))
+		Expect(env.GetTags()).To(HaveKeyWithValue("source_type", "rep"))
+		Expect(env.GetTags()).To(HaveKeyWithValue("level", "info"))
+		Expect(env.GetTimestamp()).To(Equal(time.Unix(1570000000, 500000000).UnixNano()))
+		Expect(env.GetLog().GetType()).To(Equal(loggregator_v2.Log_OUT))
+		Expect(env.GetLog().GetPayload()).To(MatchJSON(
+			`{"message": "rep.started", "session": "1"}`,
+		))
+	})
+
+	It("emits errors to stderr", func() {
+		fmt.Fprintln(sink, `{"timestamp":"1570000000.0","source":"rep","message":"rep.failed","log_level":2,"data":{"error":"boom"}}`)
+
+		var env *loggregator_v2.Envelope
+		Expect(client.envelopes).To(Receive(&env))
+		Expect(env.GetTags()).To(HaveKeyWithValue("level", "error"))
+		Expect(env.GetLog().GetType()).To(Equal(loggregator_v2.Log_ERR))
+	})
+
+	It("understands lager's pretty format", func() {
+		fmt.Fprintln(sink, `{"timestamp":"2019-10-02T07:06:40.5Z","level":"fatal","source":"bbs","message":"bbs.crashed","data":{},"error":"oops"}`)
+
+		var env *loggregator_v2.Envelope
+		Expect(client.envelopes).To(Receive(&env))
+		Expect(env.GetTags()).To(HaveKeyWithValue("source_type", "bbs"))
+		Expect(env.GetTags()).To(HaveKeyWithValue("level", "fatal"))
+		Expect(env.GetTimestamp()).To(Equal(time.Date(2019, 10, 2, 7, 6, 40, 500000000, time.UTC).UnixNano()))
+		Expect(env.GetLog().GetType()).To(Equal(loggregator_v2.Log_ERR))
+		Expect(env.GetLog().GetPayload()).To(MatchJSON(
+			`{"message": "bbs.crashed", "error": "oops"}`,
+		))
+	})
+
+	It("holds partial lines until they are complete", func() {
+		fmt.Fprint(sink, `{"source":"rep","message":"rep.`)
+		Expect(client.envelopes).ToNot(Receive())
+
+		fmt.Fprint(sink, "a\",\"log_level\":0}\n{\"source\":\"rep\",\"message\":\"rep.b\",\"log_level\":0}\n")
+
+		var env *loggregator_v2.Envelope
+		Expect(client.envelopes).To(Receive(&env))
+		Expect(string(env.GetLog().GetPayload())).To(Equal("rep.a"))
+		Expect(env.GetTags()).To(HaveKeyWithValue("level", "debug"))
+		Expect(client.envelopes).To(Receive(&env))
+		Expect(string(env.GetLog().GetPayload())).To(Equal("rep.b"))
+	})
+
+	It("emits lines that are not lager JSON as they are", func() {
+		fmt.Fprintln(sink, "plain text")
+
+		var env *loggregator_v2.Envelope
+		Expect(client.envelopes).To(Receive(&env))
+		Expect(string(env.GetLog().GetPayload())).To(Equal("plain text"))
+		Expect(env.GetLog().GetType()).To(Equal(loggregator_v2.Log_OUT))
+		Expect(env.GetSourceId()).To(Equal("source-id"))
+	})
+})
+
+type spyLogClient struct {
+	envelopes chan *loggregator_v2.Envelope
+}
+
+func newSpyLogClient() *spyLogClient {
+	return &spyLogClient{
+		envelopes: make(chan *loggregator_v2.Envelope, 100),
+	}
+}
+
+func (s *spyLogClient) EmitLog(message string, opts ...loggregator.EmitLogOption) {
+	env := &loggregator_v2.Envelope{
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{
+				Payload: []byte(message),
+				Type:    loggregator_v2.Log_ERR,
+			},
+		},
+		Tags: make(map[string]string),
+	}
+
+	for _, o := range opts {
+		o(env)
+	}
+
+	s.envelopes <- env
+}
@@ -0,0 +1,404 @@
+// Package logcache provides a client for the Log Cache read API. Envelopes
+// are returned as loggregator_v2 envelopes so that historical queries use
+// the same types as streaming from the Reverse Log Proxy.
+package logcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/golang/protobuf/jsonpb"
+	"golang.org/x/net/context"
+)
+
+// Client reads envelopes and metadata from Log Cache over HTTP. It should be
+// created with the NewClient constructor.
+type Client struct {
+	addr       string
+	httpClient loggregator.Doer
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithHTTPClient sets the HTTP client used to talk to Log Cache. It defaults
+// to the http.DefaultClient. Log Cache requires an authorization header
+// when accessed via the gorouter; a Doer that adds it can be given here.
+func WithHTTPClient(d loggregator.Doer) ClientOption {
+	return func(c *Client) {
+		c.httpClient = d
+	}
+}
+
+// NewClient returns a Client for Log Cache at the given address (e.g.
+// https://log-cache.some-system-domain).
+func NewClient(addr string, opts ...ClientOption) *Client {
+	c := &Client{
+		addr:       strings.TrimSuffix(addr, "/"),
+		httpClient: http.DefaultClient,
+	}
+
+	for _, o := range opts {
+		o(c)
+	}
+
+	return c
+}
+
+// ReadOption configures a Read request.
+type ReadOption func(url.Values)
+
+// WithEndTime sets the end of the time range to read. It is exclusive and
+// defaults to now.
+func WithEndTime(t time.Time) ReadOption {
+	return func(v url.Values) {
+		v.Set("end_time", strconv.FormatInt(t.UnixNano(), 10))
+	}
+}
+
+// WithLimit sets the maximum number of envelopes to return. Log Cache caps
+// the limit at 1000 and uses 100 when it is not given.
+func WithLimit(n int) ReadOption {
+	return func(v url.Values) {
+		v.Set("limit", strconv.Itoa(n))
+	}
+}
+
+// WithEnvelopeTypes restricts the envelopes to the given types.
+func WithEnvelopeTypes(types ...loggregator.EnvelopeType) ReadOption {
+	return func(v url.Values) {
+		for _, t := range types {
+			if name, ok := envelopeTypeNames[t]; ok {
+				v.Add("envelope_types", name)
+			}
+		}
+	}
+}
+
+// WithDescending returns the newest envelopes first.
+func WithDescending() ReadOption {
+	return func(v url.Values) {
+		v.Set("descending", "true")
+	}
+}
+
+var envelopeTypeNames = map[loggregator.EnvelopeType]string{
+	loggregator.LogEnvelope:     "LOG",
+	loggregator.CounterEnvelope: "COUNTER",
+	loggregator.GaugeEnvelope:   "GAUGE",
+	loggregator.TimerEnvelope:   "TIMER",
+	loggregator.EventEnvelope:   "EVENT",
+}
+
+// Read returns envelopes for the given source ID, starting at start. By
+// default envelopes are returned oldest first.
+func (c *Client) Read(
+	ctx context.Context,
+	sourceID string,
+	start time.Time,
+	opts ...ReadOption,
+) ([]*loggregator_v2.Envelope, error) {
+	q := url.Values{}
+	q.Set("start_time", strconv.FormatInt(start.UnixNano(), 10))
+	for _, o := range opts {
+		o(q)
+	}
+
+	var resp struct {
+		Envelopes json.RawMessage `json:"envelopes"`
+	}
+	if err := c.get(ctx, "/api/v1/read/"+url.PathEscape(sourceID), q, &resp); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Envelopes) == 0 {
+		return nil, nil
+	}
+
+	var batch loggregator_v2.EnvelopeBatch
+	u := jsonpb.Unmarshaler{AllowUnknownFields: true}
+	if err := u.Unmarshal(bytes.NewReader(resp.Envelopes), &batch); err != nil {
+		return nil, err
+	}
+
+	return batch.GetBatch(), nil
+}
+
+// maxReadLimit is the most envelopes Log Cache returns for a single read.
+const maxReadLimit = 1000
+
+// RecentLogs returns up to limit of the most recent logs of the given source
+// ID, oldest first, like "cf logs --recent". Limits above what Log Cache
+// returns for a single read are served by reading several pages.
+func (c *Client) RecentLogs(ctx context.Context, sourceID string, limit int) ([]*loggregator_v2.Envelope, error) {
+	var (
+		logs []*loggregator_v2.Envelope
+		end  = time.Now()
+	)
+	for len(logs) < limit {
+		n := limit - len(logs)
+		if n > maxReadLimit {
+			n = maxReadLimit
+		}
+
+		page, err := c.Read(ctx, sourceID, time.Unix(0, 0),
+			WithEnvelopeTypes(loggregator.LogEnvelope),
+			WithDescending(),
+			WithLimit(n),
+			WithEndTime(end),
+		)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, page...)
+
+		if len(page) < n {
+			break
+		}
+		end = time.Unix(0, page[len(page)-1].GetTimestamp())
+	}
+
+	for i, j := 0, len(logs)-1; i < j; i, j = i+1, j-1 {
+		logs[i], logs[j] = logs[j], logs[i]
+	}
+
+	return logs, nil
+}
+
+// MetaInfo describes what Log Cache holds for a source ID.
+type MetaInfo struct {
+	Count           int64
+	Expired         int64
+	OldestTimestamp time.Time
+	NewestTimestamp time.Time
+}
+
+// Meta returns information about every source ID that Log Cache holds
+// envelopes for, keyed by source ID.
+func (c *Client) Meta(ctx context.Context) (map[string]MetaInfo, error) {
+	var resp struct {
+		Meta map[string]struct {
+			Count           jsonInt64 `json:"count"`
+			Expired         jsonInt64 `json:"expired"`
+			OldestTimestamp jsonInt64 `json:"oldestTimestamp"`
+			NewestTimestamp jsonInt64 `json:"newestTimestamp"`
+		} `json:"meta"`
+	}
+	if err := c.get(ctx, "/api/v1/meta", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	meta := make(map[string]MetaInfo, len(resp.Meta))
+	for sourceID, m := range resp.Meta {
+		meta[sourceID] = MetaInfo{
+			Count:           int64(m.Count),
+			Expired:         int64(m.Expired),
+			OldestTimestamp: time.Unix(0, int64(m.OldestTimestamp)),
+			NewestTimestamp: time.Unix(0, int64(m.NewestTimestamp)),
+		}
+	}
+
+	return meta, nil
+}
+
+// PromQLOption configures a PromQL request.
+type PromQLOption func(url.Values)
+
+// WithPromQLTime sets the time the query is evaluated at. It defaults to now.
+func WithPromQLTime(t time.Time) PromQLOption {
+	return func(v url.Values) {
+		v.Set("time", formatPromTime(t))
+	}
+}
+
+// PromQLResult is the result of an instant PromQL query. Depending on
+// ResultType ("scalar", "vector" or "matrix") either Scalar, Vector or
+// Matrix is set.
+type PromQLResult struct {
+	ResultType string
+	Scalar     *Point
+	Vector     []Sample
+	Matrix     []Series
+}
+
+// Point is a single value at a point in time.
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Sample is a single point of a labelled series.
+type Sample struct {
+	Metric map[string]string
+	Point  Point
+}
+
+// Series is a labelled series of points.
+type Series struct {
+	Metric map[string]string
+	Points []Point
+}
+
+// PromQL evaluates an instant query against Log Cache's Prometheus
+// compatible API.
+func (c *Client) PromQL(ctx context.Context, query string, opts ...PromQLOption) (*PromQLResult, error) {
+	q := url.Values{}
+	q.Set("query", query)
+	for _, o := range opts {
+		o(q)
+	}
+
+	var resp struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := c.get(ctx, "/api/v1/query", q, &resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Status != "success" {
+		return nil, fmt.Errorf("promql query failed: %s", resp.Error)
+	}
+
+	result := &PromQLResult{ResultType: resp.Data.ResultType}
+	switch resp.Data.ResultType {
+	case "scalar":
+		var p promPoint
+		if err := json.Unmarshal(resp.Data.Result, &p); err != nil {
+			return nil, err
+		}
+		result.Scalar = &p.Point
+	case "vector":
+		var samples []struct {
+			Metric map[string]string `json:"metric"`
+			Value  promPoint         `json:"value"`
+		}
+		if err := json.Unmarshal(resp.Data.Result, &samples); err != nil {
+			return nil, err
+		}
+		for _, s := range samples {
+			result.Vector = append(result.Vector, Sample{
+				Metric: s.Metric,
+				Point:  s.Value.Point,
+			})
+		}
+	case "matrix":
+		var series []struct {
+			Metric map[string]string `json:"metric"`
+			Values []promPoint       `json:"values"`
+		}
+		if err := json.Unmarshal(resp.Data.Result, &series); err != nil {
+			return nil, err
+		}
+		for _, s := range series {
+			points := make([]Point, 0, len(s.Values))
+			for _, v := range s.Values {
+				points = append(points, v.Point)
+			}
+			result.Matrix = append(result.Matrix, Series{
+				Metric: s.Metric,
+				Points: points,
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported promql result type %q", resp.Data.ResultType)
+	}
+
+	return result, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	u := c.addr + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, body)
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// jsonInt64 accepts int64 values encoded either as JSON numbers or, as
+// protobuf's JSON mapping does, as strings.
+type jsonInt64 int64
+
+func (i *jsonInt64) UnmarshalJSON(data []byte) error {
+	n, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = jsonInt64(n)
+	return nil
+}
+
+// promPoint is a Prometheus API value: [<unix seconds>, "<value>"].
+type promPoint struct {
+	Point
+}
+
+func (p *promPoint) UnmarshalJSON(data []byte) error {
+	var raw []interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 2 {
+		return fmt.Errorf("invalid promql value %s", data)
+	}
+
+	ts, ok := raw[0].(float64)
+	if !ok {
+		return fmt.Errorf("invalid promql timestamp %v", raw[0])
+	}
+	s, ok := raw[1].(string)
+	if !ok {
+		return fmt.Errorf("invalid promql sample value %v", raw[1])
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+
+	sec := int64(ts)
+	p.Time = time.Unix(sec, int64((ts-float64(sec))*1e9)).Round(time.Millisecond)
+	p.Value = value
+	return nil
+}
+
+func formatPromTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
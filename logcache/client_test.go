@@ -0,0 +1,267 @@
+package logcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/logcache"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/golang/protobuf/jsonpb"
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		server   *httptest.Server
+		requests chan *http.Request
+		status   int
+		body     string
+		client   *logcache.Client
+	)
+
+	BeforeEach(func() {
+		requests = make(chan *http.Request, 10)
+		status = http.StatusOK
+		body = "{}"
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests <- r
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}))
+		client = logcache.NewClient(server.URL)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("Read", func() {
+		It("requests envelopes for a source ID", func() {
+			start := time.Unix(0, 100)
+			_, err := client.Read(context.Background(), "some-id", start,
+				logcache.WithEndTime(time.Unix(0, 200)),
+				logcache.WithLimit(10),
+				logcache.WithEnvelopeTypes(loggregator.LogEnvelope, loggregator.GaugeEnvelope),
+				logcache.WithDescending(),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			var r *http.Request
+			Expect(requests).To(Receive(&r))
+			Expect(r.Method).To(Equal(http.MethodGet))
+			Expect(r.URL.Path).To(Equal("/api/v1/read/some-id"))
+			Expect(r.URL.Query()).To(Equal(url.Values{
+				"start_time":     {"100"},
+				"end_time":       {"200"},
+				"limit":          {"10"},
+				"envelope_types": {"LOG", "GAUGE"},
+				"descending":     {"true"},
+			}))
+		})
+
+		It("returns the envelopes", func() {
+			m := jsonpb.Marshaler{}
+			batch, err := m.MarshalToString(&loggregator_v2.EnvelopeBatch{
+				Batch: []*loggregator_v2.Envelope{
+					{SourceId: "some-id", Timestamp: 1},
+					{SourceId: "some-id", Timestamp: 2},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			body = `{"envelopes":` + batch + `}`
+
+			envelopes, err := client.Read(context.Background(), "some-id", time.Unix(0, 0))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(envelopes).To(HaveLen(2))
+			Expect(envelopes[1].GetTimestamp()).To(Equal(int64(2)))
+		})
+
+		It("returns an error for non-200 responses", func() {
+			status = http.StatusNotFound
+			body = "no such source"
+
+			_, err := client.Read(context.Background(), "some-id", time.Unix(0, 0))
+			Expect(err).To(MatchError(ContainSubstring("404")))
+		})
+
+		It("uses the given HTTP client", func() {
+			doer := &spyDoer{}
+			client = logcache.NewClient(server.URL, logcache.WithHTTPClient(doer))
+
+			_, err := client.Read(context.Background(), "some-id", time.Unix(0, 0))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doer.called).To(BeTrue())
+		})
+	})
+
+	Describe("RecentLogs", func() {
+		It("returns the most recent logs, oldest first", func() {
+			body = logsResponse(3, 2, 1)
+
+			logs, err := client.RecentLogs(context.Background(), "some-id", 3)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(logs).To(HaveLen(3))
+			Expect(logs[0].GetTimestamp()).To(Equal(int64(1)))
+			Expect(logs[2].GetTimestamp()).To(Equal(int64(3)))
+
+			var r *http.Request
+			Expect(requests).To(Receive(&r))
+			Expect(r.URL.Path).To(Equal("/api/v1/read/some-id"))
+			Expect(r.URL.Query().Get("envelope_types")).To(Equal("LOG"))
+			Expect(r.URL.Query().Get("descending")).To(Equal("true"))
+			Expect(r.URL.Query().Get("limit")).To(Equal("3"))
+		})
+
+		It("reads older pages until the limit is reached", func() {
+			var first []int64
+			for ts := int64(2000); ts > 1000; ts-- {
+				first = append(first, ts)
+			}
+			bodies := []string{logsResponse(first...), logsResponse(1000, 999)}
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests <- r
+				w.Write([]byte(bodies[0]))
+				bodies = bodies[1:]
+			})
+
+			logs, err := client.RecentLogs(context.Background(), "some-id", 1500)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(logs).To(HaveLen(1002))
+			Expect(logs[0].GetTimestamp()).To(Equal(int64(999)))
+			Expect(logs[1001].GetTimestamp()).To(Equal(int64(2000)))
+
+			var r *http.Request
+			Expect(requests).To(Receive(&r))
+			Expect(r.URL.Query().Get("limit")).To(Equal("1000"))
+			Expect(requests).To(Receive(&r))
+			Expect(r.URL.Query().Get("limit")).To(Equal("500"))
+			Expect(r.URL.Query().Get("end_time")).To(Equal("1001"))
+		})
+
+		It("returns an error for non-200 responses", func() {
+			status = http.StatusNotFound
+
+			_, err := client.RecentLogs(context.Background(), "some-id", 10)
+			Expect(err).To(MatchError(ContainSubstring("404")))
+		})
+	})
+
+	Describe("Meta", func() {
+		It("returns the meta information by source ID", func() {
+			body = `{"meta":{"some-id":{"count":"10","expired":3,"oldestTimestamp":"100","newestTimestamp":"200"}}}`
+
+			meta, err := client.Meta(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+
+			var r *http.Request
+			Expect(requests).To(Receive(&r))
+			Expect(r.URL.Path).To(Equal("/api/v1/meta"))
+
+			Expect(meta).To(Equal(map[string]logcache.MetaInfo{
+				"some-id": {
+					Count:           10,
+					Expired:         3,
+					OldestTimestamp: time.Unix(0, 100),
+					NewestTimestamp: time.Unix(0, 200),
+				},
+			}))
+		})
+	})
+
+	Describe("PromQL", func() {
+		It("sends the query", func() {
+			body = `{"status":"success","data":{"resultType":"scalar","result":[1.5,"2"]}}`
+
+			_, err := client.PromQL(context.Background(), "metric{source_id=\"a\"}",
+				logcache.WithPromQLTime(time.Unix(1, 500000000)),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			var r *http.Request
+			Expect(requests).To(Receive(&r))
+			Expect(r.URL.Path).To(Equal("/api/v1/query"))
+			Expect(r.URL.Query().Get("query")).To(Equal("metric{source_id=\"a\"}"))
+			Expect(r.URL.Query().Get("time")).To(Equal("1.500"))
+		})
+
+		It("returns scalar results", func() {
+			body = `{"status":"success","data":{"resultType":"scalar","result":[1.5,"2"]}}`
+
+			result, err := client.PromQL(context.Background(), "2")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.ResultType).To(Equal("scalar"))
+			Expect(result.Scalar.Value).To(Equal(2.0))
+			Expect(result.Scalar.Time).To(Equal(time.Unix(1, 500000000)))
+		})
+
+		It("returns vector results", func() {
+			body = `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"source_id":"a"},"value":[1,"10"]},
+				{"metric":{"source_id":"b"},"value":[1,"20"]}
+			]}}`
+
+			result, err := client.PromQL(context.Background(), "metric")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Vector).To(Equal([]logcache.Sample{
+				{Metric: map[string]string{"source_id": "a"}, Point: logcache.Point{Time: time.Unix(1, 0), Value: 10}},
+				{Metric: map[string]string{"source_id": "b"}, Point: logcache.Point{Time: time.Unix(1, 0), Value: 20}},
+			}))
+		})
+
+		It("returns matrix results", func() {
+			body = `{"status":"success","data":{"resultType":"matrix","result":[
+				{"metric":{"source_id":"a"},"values":[[1,"10"],[2,"11"]]}
+			]}}`
+
+			result, err := client.PromQL(context.Background(), "metric[1m]")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Matrix).To(HaveLen(1))
+			Expect(result.Matrix[0].Points).To(Equal([]logcache.Point{
+				{Time: time.Unix(1, 0), Value: 10},
+				{Time: time.Unix(2, 0), Value: 11},
+			}))
+		})
+
+		It("returns an error for failed queries", func() {
+			status = http.StatusBadRequest
+			body = `{"status":"error","errorType":"bad_data","error":"parse error"}`
+
+			_, err := client.PromQL(context.Background(), "(")
+			Expect(err).To(MatchError(ContainSubstring("parse error")))
+		})
+	})
+})
+
+type spyDoer struct {
+	called bool
+}
+
+func (s *spyDoer) Do(r *http.Request) (*http.Response, error) {
+	s.called = true
+	return http.DefaultClient.Do(r)
+}
+
+// logsResponse returns a read response with a log for each timestamp.
+func logsResponse(timestamps ...int64) string {
+	var batch loggregator_v2.EnvelopeBatch
+	for _, ts := range timestamps {
+		batch.Batch = append(batch.Batch, &loggregator_v2.Envelope{
+			Timestamp: ts,
+			Message: &loggregator_v2.Envelope_Log{
+				Log: &loggregator_v2.Log{Payload: []byte("some log")},
+			},
+		})
+	}
+
+	m := jsonpb.Marshaler{}
+	s, err := m.MarshalToString(&batch)
+	Expect(err).ToNot(HaveOccurred())
+
+	return `{"envelopes":` + s + `}`
+}
@@ -0,0 +1,13 @@
+package logcache_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestLogcache(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Logcache Suite")
+}
@@ -0,0 +1,206 @@
+// Package logwriter provides an io.Writer that emits what is written to it
+// as loggregator logs, e.g. to capture the output of a child process or a
+// standard library logger:
+//
+//	log.SetOutput(logwriter.New(client))
+//
+// Lines belonging to a single message, such as a stack trace, can be joined
+// into one log with WithMultiline.
+package logwriter
+
+import (
+	"bytes"
+	"regexp"
+	"sync"
+	"time"
+
+	loggregator "code.cloudfoundry.org/go-loggregator"
+)
+
+// LogClient is the client used by Writer to emit logs. This would usually be
+// the go-loggregator v2 client.
+type LogClient interface {
+	EmitLog(message string, opts ...loggregator.EmitLogOption)
+}
+
+// WriterOption is a function type that is used to configure optional
+// settings for a Writer.
+type WriterOption func(*Writer)
+
+// WithEmitLogOptions sets options that are applied to every emitted log,
+// e.g. loggregator.WithSourceInfo or loggregator.WithStdout.
+func WithEmitLogOptions(opts ...loggregator.EmitLogOption) WriterOption {
+	return func(w *Writer) {
+		w.opts = append(w.opts, opts...)
+	}
+}
+
+// WithMultiline joins lines into a single log. A line that matches start
+// begins a new log and every line that does not is appended to the previous
+// one, e.g. to keep the frames of a stack trace with the line that
+// introduced them:
+//
+//	logwriter.WithMultiline(regexp.MustCompile(`^\S`))
+//
+// A nil start joins every line written within the multiline timeout (see
+// WithMultilineTimeout) of the previous one.
+func WithMultiline(start *regexp.Regexp) WriterOption {
+	return func(w *Writer) {
+		w.multiline = true
+		w.start = start
+	}
+}
+
+// WithMultilineTimeout sets how long a joined log waits for more lines
+// before it is emitted. It defaults to 500 milliseconds.
+func WithMultilineTimeout(d time.Duration) WriterOption {
+	return func(w *Writer) {
+		w.timeout = d
+	}
+}
+
+// WithMaxLines sets the maximum number of lines joined into a single log.
+// Once it is reached, the log is emitted and the next line begins a new
+// one. It defaults to 500.
+func WithMaxLines(n int) WriterOption {
+	return func(w *Writer) {
+		w.maxLines = n
+	}
+}
+
+// Writer is an io.Writer that emits each line written to it as a loggregator
+// log, or, with WithMultiline, joins related lines into a single log. It is
+// safe for concurrent use.
+type Writer struct {
+	client LogClient
+	opts   []loggregator.EmitLogOption
+
+	multiline bool
+	start     *regexp.Regexp
+	timeout   time.Duration
+	maxLines  int
+
+	mu      sync.Mutex
+	buf     []byte
+	pending [][]byte
+	timer   *time.Timer
+	// gen identifies the pending log so that a timer that fires after it
+	// has already been emitted does nothing.
+	gen int
+}
+
+// New returns a Writer configured with the given LogClient and
+// WriterOptions.
+func New(c LogClient, opts ...WriterOption) *Writer {
+	w := &Writer{
+		client:   c,
+		timeout:  500 * time.Millisecond,
+		maxLines: 500,
+	}
+
+	for _, o := range opts {
+		o(w)
+	}
+
+	return w
+}
+
+// Write implements io.Writer. Each newline terminated line is emitted or, in
+// multiline mode, added to the pending log. A trailing partial line is held
+// until the rest of it is written.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := bytes.TrimSuffix(w.buf[:i], []byte("\r"))
+		w.buf = w.buf[i+1:]
+		w.addLine(line)
+	}
+
+	if len(w.buf) == 0 {
+		w.buf = nil
+	}
+	if len(w.pending) > 0 {
+		w.resetTimer()
+	}
+
+	return len(p), nil
+}
+
+// Flush emits the pending log and any partial line.
+func (w *Writer) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.addLine(w.buf)
+		w.buf = nil
+	}
+	w.emitPending()
+}
+
+// Close flushes the Writer. It always returns nil.
+func (w *Writer) Close() error {
+	w.Flush()
+	return nil
+}
+
+func (w *Writer) addLine(line []byte) {
+	if !w.multiline {
+		if len(bytes.TrimSpace(line)) > 0 {
+			w.client.EmitLog(string(line), w.opts...)
+		}
+		return
+	}
+
+	if len(w.pending) > 0 && w.start != nil && w.start.Match(line) {
+		w.emitPending()
+	}
+	if len(w.pending) == 0 && len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+
+	w.pending = append(w.pending, append([]byte(nil), line...))
+	if len(w.pending) >= w.maxLines {
+		w.emitPending()
+	}
+}
+
+func (w *Writer) emitPending() {
+	if len(w.pending) == 0 {
+		return
+	}
+
+	w.client.EmitLog(string(bytes.Join(w.pending, []byte("\n"))), w.opts...)
+	w.pending = nil
+	w.gen++
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
+
+// resetTimer restarts the multiline timeout of the pending log.
+func (w *Writer) resetTimer() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+
+	w.gen++
+	gen := w.gen
+	w.timer = time.AfterFunc(w.timeout, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		if w.gen == gen {
+			w.emitPending()
+		}
+	})
+}
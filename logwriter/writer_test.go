@@ -0,0 +1,137 @@
+package logwriter_test
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	loggregator "code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/logwriter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Writer", func() {
+	var client *spyLogClient
+
+	BeforeEach(func() {
+		client = newSpyLogClient()
+	})
+
+	It("emits each line as a log", func() {
+		w := logwriter.New(client, logwriter.WithEmitLogOptions(
+			loggregator.WithSourceInfo("source-id", "APP", "0"),
+			loggregator.WithStdout(),
+		))
+
+		fmt.Fprint(w, "first\nsec")
+		fmt.Fprint(w, "ond\r\n\n")
+
+		Expect(client.payloads()).To(Equal([]string{"first", "second"}))
+		env := client.envelopes()[0]
+		Expect(env.GetSourceId()).To(Equal("source-id"))
+		Expect(env.GetLog().GetType()).To(Equal(loggregator_v2.Log_OUT))
+	})
+
+	It("emits a partial line when flushed", func() {
+		w := logwriter.New(client)
+
+		fmt.Fprint(w, "partial")
+		Expect(client.payloads()).To(BeEmpty())
+
+		w.Flush()
+		Expect(client.payloads()).To(Equal([]string{"partial"}))
+	})
+
+	Describe("multiline", func() {
+		It("joins lines that do not match the start pattern", func() {
+			w := logwriter.New(client,
+				logwriter.WithMultiline(regexp.MustCompile(`^\S`)),
+			)
+
+			fmt.Fprintln(w, "panic: boom")
+			fmt.Fprintln(w, "\tmain.go:10")
+			fmt.Fprintln(w, "\tmain.go:20")
+			fmt.Fprintln(w, "next message")
+			Expect(client.payloads()).To(Equal([]string{
+				"panic: boom\n\tmain.go:10\n\tmain.go:20",
+			}))
+
+			w.Flush()
+			Expect(client.payloads()).To(HaveLen(2))
+			Expect(client.payloads()[1]).To(Equal("next message"))
+		})
+
+		It("emits the pending log after the timeout", func() {
+			w := logwriter.New(client,
+				logwriter.WithMultiline(nil),
+				logwriter.WithMultilineTimeout(50*time.Millisecond),
+			)
+
+			fmt.Fprintln(w, "one")
+			fmt.Fprintln(w, "two")
+			Consistently(client.payloads, 20*time.Millisecond).Should(BeEmpty())
+
+			Eventually(client.payloads).Should(Equal([]string{"one\ntwo"}))
+		})
+
+		It("emits the pending log once it reaches the maximum lines", func() {
+			w := logwriter.New(client,
+				logwriter.WithMultiline(nil),
+				logwriter.WithMaxLines(2),
+			)
+
+			fmt.Fprint(w, "one\ntwo\nthree\n")
+			Expect(client.payloads()).To(Equal([]string{"one\ntwo"}))
+
+			w.Close()
+			Expect(client.payloads()).To(Equal([]string{"one\ntwo", "three"}))
+		})
+	})
+})
+
+type spyLogClient struct {
+	mu   sync.Mutex
+	envs []*loggregator_v2.Envelope
+}
+
+func newSpyLogClient() *spyLogClient {
+	return &spyLogClient{}
+}
+
+func (s *spyLogClient) EmitLog(message string, opts ...loggregator.EmitLogOption) {
+	env := &loggregator_v2.Envelope{
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{
+				Payload: []byte(message),
+				Type:    loggregator_v2.Log_ERR,
+			},
+		},
+		Tags: make(map[string]string),
+	}
+
+	for _, o := range opts {
+		o(env)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.envs = append(s.envs, env)
+}
+
+func (s *spyLogClient) envelopes() []*loggregator_v2.Envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*loggregator_v2.Envelope(nil), s.envs...)
+}
+
+func (s *spyLogClient) payloads() []string {
+	var p []string
+	for _, e := range s.envelopes() {
+		p = append(p, string(e.GetLog().GetPayload()))
+	}
+	return p
+}
@@ -0,0 +1,252 @@
+package loggregator
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// Destination is a client that a MultiClient duplicates envelopes to. It is
+// satisfied by IngressClient as well as the v1 client.
+type Destination interface {
+	EmitLog(message string, opts ...EmitLogOption)
+	EmitGauge(opts ...EmitGaugeOption)
+	EmitCounter(name string, opts ...EmitCounterOption)
+	EmitTimer(name string, start, stop time.Time, opts ...EmitTimerOption)
+}
+
+// multiClientQueueSize is the number of emits a MultiClient queues for each
+// destination before it starts dropping them for that destination.
+const multiClientQueueSize = 1000
+
+// MultiClient duplicates everything it emits to several destinations, e.g.
+// two loggregator deployments during a migration. Each destination builds,
+// buffers and sends its own copy, so client options such as tags and
+// backpressure apply per destination. Every destination has its own queue
+// and goroutine, so a destination that blocks (e.g. an IngressClient with
+// the Block backpressure strategy and a full buffer) does not hold up the
+// others; once its queue is full, emits for that destination are dropped.
+// It should be created with the NewMultiClient constructor.
+type MultiClient struct {
+	mu      sync.RWMutex
+	closed  bool
+	closing chan struct{}
+	queues  []*destinationQueue
+
+	dropped uint64
+}
+
+// destinationQueue runs the emits queued for a single destination. Its work
+// channel is never closed, so that Flush can send to it without holding the
+// MultiClient's lock; the queue is drained and stopped once closing is
+// closed instead.
+type destinationQueue struct {
+	destination Destination
+	work        chan func(Destination)
+	closing     chan struct{}
+	done        chan struct{}
+}
+
+// NewMultiClient returns a MultiClient that emits to the given destinations.
+func NewMultiClient(destinations ...Destination) *MultiClient {
+	m := &MultiClient{
+		closing: make(chan struct{}),
+	}
+	for _, d := range destinations {
+		q := &destinationQueue{
+			destination: d,
+			work:        make(chan func(Destination), multiClientQueueSize),
+			closing:     m.closing,
+			done:        make(chan struct{}),
+		}
+		go q.run()
+		m.queues = append(m.queues, q)
+	}
+
+	return m
+}
+
+func (q *destinationQueue) run() {
+	defer close(q.done)
+	for {
+		select {
+		case f := <-q.work:
+			f(q.destination)
+		case <-q.closing:
+			for {
+				select {
+				case f := <-q.work:
+					f(q.destination)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// enqueue queues f for every destination without blocking. Destinations
+// whose queue is full miss out and are counted as dropped.
+func (m *MultiClient) enqueue(f func(Destination)) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		atomic.AddUint64(&m.dropped, uint64(len(m.queues)))
+		return
+	}
+
+	for _, q := range m.queues {
+		select {
+		case q.work <- f:
+		default:
+			atomic.AddUint64(&m.dropped, 1)
+		}
+	}
+}
+
+// Dropped returns the number of emits discarded because a destination's
+// queue was full or the MultiClient was closed. Each destination that
+// misses an emit counts once.
+func (m *MultiClient) Dropped() uint64 {
+	return atomic.LoadUint64(&m.dropped)
+}
+
+// EmitLog sends a message to every destination.
+func (m *MultiClient) EmitLog(message string, opts ...EmitLogOption) {
+	m.enqueue(func(d Destination) {
+		d.EmitLog(message, opts...)
+	})
+}
+
+// EmitGauge sends the configured gauge values to every destination.
+func (m *MultiClient) EmitGauge(opts ...EmitGaugeOption) {
+	m.enqueue(func(d Destination) {
+		d.EmitGauge(opts...)
+	})
+}
+
+// EmitCounter sends a counter envelope to every destination.
+func (m *MultiClient) EmitCounter(name string, opts ...EmitCounterOption) {
+	m.enqueue(func(d Destination) {
+		d.EmitCounter(name, opts...)
+	})
+}
+
+// EmitTimer sends a timer envelope to every destination.
+func (m *MultiClient) EmitTimer(name string, start, stop time.Time, opts ...EmitTimerOption) {
+	m.enqueue(func(d Destination) {
+		d.EmitTimer(name, start, stop, opts...)
+	})
+}
+
+// Emit sends a copy of the envelope to every destination that supports
+// emitting envelopes directly, such as IngressClient. Other destinations
+// are skipped.
+func (m *MultiClient) Emit(e *loggregator_v2.Envelope) {
+	e = proto.Clone(e).(*loggregator_v2.Envelope)
+	m.enqueue(func(d Destination) {
+		if ed, ok := d.(interface {
+			Emit(*loggregator_v2.Envelope)
+		}); ok {
+			ed.Emit(proto.Clone(e).(*loggregator_v2.Envelope))
+		}
+	})
+}
+
+// Flush waits for every destination to work through its queue and then
+// flushes the destinations that can be flushed, such as IngressClient. It
+// returns the first error, or the context's error if it is done first, or
+// ErrClosed if the MultiClient is closed first.
+func (m *MultiClient) Flush(ctx context.Context) error {
+	// The queues are fixed once the MultiClient is created, so they can be
+	// sent to without the lock. Holding it while a stalled destination's
+	// queue is full would block CloseSend and, behind it, every emit.
+	m.mu.RLock()
+	closed := m.closed
+	m.mu.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+
+	results := make([]chan error, 0, len(m.queues))
+	for _, q := range m.queues {
+		result := make(chan error, 1)
+		f := func(d Destination) {
+			if fd, ok := d.(interface {
+				Flush(context.Context) error
+			}); ok {
+				result <- fd.Flush(ctx)
+				return
+			}
+			result <- nil
+		}
+
+		select {
+		case q.work <- f:
+		case <-m.closing:
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		results = append(results, result)
+	}
+
+	var firstErr error
+	for _, result := range results {
+		select {
+		case err := <-result:
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		case <-m.closing:
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return firstErr
+}
+
+// CloseSend waits for every destination to work through its queue and then
+// closes the destinations that can be closed, such as IngressClient. The
+// destinations are closed concurrently and all of them are closed even if
+// some fail; the first error, in destination order, is returned.
+func (m *MultiClient) CloseSend() error {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.closing)
+	}
+	m.mu.Unlock()
+
+	errs := make([]error, len(m.queues))
+	var wg sync.WaitGroup
+	for i, q := range m.queues {
+		wg.Add(1)
+		go func(i int, q *destinationQueue) {
+			defer wg.Done()
+			<-q.done
+			if c, ok := q.destination.(interface {
+				CloseSend() error
+			}); ok {
+				errs[i] = c.CloseSend()
+			}
+		}(i, q)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package loggregator_test
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MultiClient", func() {
+	var (
+		servers   []*testIngressServer
+		received  []chan *loggregator_v2.Envelope
+		clients   []*loggregator.IngressClient
+		multi     *loggregator.MultiClient
+		receiveOn = func(i int) *loggregator_v2.Envelope {
+			var e *loggregator_v2.Envelope
+			Eventually(received[i], 5).Should(Receive(&e))
+			return e
+		}
+	)
+
+	BeforeEach(func() {
+		servers, received, clients = nil, nil, nil
+
+		var destinations []loggregator.Destination
+		for _, name := range []string{"a", "b"} {
+			server := newInsecureTestIngressServer()
+			Expect(server.start()).To(Succeed())
+			servers = append(servers, server)
+			received = append(received, server.collect())
+
+			client, err := loggregator.NewInsecureIngressClient(
+				loggregator.WithAddr(server.addr),
+				loggregator.WithBatchFlushInterval(time.Hour),
+				loggregator.WithTag("destination", name),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			clients = append(clients, client)
+			destinations = append(destinations, client)
+		}
+
+		multi = loggregator.NewMultiClient(destinations...)
+	})
+
+	AfterEach(func() {
+		for _, s := range servers {
+			s.stop()
+		}
+	})
+
+	flush := func() {
+		Expect(multi.Flush(context.Background())).To(Succeed())
+	}
+
+	It("duplicates logs to every destination", func() {
+		multi.EmitLog("message", loggregator.WithStdout())
+		flush()
+
+		for i, name := range []string{"a", "b"} {
+			e := receiveOn(i)
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("message")))
+			Expect(e.GetLog().GetType()).To(Equal(loggregator_v2.Log_OUT))
+			Expect(e.GetTags()["destination"]).To(Equal(name))
+		}
+	})
+
+	It("duplicates metrics to every destination", func() {
+		multi.EmitCounter("counter")
+		multi.EmitGauge(loggregator.WithGaugeValue("gauge", 1, "unit"))
+		multi.EmitTimer("timer", time.Now(), time.Now())
+		flush()
+
+		for i := range servers {
+			Expect(receiveOn(i).GetCounter().GetName()).To(Equal("counter"))
+			Expect(receiveOn(i).GetGauge().GetMetrics()).To(HaveKey("gauge"))
+			Expect(receiveOn(i).GetTimer().GetName()).To(Equal("timer"))
+		}
+	})
+
+	It("sends a separate copy of emitted envelopes", func() {
+		e := loggregator.NewEnvelope().SetEvent("title", "body").Build()
+		multi.Emit(e)
+		flush()
+
+		first, second := receiveOn(0), receiveOn(1)
+		Expect(first.GetEvent().GetTitle()).To(Equal("title"))
+		Expect(second.GetEvent().GetTitle()).To(Equal("title"))
+		Expect(first).ToNot(BeIdenticalTo(second))
+	})
+
+	It("does not let a stalled destination delay the others", func() {
+		stalled := newStalledDestination()
+		defer stalled.release()
+		multi = loggregator.NewMultiClient(stalled, clients[0])
+
+		for i := 0; i < 10; i++ {
+			multi.EmitLog("message")
+		}
+		Eventually(stalled.emits).Should(Equal(1))
+		Expect(clients[0].Flush(context.Background())).To(Succeed())
+
+		for i := 0; i < 10; i++ {
+			Expect(receiveOn(0).GetLog().GetPayload()).To(Equal([]byte("message")))
+		}
+	})
+
+	It("drops emits for a destination whose queue is full", func() {
+		stalled := newStalledDestination()
+		defer stalled.release()
+		multi = loggregator.NewMultiClient(stalled)
+
+		for i := 0; i < 2000; i++ {
+			multi.EmitCounter("counter")
+		}
+
+		Expect(multi.Dropped()).To(BeNumerically(">", 0))
+	})
+
+	It("does not block emits while a flush waits for a stalled destination", func() {
+		stalled := newStalledDestination()
+		defer stalled.release()
+		m := loggregator.NewMultiClient(stalled)
+
+		for i := 0; i < 2000; i++ {
+			m.EmitLog("message")
+		}
+
+		flushed := make(chan error, 1)
+		go func() {
+			flushed <- m.Flush(context.Background())
+		}()
+		Consistently(flushed, 100*time.Millisecond).ShouldNot(Receive())
+
+		go m.CloseSend()
+		Eventually(flushed).Should(Receive(MatchError(loggregator.ErrClosed)))
+
+		emitted := make(chan struct{})
+		go func() {
+			defer close(emitted)
+			m.EmitLog("message")
+		}()
+		Eventually(emitted).Should(BeClosed())
+	})
+
+	It("closes every destination", func() {
+		Expect(multi.CloseSend()).To(Succeed())
+
+		for _, c := range clients {
+			Expect(c.Flush(context.Background())).To(MatchError(loggregator.ErrClosed))
+		}
+	})
+})
+
+// stalledDestination blocks on its first emit until it is released.
+type stalledDestination struct {
+	mu      sync.Mutex
+	emits_  int
+	blocked chan struct{}
+	once    sync.Once
+}
+
+func newStalledDestination() *stalledDestination {
+	return &stalledDestination{
+		blocked: make(chan struct{}),
+	}
+}
+
+func (s *stalledDestination) stall() {
+	s.mu.Lock()
+	s.emits_++
+	s.mu.Unlock()
+	<-s.blocked
+}
+
+func (s *stalledDestination) emits() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.emits_
+}
+
+func (s *stalledDestination) release() {
+	s.once.Do(func() { close(s.blocked) })
+}
+
+func (s *stalledDestination) EmitLog(string, ...loggregator.EmitLogOption) {
+	s.stall()
+}
+
+func (s *stalledDestination) EmitGauge(...loggregator.EmitGaugeOption) {
+	s.stall()
+}
+
+func (s *stalledDestination) EmitCounter(string, ...loggregator.EmitCounterOption) {
+	s.stall()
+}
+
+func (s *stalledDestination) EmitTimer(string, time.Time, time.Time, ...loggregator.EmitTimerOption) {
+	s.stall()
+}
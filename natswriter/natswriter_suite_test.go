@@ -0,0 +1,13 @@
+package natswriter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestNatswriter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "NATS Writer Suite")
+}
@@ -0,0 +1,150 @@
+// Package natswriter publishes envelopes over NATS, for deployments that
+// transport telemetry over NATS instead of gRPC to Metron. Its Writer is a
+// loggregator.BatchWriter, so it is used through an IngressClient:
+//
+//	client, err := loggregator.NewIngressClient(nil,
+//		loggregator.WithBatchWriter(natswriter.New(nc, "envelopes")),
+//	)
+//
+// Rather than depending on the NATS client library, Writer publishes
+// through the small Publisher interface, which a *nats.Conn from
+// github.com/nats-io/nats.go implements. For JetStream, whose Publish also
+// returns an acknowledgement, use PublisherFunc:
+//
+//	p := natswriter.PublisherFunc(func(subject string, data []byte) error {
+//		_, err := js.Publish(subject, data)
+//		return err
+//	})
+package natswriter
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// Publisher publishes a message to a NATS subject.
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// PublisherFunc is an adapter that allows a function to be used as a
+// Publisher.
+type PublisherFunc func(subject string, data []byte) error
+
+// Publish calls f.
+func (f PublisherFunc) Publish(subject string, data []byte) error {
+	return f(subject, data)
+}
+
+// contextFlusher and flusher are implemented by *nats.Conn. Flushing waits
+// until the server has processed everything published so far.
+type contextFlusher interface {
+	FlushWithContext(ctx context.Context) error
+}
+
+type flusher interface {
+	Flush() error
+}
+
+// Option is a function type that is used to configure optional settings for
+// a Writer.
+type Option func(*Writer)
+
+// WithJSON makes the Writer serialize envelopes as JSON, in the format of
+// the RLP gateway (see loggregator_v2.Envelope.MarshalJSON), instead of as
+// protobuf.
+func WithJSON() Option {
+	return func(w *Writer) {
+		w.json = true
+	}
+}
+
+// WithSourceSubjects publishes every envelope to a subject of its own
+// source, i.e. "<subject>.<source ID>", so that subscribers can select
+// sources with subject wildcards. Characters that are not allowed in a
+// subject token are replaced with underscores, and envelopes without a
+// source ID are published to "<subject>._".
+func WithSourceSubjects() Option {
+	return func(w *Writer) {
+		w.sourceSubjects = true
+	}
+}
+
+// Writer is a loggregator.BatchWriter that publishes every envelope of a
+// batch as a NATS message.
+type Writer struct {
+	publisher      Publisher
+	subject        string
+	json           bool
+	sourceSubjects bool
+}
+
+// New returns a Writer that publishes to the given subject.
+func New(p Publisher, subject string, opts ...Option) *Writer {
+	w := &Writer{
+		publisher: p,
+		subject:   subject,
+	}
+
+	for _, o := range opts {
+		o(w)
+	}
+
+	return w
+}
+
+// Write implements loggregator.BatchWriter. If the Publisher can be
+// flushed, as a *nats.Conn can, Write flushes it after publishing the batch
+// so that an error is returned if the server did not receive it.
+func (w *Writer) Write(ctx context.Context, batch []*loggregator_v2.Envelope) error {
+	for _, e := range batch {
+		data, err := w.marshal(e)
+		if err != nil {
+			return err
+		}
+
+		if err := w.publisher.Publish(w.subjectFor(e), data); err != nil {
+			return err
+		}
+	}
+
+	switch f := w.publisher.(type) {
+	case contextFlusher:
+		return f.FlushWithContext(ctx)
+	case flusher:
+		return f.Flush()
+	}
+
+	return nil
+}
+
+func (w *Writer) subjectFor(e *loggregator_v2.Envelope) string {
+	if !w.sourceSubjects {
+		return w.subject
+	}
+
+	token := strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, e.GetSourceId())
+	if token == "" {
+		token = "_"
+	}
+
+	return w.subject + "." + token
+}
+
+func (w *Writer) marshal(e *loggregator_v2.Envelope) ([]byte, error) {
+	if w.json {
+		return json.Marshal(e)
+	}
+	return proto.Marshal(e)
+}
@@ -0,0 +1,88 @@
+package natswriter_test
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-loggregator/natswriter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Writer", func() {
+	var (
+		conn  *spyConn
+		batch []*loggregator_v2.Envelope
+	)
+
+	BeforeEach(func() {
+		conn = &spyConn{}
+		batch = []*loggregator_v2.Envelope{
+			{SourceId: "app.1", Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{Payload: []byte("one")}}},
+			{Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{Payload: []byte("two")}}},
+		}
+	})
+
+	It("publishes each envelope to the subject and flushes", func() {
+		w := natswriter.New(conn, "envelopes")
+		Expect(w.Write(context.Background(), batch)).To(Succeed())
+
+		Expect(conn.subjects).To(Equal([]string{"envelopes", "envelopes"}))
+		Expect(conn.flushes).To(Equal(1))
+
+		var e loggregator_v2.Envelope
+		Expect(proto.Unmarshal(conn.data[0], &e)).To(Succeed())
+		Expect(proto.Equal(&e, batch[0])).To(BeTrue())
+	})
+
+	It("publishes to a subject per source", func() {
+		w := natswriter.New(conn, "envelopes", natswriter.WithSourceSubjects())
+		Expect(w.Write(context.Background(), batch)).To(Succeed())
+
+		Expect(conn.subjects).To(Equal([]string{"envelopes.app_1", "envelopes._"}))
+	})
+
+	It("serializes envelopes as JSON", func() {
+		w := natswriter.New(conn, "envelopes", natswriter.WithJSON())
+		Expect(w.Write(context.Background(), batch[:1])).To(Succeed())
+
+		var e loggregator_v2.Envelope
+		Expect(json.Unmarshal(conn.data[0], &e)).To(Succeed())
+		Expect(e.GetSourceId()).To(Equal("app.1"))
+	})
+
+	It("returns publish and flush errors", func() {
+		conn.flushErr = errors.New("timeout")
+		w := natswriter.New(conn, "envelopes")
+		Expect(w.Write(context.Background(), batch)).To(MatchError("timeout"))
+
+		p := natswriter.PublisherFunc(func(string, []byte) error {
+			return errors.New("closed")
+		})
+		w = natswriter.New(p, "envelopes")
+		Expect(w.Write(context.Background(), batch)).To(MatchError("closed"))
+	})
+})
+
+type spyConn struct {
+	subjects []string
+	data     [][]byte
+	flushes  int
+	flushErr error
+}
+
+func (c *spyConn) Publish(subject string, data []byte) error {
+	c.subjects = append(c.subjects, subject)
+	c.data = append(c.data, data)
+	return nil
+}
+
+func (c *spyConn) FlushWithContext(context.Context) error {
+	c.flushes++
+	return c.flushErr
+}
@@ -0,0 +1,174 @@
+// Package promemitter scrapes a Prometheus exposition endpoint and emits the
+// collected metrics as counter and gauge envelopes. It lets applications
+// instrumented with a Prometheus client library feed Loggregator without
+// instrumenting twice.
+package promemitter
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+)
+
+// Sender is the interface of the client that the scraped metrics are
+// emitted to. It is satisfied by the IngressClient and the v1 client.
+type Sender interface {
+	EmitCounter(name string, opts ...loggregator.EmitCounterOption)
+	EmitGauge(opts ...loggregator.EmitGaugeOption)
+}
+
+// Emitter scrapes a Prometheus endpoint on an interval and emits what it
+// collects via the sender. Counters, and the _count and _bucket samples of
+// histograms and summaries, are emitted as counters with their total set
+// (fractional totals are truncated). Every other sample is emitted as a
+// gauge. Labels become envelope tags; non-finite values are skipped. It
+// should be created with the New constructor.
+type Emitter struct {
+	url      string
+	sender   Sender
+	interval time.Duration
+	doer     loggregator.Doer
+	log      loggregator.Logger
+	tags     map[string]string
+}
+
+// EmitterOption configures an Emitter.
+type EmitterOption func(*Emitter)
+
+// WithInterval sets the interval between scrapes. It defaults to 15
+// seconds.
+func WithInterval(d time.Duration) EmitterOption {
+	return func(e *Emitter) {
+		e.interval = d
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to scrape the endpoint. It
+// defaults to the http.DefaultClient.
+func WithHTTPClient(d loggregator.Doer) EmitterOption {
+	return func(e *Emitter) {
+		e.doer = d
+	}
+}
+
+// WithLogger sets the logger that failed scrapes are reported to. By
+// default they are discarded.
+func WithLogger(l loggregator.Logger) EmitterOption {
+	return func(e *Emitter) {
+		e.log = l
+	}
+}
+
+// WithTags sets tags that are added to every emitted envelope in addition
+// to the labels of each sample.
+func WithTags(tags map[string]string) EmitterOption {
+	return func(e *Emitter) {
+		e.tags = tags
+	}
+}
+
+// New returns an Emitter that scrapes the given URL (e.g.
+// http://localhost:8080/metrics) and emits via the sender.
+func New(url string, sender Sender, opts ...EmitterOption) *Emitter {
+	e := &Emitter{
+		url:      url,
+		sender:   sender,
+		interval: 15 * time.Second,
+		doer:     http.DefaultClient,
+		log:      log.New(ioutil.Discard, "", 0),
+	}
+
+	for _, o := range opts {
+		o(e)
+	}
+
+	return e
+}
+
+// Run scrapes the endpoint on the configured interval. This method will
+// block but the user may run in a go routine.
+func (e *Emitter) Run() {
+	for range time.Tick(e.interval) {
+		if err := e.Scrape(); err != nil {
+			e.log.Printf("failed to scrape %s: %s", e.url, err)
+		}
+	}
+}
+
+// Scrape scrapes the endpoint once and emits the collected metrics.
+func (e *Emitter) Scrape() error {
+	req, err := http.NewRequest(http.MethodGet, e.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+
+	resp, err := e.doer.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	samples, err := parse(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range samples {
+		e.emit(s)
+	}
+
+	return nil
+}
+
+func (e *Emitter) emit(s sample) {
+	if math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+		return
+	}
+
+	tags := make(map[string]string, len(e.tags)+len(s.labels))
+	for k, v := range e.tags {
+		tags[k] = v
+	}
+	for k, v := range s.labels {
+		tags[k] = v
+	}
+
+	if isCounter(s) && s.value >= 0 {
+		e.sender.EmitCounter(s.name,
+			loggregator.WithTotal(uint64(s.value)),
+			loggregator.WithEnvelopeTags(tags),
+		)
+		return
+	}
+
+	e.sender.EmitGauge(
+		loggregator.WithGaugeValue(s.name, s.value, ""),
+		loggregator.WithEnvelopeTags(tags),
+	)
+}
+
+func isCounter(s sample) bool {
+	switch s.typ {
+	case "counter":
+		return true
+	case "histogram":
+		return s.name == s.family+"_count" || s.name == s.family+"_bucket"
+	case "summary":
+		return s.name == s.family+"_count"
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package promemitter_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/promemitter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const exposition = `# HELP http_requests_total The total number of requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post",code="400"}    3 1395066363000
+
+# A gauge without help.
+# TYPE temperature gauge
+temperature{room="a \"quoted\" name"} 21.5
+temperature{room="broken"} NaN
+
+untyped_metric 7
+
+# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{le="0.5"} 24054
+request_duration_seconds_bucket{le="+Inf"} 144320
+request_duration_seconds_sum 53423.5
+request_duration_seconds_count 144320
+
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.99"} 76656
+rpc_duration_seconds_sum 1.7560473e+07
+rpc_duration_seconds_count 2693
+`
+
+var _ = Describe("Emitter", func() {
+	var (
+		server *httptest.Server
+		body   string
+		status int
+		sender *spySender
+	)
+
+	BeforeEach(func() {
+		body, status = exposition, http.StatusOK
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}))
+		sender = newSpySender()
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("emits counters with their totals and labels as tags", func() {
+		e := promemitter.New(server.URL, sender)
+		Expect(e.Scrape()).To(Succeed())
+
+		c := sender.counters["http_requests_total"]
+		Expect(c).To(HaveLen(2))
+		Expect(c[0].GetCounter().GetTotal()).To(Equal(uint64(1027)))
+		Expect(c[0].GetTags()).To(Equal(map[string]string{"method": "post", "code": "200"}))
+		Expect(c[1].GetCounter().GetTotal()).To(Equal(uint64(3)))
+	})
+
+	It("emits gauges and untyped metrics as gauges", func() {
+		e := promemitter.New(server.URL, sender)
+		Expect(e.Scrape()).To(Succeed())
+
+		g := sender.gauges["temperature"]
+		Expect(g).To(HaveLen(1))
+		Expect(g[0].GetGauge().GetMetrics()["temperature"].GetValue()).To(Equal(21.5))
+		Expect(g[0].GetTags()).To(Equal(map[string]string{"room": `a "quoted" name`}))
+
+		Expect(sender.gauges["untyped_metric"]).To(HaveLen(1))
+	})
+
+	It("emits histogram and summary counts as counters and the rest as gauges", func() {
+		e := promemitter.New(server.URL, sender)
+		Expect(e.Scrape()).To(Succeed())
+
+		Expect(sender.counters["request_duration_seconds_bucket"]).To(HaveLen(2))
+		Expect(sender.counters["request_duration_seconds_bucket"][1].GetTags()).To(HaveKeyWithValue("le", "+Inf"))
+		Expect(sender.counters["request_duration_seconds_count"]).To(HaveLen(1))
+		Expect(sender.gauges["request_duration_seconds_sum"]).To(HaveLen(1))
+
+		Expect(sender.counters["rpc_duration_seconds_count"]).To(HaveLen(1))
+		Expect(sender.gauges["rpc_duration_seconds"]).To(HaveLen(1))
+		Expect(sender.gauges["rpc_duration_seconds_sum"]).To(HaveLen(1))
+	})
+
+	It("adds the configured tags", func() {
+		e := promemitter.New(server.URL, sender,
+			promemitter.WithTags(map[string]string{"source": "app", "room": "overridden"}),
+		)
+		Expect(e.Scrape()).To(Succeed())
+
+		tags := sender.gauges["temperature"][0].GetTags()
+		Expect(tags).To(HaveKeyWithValue("source", "app"))
+		Expect(tags).To(HaveKeyWithValue("room", `a "quoted" name`))
+	})
+
+	It("returns an error for non-200 responses", func() {
+		status = http.StatusInternalServerError
+
+		e := promemitter.New(server.URL, sender)
+		Expect(e.Scrape()).To(MatchError(ContainSubstring("500")))
+	})
+
+	It("returns an error for malformed expositions", func() {
+		body = `metric{label="unterminated} 1`
+
+		e := promemitter.New(server.URL, sender)
+		Expect(e.Scrape()).ToNot(Succeed())
+	})
+
+	It("scrapes on an interval", func() {
+		s := newSpySender()
+		s.calls = make(chan struct{}, 1000)
+		e := promemitter.New(server.URL, s, promemitter.WithInterval(10*time.Millisecond))
+
+		go e.Run()
+
+		// A single scrape emits 11 envelopes.
+		Eventually(func() int { return len(s.calls) }).Should(BeNumerically(">", 11))
+	})
+})
+
+type spySender struct {
+	counters map[string][]*loggregator_v2.Envelope
+	gauges   map[string][]*loggregator_v2.Envelope
+	calls    chan struct{}
+}
+
+func newSpySender() *spySender {
+	return &spySender{
+		counters: make(map[string][]*loggregator_v2.Envelope),
+		gauges:   make(map[string][]*loggregator_v2.Envelope),
+	}
+}
+
+func (s *spySender) EmitCounter(name string, opts ...loggregator.EmitCounterOption) {
+	if s.calls != nil {
+		s.calls <- struct{}{}
+		return
+	}
+
+	e := &loggregator_v2.Envelope{
+		Tags: make(map[string]string),
+		Message: &loggregator_v2.Envelope_Counter{
+			Counter: &loggregator_v2.Counter{Name: name},
+		},
+	}
+	for _, o := range opts {
+		o(e)
+	}
+	s.counters[name] = append(s.counters[name], e)
+}
+
+func (s *spySender) EmitGauge(opts ...loggregator.EmitGaugeOption) {
+	if s.calls != nil {
+		s.calls <- struct{}{}
+		return
+	}
+
+	e := &loggregator_v2.Envelope{
+		Tags: make(map[string]string),
+		Message: &loggregator_v2.Envelope_Gauge{
+			Gauge: &loggregator_v2.Gauge{
+				Metrics: make(map[string]*loggregator_v2.GaugeValue),
+			},
+		},
+	}
+	for _, o := range opts {
+		o(e)
+	}
+	for name := range e.GetGauge().GetMetrics() {
+		s.gauges[name] = append(s.gauges[name], e)
+	}
+}
@@ -0,0 +1,141 @@
+package promemitter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// sample is a single sample from the Prometheus text exposition format.
+type sample struct {
+	name   string
+	family string
+	typ    string
+	labels map[string]string
+	value  float64
+}
+
+// parse reads samples in the Prometheus text exposition format (version
+// 0.0.4). Each sample carries the type declared for its metric family, or
+// "untyped" if there was none.
+func parse(r io.Reader) ([]sample, error) {
+	types := make(map[string]string)
+
+	var samples []sample
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		s, err := parseSample(line)
+		if err != nil {
+			return nil, err
+		}
+
+		s.family, s.typ = s.name, "untyped"
+		for _, suffix := range []string{"", "_bucket", "_count", "_sum"} {
+			family := strings.TrimSuffix(s.name, suffix)
+			if t, ok := types[family]; ok && (suffix == "" || family != s.name) {
+				s.family, s.typ = family, t
+				break
+			}
+		}
+
+		samples = append(samples, s)
+	}
+
+	return samples, scanner.Err()
+}
+
+func parseSample(line string) (sample, error) {
+	s := sample{labels: make(map[string]string)}
+
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return s, fmt.Errorf("invalid sample %q", line)
+	}
+	s.name = line[:end]
+	rest := line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		rest, err = parseLabels(rest[1:], s.labels)
+		if err != nil {
+			return s, fmt.Errorf("invalid sample %q: %s", line, err)
+		}
+	}
+
+	// The value may be followed by a timestamp, which is ignored.
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return s, fmt.Errorf("invalid sample %q: missing value", line)
+	}
+
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, fmt.Errorf("invalid sample %q: %s", line, err)
+	}
+	s.value = v
+
+	return s, nil
+}
+
+// parseLabels parses the labels following the opening brace into labels and
+// returns the remainder of the line after the closing brace.
+func parseLabels(in string, labels map[string]string) (string, error) {
+	for {
+		in = strings.TrimLeft(in, " \t,")
+		if strings.HasPrefix(in, "}") {
+			return in[1:], nil
+		}
+
+		eq := strings.IndexByte(in, '=')
+		if eq <= 0 {
+			return "", fmt.Errorf("invalid label")
+		}
+		name := strings.TrimSpace(in[:eq])
+		in = strings.TrimLeft(in[eq+1:], " \t")
+
+		if !strings.HasPrefix(in, `"`) {
+			return "", fmt.Errorf("label %s is not quoted", name)
+		}
+
+		var value strings.Builder
+		i := 1
+		for ; i < len(in); i++ {
+			c := in[i]
+			if c == '"' {
+				break
+			}
+			if c == '\\' && i+1 < len(in) {
+				i++
+				switch in[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(in[i])
+				}
+				continue
+			}
+			value.WriteByte(c)
+		}
+		if i == len(in) {
+			return "", fmt.Errorf("label %s is not terminated", name)
+		}
+
+		labels[name] = value.String()
+		in = in[i+1:]
+	}
+}
@@ -0,0 +1,13 @@
+package promemitter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPromemitter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Promemitter Suite")
+}
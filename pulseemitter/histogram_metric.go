@@ -0,0 +1,131 @@
+package pulseemitter
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	loggregator "code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/golang/protobuf/proto"
+)
+
+// histogramSampleSize is the most observations a histogram metric keeps
+// between emits. Beyond it, observations are sampled uniformly.
+const histogramSampleSize = 1028
+
+// HistogramMetric is used by the pulse emitter to emit the distribution of
+// observed values (e.g. request latencies) to the LogClient.
+type HistogramMetric interface {
+	// Observe records a value.
+	Observe(v float64)
+
+	// Emit sends the distribution of the values observed since the last
+	// emit to the LogClient and starts a new window.
+	Emit(c LogClient)
+}
+
+// histogramMetric is used by the pulse emitter to emit histogram metrics to
+// the LogClient.
+type histogramMetric struct {
+	name     string
+	unit     string
+	sourceID string
+	tags     map[string]string
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	samples []float64
+	count   int
+	max     float64
+}
+
+// NewHistogramMetric returns a new histogramMetric that records observations
+// and emits their 50th, 90th and 99th percentiles and maximum as a single
+// gauge, with the values named <name>_p50, <name>_p90, <name>_p99 and
+// <name>_max. Percentiles are exact up to 1028 observations per window and
+// estimated from a uniform sample beyond that. A window without
+// observations is emitted as zeros.
+func NewHistogramMetric(name, unit, sourceID string, opts ...MetricOption) HistogramMetric {
+	h := &histogramMetric{
+		name:     name,
+		unit:     unit,
+		sourceID: sourceID,
+		tags:     make(map[string]string),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	for _, opt := range opts {
+		opt(h.tags)
+	}
+
+	return h
+}
+
+// Observe records v in the current window.
+func (h *histogramMetric) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.count == 0 || v > h.max {
+		h.max = v
+	}
+	h.count++
+
+	if len(h.samples) < histogramSampleSize {
+		h.samples = append(h.samples, v)
+		return
+	}
+
+	if i := h.rand.Intn(h.count); i < histogramSampleSize {
+		h.samples[i] = v
+	}
+}
+
+// Emit will send the percentiles of the current window and tagging options
+// to the LogClient to be emitted.
+func (h *histogramMetric) Emit(c LogClient) {
+	h.mu.Lock()
+	samples, max := h.samples, h.max
+	h.samples, h.count, h.max = nil, 0, 0
+	h.mu.Unlock()
+
+	sort.Float64s(samples)
+
+	options := []loggregator.EmitGaugeOption{
+		loggregator.WithGaugeValue(h.name+"_p50", percentile(samples, 0.50), h.unit),
+		loggregator.WithGaugeValue(h.name+"_p90", percentile(samples, 0.90), h.unit),
+		loggregator.WithGaugeValue(h.name+"_p99", percentile(samples, 0.99), h.unit),
+		loggregator.WithGaugeValue(h.name+"_max", max, h.unit),
+		h.sourceIDOption,
+	}
+
+	for k, v := range h.tags {
+		options = append(options, loggregator.WithEnvelopeTag(k, v))
+	}
+
+	c.EmitGauge(options...)
+}
+
+func (h *histogramMetric) sourceIDOption(p proto.Message) {
+	env, ok := p.(*loggregator_v2.Envelope)
+	if ok {
+		env.SourceId = h.sourceID
+	}
+}
+
+// percentile returns the nearest-rank percentile of the sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	return sorted[i]
+}
@@ -0,0 +1,81 @@
+package pulseemitter_test
+
+import (
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HistogramMetric", func() {
+	var emit = func(h pulseemitter.HistogramMetric) *loggregator_v2.Envelope {
+		spy := newSpyLogClient()
+		h.Emit(spy)
+
+		e := &loggregator_v2.Envelope{
+			Message: &loggregator_v2.Envelope_Gauge{
+				Gauge: &loggregator_v2.Gauge{
+					Metrics: make(map[string]*loggregator_v2.GaugeValue),
+				},
+			},
+			Tags: make(map[string]string),
+		}
+
+		for _, o := range spy.GaugeOpts() {
+			o(e)
+		}
+		return e
+	}
+
+	It("emits the percentiles and maximum of the observations", func() {
+		h := pulseemitter.NewHistogramMetric(
+			"latency",
+			"ms",
+			"my-source-id",
+			pulseemitter.WithVersion(1, 2),
+		)
+
+		for i := 100; i >= 1; i-- {
+			h.Observe(float64(i))
+		}
+
+		e := emit(h)
+		metrics := e.GetGauge().GetMetrics()
+		Expect(metrics).To(HaveLen(4))
+		Expect(metrics["latency_p50"].GetValue()).To(Equal(50.0))
+		Expect(metrics["latency_p90"].GetValue()).To(Equal(90.0))
+		Expect(metrics["latency_p99"].GetValue()).To(Equal(99.0))
+		Expect(metrics["latency_max"].GetValue()).To(Equal(100.0))
+		Expect(metrics["latency_max"].GetUnit()).To(Equal("ms"))
+
+		Expect(e.GetSourceId()).To(Equal("my-source-id"))
+		Expect(e.GetTags()["metric_version"]).To(Equal("1.2"))
+	})
+
+	It("starts a new window after each emit", func() {
+		h := pulseemitter.NewHistogramMetric("latency", "ms", "my-source-id")
+		h.Observe(100)
+		emit(h)
+
+		h.Observe(5)
+		metrics := emit(h).GetGauge().GetMetrics()
+		Expect(metrics["latency_p99"].GetValue()).To(Equal(5.0))
+		Expect(metrics["latency_max"].GetValue()).To(Equal(5.0))
+
+		metrics = emit(h).GetGauge().GetMetrics()
+		Expect(metrics["latency_p50"].GetValue()).To(Equal(0.0))
+		Expect(metrics["latency_max"].GetValue()).To(Equal(0.0))
+	})
+
+	It("estimates percentiles from a sample of many observations", func() {
+		h := pulseemitter.NewHistogramMetric("latency", "ms", "my-source-id")
+		for i := 1; i <= 100000; i++ {
+			h.Observe(float64(i % 1000))
+		}
+
+		metrics := emit(h).GetGauge().GetMetrics()
+		Expect(metrics["latency_p50"].GetValue()).To(BeNumerically("~", 500, 100))
+		Expect(metrics["latency_p90"].GetValue()).To(BeNumerically("~", 900, 50))
+		Expect(metrics["latency_max"].GetValue()).To(Equal(999.0))
+	})
+})
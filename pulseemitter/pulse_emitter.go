@@ -83,6 +83,18 @@ func (c *PulseEmitter) NewGaugeMetric(name, unit string, opts ...MetricOption) G
 	return g
 }
 
+// NewHistogramMetric returns a HistogramMetric that records observations.
+// After calling NewHistogramMetric the histogram metric will begin to be
+// emitted on the interval configured on the PulseEmitter. Each emit sends
+// the percentiles and maximum of the values observed since the previous
+// one.
+func (c *PulseEmitter) NewHistogramMetric(name, unit string, opts ...MetricOption) HistogramMetric {
+	h := NewHistogramMetric(name, unit, c.sourceID, opts...)
+	go c.pulse(h)
+
+	return h
+}
+
 func (c *PulseEmitter) pulse(e emitter) {
 	for range time.Tick(c.pulseInterval) {
 		e.Emit(c.logClient)
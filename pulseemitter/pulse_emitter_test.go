@@ -62,6 +62,33 @@ var _ = Describe("Pulse EmitterClient", func() {
 		Expect(e.GetSourceId()).To(Equal("my-source-id"))
 	})
 
+	It("emits a histogram", func() {
+		spyLogClient := newSpyLogClient()
+		client := pulseemitter.New(
+			spyLogClient,
+			pulseemitter.WithPulseInterval(50*time.Millisecond),
+			pulseemitter.WithSourceID("my-source-id"),
+		)
+
+		h := client.NewHistogramMetric("latency", "ms")
+		h.Observe(3)
+		Eventually(spyLogClient.GaugeOpts).Should(HaveLen(5))
+
+		e := &loggregator_v2.Envelope{
+			Message: &loggregator_v2.Envelope_Gauge{
+				Gauge: &loggregator_v2.Gauge{
+					Metrics: make(map[string]*loggregator_v2.GaugeValue),
+				},
+			},
+		}
+		for _, o := range spyLogClient.GaugeOpts() {
+			o(e)
+		}
+		Expect(e.GetGauge().GetMetrics()).To(HaveKey("latency_p50"))
+		Expect(e.GetGauge().GetMetrics()).To(HaveKey("latency_max"))
+		Expect(e.GetSourceId()).To(Equal("my-source-id"))
+	})
+
 	It("pulses", func() {
 		spyLogClient := newSpyLogClient()
 		client := pulseemitter.New(
@@ -0,0 +1,80 @@
+package loggregator
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// WithSourceQuota limits each source ID to limit envelopes per interval,
+// e.g. for a proxy that forwards on behalf of many apps and must keep one
+// of them from starving the others. Envelopes over the quota are discarded
+// and reported to the quota alerter. Quotas are counted in fixed windows of
+// the given interval, and envelopes without a source ID share a quota.
+func WithSourceQuota(limit int, interval time.Duration) IngressOption {
+	return func(c *IngressClient) {
+		c.sourceQuota = newSourceQuota(limit, interval)
+	}
+}
+
+// WithQuotaAlerter configures a function that is invoked with the source ID
+// and number of envelopes whenever envelopes are discarded by the source
+// quota.
+func WithQuotaAlerter(alerter func(sourceID string, exceeded int)) IngressOption {
+	return func(c *IngressClient) {
+		c.quotaAlerter = alerter
+	}
+}
+
+// overQuota reports whether e exceeds its source's quota, recording it if
+// so.
+func (c *IngressClient) overQuota(e *loggregator_v2.Envelope) bool {
+	if c.sourceQuota == nil || c.sourceQuota.allow(e.GetSourceId()) {
+		return false
+	}
+	atomic.AddUint64(&c.stats.quotaExceeded, 1)
+	c.quotaAlerter(e.GetSourceId(), 1)
+
+	return true
+}
+
+// sourceQuota counts envelopes per source ID in fixed windows. It is safe
+// for concurrent use.
+type sourceQuota struct {
+	limit    int
+	interval time.Duration
+
+	mu     sync.Mutex
+	start  time.Time
+	counts map[string]int
+}
+
+func newSourceQuota(limit int, interval time.Duration) *sourceQuota {
+	return &sourceQuota{
+		limit:    limit,
+		interval: interval,
+		start:    time.Now(),
+		counts:   make(map[string]int),
+	}
+}
+
+// allow reports whether the source may emit another envelope in the current
+// window, counting it if so.
+func (q *sourceQuota) allow(sourceID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if now := time.Now(); now.Sub(q.start) >= q.interval {
+		q.start = now
+		q.counts = make(map[string]int, len(q.counts))
+	}
+
+	if q.counts[sourceID] >= q.limit {
+		return false
+	}
+	q.counts[sourceID]++
+
+	return true
+}
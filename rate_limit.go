@@ -0,0 +1,83 @@
+package loggregator
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// EnvelopeType identifies the kind of message carried by an envelope.
+type EnvelopeType int
+
+const (
+	// LogEnvelope is an envelope that contains a log.
+	LogEnvelope EnvelopeType = iota
+
+	// CounterEnvelope is an envelope that contains a counter.
+	CounterEnvelope
+
+	// GaugeEnvelope is an envelope that contains a gauge.
+	GaugeEnvelope
+
+	// TimerEnvelope is an envelope that contains a timer.
+	TimerEnvelope
+
+	// EventEnvelope is an envelope that contains an event.
+	EventEnvelope
+)
+
+func envelopeType(e *loggregator_v2.Envelope) (EnvelopeType, bool) {
+	switch e.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		return LogEnvelope, true
+	case *loggregator_v2.Envelope_Counter:
+		return CounterEnvelope, true
+	case *loggregator_v2.Envelope_Gauge:
+		return GaugeEnvelope, true
+	case *loggregator_v2.Envelope_Timer:
+		return TimerEnvelope, true
+	case *loggregator_v2.Envelope_Event:
+		return EventEnvelope, true
+	default:
+		return 0, false
+	}
+}
+
+// rateLimiter is a token bucket that refills at a fixed rate per second and
+// holds at most one second's worth of tokens. It is safe for concurrent use.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perSecond int) *rateLimiter {
+	return &rateLimiter{
+		rate:   float64(perSecond),
+		tokens: float64(perSecond),
+		last:   time.Now(),
+	}
+}
+
+// allow reports whether an envelope may be emitted now, consuming a token if
+// so.
+func (r *rateLimiter) allow() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.rate {
+		r.tokens = r.rate
+	}
+	r.last = now
+
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+
+	return true
+}
@@ -0,0 +1,204 @@
+package loggregator
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithMetricInterval sets how often counters and gauges created with
+// NewCounter and NewGauge are emitted. It defaults to 10 seconds. The
+// interval must be positive; the client constructors return an error
+// otherwise.
+func WithMetricInterval(d time.Duration) IngressOption {
+	return func(c *IngressClient) {
+		c.metricInterval = d
+	}
+}
+
+// Counter is a monotonic counter that is emitted by the client on the
+// metric interval (see WithMetricInterval) rather than on every increment.
+// Increments are atomic, so a Counter can be shared by many goroutines and
+// is much cheaper to update than emitting an envelope per increment. It
+// should be created with the IngressClient's NewCounter method.
+type Counter struct {
+	name string
+	opts []EmitCounterOption
+
+	delta uint64
+	total uint64
+}
+
+// Increment adds 1 to the counter.
+func (c *Counter) Increment() {
+	c.Add(1)
+}
+
+// Add adds n to the counter.
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.delta, n)
+}
+
+func (c *Counter) emit(ctx context.Context, client *IngressClient) {
+	delta := atomic.SwapUint64(&c.delta, 0)
+	c.total += delta
+
+	opts := make([]EmitCounterOption, 0, len(c.opts)+2)
+	opts = append(opts, c.opts...)
+	opts = append(opts, WithTotal(c.total), WithDelta(delta))
+
+	client.EmitCounterContext(ctx, c.name, opts...)
+}
+
+// NewCounter returns a Counter that the client emits on every metric
+// interval with the delta since the previous interval and the running
+// total, including intervals without increments. The given options, e.g.
+// WithEnvelopeTag or WithCounterSourceInfo, are applied to every emitted
+// envelope. Counters are emitted one last time when the client is closed.
+func (c *IngressClient) NewCounter(name string, opts ...EmitCounterOption) *Counter {
+	counter := &Counter{
+		name: name,
+		opts: opts,
+	}
+	c.metrics.add(c, counter)
+
+	return counter
+}
+
+// Gauge is a value that is emitted by the client on the metric interval
+// (see WithMetricInterval). Updates are atomic, so a Gauge can be shared by
+// many goroutines. It should be created with the IngressClient's NewGauge
+// method.
+type Gauge struct {
+	name string
+	unit string
+	opts []EmitGaugeOption
+
+	bits uint64
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+// Add adds delta, which may be negative, to the gauge.
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&g.bits)
+		n := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&g.bits, old, n) {
+			return
+		}
+	}
+}
+
+// Value returns the gauge's current value.
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+func (g *Gauge) emit(ctx context.Context, client *IngressClient) {
+	opts := make([]EmitGaugeOption, 0, len(g.opts)+1)
+	opts = append(opts, g.opts...)
+	opts = append(opts, WithGaugeValue(g.name, g.Value(), g.unit))
+
+	client.EmitGaugeContext(ctx, opts...)
+}
+
+// NewGauge returns a Gauge, starting at 0, that the client emits with its
+// current value on every metric interval. The given options, e.g.
+// WithEnvelopeTag or WithGaugeSourceInfo, are applied to every emitted
+// envelope. Gauges are emitted one last time when the client is closed.
+func (c *IngressClient) NewGauge(name, unit string, opts ...EmitGaugeOption) *Gauge {
+	gauge := &Gauge{
+		name: name,
+		unit: unit,
+		opts: opts,
+	}
+	c.metrics.add(c, gauge)
+
+	return gauge
+}
+
+// metric is a value held by the client's registry and emitted on the metric
+// interval.
+type metric interface {
+	emit(ctx context.Context, c *IngressClient)
+}
+
+// metricRegistry emits registered metrics on the client's metric interval.
+// Its goroutine is only started once a metric is registered.
+type metricRegistry struct {
+	mu      sync.Mutex
+	metrics []metric
+	started bool
+	closed  bool
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newMetricRegistry() *metricRegistry {
+	return &metricRegistry{
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (r *metricRegistry) add(c *IngressClient, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metrics = append(r.metrics, m)
+	if !r.started && !r.closed {
+		r.started = true
+		go r.run(c)
+	}
+}
+
+func (r *metricRegistry) run(c *IngressClient) {
+	defer close(r.stopped)
+
+	t := time.NewTicker(c.metricInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			r.emit(c.ctx, c)
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *metricRegistry) emit(ctx context.Context, c *IngressClient) {
+	r.mu.Lock()
+	metrics := r.metrics
+	r.mu.Unlock()
+
+	for _, m := range metrics {
+		m.emit(ctx, c)
+	}
+}
+
+// stop stops emitting on the interval and emits every metric one last time,
+// giving up once ctx is done. The client must not be closed until it
+// returns.
+func (r *metricRegistry) stop(ctx context.Context, c *IngressClient) {
+	r.mu.Lock()
+	started := r.started
+	r.closed = true
+	r.mu.Unlock()
+
+	if !started {
+		return
+	}
+
+	close(r.done)
+	<-r.stopped
+	r.emit(ctx, c)
+}
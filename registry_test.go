@@ -0,0 +1,130 @@
+package loggregator_test
+
+import (
+	"context"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metric registry", func() {
+	var (
+		server   *testIngressServer
+		received chan *loggregator_v2.Envelope
+	)
+
+	BeforeEach(func() {
+		server = newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		received = server.collect()
+	})
+
+	AfterEach(func() {
+		server.stop()
+	})
+
+	newClient := func(interval time.Duration) *loggregator.IngressClient {
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+			loggregator.WithMetricInterval(interval),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		return client
+	}
+
+	It("returns an error for a non-positive interval", func() {
+		_, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithMetricInterval(0),
+		)
+		Expect(err).To(HaveOccurred())
+	})
+
+	Describe("Counter", func() {
+		It("emits the delta and total on the metric interval", func() {
+			client := newClient(50 * time.Millisecond)
+			counter := client.NewCounter("requests", loggregator.WithEnvelopeTag("route", "/"))
+
+			counter.Add(3)
+			counter.Increment()
+
+			var e *loggregator_v2.Envelope
+			Eventually(received, 5).Should(Receive(&e))
+			Expect(e.GetCounter().GetName()).To(Equal("requests"))
+			Expect(e.GetCounter().GetDelta()).To(Equal(uint64(4)))
+			Expect(e.GetCounter().GetTotal()).To(Equal(uint64(4)))
+			Expect(e.GetTags()).To(HaveKeyWithValue("route", "/"))
+
+			counter.Increment()
+			Eventually(func() uint64 {
+				Eventually(received, 5).Should(Receive(&e))
+				return e.GetCounter().GetTotal()
+			}, 5).Should(Equal(uint64(5)))
+			Expect(e.GetCounter().GetDelta()).To(Equal(uint64(1)))
+		})
+
+		It("emits counters one last time when the client is closed", func() {
+			client := newClient(time.Hour)
+			counter := client.NewCounter("requests")
+			counter.Add(2)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			client.CloseSendWithContext(ctx)
+
+			var e *loggregator_v2.Envelope
+			Eventually(received, 5).Should(Receive(&e))
+			Expect(e.GetCounter().GetDelta()).To(Equal(uint64(2)))
+		})
+	})
+
+	Describe("Gauge", func() {
+		It("emits the current value on the metric interval", func() {
+			client := newClient(50 * time.Millisecond)
+			gauge := client.NewGauge("queue_depth", "items", loggregator.WithEnvelopeTag("queue", "a"))
+
+			gauge.Set(10)
+			gauge.Add(2.5)
+			gauge.Add(-0.5)
+			Expect(gauge.Value()).To(Equal(12.0))
+
+			var e *loggregator_v2.Envelope
+			Eventually(received, 5).Should(Receive(&e))
+			Expect(e.GetGauge().GetMetrics()).To(HaveLen(1))
+			Expect(e.GetGauge().GetMetrics()["queue_depth"].GetValue()).To(Equal(12.0))
+			Expect(e.GetGauge().GetMetrics()["queue_depth"].GetUnit()).To(Equal("items"))
+			Expect(e.GetTags()).To(HaveKeyWithValue("queue", "a"))
+
+			gauge.Set(1)
+			Eventually(func() float64 {
+				Eventually(received, 5).Should(Receive(&e))
+				return e.GetGauge().GetMetrics()["queue_depth"].GetValue()
+			}, 5).Should(Equal(1.0))
+		})
+
+		It("handles concurrent updates", func() {
+			client := newClient(time.Hour)
+			gauge := client.NewGauge("in_flight", "requests")
+
+			done := make(chan struct{})
+			for i := 0; i < 10; i++ {
+				go func() {
+					for j := 0; j < 100; j++ {
+						gauge.Add(1)
+					}
+					done <- struct{}{}
+				}()
+			}
+			for i := 0; i < 10; i++ {
+				<-done
+			}
+
+			Expect(gauge.Value()).To(Equal(1000.0))
+		})
+	})
+})
@@ -0,0 +1,148 @@
+// Package replayer emits envelopes captured by the filewriter package again
+// through an IngressClient, e.g. for load testing or to reproduce an
+// incident:
+//
+//	paths, err := filewriter.Files("/tmp/capture")
+//	...
+//	n, err := replayer.New(client, replayer.WithSpeed(1)).Replay(ctx, paths...)
+package replayer
+
+import (
+	"io"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-loggregator/filewriter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// Client is the client used by Replayer to emit envelopes. This would
+// usually be the go-loggregator v2 client.
+type Client interface {
+	EmitContext(ctx context.Context, e *loggregator_v2.Envelope) error
+}
+
+// Option is a function type that is used to configure optional settings for
+// a Replayer.
+type Option func(*Replayer)
+
+// WithSpeed replays envelopes at the pace they were captured at, going by
+// their timestamps, sped up by the given factor: 1 replays in real time and
+// 2 twice as fast. By default, envelopes are emitted as fast as the client
+// accepts them.
+func WithSpeed(factor float64) Option {
+	return func(r *Replayer) {
+		r.speed = factor
+	}
+}
+
+// WithRewriteTimestamps sets the timestamp of every envelope to the time it
+// is replayed, so that downstream systems treat it as current. By default
+// envelopes keep their captured timestamps.
+func WithRewriteTimestamps() Option {
+	return func(r *Replayer) {
+		r.rewrite = true
+	}
+}
+
+// Replayer reads captured envelopes and emits them.
+type Replayer struct {
+	client  Client
+	speed   float64
+	rewrite bool
+
+	// start is the time the first envelope was emitted and first its
+	// captured timestamp.
+	start time.Time
+	first int64
+}
+
+// New returns a Replayer that emits to the given client.
+func New(c Client, opts ...Option) *Replayer {
+	r := &Replayer{client: c}
+
+	for _, o := range opts {
+		o(r)
+	}
+
+	return r
+}
+
+// Replay emits the envelopes of the given files in order and returns how
+// many were emitted. A file that ends within an envelope, e.g. because it
+// was still being written, is replayed up to that envelope. Replay stops at
+// the first error, including the context being done.
+func (r *Replayer) Replay(ctx context.Context, paths ...string) (int, error) {
+	r.start = time.Time{}
+
+	var n int
+	for _, path := range paths {
+		f, err := filewriter.Open(path)
+		if err != nil {
+			return n, err
+		}
+
+		m, err := r.replay(ctx, f)
+		f.Close()
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+func (r *Replayer) replay(ctx context.Context, f *filewriter.Reader) (int, error) {
+	var n int
+	for {
+		e, err := f.Next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		if err := r.wait(ctx, e.GetTimestamp()); err != nil {
+			return n, err
+		}
+		if r.rewrite {
+			e.Timestamp = time.Now().UnixNano()
+		}
+
+		if err := r.client.EmitContext(ctx, e); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// wait sleeps until the envelope with the given timestamp is due when
+// replaying at a set speed.
+func (r *Replayer) wait(ctx context.Context, ts int64) error {
+	if r.start.IsZero() {
+		r.start, r.first = time.Now(), ts
+		return nil
+	}
+	if r.speed <= 0 {
+		return nil
+	}
+
+	due := r.start.Add(time.Duration(float64(ts-r.first) / r.speed))
+	d := time.Until(due)
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
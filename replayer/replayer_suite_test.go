@@ -0,0 +1,13 @@
+package replayer_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestReplayer(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Replayer Suite")
+}
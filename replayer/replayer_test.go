@@ -0,0 +1,114 @@
+package replayer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-loggregator/filewriter"
+	"code.cloudfoundry.org/go-loggregator/replayer"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Replayer", func() {
+	var (
+		dir    string
+		paths  []string
+		client *spyClient
+		base   time.Time
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "replayer")
+		Expect(err).ToNot(HaveOccurred())
+
+		w, err := filewriter.New(dir, filewriter.WithMaxFileSize(1))
+		Expect(err).ToNot(HaveOccurred())
+
+		base = time.Now().Add(-time.Hour)
+		for i := 0; i < 3; i++ {
+			e := &loggregator_v2.Envelope{
+				SourceId:  "app",
+				Timestamp: base.Add(time.Duration(i) * 100 * time.Millisecond).UnixNano(),
+			}
+			Expect(w.Write(context.Background(), []*loggregator_v2.Envelope{e})).To(Succeed())
+		}
+		Expect(w.Close()).To(Succeed())
+
+		paths, err = filewriter.Files(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(paths).To(HaveLen(3))
+
+		client = &spyClient{}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("emits the envelopes of every file in order", func() {
+		n, err := replayer.New(client).Replay(context.Background(), paths...)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(3))
+
+		envs := client.envelopes()
+		Expect(envs).To(HaveLen(3))
+		for i, e := range envs {
+			Expect(e.GetTimestamp()).To(Equal(base.Add(time.Duration(i) * 100 * time.Millisecond).UnixNano()))
+		}
+	})
+
+	It("replays at the original pace scaled by the speed", func() {
+		start := time.Now()
+		_, err := replayer.New(client, replayer.WithSpeed(2)).Replay(context.Background(), paths...)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+		Expect(time.Since(start)).To(BeNumerically("<", 200*time.Millisecond))
+	})
+
+	It("rewrites timestamps to the replay time", func() {
+		_, err := replayer.New(client, replayer.WithRewriteTimestamps()).Replay(context.Background(), paths...)
+		Expect(err).ToNot(HaveOccurred())
+
+		for _, e := range client.envelopes() {
+			Expect(time.Unix(0, e.GetTimestamp())).To(BeTemporally("~", time.Now(), time.Second))
+		}
+	})
+
+	It("stops when the context is done", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		n, err := replayer.New(client, replayer.WithSpeed(1)).Replay(ctx, paths...)
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		Expect(n).To(Equal(1))
+	})
+})
+
+type spyClient struct {
+	mu   sync.Mutex
+	envs []*loggregator_v2.Envelope
+}
+
+func (s *spyClient) EmitContext(_ context.Context, e *loggregator_v2.Envelope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.envs = append(s.envs, e)
+	return nil
+}
+
+func (s *spyClient) envelopes() []*loggregator_v2.Envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*loggregator_v2.Envelope(nil), s.envs...)
+}
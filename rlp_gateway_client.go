@@ -11,17 +11,23 @@ import (
 	"strings"
 	"time"
 
+	"code.cloudfoundry.org/go-loggregator/internal/backoff"
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"github.com/golang/protobuf/jsonpb"
 	"golang.org/x/net/context"
 )
 
+// RLPGatewayClient streams envelopes from the Reverse Log Proxy Gateway over
+// HTTP server-sent events. It should be created with the NewRLPGatewayClient
+// constructor.
 type RLPGatewayClient struct {
 	addr string
 	log  *log.Logger
 	doer Doer
 }
 
+// NewRLPGatewayClient creates a RLPGatewayClient for the gateway at the given
+// address (e.g. https://log-stream.some-system-domain).
 func NewRLPGatewayClient(addr string, opts ...RLPGatewayClientOption) *RLPGatewayClient {
 	c := &RLPGatewayClient{
 		addr: addr,
@@ -47,7 +53,7 @@ func WithRLPGatewayClientLogger(log *log.Logger) RLPGatewayClientOption {
 	}
 }
 
-// WithRLPGatewayClientLogger returns a RLPGatewayClientOption to configure
+// WithRLPGatewayHTTPClient returns a RLPGatewayClientOption to configure
 // the HTTP client. It defaults to the http.DefaultClient.
 func WithRLPGatewayHTTPClient(d Doer) RLPGatewayClientOption {
 	return func(c *RLPGatewayClient) {
@@ -63,14 +69,19 @@ type Doer interface {
 
 // Stream returns a new EnvelopeStream for the given context and request. The
 // lifecycle of the EnvelopeStream is managed by the given context. If the
-// underlying SSE stream dies, it attempts to reconnect until the context
-// is done. Any errors are logged via the client's logger.
+// underlying SSE stream dies, it attempts to reconnect with an exponential
+// backoff until the context is done. Any errors are logged via the client's
+// logger.
 func (c *RLPGatewayClient) Stream(ctx context.Context, req *loggregator_v2.EgressBatchRequest) EnvelopeStream {
 	es := make(chan *loggregator_v2.Envelope, 100)
 	go func() {
 		defer close(es)
+		b := backoff.New(50*time.Millisecond, 5*time.Second)
 		for ctx.Err() == nil {
-			c.connect(ctx, es, req)
+			if c.connect(ctx, es, req) {
+				b.Reset()
+			}
+			b.Wait(ctx)
 		}
 	}()
 
@@ -96,11 +107,13 @@ func (c *RLPGatewayClient) Stream(ctx context.Context, req *loggregator_v2.Egres
 	}
 }
 
+// connect reads envelopes from a single SSE stream until it dies. It returns
+// true if the stream was established.
 func (c *RLPGatewayClient) connect(
 	ctx context.Context,
 	es chan<- *loggregator_v2.Envelope,
 	logReq *loggregator_v2.EgressBatchRequest,
-) {
+) bool {
 	readAddr := fmt.Sprintf("%s/v2/read%s", c.addr, c.buildQuery(logReq))
 
 	req, err := http.NewRequest(http.MethodGet, readAddr, nil)
@@ -113,7 +126,7 @@ func (c *RLPGatewayClient) connect(
 	resp, err := c.doer.Do(req.WithContext(ctx))
 	if err != nil {
 		c.log.Printf("error making request: %s", err)
-		return
+		return false
 	}
 
 	defer func() {
@@ -125,10 +138,10 @@ func (c *RLPGatewayClient) connect(
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
 			c.log.Printf("failed to read body: %s", err)
-			return
+			return false
 		}
 		c.log.Printf("unexpected status code %d: %s", resp.StatusCode, body)
-		return
+		return false
 	}
 
 	buf := bytes.NewBuffer(nil)
@@ -137,7 +150,7 @@ func (c *RLPGatewayClient) connect(
 		line, err := reader.ReadBytes('\n')
 		if err != nil {
 			c.log.Printf("failed while reading stream: %s", err)
-			return
+			return true
 		}
 
 		switch {
@@ -145,7 +158,7 @@ func (c *RLPGatewayClient) connect(
 			// TODO: Remove this old case
 			continue
 		case bytes.HasPrefix(line, []byte("event: closing")):
-			return
+			return true
 		case bytes.HasPrefix(line, []byte("event: heartbeat")):
 			// Throw away the data of the heartbeat event and the next
 			// newline.
@@ -168,7 +181,7 @@ func (c *RLPGatewayClient) connect(
 			for _, e := range eb.Batch {
 				select {
 				case <-ctx.Done():
-					return
+					return true
 				case es <- e:
 				}
 			}
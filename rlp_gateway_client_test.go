@@ -336,6 +336,22 @@ var _ = Describe("RlpGatewayClient", func() {
 
 		Eventually(spyDoer.Reqs).Should(HaveLen(3))
 	})
+
+	It("backs off between failed reconnects", func() {
+		for i := 0; i < 10; i++ {
+			spyDoer.resps = append(spyDoer.resps, &http.Response{StatusCode: 500})
+			spyDoer.errs = append(spyDoer.errs, nil)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		c.Stream(ctx, &loggregator_v2.EgressBatchRequest{})
+
+		Eventually(spyDoer.Reqs).Should(HaveLen(3))
+		Consistently(func() int {
+			return len(spyDoer.Reqs())
+		}, 300*time.Millisecond).Should(BeNumerically("<", 6))
+	})
 })
 
 type spyDoer struct {
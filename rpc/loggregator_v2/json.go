@@ -0,0 +1,50 @@
+package loggregator_v2
+
+import (
+	"bytes"
+
+	"github.com/golang/protobuf/jsonpb"
+)
+
+// jsonMarshaler produces the JSON format of the RLP gateway: the JSON names
+// declared in envelope.proto (e.g. source_id), 64-bit integers as strings
+// and bytes as base64.
+var jsonMarshaler = jsonpb.Marshaler{}
+
+// jsonUnmarshaler ignores unknown fields, so that envelopes written by newer
+// versions of loggregator can still be read.
+var jsonUnmarshaler = jsonpb.Unmarshaler{AllowUnknownFields: true}
+
+// MarshalJSON encodes the envelope in the JSON format used by the RLP
+// gateway. It makes encoding/json use protobuf's JSON mapping rather than
+// the Go field names of the generated struct.
+func (m *Envelope) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jsonMarshaler.Marshal(&buf, m); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes an envelope encoded by MarshalJSON or by the RLP
+// gateway.
+func (m *Envelope) UnmarshalJSON(data []byte) error {
+	return jsonUnmarshaler.Unmarshal(bytes.NewReader(data), m)
+}
+
+// MarshalJSON encodes the batch in the JSON format used by the RLP gateway,
+// i.e. as an object with the envelopes in its "batch" field.
+func (m *EnvelopeBatch) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jsonMarshaler.Marshal(&buf, m); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a batch encoded by MarshalJSON or by the RLP gateway.
+func (m *EnvelopeBatch) UnmarshalJSON(data []byte) error {
+	return jsonUnmarshaler.Unmarshal(bytes.NewReader(data), m)
+}
@@ -0,0 +1,81 @@
+package loggregator_v2_test
+
+import (
+	"encoding/json"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JSON", func() {
+	It("encodes envelopes in the RLP gateway format", func() {
+		env := &loggregator_v2.Envelope{
+			SourceId:  "some-id",
+			Timestamp: 1234,
+			Tags:      map[string]string{"a": "b"},
+			Message: &loggregator_v2.Envelope_Log{
+				Log: &loggregator_v2.Log{Payload: []byte("hello")},
+			},
+		}
+
+		data, err := json.Marshal(env)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(MatchJSON(`{
+			"source_id": "some-id",
+			"timestamp": "1234",
+			"tags": {"a": "b"},
+			"log": {"payload": "aGVsbG8="}
+		}`))
+	})
+
+	It("decodes envelopes in the RLP gateway format", func() {
+		var env loggregator_v2.Envelope
+		err := json.Unmarshal([]byte(`{
+			"source_id": "some-id",
+			"timestamp": "1234",
+			"counter": {"name": "requests", "delta": "2", "total": "10"},
+			"someNewField": true
+		}`), &env)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(env.GetSourceId()).To(Equal("some-id"))
+		Expect(env.GetTimestamp()).To(Equal(int64(1234)))
+		Expect(env.GetCounter().GetName()).To(Equal("requests"))
+		Expect(env.GetCounter().GetTotal()).To(Equal(uint64(10)))
+	})
+
+	It("round trips batches", func() {
+		batch := &loggregator_v2.EnvelopeBatch{
+			Batch: []*loggregator_v2.Envelope{
+				{SourceId: "first", Message: &loggregator_v2.Envelope_Gauge{
+					Gauge: &loggregator_v2.Gauge{Metrics: map[string]*loggregator_v2.GaugeValue{
+						"cpu": {Unit: "percentage", Value: 0.5},
+					}},
+				}},
+				{SourceId: "second", Message: &loggregator_v2.Envelope_Event{
+					Event: &loggregator_v2.Event{Title: "title", Body: "body"},
+				}},
+			},
+		}
+
+		data, err := json.Marshal(batch)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(HavePrefix(`{"batch":[`))
+
+		var decoded loggregator_v2.EnvelopeBatch
+		Expect(json.Unmarshal(data, &decoded)).To(Succeed())
+		Expect(decoded.GetBatch()).To(HaveLen(2))
+		Expect(decoded.GetBatch()[0].GetGauge().GetMetrics()["cpu"].GetValue()).To(Equal(0.5))
+		Expect(decoded.GetBatch()[1].GetEvent().GetTitle()).To(Equal("title"))
+	})
+
+	It("encodes envelopes nested in other values", func() {
+		data, err := json.Marshal(map[string][]*loggregator_v2.Envelope{
+			"envelopes": {{SourceId: "some-id"}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(MatchJSON(`{"envelopes": [{"source_id": "some-id"}]}`))
+	})
+})
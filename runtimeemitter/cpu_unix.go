@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package runtimeemitter
+
+import (
+	"syscall"
+	"time"
+)
+
+// cpuTime returns the user and system CPU time consumed by the process.
+func cpuTime() (time.Duration, bool) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, false
+	}
+
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano()), true
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package runtimeemitter
+
+import "time"
+
+// cpuTime is not supported on Windows.
+func cpuTime() (time.Duration, bool) {
+	return 0, false
+}
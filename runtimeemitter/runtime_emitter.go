@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/units"
 )
 
 // Emitter will emit a gauge with runtime stats via the sender on the given
@@ -16,7 +17,19 @@ type Emitter struct {
 }
 
 type valueSender interface {
-	send(heap, stack, gc, goroutines float64)
+	send(stats runtimeStats)
+}
+
+// runtimeStats is a snapshot of the runtime stats emitted on each interval.
+// hasCPU is false on platforms where the CPU usage of the process is not
+// available.
+type runtimeStats struct {
+	heap       float64
+	stack      float64
+	gc         float64
+	goroutines float64
+	cpu        float64
+	hasCPU     bool
 }
 
 // Sender is the interface of the client that can be used to emit gauge
@@ -74,16 +87,33 @@ func NewV1(sender V1Sender, opts ...RuntimeEmitterOption) *Emitter {
 
 // Run starts the ticker with the configured interval and emits a gauge on
 // that interval. This method will block but the user may run in a go routine.
+//
+// The CPU usage is reported as the percentage of a single core used by the
+// process since the previous interval. It is omitted on platforms where it
+// is not available.
 func (e *Emitter) Run() {
+	lastCPU, hasCPU := cpuTime()
+	lastWall := time.Now()
+
 	for range time.Tick(e.interval) {
 		memstats := &runtime.MemStats{}
 		runtime.ReadMemStats(memstats)
-		e.sender.send(
-			float64(memstats.HeapAlloc),
-			float64(memstats.StackInuse),
-			float64(memstats.PauseNs[(memstats.NumGC+255)%256]),
-			float64(runtime.NumGoroutine()),
-		)
+		stats := runtimeStats{
+			heap:       float64(memstats.HeapAlloc),
+			stack:      float64(memstats.StackInuse),
+			gc:         float64(memstats.PauseNs[(memstats.NumGC+255)%256]),
+			goroutines: float64(runtime.NumGoroutine()),
+		}
+
+		if hasCPU {
+			now := time.Now()
+			cpu, _ := cpuTime()
+			stats.cpu = 100 * float64(cpu-lastCPU) / float64(now.Sub(lastWall))
+			stats.hasCPU = true
+			lastCPU, lastWall = cpu, now
+		}
+
+		e.sender.send(stats)
 	}
 }
 
@@ -91,22 +121,32 @@ type v2Sender struct {
 	sender Sender
 }
 
-func (s v2Sender) send(heap, stack, gc, goroutines float64) {
-	s.sender.EmitGauge(
-		loggregator.WithGaugeValue("memoryStats.numBytesAllocatedHeap", heap, "Bytes"),
-		loggregator.WithGaugeValue("memoryStats.numBytesAllocatedStack", stack, "Bytes"),
-		loggregator.WithGaugeValue("memoryStats.lastGCPauseTimeNS", gc, "ns"),
-		loggregator.WithGaugeValue("numGoRoutines", goroutines, "Count"),
-	)
+func (s v2Sender) send(stats runtimeStats) {
+	opts := []loggregator.EmitGaugeOption{
+		loggregator.WithGaugeValue("memoryStats.numBytesAllocatedHeap", stats.heap, units.Bytes),
+		loggregator.WithGaugeValue("memoryStats.numBytesAllocatedStack", stats.stack, units.Bytes),
+		loggregator.WithGaugeValue("memoryStats.lastGCPauseTimeNS", stats.gc, units.Nanoseconds),
+		loggregator.WithGaugeValue("numGoRoutines", stats.goroutines, units.Count),
+	}
+
+	if stats.hasCPU {
+		opts = append(opts, loggregator.WithGaugeValue("cpuStats.percentUsed", stats.cpu, units.Percentage))
+	}
+
+	s.sender.EmitGauge(opts...)
 }
 
 type v1Sender struct {
 	sender V1Sender
 }
 
-func (s v1Sender) send(heap, stack, gc, goroutines float64) {
-	s.sender.SendComponentMetric("memoryStats.numBytesAllocatedHeap", heap, "Bytes")
-	s.sender.SendComponentMetric("memoryStats.numBytesAllocatedStack", stack, "Bytes")
-	s.sender.SendComponentMetric("memoryStats.lastGCPauseTimeNS", gc, "ns")
-	s.sender.SendComponentMetric("numGoRoutines", goroutines, "Count")
+func (s v1Sender) send(stats runtimeStats) {
+	s.sender.SendComponentMetric("memoryStats.numBytesAllocatedHeap", stats.heap, units.Bytes)
+	s.sender.SendComponentMetric("memoryStats.numBytesAllocatedStack", stats.stack, units.Bytes)
+	s.sender.SendComponentMetric("memoryStats.lastGCPauseTimeNS", stats.gc, units.Nanoseconds)
+	s.sender.SendComponentMetric("numGoRoutines", stats.goroutines, units.Count)
+
+	if stats.hasCPU {
+		s.sender.SendComponentMetric("cpuStats.percentUsed", stats.cpu, units.Percentage)
+	}
 }
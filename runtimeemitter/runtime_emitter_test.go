@@ -7,6 +7,7 @@ import (
 	loggregator "code.cloudfoundry.org/go-loggregator"
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"code.cloudfoundry.org/go-loggregator/runtimeemitter"
+	"code.cloudfoundry.org/go-loggregator/units"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -41,16 +42,21 @@ var _ = Describe("RuntimeEmitter", func() {
 
 		metrics := env.GetGauge().Metrics
 		Expect(metrics["memoryStats.numBytesAllocatedHeap"].Value).To(BeNumerically(">", 0.0))
-		Expect(metrics["memoryStats.numBytesAllocatedHeap"].Unit).To(Equal("Bytes"))
+		Expect(metrics["memoryStats.numBytesAllocatedHeap"].Unit).To(Equal(units.Bytes))
 
 		Expect(metrics["memoryStats.numBytesAllocatedStack"].Value).To(BeNumerically(">", 0.0))
-		Expect(metrics["memoryStats.numBytesAllocatedStack"].Unit).To(Equal("Bytes"))
+		Expect(metrics["memoryStats.numBytesAllocatedStack"].Unit).To(Equal(units.Bytes))
 
 		Expect(metrics["numGoRoutines"].Value).To(BeNumerically(">", 0.0))
-		Expect(metrics["numGoRoutines"].Unit).To(Equal("Count"))
+		Expect(metrics["numGoRoutines"].Unit).To(Equal(units.Count))
 
 		Expect(metrics["memoryStats.lastGCPauseTimeNS"].Value).To(BeNumerically(">", 0.0))
-		Expect(metrics["memoryStats.lastGCPauseTimeNS"].Unit).To(Equal("ns"))
+		Expect(metrics["memoryStats.lastGCPauseTimeNS"].Unit).To(Equal(units.Nanoseconds))
+
+		if runtime.GOOS != "windows" {
+			Expect(metrics["cpuStats.percentUsed"].Value).To(BeNumerically(">=", 0.0))
+			Expect(metrics["cpuStats.percentUsed"].Unit).To(Equal(units.Percentage))
+		}
 	})
 
 	Describe("V1 Emitter", func() {
@@ -64,6 +70,27 @@ var _ = Describe("RuntimeEmitter", func() {
 
 			Eventually(v1Client.sendCalled).Should(BeNumerically(">", 4))
 		})
+
+		It("emits metrics with canonical units", func() {
+			v1Client := newSpyV1Client()
+			emitter := runtimeemitter.NewV1(v1Client,
+				runtimeemitter.WithInterval(10*time.Millisecond),
+			)
+
+			go emitter.Run()
+
+			metrics := make(map[string]string)
+			for len(metrics) < 4 {
+				var m v1Metric
+				Eventually(v1Client.called).Should(Receive(&m))
+				metrics[m.name] = m.unit
+			}
+
+			Expect(metrics["memoryStats.numBytesAllocatedHeap"]).To(Equal(units.Bytes))
+			Expect(metrics["memoryStats.numBytesAllocatedStack"]).To(Equal(units.Bytes))
+			Expect(metrics["memoryStats.lastGCPauseTimeNS"]).To(Equal(units.Nanoseconds))
+			Expect(metrics["numGoRoutines"]).To(Equal(units.Count))
+		})
 	})
 })
 
@@ -97,13 +124,18 @@ func (s *SpyV2Client) EmitGauge(opts ...loggregator.EmitGaugeOption) {
 	s.envelopes <- env
 }
 
+type v1Metric struct {
+	name string
+	unit string
+}
+
 type SpyV1Client struct {
-	called chan bool
+	called chan v1Metric
 }
 
 func newSpyV1Client() *SpyV1Client {
 	return &SpyV1Client{
-		called: make(chan bool, 100),
+		called: make(chan v1Metric, 100),
 	}
 }
 
@@ -112,6 +144,6 @@ func (c *SpyV1Client) sendCalled() int64 {
 }
 
 func (c *SpyV1Client) SendComponentMetric(name string, value float64, unit string) error {
-	c.called <- true
+	c.called <- v1Metric{name: name, unit: unit}
 	return nil
 }
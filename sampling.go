@@ -0,0 +1,74 @@
+package loggregator
+
+import (
+	"math/rand"
+	"sync/atomic"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// sampledOutCounter is the name of the counter of logs discarded by
+// sampling.
+const sampledOutCounter = "sampled_out_logs"
+
+// WithSampling keeps each log with the given probability, between 0 and 1,
+// and discards the rest, e.g. for services whose debug logging would
+// overwhelm Doppler. Rules added with WithTagSampling take precedence.
+// Discarded logs are counted in the client's Stats and in a
+// "sampled_out_logs" counter that is emitted on the metric interval (see
+// WithMetricInterval). Other envelope types are never sampled.
+func WithSampling(rate float64) IngressOption {
+	return func(c *IngressClient) {
+		c.sampleRate = rate
+		c.sampling = true
+	}
+}
+
+// WithTagSampling keeps logs with the given tag value with the given
+// probability, see WithSampling. For example, to keep one in a hundred
+// debug logs:
+//
+//	WithTagSampling("level", "debug", 0.01)
+//
+// Rules are checked in the order they are given and the first match
+// applies.
+func WithTagSampling(name, value string, rate float64) IngressOption {
+	return func(c *IngressClient) {
+		c.sampleRules = append(c.sampleRules, sampleRule{
+			name:  name,
+			value: value,
+			rate:  rate,
+		})
+		c.sampling = true
+	}
+}
+
+type sampleRule struct {
+	name  string
+	value string
+	rate  float64
+}
+
+// sampledOut reports whether e is a log discarded by sampling, recording it
+// if so.
+func (c *IngressClient) sampledOut(e *loggregator_v2.Envelope) bool {
+	if !c.sampling || e.GetLog() == nil {
+		return false
+	}
+
+	rate := c.sampleRate
+	for _, r := range c.sampleRules {
+		if v, ok := e.GetTags()[r.name]; ok && v == r.value {
+			rate = r.rate
+			break
+		}
+	}
+	if rate >= 1 || (rate > 0 && rand.Float64() < rate) {
+		return false
+	}
+
+	atomic.AddUint64(&c.stats.sampledOut, 1)
+	c.sampledOutLogs.Increment()
+
+	return true
+}
@@ -0,0 +1,160 @@
+package loggregator
+
+import (
+	"github.com/golang/protobuf/proto"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// LogSelector returns a selector for log envelopes.
+func LogSelector() *loggregator_v2.Selector {
+	return &loggregator_v2.Selector{
+		Message: &loggregator_v2.Selector_Log{
+			Log: &loggregator_v2.LogSelector{},
+		},
+	}
+}
+
+// CounterSelector returns a selector for counter envelopes with the given
+// name. An empty name selects every counter.
+func CounterSelector(name string) *loggregator_v2.Selector {
+	return &loggregator_v2.Selector{
+		Message: &loggregator_v2.Selector_Counter{
+			Counter: &loggregator_v2.CounterSelector{
+				Name: name,
+			},
+		},
+	}
+}
+
+// GaugeSelectors returns selectors for gauge envelopes containing any of the
+// given metric names, one selector per name. Without names it returns a
+// single selector for every gauge. Separate selectors are used because the
+// RLP Gateway only supports a single name per gauge selector.
+func GaugeSelectors(names ...string) []*loggregator_v2.Selector {
+	if len(names) == 0 {
+		return []*loggregator_v2.Selector{gaugeSelector()}
+	}
+
+	selectors := make([]*loggregator_v2.Selector, 0, len(names))
+	for _, name := range names {
+		selectors = append(selectors, gaugeSelector(name))
+	}
+
+	return selectors
+}
+
+func gaugeSelector(names ...string) *loggregator_v2.Selector {
+	return &loggregator_v2.Selector{
+		Message: &loggregator_v2.Selector_Gauge{
+			Gauge: &loggregator_v2.GaugeSelector{
+				Names: names,
+			},
+		},
+	}
+}
+
+// TimerSelector returns a selector for timer envelopes.
+func TimerSelector() *loggregator_v2.Selector {
+	return &loggregator_v2.Selector{
+		Message: &loggregator_v2.Selector_Timer{
+			Timer: &loggregator_v2.TimerSelector{},
+		},
+	}
+}
+
+// EventSelector returns a selector for event envelopes.
+func EventSelector() *loggregator_v2.Selector {
+	return &loggregator_v2.Selector{
+		Message: &loggregator_v2.Selector_Event{
+			Event: &loggregator_v2.EventSelector{},
+		},
+	}
+}
+
+// AllSelectors returns selectors for every type of envelope.
+func AllSelectors() []*loggregator_v2.Selector {
+	return append(
+		[]*loggregator_v2.Selector{LogSelector(), CounterSelector(""), TimerSelector(), EventSelector()},
+		GaugeSelectors()...,
+	)
+}
+
+// SelectorSet builds the selectors of an EgressBatchRequest. Every selector
+// added to the set is applied to each of its source IDs. It should be
+// created with the NewSelectorSet constructor.
+type SelectorSet struct {
+	sourceIDs []string
+	selectors []*loggregator_v2.Selector
+}
+
+// NewSelectorSet returns a SelectorSet for the given source IDs. Without
+// source IDs the selectors match envelopes from every source.
+func NewSelectorSet(sourceIDs ...string) *SelectorSet {
+	return &SelectorSet{
+		sourceIDs: sourceIDs,
+	}
+}
+
+// Add adds the given selectors to the set.
+func (s *SelectorSet) Add(selectors ...*loggregator_v2.Selector) *SelectorSet {
+	s.selectors = append(s.selectors, selectors...)
+	return s
+}
+
+// Logs adds a selector for logs to the set.
+func (s *SelectorSet) Logs() *SelectorSet {
+	return s.Add(LogSelector())
+}
+
+// Counters adds selectors for counters with the given names to the set.
+// Without names every counter is selected.
+func (s *SelectorSet) Counters(names ...string) *SelectorSet {
+	if len(names) == 0 {
+		return s.Add(CounterSelector(""))
+	}
+
+	for _, name := range names {
+		s.Add(CounterSelector(name))
+	}
+	return s
+}
+
+// Gauges adds selectors for gauges with the given names to the set. Without
+// names every gauge is selected.
+func (s *SelectorSet) Gauges(names ...string) *SelectorSet {
+	return s.Add(GaugeSelectors(names...)...)
+}
+
+// Timers adds a selector for timers to the set.
+func (s *SelectorSet) Timers() *SelectorSet {
+	return s.Add(TimerSelector())
+}
+
+// Events adds a selector for events to the set.
+func (s *SelectorSet) Events() *SelectorSet {
+	return s.Add(EventSelector())
+}
+
+// Selectors returns the selectors of the set, one for each combination of
+// source ID and added selector.
+func (s *SelectorSet) Selectors() []*loggregator_v2.Selector {
+	if len(s.sourceIDs) == 0 {
+		selectors := make([]*loggregator_v2.Selector, 0, len(s.selectors))
+		for _, sel := range s.selectors {
+			selectors = append(selectors, proto.Clone(sel).(*loggregator_v2.Selector))
+		}
+		return selectors
+	}
+
+	selectors := make([]*loggregator_v2.Selector, 0, len(s.sourceIDs)*len(s.selectors))
+	for _, sourceID := range s.sourceIDs {
+		for _, sel := range s.selectors {
+			sel = proto.Clone(sel).(*loggregator_v2.Selector)
+			sel.SourceId = sourceID
+			selectors = append(selectors, sel)
+		}
+	}
+
+	return selectors
+}
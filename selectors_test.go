@@ -0,0 +1,77 @@
+package loggregator_test
+
+import (
+	"code.cloudfoundry.org/go-loggregator"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Selectors", func() {
+	It("builds selectors for each envelope type", func() {
+		Expect(loggregator.LogSelector().GetLog()).ToNot(BeNil())
+		Expect(loggregator.CounterSelector("name").GetCounter().GetName()).To(Equal("name"))
+		Expect(loggregator.TimerSelector().GetTimer()).ToNot(BeNil())
+		Expect(loggregator.EventSelector().GetEvent()).ToNot(BeNil())
+	})
+
+	It("builds one gauge selector per name", func() {
+		selectors := loggregator.GaugeSelectors("a", "b")
+
+		Expect(selectors).To(HaveLen(2))
+		Expect(selectors[0].GetGauge().GetNames()).To(Equal([]string{"a"}))
+		Expect(selectors[1].GetGauge().GetNames()).To(Equal([]string{"b"}))
+	})
+
+	It("selects every gauge without names", func() {
+		selectors := loggregator.GaugeSelectors()
+
+		Expect(selectors).To(HaveLen(1))
+		Expect(selectors[0].GetGauge()).ToNot(BeNil())
+		Expect(selectors[0].GetGauge().GetNames()).To(BeEmpty())
+	})
+
+	It("selects every type of envelope", func() {
+		Expect(loggregator.AllSelectors()).To(HaveLen(5))
+	})
+
+	Describe("SelectorSet", func() {
+		It("applies every selector to each source ID", func() {
+			selectors := loggregator.NewSelectorSet("a", "b").
+				Logs().
+				Counters("c").
+				Selectors()
+
+			Expect(selectors).To(HaveLen(4))
+			Expect(selectors[0].GetSourceId()).To(Equal("a"))
+			Expect(selectors[0].GetLog()).ToNot(BeNil())
+			Expect(selectors[1].GetSourceId()).To(Equal("a"))
+			Expect(selectors[1].GetCounter().GetName()).To(Equal("c"))
+			Expect(selectors[2].GetSourceId()).To(Equal("b"))
+			Expect(selectors[3].GetSourceId()).To(Equal("b"))
+		})
+
+		It("selects every source without source IDs", func() {
+			selectors := loggregator.NewSelectorSet().
+				Gauges("x", "y").
+				Timers().
+				Events().
+				Add(loggregator.CounterSelector("")).
+				Selectors()
+
+			Expect(selectors).To(HaveLen(5))
+			for _, s := range selectors {
+				Expect(s.GetSourceId()).To(BeEmpty())
+			}
+		})
+
+		It("does not share selectors between calls", func() {
+			set := loggregator.NewSelectorSet("a").Logs()
+			first := set.Selectors()
+			first[0].SourceId = "changed"
+
+			Expect(set.Selectors()[0].GetSourceId()).To(Equal("a"))
+		})
+
+	})
+})
@@ -0,0 +1,40 @@
+package loggregator
+
+import (
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// WithSendDeadline limits how long sending a single batch may take. When a
+// Send on the BatchSender stream does not complete in time, e.g. because
+// loggregator stopped reading and flow control holds the stream, the stream
+// is aborted and the send fails with codes.DeadlineExceeded. The batch is
+// then retried on a new stream like after any other failed send (see
+// WithMaxRetries). Unary sends and batch writers (see
+// WithAcknowledgedDelivery and WithBatchWriter) get a context with the
+// deadline instead. By default sends have no deadline.
+func WithSendDeadline(d time.Duration) IngressOption {
+	return func(c *IngressClient) {
+		c.sendDeadline = d
+	}
+}
+
+// sendStream sends the batch on the stream, aborting the stream if the
+// send deadline passes first.
+func (c *IngressClient) sendStream(s *ingressStream, batch []*loggregator_v2.Envelope) error {
+	if c.sendDeadline <= 0 {
+		return s.sender.Send(&loggregator_v2.EnvelopeBatch{Batch: batch})
+	}
+
+	t := time.AfterFunc(c.sendDeadline, s.cancel)
+	err := s.sender.Send(&loggregator_v2.EnvelopeBatch{Batch: batch})
+	if !t.Stop() {
+		return status.Errorf(codes.DeadlineExceeded, "send did not complete within %s", c.sendDeadline)
+	}
+
+	return err
+}
@@ -50,6 +50,37 @@ func newTestIngressServer(serverCert, serverKey, caCert string) (*testIngressSer
 	}, nil
 }
 
+func newInsecureTestIngressServer() *testIngressServer {
+	return &testIngressServer{
+		receivers:    make(chan loggregator_v2.Ingress_BatchSenderServer),
+		sendReceiver: make(chan *loggregator_v2.EnvelopeBatch, 100),
+		addr:         "localhost:0",
+	}
+}
+
+// collect receives every envelope sent to the server over any BatchSender
+// stream.
+func (t *testIngressServer) collect() chan *loggregator_v2.Envelope {
+	envelopes := make(chan *loggregator_v2.Envelope, 1000)
+	go func() {
+		for srv := range t.receivers {
+			go func(srv loggregator_v2.Ingress_BatchSenderServer) {
+				for {
+					b, err := srv.Recv()
+					if err != nil {
+						return
+					}
+					for _, e := range b.GetBatch() {
+						envelopes <- e
+					}
+				}
+			}(srv)
+		}
+	}()
+
+	return envelopes
+}
+
 func (*testIngressServer) Sender(srv loggregator_v2.Ingress_SenderServer) error {
 	return nil
 }
@@ -74,6 +105,25 @@ func (t *testIngressServer) start() error {
 	}
 	t.addr = listener.Addr().String()
 
+	t.serve(listener)
+
+	return nil
+}
+
+// startUnix starts the server on a Unix domain socket at path.
+func (t *testIngressServer) startUnix(path string) error {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	t.addr = path
+
+	t.serve(listener)
+
+	return nil
+}
+
+func (t *testIngressServer) serve(listener net.Listener) {
 	var opts []grpc.ServerOption
 	if t.tlsConfig != nil {
 		opts = append(opts, grpc.Creds(credentials.NewTLS(t.tlsConfig)))
@@ -83,8 +133,6 @@ func (t *testIngressServer) start() error {
 	loggregator_v2.RegisterIngressServer(t.grpcServer, t)
 
 	go t.grpcServer.Serve(listener)
-
-	return nil
 }
 
 func (t *testIngressServer) stop() {
@@ -0,0 +1,83 @@
+package loggregator
+
+import (
+	"github.com/golang/protobuf/proto"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// Severity is the level of a log, see WithSeverity.
+type Severity int
+
+const (
+	// SeverityDebug is for diagnostic logs.
+	SeverityDebug Severity = iota
+
+	// SeverityInfo is for logs about normal operation.
+	SeverityInfo
+
+	// SeverityWarn is for logs about unexpected but handled conditions.
+	SeverityWarn
+
+	// SeverityError is for logs about failures.
+	SeverityError
+)
+
+var severityNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the name of the severity that is used as the value of the
+// "level" tag, e.g. "warn".
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return "unknown"
+	}
+	return severityNames[s]
+}
+
+// WithSeverity adds a "level" tag with the name of the severity to a log,
+// so that it can be filtered on downstream. Logs with SeverityError are
+// emitted as stderr and all others as stdout.
+func WithSeverity(s Severity) EmitLogOption {
+	return func(m proto.Message) {
+		switch e := m.(type) {
+		case *loggregator_v2.Envelope:
+			setTag(e, "level", s.String())
+			if l := e.GetLog(); l != nil {
+				l.Type = loggregator_v2.Log_OUT
+				if s >= SeverityError {
+					l.Type = loggregator_v2.Log_ERR
+				}
+			}
+		case protoEditor:
+			e.SetTag("level", s.String())
+			if s < SeverityError {
+				e.SetLogToStdout()
+			}
+		}
+	}
+}
+
+// Debug emits a log with SeverityDebug. Options passed to Debug are applied
+// after the severity and may override its output type.
+func (c *IngressClient) Debug(message string, opts ...EmitLogOption) {
+	c.EmitLog(message, withSeverity(SeverityDebug, opts)...)
+}
+
+// Info emits a log with SeverityInfo, see Debug.
+func (c *IngressClient) Info(message string, opts ...EmitLogOption) {
+	c.EmitLog(message, withSeverity(SeverityInfo, opts)...)
+}
+
+// Warn emits a log with SeverityWarn, see Debug.
+func (c *IngressClient) Warn(message string, opts ...EmitLogOption) {
+	c.EmitLog(message, withSeverity(SeverityWarn, opts)...)
+}
+
+// Error emits a log with SeverityError, see Debug.
+func (c *IngressClient) Error(message string, opts ...EmitLogOption) {
+	c.EmitLog(message, withSeverity(SeverityError, opts)...)
+}
+
+func withSeverity(s Severity, opts []EmitLogOption) []EmitLogOption {
+	return append([]EmitLogOption{WithSeverity(s)}, opts...)
+}
@@ -0,0 +1,68 @@
+package loggregator
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FlushOnShutdown installs a handler for the given signals, SIGINT and
+// SIGTERM if none are given, that flushes the client and closes its stream
+// before the process exits. This keeps short-lived processes such as tasks
+// from losing the envelopes still buffered when they are stopped. Flushing
+// and closing together take at most timeout. The signal is then raised again
+// with its default handling restored, so the process exits as it would have
+// without the handler.
+//
+// The returned function removes the handler without flushing the client.
+func FlushOnShutdown(c *IngressClient, timeout time.Duration, signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, signals...)
+
+	go func() {
+		select {
+		case sig := <-sigs:
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			if err := c.Flush(ctx); err != nil {
+				c.logger.Printf("failed to flush on %s: %s", sig, err)
+			}
+			if err := c.CloseSendWithContext(ctx); err != nil {
+				c.logger.Printf("failed to close on %s: %s", sig, err)
+			}
+
+			signal.Reset(signals...)
+			reraise(sig)
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(sigs)
+			close(done)
+		})
+	}
+}
+
+// reraise sends sig to the current process, exiting instead where sending
+// signals is not supported (e.g. Windows).
+func reraise(sig os.Signal) {
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(sig)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,73 @@
+//go:build !windows
+// +build !windows
+
+package loggregator_test
+
+import (
+	"context"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FlushOnShutdown", func() {
+	var (
+		server   *testIngressServer
+		received chan *loggregator_v2.Envelope
+		client   *loggregator.IngressClient
+	)
+
+	BeforeEach(func() {
+		server = newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		received = server.collect()
+
+		var err error
+		client, err = loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(time.Hour),
+		)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.stop()
+	})
+
+	// SIGWINCH is ignored by default, so raising it again after the
+	// handler runs does not stop the test process.
+	It("flushes and closes the client when a signal arrives", func() {
+		stop := loggregator.FlushOnShutdown(client, 100*time.Millisecond, syscall.SIGWINCH)
+		defer stop()
+
+		client.EmitLog("message")
+		Expect(syscall.Kill(syscall.Getpid(), syscall.SIGWINCH)).To(Succeed())
+
+		var e *loggregator_v2.Envelope
+		Eventually(received, 5).Should(Receive(&e))
+		Expect(e.GetLog().GetPayload()).To(Equal([]byte("message")))
+
+		Eventually(func() error {
+			return client.Flush(context.Background())
+		}, 5).Should(MatchError(loggregator.ErrClosed))
+	})
+
+	// SIGCHLD is ignored by default as well. It differs from the signal
+	// above so that the signal raised again by that spec cannot reach this
+	// handler.
+	It("does nothing once stopped", func() {
+		stop := loggregator.FlushOnShutdown(client, 100*time.Millisecond, syscall.SIGCHLD)
+		stop()
+		stop()
+
+		client.EmitLog("message")
+		Expect(syscall.Kill(syscall.Getpid(), syscall.SIGCHLD)).To(Succeed())
+
+		Consistently(received, 500*time.Millisecond).ShouldNot(Receive())
+	})
+})
@@ -0,0 +1,186 @@
+//go:build go1.21
+
+// Package sloghandler provides a log/slog Handler that ships records to
+// loggregator.
+package sloghandler
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	loggregator "code.cloudfoundry.org/go-loggregator"
+)
+
+// LogClient is the client used by Handler to emit logs. This would usually be
+// the go-loggregator v2 client.
+type LogClient interface {
+	EmitLog(message string, opts ...loggregator.EmitLogOption)
+}
+
+// HandlerOption is a function type that is used to configure optional
+// settings for a Handler.
+type HandlerOption func(*Handler)
+
+// WithLevel sets the minimum level that is emitted. It defaults to
+// slog.LevelInfo.
+func WithLevel(l slog.Leveler) HandlerOption {
+	return func(h *Handler) {
+		h.level = l
+	}
+}
+
+// WithEmitLogOptions sets options that are applied to every emitted log,
+// e.g. loggregator.WithSourceInfo.
+func WithEmitLogOptions(opts ...loggregator.EmitLogOption) HandlerOption {
+	return func(h *Handler) {
+		h.opts = append(h.opts, opts...)
+	}
+}
+
+// Handler is a slog.Handler that emits each record as a loggregator log.
+// The record's message and attributes are written to the payload as a JSON
+// object (see loggregator.WithLogFields), with groups becoming nested
+// objects. The level is added as a "level" tag. Records at slog.LevelError or
+// above are emitted as stderr, everything else as stdout.
+type Handler struct {
+	client LogClient
+	level  slog.Leveler
+	opts   []loggregator.EmitLogOption
+
+	fields map[string]interface{}
+	groups []string
+}
+
+// NewHandler returns a Handler configured with the given LogClient and
+// HandlerOptions.
+func NewHandler(c LogClient, opts ...HandlerOption) *Handler {
+	h := &Handler{
+		client: c,
+		level:  slog.LevelInfo,
+		fields: make(map[string]interface{}),
+	}
+
+	for _, o := range opts {
+		o(h)
+	}
+
+	return h
+}
+
+// Enabled implements slog.Handler.
+func (h *Handler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+// Handle implements slog.Handler.
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	fields := cloneFields(h.fields)
+	r.Attrs(func(a slog.Attr) bool {
+		addAttr(fields, h.groups, a)
+		return true
+	})
+
+	opts := make([]loggregator.EmitLogOption, 0, len(h.opts)+3)
+	opts = append(opts, h.opts...)
+	opts = append(opts, loggregator.WithEnvelopeTag("level", strings.ToLower(r.Level.String())))
+	if r.Level < slog.LevelError {
+		opts = append(opts, loggregator.WithStdout())
+	}
+	if len(fields) > 0 {
+		opts = append(opts, loggregator.WithLogFields(fields))
+	}
+
+	h.client.EmitLog(r.Message, opts...)
+
+	return nil
+}
+
+// WithAttrs implements slog.Handler.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := h.clone()
+	for _, a := range attrs {
+		addAttr(h2.fields, h2.groups, a)
+	}
+	return h2
+}
+
+// WithGroup implements slog.Handler.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := h.clone()
+	h2.groups = append(h2.groups, name)
+	return h2
+}
+
+func (h *Handler) clone() *Handler {
+	return &Handler{
+		client: h.client,
+		level:  h.level,
+		opts:   h.opts,
+		fields: cloneFields(h.fields),
+		groups: append([]string(nil), h.groups...),
+	}
+}
+
+func addAttr(fields map[string]interface{}, groups []string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		if len(attrs) == 0 {
+			return
+		}
+		if a.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+		for _, ga := range attrs {
+			addAttr(fields, groups, ga)
+		}
+		return
+	}
+
+	for _, g := range groups {
+		sub, ok := fields[g].(map[string]interface{})
+		if !ok {
+			sub = make(map[string]interface{})
+			fields[g] = sub
+		}
+		fields = sub
+	}
+
+	fields[a.Key] = value(a.Value)
+}
+
+func value(v slog.Value) interface{} {
+	switch v.Kind() {
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339Nano)
+	case slog.KindDuration:
+		return v.Duration().String()
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return err.Error()
+		}
+	}
+
+	return v.Any()
+}
+
+func cloneFields(fields map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if sub, ok := v.(map[string]interface{}); ok {
+			v = cloneFields(sub)
+		}
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,122 @@
+//go:build go1.21
+
+package sloghandler_test
+
+import (
+	"errors"
+	"log/slog"
+
+	loggregator "code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/go-loggregator/sloghandler"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+	var (
+		client *spyLogClient
+		logger *slog.Logger
+	)
+
+	BeforeEach(func() {
+		client = newSpyLogClient()
+		logger = slog.New(sloghandler.NewHandler(client,
+			sloghandler.WithEmitLogOptions(
+				loggregator.WithSourceInfo("source-id", "source-type", "instance-id"),
+			),
+		))
+	})
+
+	It("emits the message and attributes as JSON", func() {
+		logger.Info("hello", "user", "alice", "err", errors.New("boom"))
+
+		var env *loggregator_v2.Envelope
+		Expect(client.envelopes).To(Receive(&env))
+		Expect(env.GetSourceId()).To(Equal("source-id"))
+		Expect(env.GetTags()).To(HaveKeyWithValue("level", "info"))
+		Expect(env.GetLog().GetType()).To(Equal(loggregator_v2.Log_OUT))
+		Expect(env.GetLog().GetPayload()).To(MatchJSON(
+			`{"message": "hello", "user": "alice", "err": "boom"}`,
+		))
+	})
+
+	It("emits errors to stderr", func() {
+		logger.Error("oops")
+
+		var env *loggregator_v2.Envelope
+		Expect(client.envelopes).To(Receive(&env))
+		Expect(env.GetTags()).To(HaveKeyWithValue("level", "error"))
+		Expect(env.GetLog().GetType()).To(Equal(loggregator_v2.Log_ERR))
+		Expect(env.GetLog().GetPayload()).To(Equal([]byte("oops")))
+	})
+
+	It("nests groups", func() {
+		logger.With("a", 1).WithGroup("req").With("id", "x").Info(
+			"hello",
+			slog.Group("user", "name", "bob"),
+			slog.Group("empty"),
+		)
+
+		var env *loggregator_v2.Envelope
+		Expect(client.envelopes).To(Receive(&env))
+		Expect(env.GetLog().GetPayload()).To(MatchJSON(
+			`{"message": "hello", "a": 1, "req": {"id": "x", "user": {"name": "bob"}}}`,
+		))
+	})
+
+	It("does not share attributes between derived handlers", func() {
+		base := logger.WithGroup("g")
+		base.With("a", 1).Info("one")
+		base.With("b", 2).Info("two")
+
+		var env *loggregator_v2.Envelope
+		Expect(client.envelopes).To(Receive(&env))
+		Expect(env.GetLog().GetPayload()).To(MatchJSON(`{"message": "one", "g": {"a": 1}}`))
+		Expect(client.envelopes).To(Receive(&env))
+		Expect(env.GetLog().GetPayload()).To(MatchJSON(`{"message": "two", "g": {"b": 2}}`))
+	})
+
+	It("drops records below the configured level", func() {
+		logger = slog.New(sloghandler.NewHandler(client,
+			sloghandler.WithLevel(slog.LevelWarn),
+		))
+
+		logger.Info("ignored")
+		logger.Warn("kept")
+
+		var env *loggregator_v2.Envelope
+		Expect(client.envelopes).To(Receive(&env))
+		Expect(env.GetLog().GetPayload()).To(Equal([]byte("kept")))
+		Expect(client.envelopes).ToNot(Receive())
+	})
+})
+
+type spyLogClient struct {
+	envelopes chan *loggregator_v2.Envelope
+}
+
+func newSpyLogClient() *spyLogClient {
+	return &spyLogClient{
+		envelopes: make(chan *loggregator_v2.Envelope, 100),
+	}
+}
+
+func (s *spyLogClient) EmitLog(message string, opts ...loggregator.EmitLogOption) {
+	env := &loggregator_v2.Envelope{
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{
+				Payload: []byte(message),
+				Type:    loggregator_v2.Log_ERR,
+			},
+		},
+		Tags: make(map[string]string),
+	}
+
+	for _, o := range opts {
+		o(env)
+	}
+
+	s.envelopes <- env
+}
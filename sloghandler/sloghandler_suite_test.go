@@ -0,0 +1,15 @@
+//go:build go1.21
+
+package sloghandler_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSloghandler(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Slog Handler Suite")
+}
@@ -0,0 +1,35 @@
+package loggregator
+
+// The options below set the tags that loggregator turns into the fields of
+// the same name when it converts an envelope to v1, so that envelopes from
+// this client carry the metadata that platform components emitting with
+// dropsonde set. The v1 client (see package v1) has options of the same
+// names that set the fields directly.
+
+// WithOrigin adds an origin tag, which becomes the Origin of the envelope in
+// v1.
+func WithOrigin(origin string) IngressOption {
+	return WithTag("origin", origin)
+}
+
+// WithDeployment adds a deployment tag, which becomes the Deployment of the
+// envelope in v1.
+func WithDeployment(deployment string) IngressOption {
+	return WithTag("deployment", deployment)
+}
+
+// WithJob adds a job tag, which becomes the Job of the envelope in v1.
+func WithJob(job string) IngressOption {
+	return WithTag("job", job)
+}
+
+// WithIndex adds an index tag, which becomes the Index of the envelope in
+// v1. On BOSH VMs this is usually the instance ID of the VM.
+func WithIndex(index string) IngressOption {
+	return WithTag("index", index)
+}
+
+// WithIP adds an ip tag, which becomes the Ip of the envelope in v1.
+func WithIP(ip string) IngressOption {
+	return WithTag("ip", ip)
+}
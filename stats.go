@@ -0,0 +1,88 @@
+package loggregator
+
+import "sync/atomic"
+
+// Stats is a snapshot of the counters an IngressClient keeps about itself.
+// All counts are totals since the client was created.
+type Stats struct {
+	// Emitted is the number of envelopes accepted into the envelope buffer.
+	Emitted uint64
+
+	// Dropped is the number of envelopes discarded by the backpressure
+	// strategy or because they were emitted after the client was closed.
+	Dropped uint64
+
+	// Throttled is the number of envelopes discarded by rate limits.
+	Throttled uint64
+
+	// QuotaExceeded is the number of envelopes discarded by the source
+	// quota.
+	QuotaExceeded uint64
+
+	// SampledOut is the number of logs discarded by sampling.
+	SampledOut uint64
+
+	// Deduplicated is the number of repeated logs suppressed by log
+	// deduplication.
+	Deduplicated uint64
+
+	// Failed is the number of envelopes discarded because they could not be
+	// sent, including oversize envelopes. Envelopes spooled to the disk
+	// buffer are not counted.
+	Failed uint64
+
+	// BatchesSent and EnvelopesSent count the batches, and the envelopes
+	// within them, that were written to loggregator.
+	BatchesSent   uint64
+	EnvelopesSent uint64
+
+	// SendErrors is the number of failed attempts to send a batch.
+	SendErrors uint64
+
+	// Retries is the number of times a batch was resent after a failure.
+	Retries uint64
+
+	// BufferDepth is the number of envelopes currently waiting in the
+	// envelope buffer.
+	BufferDepth int
+}
+
+// clientStats holds the counters behind Stats. Its fields are only accessed
+// atomically, so it is allocated separately to keep them 64-bit aligned.
+type clientStats struct {
+	emitted       uint64
+	dropped       uint64
+	throttled     uint64
+	quotaExceeded uint64
+	sampledOut    uint64
+	deduplicated  uint64
+	failed        uint64
+	batchesSent   uint64
+	envelopesSent uint64
+	sendErrors    uint64
+	retries       uint64
+}
+
+// Stats returns a snapshot of the client's counters, e.g. for monitoring
+// the health of the emitter.
+func (c *IngressClient) Stats() Stats {
+	return Stats{
+		Emitted:       atomic.LoadUint64(&c.stats.emitted),
+		Dropped:       atomic.LoadUint64(&c.stats.dropped),
+		Throttled:     atomic.LoadUint64(&c.stats.throttled),
+		QuotaExceeded: atomic.LoadUint64(&c.stats.quotaExceeded),
+		SampledOut:    atomic.LoadUint64(&c.stats.sampledOut),
+		Deduplicated:  atomic.LoadUint64(&c.stats.deduplicated),
+		Failed:        atomic.LoadUint64(&c.stats.failed),
+		BatchesSent:   atomic.LoadUint64(&c.stats.batchesSent),
+		EnvelopesSent: atomic.LoadUint64(&c.stats.envelopesSent),
+		SendErrors:    atomic.LoadUint64(&c.stats.sendErrors),
+		Retries:       atomic.LoadUint64(&c.stats.retries),
+		BufferDepth:   len(c.envelopes),
+	}
+}
+
+func (c *IngressClient) recordSent(batch int) {
+	atomic.AddUint64(&c.stats.batchesSent, 1)
+	atomic.AddUint64(&c.stats.envelopesSent, uint64(batch))
+}
@@ -0,0 +1,72 @@
+package loggregator_test
+
+import (
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IngressClient stats", func() {
+	var server *testIngressServer
+
+	BeforeEach(func() {
+		server = newInsecureTestIngressServer()
+		Expect(server.start()).To(Succeed())
+		server.collect()
+	})
+
+	AfterEach(func() {
+		server.stop()
+	})
+
+	It("counts emitted and sent envelopes", func() {
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(time.Hour),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		for i := 0; i < 3; i++ {
+			client.EmitLog("message")
+		}
+		Expect(client.Stats().Emitted).To(Equal(uint64(3)))
+		Expect(client.Stats().BufferDepth).To(BeNumerically("<=", 3))
+
+		Expect(client.Flush(context.Background())).To(Succeed())
+
+		stats := client.Stats()
+		Expect(stats.BatchesSent).To(Equal(uint64(1)))
+		Expect(stats.EnvelopesSent).To(Equal(uint64(3)))
+		Expect(stats.BufferDepth).To(Equal(0))
+		Expect(stats.SendErrors).To(BeZero())
+	})
+
+	It("counts send errors, retries and failed envelopes", func() {
+		client, err := loggregator.NewInsecureIngressClient(
+			loggregator.WithAddr(server.addr),
+			loggregator.WithBatchFlushInterval(time.Hour),
+			loggregator.WithMaxRetries(1),
+			loggregator.WithDialOptions(grpc.WithStreamInterceptor(
+				func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, grpc.Streamer, ...grpc.CallOption) (grpc.ClientStream, error) {
+					return nil, errors.New("unavailable")
+				},
+			)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client.EmitLog("message")
+		Expect(client.Flush(context.Background())).ToNot(Succeed())
+
+		stats := client.Stats()
+		Expect(stats.SendErrors).To(Equal(uint64(2)))
+		Expect(stats.Retries).To(Equal(uint64(1)))
+		Expect(stats.Failed).To(Equal(uint64(1)))
+		Expect(stats.BatchesSent).To(BeZero())
+	})
+})
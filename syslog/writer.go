@@ -0,0 +1,174 @@
+// Package syslog writes loggregator v2 envelopes to syslog drains as RFC 5424
+// messages.
+package syslog
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// WriterOption configures a Writer.
+type WriterOption func(*Writer)
+
+// WithTLSConfig sets the TLS configuration used for syslog-tls drains.
+func WithTLSConfig(c *tls.Config) WriterOption {
+	return func(w *Writer) {
+		w.tlsConfig = c
+	}
+}
+
+// WithDialTimeout sets the timeout for connecting to the drain. It defaults
+// to 5 seconds.
+func WithDialTimeout(d time.Duration) WriterOption {
+	return func(w *Writer) {
+		w.dialTimeout = d
+	}
+}
+
+// WithWriteTimeout sets the timeout for writing a single envelope to the
+// drain. It defaults to 5 seconds.
+func WithWriteTimeout(d time.Duration) WriterOption {
+	return func(w *Writer) {
+		w.writeTimeout = d
+	}
+}
+
+// WithSyslogOptions sets the options used to convert envelopes to syslog
+// messages, e.g. loggregator_v2.WithSyslogHostname.
+func WithSyslogOptions(opts ...loggregator_v2.SyslogOption) WriterOption {
+	return func(w *Writer) {
+		w.syslogOpts = append(w.syslogOpts, opts...)
+	}
+}
+
+// Writer writes envelopes to a syslog drain. Drains are given as URLs with
+// one of the schemes used by Cloud Foundry:
+//
+//	syslog://host:port      TCP with octet-counting framing (RFC 6587)
+//	syslog-tls://host:port  TLS with octet-counting framing (RFC 5425)
+//	syslog-udp://host:port  UDP, one message per datagram (RFC 5426)
+//
+// The connection is established lazily and re-established on the next
+// write after a failure. It is safe for concurrent use. It should be
+// created with the NewWriter constructor.
+type Writer struct {
+	network string
+	addr    string
+	framed  bool
+
+	tlsConfig    *tls.Config
+	dialTimeout  time.Duration
+	writeTimeout time.Duration
+	syslogOpts   []loggregator_v2.SyslogOption
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewWriter returns a Writer for the given drain URL.
+func NewWriter(drainURL string, opts ...WriterOption) (*Writer, error) {
+	u, err := url.Parse(drainURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Port() == "" {
+		return nil, fmt.Errorf("syslog drain %q has no port", drainURL)
+	}
+
+	w := &Writer{
+		addr:         u.Host,
+		tlsConfig:    &tls.Config{MinVersion: tls.VersionTLS12},
+		dialTimeout:  5 * time.Second,
+		writeTimeout: 5 * time.Second,
+	}
+
+	switch u.Scheme {
+	case "syslog":
+		w.network, w.framed = "tcp", true
+	case "syslog-tls":
+		w.network, w.framed = "tls", true
+	case "syslog-udp":
+		w.network = "udp"
+	default:
+		return nil, fmt.Errorf("unsupported syslog drain scheme %q", u.Scheme)
+	}
+
+	for _, o := range opts {
+		o(w)
+	}
+
+	return w, nil
+}
+
+// Write converts the envelope to syslog messages and writes them to the
+// drain. Gauges with several metrics result in one message per metric.
+func (w *Writer) Write(e *loggregator_v2.Envelope) error {
+	msgs, err := e.Syslog(w.syslogOpts...)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		w.conn, err = w.dial()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := w.conn.SetWriteDeadline(time.Now().Add(w.writeTimeout)); err != nil {
+		w.reset()
+		return err
+	}
+
+	for _, msg := range msgs {
+		if w.framed {
+			msg = append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+		}
+
+		if _, err := w.conn.Write(msg); err != nil {
+			w.reset()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes the connection to the drain, if there is one.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *Writer) dial() (net.Conn, error) {
+	d := &net.Dialer{Timeout: w.dialTimeout}
+
+	if w.network == "tls" {
+		return tls.DialWithDialer(d, "tcp", w.addr, w.tlsConfig)
+	}
+
+	return d.Dial(w.network, w.addr)
+}
+
+func (w *Writer) reset() {
+	w.conn.Close()
+	w.conn = nil
+}
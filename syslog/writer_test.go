@@ -0,0 +1,181 @@
+package syslog_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/go-loggregator/syslog"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Writer", func() {
+	var logEnvelope = func(payload string) *loggregator_v2.Envelope {
+		return &loggregator_v2.Envelope{
+			SourceId:   "source-id",
+			InstanceId: "0",
+			Tags:       map[string]string{"a": "1"},
+			Message: &loggregator_v2.Envelope_Log{
+				Log: &loggregator_v2.Log{Payload: []byte(payload)},
+			},
+		}
+	}
+
+	Context("with a TCP drain", func() {
+		var (
+			listener net.Listener
+			messages chan string
+		)
+
+		BeforeEach(func() {
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+
+			messages = make(chan string, 100)
+			go func() {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					go readFramed(conn, messages)
+				}
+			}()
+		})
+
+		AfterEach(func() {
+			listener.Close()
+		})
+
+		It("writes octet-counted RFC 5424 messages", func() {
+			w, err := syslog.NewWriter(
+				"syslog://"+listener.Addr().String(),
+				syslog.WithSyslogOptions(loggregator_v2.WithSyslogHostname("host")),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			defer w.Close()
+
+			Expect(w.Write(logEnvelope("first"))).To(Succeed())
+			Expect(w.Write(logEnvelope("second"))).To(Succeed())
+
+			var msg string
+			Eventually(messages).Should(Receive(&msg))
+			Expect(msg).To(HavePrefix("<14>1 "))
+			Expect(msg).To(ContainSubstring(" host source-id 0 - "))
+			Expect(msg).To(ContainSubstring(`[tags@47450 a="1"]`))
+			Expect(msg).To(HaveSuffix("first\n"))
+
+			Eventually(messages).Should(Receive(&msg))
+			Expect(msg).To(HaveSuffix("second\n"))
+		})
+
+		It("writes one message per gauge metric", func() {
+			w, err := syslog.NewWriter("syslog://" + listener.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			defer w.Close()
+
+			Expect(w.Write(&loggregator_v2.Envelope{
+				SourceId: "source-id",
+				Message: &loggregator_v2.Envelope_Gauge{
+					Gauge: &loggregator_v2.Gauge{
+						Metrics: map[string]*loggregator_v2.GaugeValue{
+							"cpu":    {Value: 1, Unit: "percentage"},
+							"memory": {Value: 2, Unit: "bytes"},
+						},
+					},
+				},
+			})).To(Succeed())
+
+			var first, second string
+			Eventually(messages).Should(Receive(&first))
+			Eventually(messages).Should(Receive(&second))
+			Expect(first + second).To(ContainSubstring(`[gauge@47450 name="cpu" value="1" unit="percentage"]`))
+			Expect(first + second).To(ContainSubstring(`[gauge@47450 name="memory" value="2" unit="bytes"]`))
+		})
+
+		It("reconnects on the next write after being closed", func() {
+			w, err := syslog.NewWriter("syslog://" + listener.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			defer w.Close()
+
+			Expect(w.Write(logEnvelope("first"))).To(Succeed())
+			Eventually(messages).Should(Receive())
+
+			Expect(w.Close()).To(Succeed())
+			Expect(w.Write(logEnvelope("second"))).To(Succeed())
+
+			var msg string
+			Eventually(messages).Should(Receive(&msg))
+			Expect(msg).To(HaveSuffix("second\n"))
+		})
+	})
+
+	Context("with a UDP drain", func() {
+		It("writes one message per datagram", func() {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+
+			w, err := syslog.NewWriter("syslog-udp://" + conn.LocalAddr().String())
+			Expect(err).ToNot(HaveOccurred())
+			defer w.Close()
+
+			Expect(w.Write(logEnvelope("message"))).To(Succeed())
+
+			buf := make([]byte, 65536)
+			n, _, err := conn.ReadFrom(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buf[:n])).To(HavePrefix("<14>1 "))
+			Expect(string(buf[:n])).To(HaveSuffix("message\n"))
+		})
+	})
+
+	It("returns an error when the drain cannot be reached", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		addr := listener.Addr().String()
+		listener.Close()
+
+		w, err := syslog.NewWriter("syslog://" + addr)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(w.Write(logEnvelope("message"))).ToNot(Succeed())
+	})
+
+	It("rejects unsupported drain URLs", func() {
+		_, err := syslog.NewWriter("https://example.com:443")
+		Expect(err).To(HaveOccurred())
+
+		_, err = syslog.NewWriter("syslog://example.com")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+func readFramed(conn net.Conn, messages chan<- string) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		lenStr, err := r.ReadString(' ')
+		if err != nil {
+			return
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(lenStr))
+		if err != nil {
+			return
+		}
+
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return
+		}
+		messages <- string(msg)
+	}
+}
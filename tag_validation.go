@@ -0,0 +1,172 @@
+package loggregator
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// TagPolicy determines what the client does with tags that break
+// loggregator's tag constraints.
+type TagPolicy int
+
+const (
+	// ReportInvalidTags reports invalid tags to the tag violation handler
+	// and sends them unchanged.
+	ReportInvalidTags TagPolicy = iota
+
+	// SanitizeInvalidTags reports invalid tags to the tag violation handler
+	// and fixes them before they are sent. Invalid characters in names are
+	// replaced with underscores, invalid UTF-8 in values is replaced with
+	// U+FFFD, both are truncated to their maximum length, and reserved tags
+	// are removed.
+	SanitizeInvalidTags
+)
+
+// reservedTags are set by loggregator from envelope fields when converting
+// to v1 and so are overwritten downstream.
+var reservedTags = map[string]bool{
+	"source_id":   true,
+	"instance_id": true,
+}
+
+// TagViolation describes a tag that breaks loggregator's tag constraints.
+type TagViolation struct {
+	Name   string
+	Value  string
+	Reason string
+}
+
+func (v TagViolation) Error() string {
+	return fmt.Sprintf("tag %q: %s", v.Name, v.Reason)
+}
+
+// WithTagValidation makes the client check the tags of every envelope, and
+// its own tags (see WithTag), against loggregator's tag constraints. Tag
+// names must be non-empty and may only contain ASCII letters, digits, '_',
+// '-' and '.'. Tag values must be valid UTF-8. The reserved names
+// source_id and instance_id may not be used; set the envelope's source and
+// instance IDs instead. See WithTagLimits for the length limits.
+func WithTagValidation(p TagPolicy) IngressOption {
+	return func(c *IngressClient) {
+		c.tagValidation = true
+		c.tagPolicy = p
+	}
+}
+
+// WithTagLimits sets the maximum length in bytes of tag names and values
+// checked by WithTagValidation. Both default to 256.
+func WithTagLimits(maxNameLength, maxValueLength int) IngressOption {
+	return func(c *IngressClient) {
+		c.maxTagName = maxNameLength
+		c.maxTagValue = maxValueLength
+	}
+}
+
+// WithTagViolationHandler configures a function that is invoked for every
+// invalid tag found by WithTagValidation. By default, violations are
+// written to the client's logger.
+func WithTagViolationHandler(f func(TagViolation)) IngressOption {
+	return func(c *IngressClient) {
+		c.tagViolationHandler = f
+	}
+}
+
+// validateEnvelopeTags checks the tags of e when tag validation is enabled.
+func (c *IngressClient) validateEnvelopeTags(e *loggregator_v2.Envelope) {
+	if !c.tagValidation || len(e.Tags) == 0 {
+		return
+	}
+	c.validateTags(e.Tags)
+}
+
+// validateTags reports, and depending on the tag policy sanitizes, the
+// invalid tags in tags.
+func (c *IngressClient) validateTags(tags map[string]string) {
+	for name, value := range tags {
+		reason := c.tagViolation(name, value)
+		if reason == "" {
+			continue
+		}
+		c.tagViolationHandler(TagViolation{Name: name, Value: value, Reason: reason})
+
+		if c.tagPolicy != SanitizeInvalidTags {
+			continue
+		}
+		delete(tags, name)
+		if reservedTags[name] {
+			continue
+		}
+
+		name = truncate(sanitizeTagName(name), c.maxTagName)
+		if _, ok := tags[name]; name == "" || ok {
+			continue
+		}
+		tags[name] = truncate(sanitizeTagValue(value), c.maxTagValue)
+	}
+}
+
+// tagViolation returns why the tag is invalid, or an empty string if it is
+// valid.
+func (c *IngressClient) tagViolation(name, value string) string {
+	switch {
+	case name == "":
+		return "name is empty"
+	case reservedTags[name]:
+		return "name is reserved"
+	case len(name) > c.maxTagName:
+		return fmt.Sprintf("name is longer than %d bytes", c.maxTagName)
+	case sanitizeTagName(name) != name:
+		return "name contains invalid characters"
+	case !utf8.ValidString(value):
+		return "value is not valid UTF-8"
+	case len(value) > c.maxTagValue:
+		return fmt.Sprintf("value is longer than %d bytes", c.maxTagValue)
+	}
+	return ""
+}
+
+func sanitizeTagName(name string) string {
+	b := []byte(name)
+	for i, r := range b {
+		if !validTagNameChar(r) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+func validTagNameChar(r byte) bool {
+	switch {
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return true
+	case r == '_', r == '-', r == '.':
+		return true
+	}
+	return false
+}
+
+func sanitizeTagValue(value string) string {
+	if utf8.ValidString(value) {
+		return value
+	}
+
+	b := make([]rune, 0, len(value))
+	for _, r := range value {
+		b = append(b, r)
+	}
+	return string(b)
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8
+// encoded rune.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
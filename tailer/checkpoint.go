@@ -0,0 +1,135 @@
+package tailer
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// fingerprintBytes is how much of the start of a file is hashed to tell it
+// apart from a file that replaced it under the same inode.
+const fingerprintBytes = 512
+
+// checkpoint is the position in every followed file, keyed by path. The ID
+// and fingerprint identify the file the position belongs to, so that a
+// position is not applied to a file that has replaced it. Inodes are
+// reused, so the ID alone is not enough.
+type checkpoint map[string]position
+
+type position struct {
+	ID          uint64 `json:"id,omitempty"`
+	Fingerprint uint64 `json:"fingerprint"`
+	Offset      int64  `json:"offset"`
+}
+
+func loadCheckpoint(path string) (checkpoint, error) {
+	c := make(checkpoint)
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// position returns the saved offset of the file if it is still the same
+// file and has not been truncated below the offset.
+func (c checkpoint) position(f *file, info os.FileInfo) (int64, bool) {
+	p, ok := c[f.path]
+	if !ok || p.Offset > info.Size() {
+		return 0, false
+	}
+
+	if id, ok := fileID(info); ok && id != p.ID {
+		return 0, false
+	}
+
+	if fp, err := fingerprint(f, p.Offset); err != nil || fp != p.Fingerprint {
+		return 0, false
+	}
+
+	return p.Offset, true
+}
+
+// fingerprint hashes the start of the file, up to offset.
+func fingerprint(f *file, offset int64) (uint64, error) {
+	n := int64(fingerprintBytes)
+	if offset < n {
+		n = offset
+	}
+
+	h := fnv.New64a()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, n)); err != nil {
+		return 0, err
+	}
+
+	return h.Sum64(), nil
+}
+
+// saveCheckpoint writes the checkpoint, replacing the old one atomically.
+// The offset saved for a file excludes its partial line, so that the line
+// is read again in full after a restart.
+func (t *Tailer) saveCheckpoint() {
+	if t.checkpointPath == "" {
+		return
+	}
+
+	for path, f := range t.files {
+		info, err := f.Stat()
+		if err != nil {
+			continue
+		}
+		id, _ := fileID(info)
+		offset := f.offset - int64(len(f.partial))
+		fp, err := fingerprint(f, offset)
+		if err != nil {
+			continue
+		}
+		t.checkpoint[path] = position{
+			ID:          id,
+			Fingerprint: fp,
+			Offset:      offset,
+		}
+	}
+
+	data, err := json.Marshal(t.checkpoint)
+	if err != nil {
+		t.log.Printf("failed to encode checkpoint: %s", err)
+		return
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(t.checkpointPath), filepath.Base(t.checkpointPath)+".tmp")
+	if err != nil {
+		t.log.Printf("failed to write checkpoint: %s", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		t.log.Printf("failed to write checkpoint: %s", err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		t.log.Printf("failed to write checkpoint: %s", err)
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), t.checkpointPath); err != nil {
+		t.log.Printf("failed to write checkpoint: %s", err)
+	}
+}
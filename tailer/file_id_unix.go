@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package tailer
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID returns the inode of the file, which stays the same when the file
+// is renamed.
+func fileID(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	return uint64(st.Ino), true
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package tailer
+
+import "os"
+
+// fileID is not available on Windows, where FileInfo does not carry the
+// file index. Checkpoints are then matched by path and size alone.
+func fileID(os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,412 @@
+// Package tailer follows log files and emits each line written to them as a
+// loggregator log, e.g. to ship the logs of a daemon that only writes to
+// files. Files are found with glob patterns and polled for new lines. Files
+// that are rotated by renaming or truncation are followed, and the position
+// in every file can be checkpointed so that a restarted tailer resumes
+// where it stopped.
+package tailer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/net/context"
+
+	loggregator "code.cloudfoundry.org/go-loggregator"
+)
+
+// maxLineBytes is the longest line that is held while waiting for its
+// newline. Longer lines are emitted in pieces of this size.
+const maxLineBytes = 64 * 1024
+
+// LogClient is the client used by Tailer to emit logs. This would usually be
+// the go-loggregator v2 client.
+type LogClient interface {
+	EmitLog(message string, opts ...loggregator.EmitLogOption)
+}
+
+// Logger is used to report errors reading files or checkpoints.
+type Logger interface {
+	Printf(string, ...interface{})
+}
+
+// Option configures a Tailer.
+type Option func(*Tailer)
+
+// WithPollInterval sets how often files are checked for new lines and the
+// glob patterns are expanded again. It defaults to one second.
+func WithPollInterval(d time.Duration) Option {
+	return func(t *Tailer) {
+		t.pollInterval = d
+	}
+}
+
+// WithCheckpointFile saves the position in every file to the given path
+// after each poll and when the tailer stops. Files found in the checkpoint
+// are resumed at their saved position, unless they have been replaced or
+// truncated since.
+func WithCheckpointFile(path string) Option {
+	return func(t *Tailer) {
+		t.checkpointPath = path
+	}
+}
+
+// WithStartAtEnd makes the tailer skip the existing contents of files found
+// when it starts and that have no checkpoint. Files that appear later are
+// always read from the beginning.
+func WithStartAtEnd() Option {
+	return func(t *Tailer) {
+		t.startAtEnd = true
+	}
+}
+
+// WithEmitLogOptions sets options that are applied to every emitted log,
+// e.g. loggregator.WithSourceInfo.
+func WithEmitLogOptions(opts ...loggregator.EmitLogOption) Option {
+	return func(t *Tailer) {
+		t.opts = append(t.opts, opts...)
+	}
+}
+
+// WithLogger sets the logger errors are reported to. It defaults to a
+// silent logger.
+func WithLogger(l Logger) Option {
+	return func(t *Tailer) {
+		t.log = l
+	}
+}
+
+// Tailer emits the lines written to the files matching its patterns. Each
+// line is emitted to stdout with the path of its file in the "file" tag. It
+// should be created with the New constructor.
+type Tailer struct {
+	client   LogClient
+	patterns []string
+	opts     []loggregator.EmitLogOption
+	log      Logger
+
+	pollInterval   time.Duration
+	checkpointPath string
+	startAtEnd     bool
+
+	files      map[string]*file
+	checkpoint checkpoint
+	// rotated holds the files closed during this poll and the one before.
+	// A file renamed just after the patterns were globbed only shows up
+	// under its new path in the next poll.
+	rotated []rotatedFile
+	buf     []byte
+}
+
+// New returns a Tailer for the files matching the given glob patterns, see
+// filepath.Match for their syntax.
+func New(c LogClient, patterns []string, opts ...Option) *Tailer {
+	t := &Tailer{
+		client:       c,
+		patterns:     patterns,
+		log:          log.New(ioutil.Discard, "", 0),
+		pollInterval: time.Second,
+		files:        make(map[string]*file),
+		buf:          make([]byte, 32*1024),
+	}
+
+	for _, o := range opts {
+		o(t)
+	}
+
+	return t
+}
+
+// Run follows the files until the context is done. It returns an error if a
+// pattern is malformed or the checkpoint cannot be read; errors reading
+// individual files are logged and the files are tried again on the next
+// poll.
+func (t *Tailer) Run(ctx context.Context) error {
+	for _, p := range t.patterns {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	t.checkpoint, err = loadCheckpoint(t.checkpointPath)
+	if err != nil {
+		return err
+	}
+
+	defer t.closeAll()
+
+	t.poll(t.startAtEnd)
+
+	ticker := time.NewTicker(t.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.poll(false)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// poll reads the new lines of every matching file. Newly found files start
+// at their checkpoint if they have one; otherwise they start at the end if
+// atEnd is set and at the beginning if not.
+func (t *Tailer) poll(atEnd bool) {
+	previous := len(t.rotated)
+	defer func() {
+		t.rotated = t.rotated[previous:]
+	}()
+
+	matched := make(map[string]bool)
+	for _, p := range t.patterns {
+		paths, _ := filepath.Glob(p)
+		for _, path := range paths {
+			matched[path] = true
+		}
+	}
+
+	// New files are opened while the files they may have been renamed from
+	// are still open and read to the end, so that renamed files continue
+	// where they were.
+	for _, f := range t.files {
+		t.read(f)
+	}
+
+	var opened []*file
+	for path := range matched {
+		if _, ok := t.files[path]; ok {
+			continue
+		}
+
+		f, err := t.open(path, atEnd)
+		if err != nil {
+			t.log.Printf("failed to open %s: %s", path, err)
+			continue
+		}
+		opened = append(opened, f)
+	}
+
+	for path, f := range t.files {
+		if !matched[path] {
+			t.remove(f)
+			continue
+		}
+		t.follow(f)
+	}
+
+	for _, f := range opened {
+		t.files[f.path] = f
+		t.read(f)
+	}
+
+	t.saveCheckpoint()
+}
+
+// follow reopens the file if its path now refers to a different file, and
+// rewinds it if it was truncated. Lines written to the old file since it was
+// last read, e.g. just before it was renamed, are read first.
+func (t *Tailer) follow(f *file) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return
+	}
+
+	current, err := f.Stat()
+	if err != nil {
+		return
+	}
+
+	switch {
+	case !os.SameFile(info, current):
+		if !f.continued {
+			t.read(f)
+		}
+		t.flushPartial(f)
+		t.addRotated(f, current)
+		f.Close()
+
+		r, err := os.Open(f.path)
+		if err != nil {
+			t.log.Printf("failed to reopen %s: %s", f.path, err)
+			delete(t.files, f.path)
+			return
+		}
+		f.File, f.offset = r, 0
+		t.read(f)
+	case info.Size() < f.offset:
+		t.flushPartial(f)
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			t.log.Printf("failed to rewind %s: %s", f.path, err)
+			return
+		}
+		f.offset = 0
+		t.read(f)
+	}
+}
+
+// read emits every complete line that has been appended to the file.
+func (t *Tailer) read(f *file) {
+	for {
+		n, err := f.Read(t.buf)
+		f.offset += int64(n)
+		f.partial = append(f.partial, t.buf[:n]...)
+
+		for {
+			i := bytes.IndexByte(f.partial, '\n')
+			if i < 0 {
+				break
+			}
+			t.emit(f, f.partial[:i])
+			f.partial = f.partial[i+1:]
+		}
+		for len(f.partial) >= maxLineBytes {
+			t.emit(f, f.partial[:maxLineBytes])
+			f.partial = f.partial[maxLineBytes:]
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.log.Printf("failed to read %s: %s", f.path, err)
+			break
+		}
+	}
+}
+
+// flushPartial emits the line that was being held for its newline, since the
+// rest of it will not be written to this file.
+func (t *Tailer) flushPartial(f *file) {
+	if len(f.partial) > 0 {
+		t.emit(f, f.partial)
+		f.partial = nil
+	}
+}
+
+func (t *Tailer) emit(f *file, line []byte) {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if len(line) == 0 {
+		return
+	}
+
+	opts := append([]loggregator.EmitLogOption{
+		loggregator.WithStdout(),
+		loggregator.WithEnvelopeTag("file", f.path),
+	}, t.opts...)
+	t.client.EmitLog(string(line), opts...)
+}
+
+func (t *Tailer) remove(f *file) {
+	if !f.continued {
+		t.read(f)
+	}
+	t.flushPartial(f)
+	if info, err := f.Stat(); err == nil {
+		t.addRotated(f, info)
+	}
+	f.Close()
+	delete(t.files, f.path)
+	delete(t.checkpoint, f.path)
+}
+
+func (t *Tailer) closeAll() {
+	for _, f := range t.files {
+		f.Close()
+	}
+	t.saveCheckpoint()
+}
+
+// renamed returns the offset of the followed file that was renamed to a new
+// path matching the patterns, e.g. by rotation, so that its lines are not
+// emitted again.
+func (t *Tailer) renamed(f *file, info os.FileInfo) (int64, bool) {
+	for _, open := range t.files {
+		current, err := open.Stat()
+		if err == nil && os.SameFile(info, current) {
+			open.continued = true
+			return open.offset, true
+		}
+	}
+
+	// Closed files may have been deleted and their inodes reused, so they
+	// are also compared by fingerprint.
+	for _, r := range t.rotated {
+		if !os.SameFile(info, r.info) || info.Size() < r.offset {
+			continue
+		}
+		if fp, err := fingerprint(f, r.offset); err == nil && fp == r.fingerprint {
+			return r.offset, true
+		}
+	}
+
+	return 0, false
+}
+
+// rotatedFile is a file that was closed after it was replaced or stopped
+// matching the patterns.
+type rotatedFile struct {
+	info        os.FileInfo
+	offset      int64
+	fingerprint uint64
+}
+
+func (t *Tailer) addRotated(f *file, info os.FileInfo) {
+	fp, err := fingerprint(f, f.offset)
+	if err != nil {
+		return
+	}
+	t.rotated = append(t.rotated, rotatedFile{info: info, offset: f.offset, fingerprint: fp})
+}
+
+// file is a followed file. offset is the position of the next read, and
+// partial holds the bytes read after the last newline. continued is set once
+// the file has been opened again under the path it was renamed to, which
+// then reads the rest of it.
+type file struct {
+	*os.File
+	path      string
+	offset    int64
+	partial   []byte
+	continued bool
+}
+
+func (t *Tailer) open(path string, atEnd bool) (*file, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &file{File: r, path: path}
+
+	info, err := r.Stat()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	var offset int64
+	if pos, ok := t.renamed(f, info); ok {
+		offset = pos
+	} else if pos, ok := t.checkpoint.position(f, info); ok {
+		offset = pos
+	} else if atEnd {
+		offset = info.Size()
+	}
+
+	if offset > 0 {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			r.Close()
+			return nil, err
+		}
+		f.offset = offset
+	}
+
+	return f, nil
+}
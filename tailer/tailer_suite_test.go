@@ -0,0 +1,13 @@
+package tailer_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestTailer(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tailer Suite")
+}
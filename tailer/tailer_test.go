@@ -0,0 +1,228 @@
+package tailer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	loggregator "code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/go-loggregator/tailer"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tailer", func() {
+	var (
+		dir    string
+		client *spyLogClient
+		cancel context.CancelFunc
+		done   chan error
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "tailer")
+		Expect(err).ToNot(HaveOccurred())
+
+		client = &spyLogClient{}
+	})
+
+	AfterEach(func() {
+		if cancel != nil {
+			cancel()
+			Eventually(done).Should(Receive())
+			cancel = nil
+		}
+		os.RemoveAll(dir)
+	})
+
+	run := func(opts ...tailer.Option) {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		done = make(chan error, 1)
+
+		opts = append([]tailer.Option{tailer.WithPollInterval(10 * time.Millisecond)}, opts...)
+		t := tailer.New(client, []string{filepath.Join(dir, "*.log")}, opts...)
+		go func() {
+			done <- t.Run(ctx)
+		}()
+	}
+
+	stop := func() {
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+		cancel = nil
+	}
+
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	It("emits every line of the matching files with the file tag", func() {
+		write(path("app.log"), "first\nsecond\n")
+		write(path("other.txt"), "ignored\n")
+
+		run()
+
+		Eventually(client.payloads).Should(Equal([]string{"first", "second"}))
+		e := client.envelopes()[0]
+		Expect(e.GetTags()).To(HaveKeyWithValue("file", path("app.log")))
+		Expect(e.GetLog().GetType()).To(Equal(loggregator_v2.Log_OUT))
+	})
+
+	It("follows appended lines and holds partial lines", func() {
+		write(path("app.log"), "first\n")
+		run()
+		Eventually(client.payloads).Should(Equal([]string{"first"}))
+
+		write(path("app.log"), "sec")
+		Consistently(client.payloads, 100*time.Millisecond).Should(HaveLen(1))
+
+		write(path("app.log"), "ond\r\n")
+		Eventually(client.payloads).Should(Equal([]string{"first", "second"}))
+	})
+
+	It("picks up files that are created later", func() {
+		run()
+
+		write(path("new.log"), "hello\n")
+		Eventually(client.payloads).Should(Equal([]string{"hello"}))
+	})
+
+	It("follows files rotated by renaming", func() {
+		write(path("app.log"), "before\n")
+		run()
+		Eventually(client.payloads).Should(Equal([]string{"before"}))
+
+		write(path("app.log"), "last")
+		Expect(os.Rename(path("app.log"), path("app.1"))).To(Succeed())
+		write(path("app.log"), "after\n")
+
+		Eventually(client.payloads).Should(Equal([]string{"before", "last", "after"}))
+	})
+
+	It("does not emit a rotated file again if it still matches", func() {
+		write(path("app.log"), "before\n")
+		run()
+		Eventually(client.payloads).Should(Equal([]string{"before"}))
+
+		Expect(os.Rename(path("app.log"), path("app.1.log"))).To(Succeed())
+		write(path("app.log"), "after\n")
+
+		Eventually(client.payloads).Should(Equal([]string{"before", "after"}))
+		Consistently(client.payloads, 100*time.Millisecond).Should(HaveLen(2))
+	})
+
+	It("starts over when a file is truncated", func() {
+		write(path("app.log"), "a long first line\n")
+		run()
+		Eventually(client.payloads).Should(HaveLen(1))
+
+		Expect(os.Truncate(path("app.log"), 0)).To(Succeed())
+		write(path("app.log"), "short\n")
+
+		Eventually(client.payloads).Should(Equal([]string{"a long first line", "short"}))
+	})
+
+	It("skips existing contents when starting at the end", func() {
+		write(path("app.log"), "old\n")
+		run(tailer.WithStartAtEnd())
+		Consistently(client.payloads, 100*time.Millisecond).Should(BeEmpty())
+
+		write(path("app.log"), "new\n")
+		Eventually(client.payloads).Should(Equal([]string{"new"}))
+	})
+
+	It("resumes from the checkpoint", func() {
+		checkpoint := path("checkpoint.json")
+		write(path("app.log"), "first\nsecond\npart")
+		run(tailer.WithCheckpointFile(checkpoint))
+		Eventually(client.payloads).Should(Equal([]string{"first", "second"}))
+		stop()
+
+		write(path("app.log"), "ial\nthird\n")
+		client = &spyLogClient{}
+		run(tailer.WithCheckpointFile(checkpoint), tailer.WithStartAtEnd())
+
+		Eventually(client.payloads).Should(Equal([]string{"partial", "third"}))
+	})
+
+	It("ignores the checkpoint of a file that has been replaced", func() {
+		checkpoint := path("checkpoint.json")
+		write(path("app.log"), "first\n")
+		run(tailer.WithCheckpointFile(checkpoint))
+		Eventually(client.payloads).Should(HaveLen(1))
+		stop()
+
+		Expect(os.Remove(path("app.log"))).To(Succeed())
+		write(path("app.log"), "replaced\n")
+		client = &spyLogClient{}
+		run(tailer.WithCheckpointFile(checkpoint))
+
+		Eventually(client.payloads).Should(Equal([]string{"replaced"}))
+	})
+
+	It("applies the configured emit options", func() {
+		write(path("app.log"), "hello\n")
+		run(tailer.WithEmitLogOptions(loggregator.WithSourceInfo("some-id", "DAEMON", "0")))
+
+		Eventually(client.payloads).Should(HaveLen(1))
+		Expect(client.envelopes()[0].GetSourceId()).To(Equal("some-id"))
+	})
+
+	It("returns an error for malformed patterns", func() {
+		t := tailer.New(client, []string{"[a-"})
+		Expect(t.Run(context.Background())).To(HaveOccurred())
+	})
+})
+
+func write(path, data string) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	Expect(err).ToNot(HaveOccurred())
+	defer f.Close()
+
+	_, err = f.WriteString(data)
+	Expect(err).ToNot(HaveOccurred())
+}
+
+type spyLogClient struct {
+	mu   sync.Mutex
+	envs []*loggregator_v2.Envelope
+}
+
+func (s *spyLogClient) EmitLog(message string, opts ...loggregator.EmitLogOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := &loggregator_v2.Envelope{
+		Tags: make(map[string]string),
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{Payload: []byte(message), Type: loggregator_v2.Log_ERR},
+		},
+	}
+	for _, o := range opts {
+		o(e)
+	}
+	s.envs = append(s.envs, e)
+}
+
+func (s *spyLogClient) envelopes() []*loggregator_v2.Envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*loggregator_v2.Envelope(nil), s.envs...)
+}
+
+func (s *spyLogClient) payloads() []string {
+	var payloads []string
+	for _, e := range s.envelopes() {
+		payloads = append(payloads, string(e.GetLog().GetPayload()))
+	}
+	return payloads
+}
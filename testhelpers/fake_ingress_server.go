@@ -0,0 +1,186 @@
+// Package testhelpers provides fakes for testing code that uses the
+// go-loggregator clients.
+package testhelpers
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"sync"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// FakeIngressServer is an in-memory loggregator v2 ingress server. It
+// records every envelope it receives so that tests can make assertions
+// against them. It should be created with the NewFakeIngressServer
+// constructor.
+type FakeIngressServer struct {
+	addr       string
+	serverTLS  *tls.Config
+	clientTLS  *tls.Config
+	grpcServer *grpc.Server
+
+	mu        sync.Mutex
+	envelopes []*loggregator_v2.Envelope
+}
+
+// NewFakeIngressServer creates a FakeIngressServer. It generates its own CA
+// and certificates; use ClientTLSConfig to configure the client under test.
+func NewFakeIngressServer() (*FakeIngressServer, error) {
+	serverTLS, clientTLS, err := generateTLSConfigs("metron")
+	if err != nil {
+		return nil, err
+	}
+
+	return &FakeIngressServer{
+		addr:      "127.0.0.1:0",
+		serverTLS: serverTLS,
+		clientTLS: clientTLS,
+	}, nil
+}
+
+// Start starts listening for gRPC connections on a random local port.
+func (s *FakeIngressServer) Start() error {
+	lis, err := net.Listen("tcp4", s.addr)
+	if err != nil {
+		return err
+	}
+	s.addr = lis.Addr().String()
+
+	s.grpcServer = grpc.NewServer(grpc.Creds(credentials.NewTLS(s.serverTLS)))
+	loggregator_v2.RegisterIngressServer(s.grpcServer, s)
+
+	go s.grpcServer.Serve(lis)
+
+	return nil
+}
+
+// Stop stops the server and closes any open streams.
+func (s *FakeIngressServer) Stop() {
+	if s.grpcServer == nil {
+		return
+	}
+	s.grpcServer.Stop()
+}
+
+// Addr returns the address the server is listening on. It is only valid
+// after Start has been called.
+func (s *FakeIngressServer) Addr() string {
+	return s.addr
+}
+
+// ClientTLSConfig returns a TLS configuration that can be used by a client
+// (e.g. loggregator.NewIngressClient) to connect to the server.
+func (s *FakeIngressServer) ClientTLSConfig() *tls.Config {
+	return s.clientTLS.Clone()
+}
+
+// Envelopes returns every envelope received so far, in the order they were
+// received.
+func (s *FakeIngressServer) Envelopes() []*loggregator_v2.Envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	envelopes := make([]*loggregator_v2.Envelope, len(s.envelopes))
+	copy(envelopes, s.envelopes)
+	return envelopes
+}
+
+// Logs returns the received envelopes that contain a log.
+func (s *FakeIngressServer) Logs() []*loggregator_v2.Envelope {
+	return s.filter(func(e *loggregator_v2.Envelope) bool {
+		return e.GetLog() != nil
+	})
+}
+
+// Counters returns the received envelopes that contain a counter.
+func (s *FakeIngressServer) Counters() []*loggregator_v2.Envelope {
+	return s.filter(func(e *loggregator_v2.Envelope) bool {
+		return e.GetCounter() != nil
+	})
+}
+
+// Gauges returns the received envelopes that contain a gauge.
+func (s *FakeIngressServer) Gauges() []*loggregator_v2.Envelope {
+	return s.filter(func(e *loggregator_v2.Envelope) bool {
+		return e.GetGauge() != nil
+	})
+}
+
+// Timers returns the received envelopes that contain a timer.
+func (s *FakeIngressServer) Timers() []*loggregator_v2.Envelope {
+	return s.filter(func(e *loggregator_v2.Envelope) bool {
+		return e.GetTimer() != nil
+	})
+}
+
+// Events returns the received envelopes that contain an event.
+func (s *FakeIngressServer) Events() []*loggregator_v2.Envelope {
+	return s.filter(func(e *loggregator_v2.Envelope) bool {
+		return e.GetEvent() != nil
+	})
+}
+
+// Reset discards every envelope received so far.
+func (s *FakeIngressServer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.envelopes = nil
+}
+
+// Sender implements loggregator_v2.IngressServer.
+func (s *FakeIngressServer) Sender(srv loggregator_v2.Ingress_SenderServer) error {
+	for {
+		e, err := srv.Recv()
+		if err == io.EOF {
+			return srv.SendAndClose(&loggregator_v2.IngressResponse{})
+		}
+		if err != nil {
+			return err
+		}
+
+		s.record(e)
+	}
+}
+
+// BatchSender implements loggregator_v2.IngressServer.
+func (s *FakeIngressServer) BatchSender(srv loggregator_v2.Ingress_BatchSenderServer) error {
+	for {
+		b, err := srv.Recv()
+		if err == io.EOF {
+			return srv.SendAndClose(&loggregator_v2.BatchSenderResponse{})
+		}
+		if err != nil {
+			return err
+		}
+
+		s.record(b.GetBatch()...)
+	}
+}
+
+// Send implements loggregator_v2.IngressServer.
+func (s *FakeIngressServer) Send(_ context.Context, b *loggregator_v2.EnvelopeBatch) (*loggregator_v2.SendResponse, error) {
+	s.record(b.GetBatch()...)
+	return &loggregator_v2.SendResponse{}, nil
+}
+
+func (s *FakeIngressServer) record(envelopes ...*loggregator_v2.Envelope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.envelopes = append(s.envelopes, envelopes...)
+}
+
+func (s *FakeIngressServer) filter(f func(*loggregator_v2.Envelope) bool) []*loggregator_v2.Envelope {
+	var envelopes []*loggregator_v2.Envelope
+	for _, e := range s.Envelopes() {
+		if f(e) {
+			envelopes = append(envelopes, e)
+		}
+	}
+	return envelopes
+}
@@ -0,0 +1,71 @@
+package testhelpers_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/testhelpers"
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FakeIngressServer", func() {
+	var (
+		server *testhelpers.FakeIngressServer
+		client *loggregator.IngressClient
+	)
+
+	BeforeEach(func() {
+		var err error
+		server, err = testhelpers.NewFakeIngressServer()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.Start()).To(Succeed())
+
+		client, err = loggregator.NewIngressClient(
+			server.ClientTLSConfig(),
+			loggregator.WithAddr(server.Addr()),
+			loggregator.WithBatchFlushInterval(10*time.Millisecond),
+		)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Stop()
+	})
+
+	It("records envelopes sent by an IngressClient", func() {
+		client.EmitLog("some-message")
+		client.EmitCounter("some-counter")
+		client.EmitGauge(loggregator.WithGaugeValue("some-gauge", 1, "some-unit"))
+		client.EmitTimer("some-timer", time.Now(), time.Now())
+		Expect(client.CloseSend()).To(Succeed())
+
+		Eventually(server.Envelopes).Should(HaveLen(4))
+		Expect(server.Logs()).To(HaveLen(1))
+		Expect(server.Logs()[0].GetLog().GetPayload()).To(Equal([]byte("some-message")))
+		Expect(server.Counters()).To(HaveLen(1))
+		Expect(server.Counters()[0].GetCounter().GetName()).To(Equal("some-counter"))
+		Expect(server.Gauges()).To(HaveLen(1))
+		Expect(server.Timers()).To(HaveLen(1))
+	})
+
+	It("records envelopes sent via Send", func() {
+		Eventually(func() error {
+			return client.EmitEvent(context.Background(), "some-title", "some-body")
+		}).Should(Succeed())
+
+		Expect(server.Events()).To(HaveLen(1))
+		Expect(server.Events()[0].GetEvent().GetTitle()).To(Equal("some-title"))
+	})
+
+	It("discards recorded envelopes on Reset", func() {
+		client.EmitLog("some-message")
+		Eventually(server.Envelopes).Should(HaveLen(1))
+
+		server.Reset()
+
+		Expect(server.Envelopes()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,18 @@
+package testhelpers_test
+
+import (
+	"log"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/grpclog"
+
+	"testing"
+)
+
+func TestTesthelpers(t *testing.T) {
+	grpclog.SetLogger(log.New(GinkgoWriter, "", 0))
+	log.SetOutput(GinkgoWriter)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Testhelpers Suite")
+}
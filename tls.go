@@ -4,17 +4,26 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
 )
 
 // NewIngressTLSConfig provides a convenient means for creating a *tls.Config
-// which uses the CA, cert, and key for the ingress endpoint.
+// which uses the CA, cert, and key for the ingress endpoint. The resulting
+// configuration verifies the server as "metron" and requires TLS 1.2 or
+// newer.
 func NewIngressTLSConfig(caPath, certPath, keyPath string) (*tls.Config, error) {
 	return newTLSConfig(caPath, certPath, keyPath, "metron")
 }
 
 // NewEgressTLSConfig provides a convenient means for creating a *tls.Config
-// which uses the CA, cert, and key for the egress endpoint.
+// which uses the CA, cert, and key for the egress endpoint. The resulting
+// configuration verifies the server as "reverselogproxy" and requires TLS 1.2
+// or newer.
 func NewEgressTLSConfig(caPath, certPath, keyPath string) (*tls.Config, error) {
 	return newTLSConfig(caPath, certPath, keyPath, "reverselogproxy")
 }
@@ -29,6 +38,7 @@ func newTLSConfig(caPath, certPath, keyPath, cn string) (*tls.Config, error) {
 		ServerName:         cn,
 		Certificates:       []tls.Certificate{cert},
 		InsecureSkipVerify: false,
+		MinVersion:         tls.VersionTLS12,
 	}
 
 	caCertBytes, err := ioutil.ReadFile(caPath)
@@ -45,3 +55,72 @@ func newTLSConfig(caPath, certPath, keyPath, cn string) (*tls.Config, error) {
 
 	return tlsConfig, nil
 }
+
+// certReloader periodically reloads a certificate and key pair from disk and
+// serves the most recently loaded pair during TLS handshakes.
+type certReloader struct {
+	certPath string
+	keyPath  string
+	interval time.Duration
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// configure returns a copy of the given TLS configuration that presents the
+// reloaded certificate. The certificate is reloaded until the context is
+// done.
+func (r *certReloader) configure(ctx context.Context, c *tls.Config, log Logger) (*tls.Config, error) {
+	if r.interval <= 0 {
+		return nil, fmt.Errorf("cert reload interval must be positive, got %s", r.interval)
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	if c == nil {
+		c = &tls.Config{}
+	} else {
+		c = c.Clone()
+	}
+	c.Certificates = nil
+	c.GetClientCertificate = r.getClientCertificate
+
+	go func() {
+		t := time.NewTicker(r.interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := r.reload(); err != nil {
+					log.Printf("Failed to reload certificate: %s", err)
+				}
+			}
+		}
+	}()
+
+	return c, nil
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+
+	return nil
+}
+
+func (r *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
@@ -0,0 +1,66 @@
+package loggregator_test
+
+import (
+	"crypto/tls"
+
+	"code.cloudfoundry.org/go-loggregator"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TLS", func() {
+	It("builds an ingress TLS config", func() {
+		c, err := loggregator.NewIngressTLSConfig(
+			fixture("CA.crt"),
+			fixture("client.crt"),
+			fixture("client.key"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(c.ServerName).To(Equal("metron"))
+		Expect(c.MinVersion).To(Equal(uint16(tls.VersionTLS12)))
+		Expect(c.Certificates).To(HaveLen(1))
+		Expect(c.RootCAs).ToNot(BeNil())
+		Expect(c.InsecureSkipVerify).To(BeFalse())
+	})
+
+	It("builds an egress TLS config", func() {
+		c, err := loggregator.NewEgressTLSConfig(
+			fixture("CA.crt"),
+			fixture("client.crt"),
+			fixture("client.key"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(c.ServerName).To(Equal("reverselogproxy"))
+		Expect(c.MinVersion).To(Equal(uint16(tls.VersionTLS12)))
+	})
+
+	It("returns an error for an invalid CA", func() {
+		_, err := loggregator.NewIngressTLSConfig(
+			fixture("invalid-ca.crt"),
+			fixture("client.crt"),
+			fixture("client.key"),
+		)
+		Expect(err).To(MatchError("cannot parse ca cert"))
+	})
+
+	It("returns an error for a missing CA", func() {
+		_, err := loggregator.NewIngressTLSConfig(
+			"/does/not/exist",
+			fixture("client.crt"),
+			fixture("client.key"),
+		)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("returns an error for a mismatched cert and key", func() {
+		_, err := loggregator.NewIngressTLSConfig(
+			fixture("CA.crt"),
+			fixture("client.crt"),
+			fixture("server.key"),
+		)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,129 @@
+package loggregator
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+)
+
+// Tag names used for trace context. They match the tags used by the
+// gorouter on HTTP timers.
+const (
+	TraceIDTag = "trace_id"
+	SpanIDTag  = "span_id"
+)
+
+// TraceContext identifies the span of a distributed trace that an envelope
+// belongs to.
+type TraceContext struct {
+	TraceID string
+	SpanID  string
+}
+
+type traceContextKey struct{}
+
+// ContextWithTraceContext returns a copy of ctx that carries the given trace
+// context.
+func ContextWithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// ContextWithTraceHeaders returns a copy of ctx that carries the trace
+// context found in the given request headers. W3C traceparent headers take
+// precedence over B3 headers (either the single b3 header or the
+// X-B3-TraceId and X-B3-SpanId pair). If the headers carry no valid trace
+// context, ctx is returned unchanged.
+func ContextWithTraceHeaders(ctx context.Context, h http.Header) context.Context {
+	tc, ok := parseTraceParent(h.Get("traceparent"))
+	if !ok {
+		tc, ok = parseB3(h)
+	}
+	if !ok {
+		return ctx
+	}
+
+	return ContextWithTraceContext(ctx, tc)
+}
+
+// TraceContextFromContext returns the trace context carried by ctx, if any.
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
+
+// WithTraceContext adds the trace and span IDs carried by ctx to the
+// envelope as the trace_id and span_id tags. It does nothing if ctx carries
+// no trace context.
+func WithTraceContext(ctx context.Context) func(proto.Message) {
+	tc, ok := TraceContextFromContext(ctx)
+	return func(m proto.Message) {
+		if !ok {
+			return
+		}
+
+		WithEnvelopeTag(TraceIDTag, tc.TraceID)(m)
+		if tc.SpanID != "" {
+			WithEnvelopeTag(SpanIDTag, tc.SpanID)(m)
+		}
+	}
+}
+
+// parseTraceParent parses a W3C traceparent header, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func parseTraceParent(v string) (TraceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return TraceContext{}, false
+	}
+
+	traceID, spanID := parts[1], parts[2]
+	if !isHexID(traceID, 32) || !isHexID(spanID, 16) {
+		return TraceContext{}, false
+	}
+
+	return TraceContext{TraceID: traceID, SpanID: spanID}, true
+}
+
+// parseB3 parses either the single b3 header
+// (<trace-id>-<span-id>[-<sampled>[-<parent-span-id>]]) or the multi
+// X-B3-TraceId and X-B3-SpanId headers.
+func parseB3(h http.Header) (TraceContext, bool) {
+	traceID, spanID := h.Get("X-B3-TraceId"), h.Get("X-B3-SpanId")
+	if b3 := h.Get("b3"); b3 != "" {
+		parts := strings.Split(strings.TrimSpace(b3), "-")
+		if len(parts) < 2 {
+			return TraceContext{}, false
+		}
+		traceID, spanID = parts[0], parts[1]
+	}
+
+	traceID, spanID = strings.ToLower(traceID), strings.ToLower(spanID)
+	if !(isHexID(traceID, 16) || isHexID(traceID, 32)) || !isHexID(spanID, 16) {
+		return TraceContext{}, false
+	}
+
+	return TraceContext{TraceID: traceID, SpanID: spanID}, true
+}
+
+// isHexID reports whether id is a lowercase hex string of length n that is
+// not all zeros.
+func isHexID(id string, n int) bool {
+	if len(id) != n {
+		return false
+	}
+
+	nonZero := false
+	for _, c := range id {
+		switch {
+		case c == '0':
+		case c >= '1' && c <= '9', c >= 'a' && c <= 'f':
+			nonZero = true
+		default:
+			return false
+		}
+	}
+
+	return nonZero
+}
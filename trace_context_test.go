@@ -0,0 +1,89 @@
+package loggregator_test
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TraceContext", func() {
+	var tagsFor = func(h http.Header) map[string]string {
+		ctx := loggregator.ContextWithTraceHeaders(context.Background(), h)
+
+		e := &loggregator_v2.Envelope{}
+		var opt loggregator.EmitLogOption = loggregator.WithTraceContext(ctx)
+		opt(e)
+
+		return e.GetTags()
+	}
+
+	It("extracts W3C traceparent headers", func() {
+		tags := tagsFor(http.Header{
+			"Traceparent":  {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			"X-B3-Traceid": {"80f198ee56343ba8"},
+			"X-B3-Spanid":  {"e457b5a2e4d86bd1"},
+		})
+
+		Expect(tags).To(Equal(map[string]string{
+			"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736",
+			"span_id":  "00f067aa0ba902b7",
+		}))
+	})
+
+	It("extracts the single B3 header", func() {
+		tags := tagsFor(http.Header{
+			"B3": {"80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90"},
+		})
+
+		Expect(tags).To(Equal(map[string]string{
+			"trace_id": "80f198ee56343ba864fe8b2a57d3eff7",
+			"span_id":  "e457b5a2e4d86bd1",
+		}))
+	})
+
+	It("extracts multiple B3 headers", func() {
+		tags := tagsFor(http.Header{
+			"X-B3-Traceid": {"80F198EE56343BA8"},
+			"X-B3-Spanid":  {"e457b5a2e4d86bd1"},
+		})
+
+		Expect(tags).To(Equal(map[string]string{
+			"trace_id": "80f198ee56343ba8",
+			"span_id":  "e457b5a2e4d86bd1",
+		}))
+	})
+
+	It("ignores invalid trace headers", func() {
+		Expect(tagsFor(http.Header{
+			"Traceparent": {"00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		})).To(BeEmpty())
+		Expect(tagsFor(http.Header{
+			"Traceparent": {"00-not-hex-01"},
+		})).To(BeEmpty())
+		Expect(tagsFor(http.Header{
+			"B3": {"0"},
+		})).To(BeEmpty())
+		Expect(tagsFor(http.Header{})).To(BeEmpty())
+	})
+
+	It("adds an explicitly set trace context", func() {
+		ctx := loggregator.ContextWithTraceContext(context.Background(), loggregator.TraceContext{
+			TraceID: "trace",
+			SpanID:  "span",
+		})
+
+		tc, ok := loggregator.TraceContextFromContext(ctx)
+		Expect(ok).To(BeTrue())
+		Expect(tc.TraceID).To(Equal("trace"))
+
+		e := &loggregator_v2.Envelope{}
+		var opt loggregator.EmitTimerOption = loggregator.WithTraceContext(ctx)
+		opt(e)
+		Expect(e.GetTags()).To(HaveKeyWithValue("span_id", "span"))
+	})
+})
@@ -0,0 +1,47 @@
+package loggregator
+
+import "code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+// truncationMarker is appended to log payloads shortened by
+// WithLogTruncation.
+const truncationMarker = "TRUNCATED"
+
+// WithLogTruncation limits log payloads to maxBytes. Longer payloads are cut
+// short, without splitting a UTF-8 encoded rune, and end with the marker
+// "TRUNCATED". Truncated envelopes are also tagged with truncated:true.
+// Metron truncates payloads longer than 61440 bytes, so that is a sensible
+// limit for clients that want to truncate predictably before it does.
+// Payloads are not truncated by default.
+func WithLogTruncation(maxBytes int) IngressOption {
+	return func(c *IngressClient) {
+		c.maxLogPayload = maxBytes
+	}
+}
+
+// truncateLog shortens the payload of e if it is a log longer than the
+// client's limit.
+func (c *IngressClient) truncateLog(e *loggregator_v2.Envelope) {
+	if c.maxLogPayload <= 0 {
+		return
+	}
+
+	l := e.GetLog()
+	if l == nil || len(l.Payload) <= c.maxLogPayload {
+		return
+	}
+
+	n := c.maxLogPayload - len(truncationMarker)
+	if n < 0 {
+		n = 0
+	}
+	payload := truncate(string(l.Payload[:n+1]), n) + truncationMarker
+	if len(payload) > c.maxLogPayload {
+		payload = payload[:c.maxLogPayload]
+	}
+	l.Payload = []byte(payload)
+
+	if e.Tags == nil {
+		e.Tags = make(map[string]string)
+	}
+	e.Tags["truncated"] = "true"
+}
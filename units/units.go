@@ -0,0 +1,110 @@
+// Package units defines the canonical names of gauge units. Emitting the
+// same unit under one name keeps dashboards from splitting a metric across
+// spellings such as "ms", "milliseconds" and "Milliseconds".
+package units
+
+import "strings"
+
+// Canonical unit names.
+const (
+	Bytes     = "bytes"
+	Kilobytes = "kilobytes"
+	Megabytes = "megabytes"
+	Gigabytes = "gigabytes"
+
+	Percentage = "percentage"
+
+	Nanoseconds  = "nanoseconds"
+	Microseconds = "microseconds"
+	Milliseconds = "milliseconds"
+	Seconds      = "seconds"
+	Minutes      = "minutes"
+	Hours        = "hours"
+
+	Count = "count"
+)
+
+// sizeAbbreviations maps abbreviations of data sizes to their canonical
+// names. They are matched case-sensitively, since "b", "Mb" and "Gb" are
+// commonly used for bits rather than bytes.
+var sizeAbbreviations = map[string]string{
+	"B":  Bytes,
+	"KB": Kilobytes,
+	"kB": Kilobytes,
+	"MB": Megabytes,
+	"GB": Gigabytes,
+}
+
+// aliases maps lower case spellings of units to their canonical names.
+var aliases = map[string]string{
+	"byte":  Bytes,
+	"bytes": Bytes,
+
+	"kilobyte":  Kilobytes,
+	"kilobytes": Kilobytes,
+
+	"megabyte":  Megabytes,
+	"megabytes": Megabytes,
+
+	"gigabyte":  Gigabytes,
+	"gigabytes": Gigabytes,
+
+	"%":          Percentage,
+	"pct":        Percentage,
+	"percent":    Percentage,
+	"percentage": Percentage,
+
+	"ns":          Nanoseconds,
+	"nanosecond":  Nanoseconds,
+	"nanoseconds": Nanoseconds,
+
+	"us":           Microseconds,
+	"µs":           Microseconds,
+	"microsecond":  Microseconds,
+	"microseconds": Microseconds,
+
+	"ms":           Milliseconds,
+	"millisecond":  Milliseconds,
+	"milliseconds": Milliseconds,
+
+	"s":       Seconds,
+	"sec":     Seconds,
+	"secs":    Seconds,
+	"second":  Seconds,
+	"seconds": Seconds,
+
+	"min":     Minutes,
+	"mins":    Minutes,
+	"minute":  Minutes,
+	"minutes": Minutes,
+
+	"h":     Hours,
+	"hr":    Hours,
+	"hrs":   Hours,
+	"hour":  Hours,
+	"hours": Hours,
+
+	"count":  Count,
+	"counts": Count,
+}
+
+// Normalize returns the canonical name of unit and true. Matching ignores
+// surrounding whitespace and, except for data size abbreviations such as
+// "MB", case. Unknown units are returned unchanged along with false.
+func Normalize(unit string) (string, bool) {
+	u := strings.TrimSpace(unit)
+	if c, ok := sizeAbbreviations[u]; ok {
+		return c, true
+	}
+	if c, ok := aliases[strings.ToLower(u)]; ok {
+		return c, true
+	}
+	return unit, false
+}
+
+// Valid reports whether unit is a canonical unit name or a known spelling
+// of one.
+func Valid(unit string) bool {
+	_, ok := Normalize(unit)
+	return ok
+}
@@ -0,0 +1,13 @@
+package units_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestUnits(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Units Suite")
+}
@@ -0,0 +1,59 @@
+package units_test
+
+import (
+	"code.cloudfoundry.org/go-loggregator/units"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Normalize", func() {
+	DescribeTable("known units",
+		func(unit, expected string) {
+			n, ok := units.Normalize(unit)
+			Expect(ok).To(BeTrue())
+			Expect(n).To(Equal(expected))
+		},
+		Entry("canonical", "milliseconds", units.Milliseconds),
+		Entry("abbreviated", "ms", units.Milliseconds),
+		Entry("capitalized", "Milliseconds", units.Milliseconds),
+		Entry("padded", " ms ", units.Milliseconds),
+		Entry("bytes", "Bytes", units.Bytes),
+		Entry("byte abbreviation", "B", units.Bytes),
+		Entry("megabyte abbreviation", "MB", units.Megabytes),
+		Entry("kilobyte abbreviation", "kB", units.Kilobytes),
+		Entry("percent sign", "%", units.Percentage),
+		Entry("percent", "Percent", units.Percentage),
+		Entry("nanoseconds", "ns", units.Nanoseconds),
+		Entry("count", "Count", units.Count),
+	)
+
+	It("returns unknown units unchanged", func() {
+		n, ok := units.Normalize("Nanofortnights")
+		Expect(ok).To(BeFalse())
+		Expect(n).To(Equal("Nanofortnights"))
+	})
+
+	DescribeTable("bit abbreviations are not bytes",
+		func(unit string) {
+			n, ok := units.Normalize(unit)
+			Expect(ok).To(BeFalse())
+			Expect(n).To(Equal(unit))
+		},
+		Entry("bits", "b"),
+		Entry("megabits", "Mb"),
+		Entry("gigabits", "Gb"),
+	)
+
+	It("does not treat an empty unit as known", func() {
+		Expect(units.Valid("")).To(BeFalse())
+	})
+})
+
+var _ = Describe("Valid", func() {
+	It("reports whether a unit is known", func() {
+		Expect(units.Valid("KB")).To(BeTrue())
+		Expect(units.Valid("dollars")).To(BeFalse())
+	})
+})
@@ -13,6 +13,8 @@ import (
 	"time"
 
 	loggregator "code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/conversion"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 
 	"github.com/cloudfoundry/dropsonde"
 	"github.com/cloudfoundry/sonde-go/events"
@@ -29,6 +31,42 @@ func WithTag(name, value string) ClientOption {
 	}
 }
 
+// WithOrigin sets the Origin of every envelope. It defaults to the origin
+// dropsonde was initialized with.
+func WithOrigin(origin string) ClientOption {
+	return func(c *Client) {
+		c.origin = origin
+	}
+}
+
+// WithDeployment sets the Deployment of every envelope.
+func WithDeployment(deployment string) ClientOption {
+	return func(c *Client) {
+		c.deployment = deployment
+	}
+}
+
+// WithJob sets the Job of every envelope.
+func WithJob(job string) ClientOption {
+	return func(c *Client) {
+		c.job = job
+	}
+}
+
+// WithIndex sets the Index of every envelope.
+func WithIndex(index string) ClientOption {
+	return func(c *Client) {
+		c.index = index
+	}
+}
+
+// WithIP sets the Ip of every envelope.
+func WithIP(ip string) ClientOption {
+	return func(c *Client) {
+		c.ip = ip
+	}
+}
+
 // WithLogger allows for the configuration of a logger.
 // By default, the logger is disabled.
 func WithLogger(l loggregator.Logger) ClientOption {
@@ -42,6 +80,12 @@ func WithLogger(l loggregator.Logger) ClientOption {
 type Client struct {
 	tags   map[string]string
 	logger loggregator.Logger
+
+	origin     string
+	deployment string
+	job        string
+	index      string
+	ip         string
 }
 
 // NewClient creates a v1 loggregator client. This is a wrapper around the
@@ -100,10 +144,15 @@ func (c *Client) EmitGauge(opts ...loggregator.EmitGaugeOption) {
 		return
 	}
 
+	// Every value is a separate envelope with tags of its own, like the
+	// envelopes converted from a v2 gauge.
 	for _, e := range w.Messages {
 		e.Timestamp = proto.Int64(time.Now().UnixNano())
 		e.EventType = events.Envelope_ValueMetric.Enum()
-		e.Tags = w.Tags
+		e.Tags = make(map[string]string, len(w.Tags))
+		for k, v := range w.Tags {
+			e.Tags[k] = v
+		}
 	}
 
 	c.emitEnvelope(w)
@@ -199,9 +248,56 @@ func (c *Client) EmitCounter(name string, opts ...loggregator.EmitCounterOption)
 	c.emitEnvelope(w)
 }
 
+// EmitTimer sends a timer envelope with the given name, start time and stop
+// time. The v1 API has no generic timer, therefore the timer is emitted as an
+// HttpStartStop envelope. HTTP specific fields (e.g. method, uri,
+// status_code) are read from the envelope tags.
+func (c *Client) EmitTimer(name string, start, stop time.Time, opts ...loggregator.EmitTimerOption) {
+	e := &loggregator_v2.Envelope{
+		Timestamp: time.Now().UnixNano(),
+		Message: &loggregator_v2.Envelope_Timer{
+			Timer: &loggregator_v2.Timer{
+				Name:  name,
+				Start: start.UnixNano(),
+				Stop:  stop.UnixNano(),
+			},
+		},
+		Tags: make(map[string]string),
+	}
+
+	for _, o := range opts {
+		o(e)
+	}
+
+	c.emitEnvelope(envelopeWrapper{
+		Messages: conversion.ToV1(e),
+	})
+}
+
 func (c *Client) emitEnvelope(w envelopeWrapper) {
 	for _, e := range w.Messages {
 		e.Origin = proto.String(dropsonde.DefaultEmitter.Origin())
+		if c.origin != "" {
+			e.Origin = proto.String(c.origin)
+		}
+		if c.deployment != "" {
+			e.Deployment = proto.String(c.deployment)
+		}
+		if c.job != "" {
+			e.Job = proto.String(c.job)
+		}
+		if c.index != "" {
+			e.Index = proto.String(c.index)
+		}
+		if c.ip != "" {
+			e.Ip = proto.String(c.ip)
+		}
+		if w.timestamp != nil {
+			e.Timestamp = w.timestamp
+			if m := e.GetLogMessage(); m != nil {
+				m.Timestamp = w.timestamp
+			}
+		}
 		for k, v := range c.tags {
 			e.Tags[k] = v
 		}
@@ -219,6 +315,8 @@ type envelopeWrapper struct {
 
 	Messages []*events.Envelope
 	Tags     map[string]string
+
+	timestamp *int64
 }
 
 func (e *envelopeWrapper) SetGaugeAppInfo(appID string, index int) {
@@ -235,13 +333,35 @@ func (e *envelopeWrapper) SetSourceInfo(sourceID, instanceID string) {
 }
 
 func (e *envelopeWrapper) SetLogAppInfo(appID string, sourceType string, sourceInstance string) {
-	e.Messages[0].GetLogMessage().AppId = proto.String(appID)
-	e.Messages[0].GetLogMessage().SourceType = proto.String(sourceType)
-	e.Messages[0].GetLogMessage().SourceInstance = proto.String(sourceInstance)
+	m := e.logMessage()
+	if m == nil {
+		return
+	}
+	m.AppId = proto.String(appID)
+	m.SourceType = proto.String(sourceType)
+	m.SourceInstance = proto.String(sourceInstance)
 }
 
 func (e *envelopeWrapper) SetLogToStdout() {
-	e.Messages[0].GetLogMessage().MessageType = events.LogMessage_OUT.Enum()
+	if m := e.logMessage(); m != nil {
+		m.MessageType = events.LogMessage_OUT.Enum()
+	}
+}
+
+func (e *envelopeWrapper) SetLogToStderr() {
+	if m := e.logMessage(); m != nil {
+		m.MessageType = events.LogMessage_ERR.Enum()
+	}
+}
+
+func (e *envelopeWrapper) LogPayload() []byte {
+	return e.logMessage().GetMessage()
+}
+
+func (e *envelopeWrapper) SetLogPayload(p []byte) {
+	if m := e.logMessage(); m != nil {
+		m.Message = p
+	}
 }
 
 func (e *envelopeWrapper) SetGaugeValue(name string, value float64, unit string) {
@@ -255,12 +375,40 @@ func (e *envelopeWrapper) SetGaugeValue(name string, value float64, unit string)
 }
 
 func (e *envelopeWrapper) SetDelta(d uint64) {
-	e.Messages[0].GetCounterEvent().Delta = proto.Uint64(d)
+	if c := e.counterEvent(); c != nil {
+		c.Delta = proto.Uint64(d)
+	}
 }
 
 func (e *envelopeWrapper) SetTotal(t uint64) {
-	e.Messages[0].GetCounterEvent().Delta = proto.Uint64(0)
-	e.Messages[0].GetCounterEvent().Total = proto.Uint64(t)
+	if c := e.counterEvent(); c != nil {
+		c.Delta = proto.Uint64(0)
+		c.Total = proto.Uint64(t)
+	}
+}
+
+// logMessage returns the wrapped log message, or nil if the wrapper does not
+// hold one.
+func (e *envelopeWrapper) logMessage() *events.LogMessage {
+	if len(e.Messages) == 0 {
+		return nil
+	}
+	return e.Messages[0].GetLogMessage()
+}
+
+// counterEvent returns the wrapped counter event, or nil if the wrapper does
+// not hold one.
+func (e *envelopeWrapper) counterEvent() *events.CounterEvent {
+	if len(e.Messages) == 0 {
+		return nil
+	}
+	return e.Messages[0].GetCounterEvent()
+}
+
+// SetTimestamp overrides the timestamp of every envelope in the wrapper,
+// including envelopes that later options add.
+func (e *envelopeWrapper) SetTimestamp(ns int64) {
+	e.timestamp = proto.Int64(ns)
 }
 
 func (e *envelopeWrapper) SetTag(name string, value string) {
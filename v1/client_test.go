@@ -81,6 +81,53 @@ var _ = Describe("DropsondeClient", func() {
 					message := env.GetLogMessage()
 					Expect(message.GetMessageType()).To(Equal(events.LogMessage_OUT))
 				})
+
+				It("emits a log to stderr", func() {
+					client.EmitLog("my message",
+						loggregator_v2.WithStdout(),
+						loggregator_v2.WithStderr(),
+					)
+
+					var env *events.Envelope
+					Expect(spyEmitter.emittedEnvelopes).To(Receive(&env))
+
+					message := env.GetLogMessage()
+					Expect(message.GetMessageType()).To(Equal(events.LogMessage_ERR))
+				})
+
+				It("emits a log with structured fields", func() {
+					client.EmitLog("my message",
+						loggregator_v2.WithLogFields(map[string]interface{}{"user": "alice"}),
+					)
+
+					var env *events.Envelope
+					Expect(spyEmitter.emittedEnvelopes).To(Receive(&env))
+
+					message := env.GetLogMessage()
+					Expect(message.GetMessage()).To(MatchJSON(`{"message": "my message", "user": "alice"}`))
+				})
+
+				It("emits a log with the given timestamp", func() {
+					ts := time.Unix(1500000000, 0)
+					client.EmitLog("my message", loggregator_v2.WithTimestamp(ts))
+
+					var env *events.Envelope
+					Expect(spyEmitter.emittedEnvelopes).To(Receive(&env))
+					Expect(env.GetTimestamp()).To(Equal(ts.UnixNano()))
+					Expect(env.GetLogMessage().GetTimestamp()).To(Equal(ts.UnixNano()))
+				})
+			})
+
+			It("ignores options that do not apply to the envelope", func() {
+				Expect(func() {
+					client.EmitGauge(
+						loggregator_v2.EmitGaugeOption(loggregator_v2.WithStdout()),
+						loggregator_v2.WithGaugeValue("name", 1, "unit"),
+					)
+					client.EmitLog("message", loggregator_v2.EmitLogOption(loggregator_v2.WithDelta(1)))
+				}).ToNot(Panic())
+
+				Expect(spyEmitter.emittedEnvelopes).To(HaveLen(2))
 			})
 
 			Describe("EmitCounter", func() {
@@ -119,6 +166,47 @@ var _ = Describe("DropsondeClient", func() {
 					Expect(counter.GetDelta()).To(Equal(uint64(0)))
 					Expect(counter.GetTotal()).To(Equal(uint64(404)))
 				})
+
+				It("emits a counter with app info and envelope tags", func() {
+					client.EmitCounter("a-name",
+						loggregator_v2.WithCounterAppInfo("app-id", 3),
+						loggregator_v2.WithEnvelopeTag("tag-name", "tag-value"),
+					)
+
+					var env *events.Envelope
+					Expect(spyEmitter.emittedEnvelopes).To(Receive(&env))
+					Expect(env.GetEventType()).To(Equal(events.Envelope_CounterEvent))
+					Expect(env.GetTags()).To(Equal(map[string]string{
+						"source_id":   "app-id",
+						"instance_id": "3",
+						"tag-name":    "tag-value",
+					}))
+				})
+			})
+
+			Describe("EmitTimer", func() {
+				It("emits an HttpStartStop", func() {
+					stop := time.Now()
+					start := stop.Add(-time.Second)
+					client.EmitTimer("http", start, stop,
+						loggregator_v2.WithTimerSourceInfo("source-id", "3"),
+						loggregator_v2.WithEnvelopeTag("method", "POST"),
+						loggregator_v2.WithEnvelopeTag("status_code", "201"),
+					)
+
+					var env *events.Envelope
+					Expect(spyEmitter.emittedEnvelopes).To(Receive(&env))
+					Expect(env.GetEventType()).To(Equal(events.Envelope_HttpStartStop))
+					Expect(env.GetOrigin()).To(Equal("my-origin"))
+					Expect(env.GetTags()).To(HaveKeyWithValue("source_id", "source-id"))
+
+					httpStartStop := env.GetHttpStartStop()
+					Expect(httpStartStop.GetStartTimestamp()).To(Equal(start.UnixNano()))
+					Expect(httpStartStop.GetStopTimestamp()).To(Equal(stop.UnixNano()))
+					Expect(httpStartStop.GetInstanceIndex()).To(Equal(int32(3)))
+					Expect(httpStartStop.GetMethod()).To(Equal(events.Method_POST))
+					Expect(httpStartStop.GetStatusCode()).To(Equal(int32(201)))
+				})
 			})
 
 			Describe("EmitGauge", func() {
@@ -153,6 +241,18 @@ var _ = Describe("DropsondeClient", func() {
 					Expect(gauge.GetUnit()).To(Equal("nanofortnights"))
 				})
 
+				It("emits a gauge with the given timestamp", func() {
+					ts := time.Unix(1500000000, 0)
+					client.EmitGauge(
+						loggregator_v2.WithTimestamp(ts),
+						loggregator_v2.WithGaugeValue("gauge-name", 123.45, "nanofortnights"),
+					)
+
+					var env *events.Envelope
+					Expect(spyEmitter.emittedEnvelopes).To(Receive(&env))
+					Expect(env.GetTimestamp()).To(Equal(ts.UnixNano()))
+				})
+
 				It("emits envelopes with multiple metrics", func() {
 					client.EmitGauge(
 						loggregator_v2.WithGaugeValue("gauge-1", 123.45, "nanofortnights"),
@@ -180,6 +280,23 @@ var _ = Describe("DropsondeClient", func() {
 					}))
 				})
 
+				It("emits the gauge tags on every value", func() {
+					client.EmitGauge(
+						loggregator_v2.WithGaugeValue("gauge-1", 1, "unit"),
+						loggregator_v2.WithGaugeTags(map[string]string{"tag": "value"}),
+						loggregator_v2.WithGaugeValue("gauge-2", 2, "unit"),
+					)
+
+					var first, second *events.Envelope
+					Expect(spyEmitter.emittedEnvelopes).To(Receive(&first))
+					Expect(spyEmitter.emittedEnvelopes).To(Receive(&second))
+					Expect(first.GetTags()).To(Equal(map[string]string{"tag": "value"}))
+					Expect(second.GetTags()).To(Equal(map[string]string{"tag": "value"}))
+
+					first.Tags["other"] = "value"
+					Expect(second.GetTags()).ToNot(HaveKey("other"))
+				})
+
 				It("emits envelopes with app info as a tag", func() {
 					client.EmitGauge(
 						loggregator_v2.WithGaugeValue("gauge-name", 123.45, "nanofortnights"),
@@ -242,6 +359,36 @@ var _ = Describe("DropsondeClient", func() {
 					})
 				})
 
+				Context("with source metadata options", func() {
+					BeforeEach(func() {
+						client, _ = v1.NewClient(
+							v1.WithOrigin("some-origin"),
+							v1.WithDeployment("cf"),
+							v1.WithJob("router"),
+							v1.WithIndex("some-index"),
+							v1.WithIP("10.0.0.1"),
+						)
+					})
+
+					It("sets the metadata on every envelope", func() {
+						client.EmitGauge(
+							loggregator_v2.WithGaugeValue("gauge-1", 1, "unit"),
+							loggregator_v2.WithGaugeValue("gauge-2", 2, "unit"),
+						)
+
+						Expect(spyEmitter.emittedEnvelopes).To(HaveLen(2))
+						for i := 0; i < 2; i++ {
+							var env *events.Envelope
+							Expect(spyEmitter.emittedEnvelopes).To(Receive(&env))
+							Expect(env.GetOrigin()).To(Equal("some-origin"))
+							Expect(env.GetDeployment()).To(Equal("cf"))
+							Expect(env.GetJob()).To(Equal("router"))
+							Expect(env.GetIndex()).To(Equal("some-index"))
+							Expect(env.GetIp()).To(Equal("10.0.0.1"))
+						}
+					})
+				})
+
 				Context("when the envelope should be promoted to a ContainerMetric", func() {
 					It("promotes the envelope", func() {
 						client.EmitGauge(
@@ -388,6 +535,7 @@ var _ = Describe("DropsondeClient", func() {
 				EmitLog(message string, opts ...loggregator_v2.EmitLogOption)
 				EmitGauge(opts ...loggregator_v2.EmitGaugeOption)
 				EmitCounter(name string, opts ...loggregator_v2.EmitCounterOption)
+				EmitTimer(name string, start, stop time.Time, opts ...loggregator_v2.EmitTimerOption)
 			}
 
 			By("ensuring that the v2 ingress client conforms to v2 interface")
@@ -395,6 +543,9 @@ var _ = Describe("DropsondeClient", func() {
 
 			By("ensuring that the v1 client conforms to v2 interface")
 			var _ V2Interface = &v1.Client{}
+
+			By("ensuring that the v1 client can be a MultiClient destination")
+			var _ loggregator_v2.Destination = &v1.Client{}
 		})
 	})
 })
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package winlog
+
+import (
+	"errors"
+
+	"golang.org/x/net/context"
+)
+
+// Run subscribes to the channels and emits their events until the context
+// is done. It is only supported on Windows.
+func (r *Reader) Run(ctx context.Context) error {
+	return errors.New("winlog: the event log is only available on Windows")
+}
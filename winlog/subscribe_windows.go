@@ -0,0 +1,223 @@
+//go:build windows
+// +build windows
+
+package winlog
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/net/context"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	wevtapi = windows.NewLazySystemDLL("wevtapi.dll")
+
+	procEvtSubscribe             = wevtapi.NewProc("EvtSubscribe")
+	procEvtNext                  = wevtapi.NewProc("EvtNext")
+	procEvtRender                = wevtapi.NewProc("EvtRender")
+	procEvtClose                 = wevtapi.NewProc("EvtClose")
+	procEvtOpenPublisherMetadata = wevtapi.NewProc("EvtOpenPublisherMetadata")
+	procEvtFormatMessage         = wevtapi.NewProc("EvtFormatMessage")
+)
+
+const (
+	evtSubscribeToFutureEvents = 1
+	evtRenderEventXML          = 1
+	evtFormatMessageEvent      = 1
+
+	// errorEvtUnresolvedValueInsert is returned when a message was
+	// formatted but some of its inserts could not be resolved.
+	errorEvtUnresolvedValueInsert syscall.Errno = 15029
+
+	// pollMillis is how long to wait for events before checking whether
+	// the context is done.
+	pollMillis = 500
+
+	batchSize = 64
+)
+
+type evtHandle uintptr
+
+// Run subscribes to the channels and emits their events until the context
+// is done. It returns an error if a channel cannot be subscribed to.
+func (r *Reader) Run(ctx context.Context) error {
+	signal, err := windows.CreateEvent(nil, 1, 1, nil)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(signal)
+
+	query, err := windows.UTF16PtrFromString(r.query)
+	if err != nil {
+		return err
+	}
+
+	var subs []evtHandle
+	defer func() {
+		for _, s := range subs {
+			evtClose(s)
+		}
+	}()
+	for _, c := range r.channels {
+		channel, err := windows.UTF16PtrFromString(c)
+		if err != nil {
+			return err
+		}
+
+		h, _, err := procEvtSubscribe.Call(
+			0,
+			uintptr(signal),
+			uintptr(unsafe.Pointer(channel)),
+			uintptr(unsafe.Pointer(query)),
+			0,
+			0,
+			0,
+			evtSubscribeToFutureEvents,
+		)
+		if h == 0 {
+			return fmt.Errorf("winlog: failed to subscribe to %s: %s", c, err)
+		}
+		subs = append(subs, evtHandle(h))
+	}
+
+	publishers := make(map[string]evtHandle)
+	defer func() {
+		for _, p := range publishers {
+			if p != 0 {
+				evtClose(p)
+			}
+		}
+	}()
+
+	for ctx.Err() == nil {
+		ev, err := windows.WaitForSingleObject(signal, pollMillis)
+		if err != nil {
+			return err
+		}
+		if ev != windows.WAIT_OBJECT_0 {
+			continue
+		}
+		windows.ResetEvent(signal)
+
+		for _, s := range subs {
+			r.drain(s, publishers)
+		}
+	}
+
+	return nil
+}
+
+// drain emits every event that is waiting on the subscription.
+func (r *Reader) drain(sub evtHandle, publishers map[string]evtHandle) {
+	events := make([]evtHandle, batchSize)
+	for {
+		var returned uint32
+		ok, _, _ := procEvtNext.Call(
+			uintptr(sub),
+			batchSize,
+			uintptr(unsafe.Pointer(&events[0])),
+			0,
+			0,
+			uintptr(unsafe.Pointer(&returned)),
+		)
+		if ok == 0 {
+			return
+		}
+
+		for _, h := range events[:returned] {
+			r.emitHandle(h, publishers)
+			evtClose(h)
+		}
+	}
+}
+
+func (r *Reader) emitHandle(h evtHandle, publishers map[string]evtHandle) {
+	data, err := renderXML(h)
+	if err != nil {
+		return
+	}
+
+	e, err := parseEvent(data)
+	if err != nil {
+		return
+	}
+
+	provider := e.System.Provider.Name
+	p, ok := publishers[provider]
+	if !ok {
+		p = openPublisher(provider)
+		publishers[provider] = p
+	}
+
+	var message string
+	if p != 0 {
+		message = formatMessage(p, h)
+	}
+
+	r.emit(e, message)
+}
+
+func renderXML(h evtHandle) ([]byte, error) {
+	buf := make([]uint16, 4096)
+	for {
+		var used, count uint32
+		ok, _, err := procEvtRender.Call(
+			0,
+			uintptr(h),
+			evtRenderEventXML,
+			uintptr(len(buf)*2),
+			uintptr(unsafe.Pointer(&buf[0])),
+			uintptr(unsafe.Pointer(&used)),
+			uintptr(unsafe.Pointer(&count)),
+		)
+		if ok != 0 {
+			return []byte(windows.UTF16ToString(buf[:used/2])), nil
+		}
+		if err != windows.ERROR_INSUFFICIENT_BUFFER {
+			return nil, err
+		}
+		buf = make([]uint16, used/2+1)
+	}
+}
+
+func openPublisher(name string) evtHandle {
+	p, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return 0
+	}
+
+	h, _, _ := procEvtOpenPublisherMetadata.Call(0, uintptr(unsafe.Pointer(p)), 0, 0, 0)
+	return evtHandle(h)
+}
+
+func formatMessage(publisher, h evtHandle) string {
+	buf := make([]uint16, 1024)
+	for {
+		var used uint32
+		ok, _, err := procEvtFormatMessage.Call(
+			uintptr(publisher),
+			uintptr(h),
+			0,
+			0,
+			0,
+			evtFormatMessageEvent,
+			uintptr(len(buf)),
+			uintptr(unsafe.Pointer(&buf[0])),
+			uintptr(unsafe.Pointer(&used)),
+		)
+		if ok != 0 || err == errorEvtUnresolvedValueInsert {
+			return windows.UTF16ToString(buf)
+		}
+		if err != windows.ERROR_INSUFFICIENT_BUFFER {
+			return ""
+		}
+		buf = make([]uint16, used)
+	}
+}
+
+func evtClose(h evtHandle) {
+	procEvtClose.Call(uintptr(h))
+}
@@ -0,0 +1,160 @@
+// Package winlog subscribes to Windows Event Log channels and emits their
+// events as loggregator logs, so that the events of Windows hosts such as
+// Diego cells reach loggregator. Subscribing is only supported on Windows;
+// elsewhere Run returns an error.
+package winlog
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+
+	loggregator "code.cloudfoundry.org/go-loggregator"
+)
+
+// LogClient is the client used by Reader to emit logs. This would usually be
+// the go-loggregator v2 client.
+type LogClient interface {
+	EmitLog(message string, opts ...loggregator.EmitLogOption)
+}
+
+// Option configures a Reader.
+type Option func(*Reader)
+
+// WithChannels sets the channels that are subscribed to. It defaults to the
+// Application and System channels.
+func WithChannels(channels ...string) Option {
+	return func(r *Reader) {
+		r.channels = channels
+	}
+}
+
+// WithQuery sets the XPath query that selects the events of every channel,
+// e.g. "*[System[(Level=1 or Level=2)]]" for errors only. It defaults to
+// every event.
+func WithQuery(query string) Option {
+	return func(r *Reader) {
+		r.query = query
+	}
+}
+
+// WithEmitLogOptions sets options that are applied to every emitted log,
+// e.g. loggregator.WithSourceInfo.
+func WithEmitLogOptions(opts ...loggregator.EmitLogOption) Option {
+	return func(r *Reader) {
+		r.opts = append(r.opts, opts...)
+	}
+}
+
+// Reader emits the events written to Event Log channels after Run is called.
+// The channel, provider, event ID and level of every event are added as the
+// "channel", "provider", "event_id" and "level" tags, and its time becomes
+// the envelope timestamp. Critical and error events are emitted as stderr,
+// everything else as stdout. It should be created with the New constructor.
+type Reader struct {
+	client   LogClient
+	channels []string
+	query    string
+	opts     []loggregator.EmitLogOption
+}
+
+// New returns a Reader that emits to the given client.
+func New(c LogClient, opts ...Option) *Reader {
+	r := &Reader{
+		client:   c,
+		channels: []string{"Application", "System"},
+		query:    "*",
+	}
+
+	for _, o := range opts {
+		o(r)
+	}
+
+	return r
+}
+
+// levels are the names of the standard event levels, by value. Level 0
+// (LogAlways) is reported as information.
+var levels = []string{"information", "critical", "error", "warning", "information", "verbose"}
+
+// errorLevel is the least severe level that is emitted as stderr.
+const errorLevel = 2
+
+// event is the part of an event's XML rendering that is emitted.
+type event struct {
+	System struct {
+		Provider struct {
+			Name string `xml:"Name,attr"`
+		} `xml:"Provider"`
+		EventID     string `xml:"EventID"`
+		Level       int    `xml:"Level"`
+		TimeCreated struct {
+			SystemTime string `xml:"SystemTime,attr"`
+		} `xml:"TimeCreated"`
+		Channel string `xml:"Channel"`
+	} `xml:"System"`
+	EventData struct {
+		Data []string `xml:"Data"`
+	} `xml:"EventData"`
+	RenderingInfo struct {
+		Message string `xml:"Message"`
+	} `xml:"RenderingInfo"`
+}
+
+func parseEvent(data []byte) (event, error) {
+	var e event
+	err := xml.Unmarshal(data, &e)
+	return e, err
+}
+
+// EmitEventXML emits an event given its XML rendering, e.g. events
+// exported with "wevtutil qe <channel> /f:RenderedXml" or forwarded from
+// another host. The message is taken from the event's RenderingInfo.
+func (r *Reader) EmitEventXML(data []byte) error {
+	e, err := parseEvent(data)
+	if err != nil {
+		return err
+	}
+	r.emit(e, e.RenderingInfo.Message)
+
+	return nil
+}
+
+// emit emits the event with the given rendered message. Events whose
+// message cannot be rendered, e.g. because their provider has no message
+// resources, are emitted with their event data instead.
+func (r *Reader) emit(e event, message string) {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		message = strings.Join(e.EventData.Data, " ")
+	}
+	if message == "" {
+		return
+	}
+
+	s := e.System
+	var opts []loggregator.EmitLogOption
+	if s.Level < 1 || s.Level > errorLevel {
+		opts = append(opts, loggregator.WithStdout())
+	}
+	if s.Level >= 0 && s.Level < len(levels) {
+		opts = append(opts, loggregator.WithEnvelopeTag("level", levels[s.Level]))
+	} else {
+		opts = append(opts, loggregator.WithEnvelopeTag("level", strconv.Itoa(s.Level)))
+	}
+	if s.Channel != "" {
+		opts = append(opts, loggregator.WithEnvelopeTag("channel", s.Channel))
+	}
+	if s.Provider.Name != "" {
+		opts = append(opts, loggregator.WithEnvelopeTag("provider", s.Provider.Name))
+	}
+	if s.EventID != "" {
+		opts = append(opts, loggregator.WithEnvelopeTag("event_id", s.EventID))
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s.TimeCreated.SystemTime); err == nil {
+		opts = append(opts, loggregator.WithTimestamp(t))
+	}
+
+	r.client.EmitLog(message, append(opts, r.opts...)...)
+}
@@ -0,0 +1,13 @@
+package winlog_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestWinlog(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Winlog Suite")
+}
@@ -0,0 +1,121 @@
+package winlog_test
+
+import (
+	"sync"
+
+	loggregator "code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/go-loggregator/winlog"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const renderedEvent = `<Event xmlns="http://schemas.microsoft.com/win/2004/08/events/event">
+  <System>
+    <Provider Name="Service Control Manager" Guid="{555908d1-a6d7-4695-8e1e-26931d2012f4}"/>
+    <EventID Qualifiers="49152">7031</EventID>
+    <Level>2</Level>
+    <TimeCreated SystemTime="2019-03-01T12:00:00.1234567Z"/>
+    <Channel>System</Channel>
+    <Computer>cell-0</Computer>
+  </System>
+  <EventData>
+    <Data Name="param1">rep</Data>
+    <Data Name="param2">1</Data>
+  </EventData>
+  <RenderingInfo Culture="en-US">
+    <Message>The rep service terminated unexpectedly.  </Message>
+    <Level>Error</Level>
+  </RenderingInfo>
+</Event>`
+
+var _ = Describe("Reader", func() {
+	var (
+		client *spyLogClient
+		r      *winlog.Reader
+	)
+
+	BeforeEach(func() {
+		client = &spyLogClient{}
+		r = winlog.New(client)
+	})
+
+	It("emits rendered events as logs", func() {
+		Expect(r.EmitEventXML([]byte(renderedEvent))).To(Succeed())
+
+		envs := client.envelopes()
+		Expect(envs).To(HaveLen(1))
+		Expect(envs[0].GetLog().GetPayload()).To(Equal([]byte("The rep service terminated unexpectedly.")))
+		Expect(envs[0].GetLog().GetType()).To(Equal(loggregator_v2.Log_ERR))
+		Expect(envs[0].GetTimestamp()).To(Equal(int64(1551441600123456700)))
+		Expect(envs[0].GetTags()).To(Equal(map[string]string{
+			"channel":  "System",
+			"provider": "Service Control Manager",
+			"event_id": "7031",
+			"level":    "error",
+		}))
+	})
+
+	It("falls back to the event data without a rendered message", func() {
+		Expect(r.EmitEventXML([]byte(`<Event>
+  <System>
+    <Provider Name="some-app"/>
+    <EventID>1</EventID>
+    <Level>4</Level>
+    <Channel>Application</Channel>
+  </System>
+  <EventData><Data>first</Data><Data>second</Data></EventData>
+</Event>`))).To(Succeed())
+
+		envs := client.envelopes()
+		Expect(envs).To(HaveLen(1))
+		Expect(envs[0].GetLog().GetPayload()).To(Equal([]byte("first second")))
+		Expect(envs[0].GetLog().GetType()).To(Equal(loggregator_v2.Log_OUT))
+		Expect(envs[0].GetTags()).To(HaveKeyWithValue("level", "information"))
+	})
+
+	It("skips events without a message or data", func() {
+		Expect(r.EmitEventXML([]byte(`<Event><System><Level>4</Level></System></Event>`))).To(Succeed())
+		Expect(client.envelopes()).To(BeEmpty())
+	})
+
+	It("applies the configured emit options", func() {
+		r = winlog.New(client, winlog.WithEmitLogOptions(loggregator.WithSourceInfo("some-id", "HOST", "0")))
+
+		Expect(r.EmitEventXML([]byte(renderedEvent))).To(Succeed())
+		Expect(client.envelopes()[0].GetSourceId()).To(Equal("some-id"))
+	})
+
+	It("returns an error for malformed XML", func() {
+		Expect(r.EmitEventXML([]byte("<Event>"))).ToNot(Succeed())
+	})
+})
+
+type spyLogClient struct {
+	mu   sync.Mutex
+	envs []*loggregator_v2.Envelope
+}
+
+func (s *spyLogClient) EmitLog(message string, opts ...loggregator.EmitLogOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := &loggregator_v2.Envelope{
+		Tags: make(map[string]string),
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{Payload: []byte(message), Type: loggregator_v2.Log_ERR},
+		},
+	}
+	for _, o := range opts {
+		o(e)
+	}
+	s.envs = append(s.envs, e)
+}
+
+func (s *spyLogClient) envelopes() []*loggregator_v2.Envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*loggregator_v2.Envelope(nil), s.envs...)
+}